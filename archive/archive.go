@@ -0,0 +1,279 @@
+// Package archive reads and writes the JSON archive format used to move a
+// whole notes database between servers. An archive is a zip file holding a
+// manifest and one JSON Lines file per kind of record, all decrypted, so it
+// can be imported into a database that uses another key or cipher.
+package archive
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/repositories"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Format identifies archives in the manifest
+const Format = "personal-notes-archive"
+
+// Version is the version of the archive layout written by Write. Readers
+// refuse archives with a newer version; the schema version of the database
+// the archive was taken from is recorded separately.
+const Version = 1
+
+// Files of an archive
+const (
+	ManifestFile     = "manifest.json"
+	CategoriesFile   = "categories.jsonl"
+	NotesFile        = "notes.jsonl"
+	TagsFile         = "tags.jsonl"
+	ActivityLogsFile = "activity_logs.jsonl"
+)
+
+// Manifest describes an archive
+type Manifest struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	// SchemaVersion is the schema version of the exported database
+	SchemaVersion int                 `json:"schema_version"`
+	Files         map[string]FileInfo `json:"files"`
+}
+
+// FileInfo describes one JSON Lines file of an archive
+type FileInfo struct {
+	Records int    `json:"records"`
+	SHA256  string `json:"sha256"`
+}
+
+// Tag lists the notes carrying a tag. Tags are stored with their notes, so
+// the tags file is derived from the notes and is not read on import.
+type Tag struct {
+	Name    string   `json:"name"`
+	NoteIDs []string `json:"note_ids"`
+}
+
+// Source is what Write exports
+type Source struct {
+	Notes         repositories.NoteRepositoryInterface
+	Checklists    repositories.ChecklistRepositoryInterface
+	Categories    repositories.CategoryRepositoryInterface
+	ActivityLogs  *repositories.ActivityLogRepository
+	SchemaVersion int
+}
+
+// Write writes an archive of src to w and returns its manifest. Records are
+// written in a stable order: categories and notes by ID, activity logs in
+// the order they were recorded.
+func Write(w io.Writer, src Source) (*Manifest, error) {
+	categories, err := src.Categories.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i].ID < categories[j].ID })
+
+	notes, err := src.Notes.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	// Notes in the trash are kept, with their trashed_at
+	trashed, err := src.Notes.GetFiltered(models.NoteFilter{Trashed: true})
+	if err != nil {
+		return nil, err
+	}
+	notes = append(notes, trashed...)
+	sort.Slice(notes, func(i, j int) bool { return notes[i].ID < notes[j].ID })
+	// Checklists go with their note
+	for _, note := range notes {
+		if note.Checklist, err = src.Checklists.GetByNoteID(note.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	logs, err := src.ActivityLogs.GetAll(models.ActivityLogFilter{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get activity logs: %w", err)
+	}
+	sort.Slice(logs, func(i, j int) bool { return logs[i].ID < logs[j].ID })
+
+	manifest := &Manifest{
+		Format:        Format,
+		Version:       Version,
+		CreatedAt:     time.Now().UTC(),
+		SchemaVersion: src.SchemaVersion,
+		Files:         make(map[string]FileInfo),
+	}
+
+	zw := zip.NewWriter(w)
+	write := func(name string, count int, record func(i int) any) error {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: manifest.CreatedAt})
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		enc := json.NewEncoder(io.MultiWriter(fw, h))
+		enc.SetEscapeHTML(false)
+		for i := 0; i < count; i++ {
+			if err := enc.Encode(record(i)); err != nil {
+				return fmt.Errorf("failed to write %s: %w", name, err)
+			}
+		}
+		manifest.Files[name] = FileInfo{Records: count, SHA256: hex.EncodeToString(h.Sum(nil))}
+		return nil
+	}
+
+	tags := noteTags(notes)
+	if err := write(CategoriesFile, len(categories), func(i int) any { return categories[i] }); err != nil {
+		return nil, err
+	}
+	if err := write(NotesFile, len(notes), func(i int) any { return notes[i] }); err != nil {
+		return nil, err
+	}
+	if err := write(TagsFile, len(tags), func(i int) any { return tags[i] }); err != nil {
+		return nil, err
+	}
+	if err := write(ActivityLogsFile, len(logs), func(i int) any { return logs[i] }); err != nil {
+		return nil, err
+	}
+
+	// The manifest goes last, once the checksums are known
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: ManifestFile, Method: zip.Deflate, Modified: manifest.CreatedAt})
+	if err != nil {
+		return nil, err
+	}
+	enc := json.NewEncoder(fw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// noteTags collects the tags of notes, sorted by name. Tags differing only
+// in case are the same tag, spelled as it was first seen.
+func noteTags(notes []*models.Note) []Tag {
+	index := make(map[string]int)
+	var tags []Tag
+	for _, note := range notes {
+		for _, name := range strings.Split(note.Tags, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			key := strings.ToLower(name)
+			i, ok := index[key]
+			if !ok {
+				i = len(tags)
+				index[key] = i
+				tags = append(tags, Tag{Name: name})
+			}
+			if ids := tags[i].NoteIDs; len(ids) == 0 || ids[len(ids)-1] != note.ID {
+				tags[i].NoteIDs = append(tags[i].NoteIDs, note.ID)
+			}
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return strings.ToLower(tags[i].Name) < strings.ToLower(tags[j].Name) })
+	return tags
+}
+
+// Reader reads an archive one record at a time
+type Reader struct {
+	Manifest Manifest
+	zr       *zip.Reader
+}
+
+// NewReader opens the archive in r, which is size bytes long, and checks
+// its manifest
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("not an archive: %w", err)
+	}
+	f, err := zr.Open(ManifestFile)
+	if err != nil {
+		return nil, fmt.Errorf("not an archive: missing %s", ManifestFile)
+	}
+	defer f.Close()
+
+	a := &Reader{zr: zr}
+	if err := json.NewDecoder(f).Decode(&a.Manifest); err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	if a.Manifest.Format != Format {
+		return nil, fmt.Errorf("not an archive: unknown format %q", a.Manifest.Format)
+	}
+	if a.Manifest.Version < 1 || a.Manifest.Version > Version {
+		return nil, fmt.Errorf("unsupported archive version %d, this version reads up to %d", a.Manifest.Version, Version)
+	}
+	for _, name := range []string{CategoriesFile, NotesFile, ActivityLogsFile} {
+		if _, ok := a.Manifest.Files[name]; !ok {
+			return nil, fmt.Errorf("manifest does not list %s", name)
+		}
+	}
+	return a, nil
+}
+
+// Categories calls fn for every category in the archive
+func (a *Reader) Categories(fn func(models.Category) error) error {
+	return each(a, CategoriesFile, fn)
+}
+
+// Notes calls fn for every note in the archive
+func (a *Reader) Notes(fn func(models.Note) error) error {
+	return each(a, NotesFile, fn)
+}
+
+// ActivityLogs calls fn for every activity log in the archive
+func (a *Reader) ActivityLogs(fn func(models.ActivityLog) error) error {
+	return each(a, ActivityLogsFile, fn)
+}
+
+// each decodes the records of the named file one at a time and checks the
+// record count and checksum against the manifest once the file has been
+// read. Callers apply records inside a transaction, so a mismatch found at
+// the end still undoes everything.
+func each[T any](a *Reader, name string, fn func(T) error) error {
+	info := a.Manifest.Files[name]
+	f, err := a.zr.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	dec := json.NewDecoder(io.TeeReader(f, h))
+	count := 0
+	for {
+		var record T
+		err := dec.Decode(&record)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read record %d of %s: %w", count+1, name, err)
+		}
+		count++
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	// The decoder may stop before the end of the file
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if count != info.Records {
+		return fmt.Errorf("%s has %d records, manifest lists %d", name, count, info.Records)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != info.SHA256 {
+		return fmt.Errorf("checksum mismatch for %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,354 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"personal-notes-with-go/database"
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/repositories"
+	"personal-notes-with-go/utils"
+)
+
+// testDB is a database with the repositories the server would use on it
+type testDB struct {
+	db         *sql.DB
+	cipher     utils.Cipher
+	bi         *utils.BlindIndex
+	notes      repositories.NoteRepositoryInterface
+	checklists repositories.ChecklistRepositoryInterface
+	categories repositories.CategoryRepositoryInterface
+	logs       *repositories.ActivityLogRepository
+}
+
+// newTestDB opens an empty database in a temporary directory. Each
+// database gets its own key, as an archive moves data between servers.
+func newTestDB(t *testing.T, keyByte byte) *testDB {
+	t.Helper()
+	db, err := database.InitDB(filepath.Join(t.TempDir(), "db.sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	key := bytes.Repeat([]byte{keyByte}, utils.KeySize)
+	c, err := utils.NewCipher(utils.CipherAESGCM, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bi, err := utils.NewBlindIndex(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testDB{
+		db:     db,
+		cipher: c,
+		bi:     bi,
+		notes: repositories.NewTaggedNoteRepository(
+			repositories.NewEncryptedNoteRepository(repositories.NewNoteRepository(db), c, bi),
+			repositories.NewEncryptedTagRepository(repositories.NewTagRepository(db), c, bi),
+		),
+		checklists: repositories.NewEncryptedChecklistRepository(repositories.NewChecklistRepository(db), c),
+		categories: repositories.NewEncryptedCategoryRepository(repositories.NewCategoryRepository(db), c),
+		logs:       repositories.NewActivityLogRepository(db),
+	}
+}
+
+// populate fills d with nested categories, notes with tags, states, dates
+// and checklists, a note in the trash and activity logs
+func populate(t *testing.T, d *testDB) {
+	t.Helper()
+	work := models.Category{Name: "Pekerjaan", Description: "Kantor", Color: "#3a7bd5", Icon: "fa-briefcase"}
+	if err := d.categories.Create(&work); err != nil {
+		t.Fatal(err)
+	}
+	projects := models.Category{Name: "Proyek", ParentID: work.ID}
+	if err := d.categories.Create(&projects); err != nil {
+		t.Fatal(err)
+	}
+	home := models.Category{Name: "Rumah"}
+	if err := d.categories.Create(&home); err != nil {
+		t.Fatal(err)
+	}
+
+	created := time.Date(2024, 3, 1, 8, 30, 0, 0, time.UTC)
+	due := time.Date(2025, 1, 31, 10, 0, 0, 0, time.UTC)
+	trashedAt := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	notes := []*models.Note{
+		{
+			ID: "note-1", Subject: "Rapat mingguan", Content: "Agenda rapat", Priority: "high", Tags: "kerja, rapat",
+			CategoryID: projects.ID, CreatedAt: created, UpdatedAt: created.Add(time.Hour),
+			Pinned: true, Favorite: true, DueAt: &due, RemindAt: &due,
+			Recurrence: "FREQ=WEEKLY;BYDAY=MO", RecurrenceMode: models.RecurrenceClone, RecurAt: &due,
+		},
+		{
+			ID: "note-2", Subject: "Belanja", Content: "Susu, roti", Priority: "low", Tags: "rumah",
+			CategoryID: home.ID, CreatedAt: created, UpdatedAt: created, Archived: true,
+		},
+		{
+			ID: "note-3", Subject: "Lama", Content: "Di tempat sampah", Priority: "medium", Tags: "rumah, arsip",
+			CreatedAt: created, UpdatedAt: created, TrashedAt: &trashedAt,
+		},
+	}
+	for _, note := range notes {
+		if err := d.notes.Insert(note); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, text := range []string{"Siapkan slide", "Kirim undangan", "Pesan ruangan"} {
+		item := models.ChecklistItem{NoteID: "note-1", Text: text, Checked: i == 1}
+		if err := d.checklists.Create(&item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	item := models.ChecklistItem{NoteID: "note-3", Text: "Buang"}
+	if err := d.checklists.Create(&item); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, entry := range []models.ActivityLog{
+		{Timestamp: created, Action: "create", EntityType: "note", Description: "Created note: Rapat mingguan", IPAddress: "127.0.0.1"},
+		{Timestamp: created.Add(time.Minute), Action: "create", EntityType: "category", Description: "Created category: Proyek", IPAddress: "127.0.0.1"},
+	} {
+		if err := d.logs.Create(&entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// export writes an archive of d and returns it
+func export(t *testing.T, d *testDB) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	_, err := Write(&buf, Source{
+		Notes:         d.notes,
+		Checklists:    d.checklists,
+		Categories:    d.categories,
+		ActivityLogs:  d.logs,
+		SchemaVersion: database.LatestSchemaVersion(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// records returns the contents of the record files of an archive
+func records(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, name := range []string{CategoriesFile, NotesFile, TagsFile, ActivityLogsFile} {
+		f, err := zr.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[name] = string(content)
+	}
+	return files
+}
+
+// assertSameRecords fails unless the archives hold the same records
+func assertSameRecords(t *testing.T, got, want []byte) {
+	t.Helper()
+	gotRecords, wantRecords := records(t, got), records(t, want)
+	for name, content := range wantRecords {
+		if gotRecords[name] != content {
+			t.Errorf("%s differs\ngot:\n%s\nwant:\n%s", name, gotRecords[name], content)
+		}
+	}
+}
+
+func importArchive(t *testing.T, d *testDB, data []byte, opts Options) *Report {
+	t.Helper()
+	a, err := NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := Import(d.db, d.cipher, d.bi, a, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func assertCounts(t *testing.T, kind string, got, want Counts) {
+	t.Helper()
+	if got != want {
+		t.Errorf("%s counts = %+v, want %+v", kind, got, want)
+	}
+}
+
+// copyOf returns a database holding what archive holds, read with its own
+// key
+func copyOf(t *testing.T, data []byte) *testDB {
+	t.Helper()
+	d := newTestDB(t, 2)
+	importArchive(t, d, data, Options{Mode: ModeReplace})
+	return d
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	src := newTestDB(t, 1)
+	populate(t, src)
+	original := export(t, src)
+
+	files := records(t, original)
+	if !strings.Contains(files[NotesFile], `"trashed_at"`) || !strings.Contains(files[NotesFile], "Siapkan slide") {
+		t.Fatalf("archive is missing the trashed note or the checklist:\n%s", files[NotesFile])
+	}
+
+	t.Run("replace into an empty database", func(t *testing.T) {
+		dst := newTestDB(t, 2)
+		report := importArchive(t, dst, original, Options{Mode: ModeReplace})
+		assertCounts(t, "categories", report.Categories, Counts{Created: 3})
+		assertCounts(t, "notes", report.Notes, Counts{Created: 3})
+		assertCounts(t, "activity logs", report.ActivityLogs, Counts{Created: 2})
+		if len(report.Warnings) > 0 {
+			t.Errorf("unexpected warnings: %v", report.Warnings)
+		}
+		assertSameRecords(t, export(t, dst), original)
+
+		// The checklist and tags are stored encrypted and indexed again
+		items, err := dst.checklists.GetByNoteID("note-1")
+		if err != nil || len(items) != 3 || items[1].Text != "Kirim undangan" || !items[1].Checked {
+			t.Errorf("checklist of note-1 = %+v, %v", items, err)
+		}
+		found, err := dst.notes.GetFiltered(models.NoteFilter{Tags: []string{"rapat"}})
+		if err != nil || len(found) != 1 || found[0].ID != "note-1" {
+			t.Errorf("notes tagged rapat = %v, %v", found, err)
+		}
+	})
+
+	t.Run("replace over existing data", func(t *testing.T) {
+		dst := newTestDB(t, 2)
+		other := models.Note{Subject: "Lain", Content: "Akan dihapus", Priority: "medium", Tags: "lain"}
+		if err := dst.notes.Create(&other); err != nil {
+			t.Fatal(err)
+		}
+		report := importArchive(t, dst, original, Options{Mode: ModeReplace})
+		assertCounts(t, "notes", report.Notes, Counts{Created: 3, Deleted: 1})
+		assertSameRecords(t, export(t, dst), original)
+	})
+
+	t.Run("merge skip", func(t *testing.T) {
+		dst := copyOf(t, original)
+		note, err := dst.notes.GetByID("note-2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		note.Content = "Diubah setelah ekspor"
+		if err := dst.notes.Update(note); err != nil {
+			t.Fatal(err)
+		}
+		before := export(t, dst)
+
+		report := importArchive(t, dst, original, Options{Mode: ModeMerge, OnConflict: ConflictSkip})
+		assertCounts(t, "categories", report.Categories, Counts{Skipped: 3})
+		assertCounts(t, "notes", report.Notes, Counts{Skipped: 3})
+		assertCounts(t, "activity logs", report.ActivityLogs, Counts{Skipped: 2})
+		assertSameRecords(t, export(t, dst), before)
+	})
+
+	t.Run("merge overwrite", func(t *testing.T) {
+		dst := copyOf(t, original)
+		note, err := dst.notes.GetByID("note-2")
+		if err != nil {
+			t.Fatal(err)
+		}
+		note.Content = "Diubah setelah ekspor"
+		note.Tags = "lain"
+		if err := dst.notes.Update(note); err != nil {
+			t.Fatal(err)
+		}
+		if err := dst.checklists.Uncheck("note-1"); err != nil {
+			t.Fatal(err)
+		}
+
+		report := importArchive(t, dst, original, Options{Mode: ModeMerge, OnConflict: ConflictOverwrite})
+		assertCounts(t, "categories", report.Categories, Counts{Overwritten: 3})
+		assertCounts(t, "notes", report.Notes, Counts{Overwritten: 3})
+		assertCounts(t, "activity logs", report.ActivityLogs, Counts{Skipped: 2})
+		assertSameRecords(t, export(t, dst), original)
+	})
+
+	t.Run("merge new-id", func(t *testing.T) {
+		dst := copyOf(t, original)
+		report := importArchive(t, dst, original, Options{Mode: ModeMerge, OnConflict: ConflictNewID})
+		// Categories with the same name under the same parent are merged
+		assertCounts(t, "categories", report.Categories, Counts{Skipped: 3})
+		assertCounts(t, "notes", report.Notes, Counts{Created: 3})
+		assertCounts(t, "activity logs", report.ActivityLogs, Counts{Skipped: 2})
+
+		newIDs := map[string]string{}
+		for _, change := range report.Changes {
+			if change.Type == "note" {
+				if change.Action != ActionNewID || change.NewID == "" || change.NewID == change.ID {
+					t.Errorf("unexpected note change %+v", change)
+				}
+				newIDs[change.ID] = change.NewID
+			}
+		}
+		for id, newID := range newIDs {
+			kept, err := dst.notes.GetByID(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			copied, err := dst.notes.GetByID(newID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if copied.Subject != kept.Subject || copied.Tags != kept.Tags || copied.CategoryID != kept.CategoryID ||
+				!copied.CreatedAt.Equal(kept.CreatedAt) || (copied.TrashedAt == nil) != (kept.TrashedAt == nil) {
+				t.Errorf("copy of %s = %+v, want it like %+v", id, copied, kept)
+			}
+			originalItems, _ := dst.checklists.GetByNoteID(id)
+			copiedItems, _ := dst.checklists.GetByNoteID(newID)
+			if len(copiedItems) != len(originalItems) {
+				t.Fatalf("copy of %s has %d checklist items, want %d", id, len(copiedItems), len(originalItems))
+			}
+			for i := range copiedItems {
+				if copiedItems[i].ID == originalItems[i].ID || copiedItems[i].Text != originalItems[i].Text || copiedItems[i].Checked != originalItems[i].Checked {
+					t.Errorf("checklist item %d of the copy of %s = %+v, want a copy of %+v", i, id, copiedItems[i], originalItems[i])
+				}
+			}
+		}
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		dst := newTestDB(t, 2)
+		other := models.Note{Subject: "Lain", Content: "Tetap ada", Priority: "medium"}
+		if err := dst.notes.Create(&other); err != nil {
+			t.Fatal(err)
+		}
+		before := export(t, dst)
+
+		for _, opts := range []Options{
+			{Mode: ModeReplace, DryRun: true},
+			{Mode: ModeMerge, OnConflict: ConflictNewID, DryRun: true},
+		} {
+			report := importArchive(t, dst, original, opts)
+			if !report.DryRun {
+				t.Errorf("%+v: report is not marked as a dry run", opts)
+			}
+			if report.Notes.Created != 3 || report.Categories.Created != 3 {
+				t.Errorf("%+v: report = notes %+v, categories %+v, want 3 of each created", opts, report.Notes, report.Categories)
+			}
+			assertSameRecords(t, export(t, dst), before)
+		}
+	})
+}
@@ -0,0 +1,496 @@
+package archive
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"personal-notes-with-go/database"
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/repositories"
+	"personal-notes-with-go/utils"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Import modes
+const (
+	// ModeMerge adds the archive to the existing data
+	ModeMerge = "merge"
+	// ModeReplace deletes all categories, notes and activity logs first
+	ModeReplace = "replace"
+)
+
+// Policies for records of a merge whose ID is already in the database
+const (
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictNewID     = "new-id"
+)
+
+// Actions recorded in a Change
+const (
+	ActionCreate    = "create"
+	ActionOverwrite = "overwrite"
+	ActionSkip      = "skip"
+	ActionNewID     = "new-id"
+	ActionMerge     = "merge"
+	ActionDelete    = "delete"
+)
+
+// Options controls an import
+type Options struct {
+	Mode       string
+	OnConflict string
+	// DryRun runs the whole import and rolls it back, so the report shows
+	// what would change
+	DryRun bool
+}
+
+// Validate checks the mode and conflict policy, filling in the defaults
+func (o *Options) Validate() error {
+	switch o.Mode {
+	case "":
+		o.Mode = ModeMerge
+	case ModeMerge, ModeReplace:
+	default:
+		return fmt.Errorf("unknown import mode %q, expected %s or %s", o.Mode, ModeMerge, ModeReplace)
+	}
+	switch o.OnConflict {
+	case "":
+		o.OnConflict = ConflictSkip
+	case ConflictSkip, ConflictOverwrite, ConflictNewID:
+	default:
+		return fmt.Errorf("unknown conflict policy %q, expected %s, %s or %s", o.OnConflict, ConflictSkip, ConflictOverwrite, ConflictNewID)
+	}
+	return nil
+}
+
+// Counts counts what happened to the records of one kind
+type Counts struct {
+	Created     int `json:"created"`
+	Overwritten int `json:"overwritten"`
+	Skipped     int `json:"skipped"`
+	Deleted     int `json:"deleted"`
+}
+
+// Change describes what happened to one category or note
+type Change struct {
+	Type   string `json:"type"`
+	ID     string `json:"id"`
+	NewID  string `json:"new_id,omitempty"`
+	Name   string `json:"name"`
+	Action string `json:"action"`
+}
+
+// Report describes the outcome of an import, or with DryRun what it would be
+type Report struct {
+	Mode          string   `json:"mode"`
+	OnConflict    string   `json:"on_conflict"`
+	DryRun        bool     `json:"dry_run"`
+	SchemaVersion int      `json:"schema_version"`
+	Categories    Counts   `json:"categories"`
+	Notes         Counts   `json:"notes"`
+	ActivityLogs  Counts   `json:"activity_logs"`
+	Changes       []Change `json:"changes"`
+	Warnings      []string `json:"warnings"`
+}
+
+// Import applies the archive to db in a single transaction, encrypting with
+// c and indexing with bi. IDs and timestamps are kept, except for records given a new ID by the
+// new-id policy. In a merge, a category whose name already exists under
+// the same parent with another ID is merged into the existing one, and
+// activity logs already in the database are not added twice.
+func Import(db *sql.DB, c utils.Cipher, bi *utils.BlindIndex, a *Reader, opts Options) (*Report, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	if latest := database.LatestSchemaVersion(); a.Manifest.SchemaVersion > latest {
+		return nil, fmt.Errorf("archive has schema version %d, this version supports up to %d; upgrade before importing", a.Manifest.SchemaVersion, latest)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	im := &importer{
+		tx:         tx,
+		opts:       opts,
+		categories: repositories.NewEncryptedCategoryRepository(repositories.NewCategoryRepository(tx), c),
+		notes: repositories.NewTaggedNoteRepository(
+			repositories.NewEncryptedNoteRepository(repositories.NewNoteRepository(tx), c, bi),
+			repositories.NewEncryptedTagRepository(repositories.NewTagRepository(tx), c, bi),
+		),
+		checklists: repositories.NewEncryptedChecklistRepository(repositories.NewChecklistRepository(tx), c),
+		report: &Report{
+			Mode:          opts.Mode,
+			OnConflict:    opts.OnConflict,
+			DryRun:        opts.DryRun,
+			SchemaVersion: a.Manifest.SchemaVersion,
+			Changes:       []Change{},
+			Warnings:      []string{},
+		},
+		categoryIDs:     make(map[string]string),
+		categoryNames:   make(map[string]string),
+		archiveCategory: make(map[string]bool),
+		noteIDs:         make(map[string]bool),
+	}
+
+	if opts.Mode == ModeReplace {
+		if err := im.deleteAll(); err != nil {
+			return nil, err
+		}
+	} else if err := im.loadExisting(); err != nil {
+		return nil, err
+	}
+
+	var categories []models.Category
+	if err := a.Categories(func(cat models.Category) error {
+		categories = append(categories, cat)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	for _, cat := range parentsFirst(categories) {
+		if err := im.category(cat); err != nil {
+			return nil, err
+		}
+	}
+	if err := a.Notes(im.note); err != nil {
+		return nil, err
+	}
+	if err := a.ActivityLogs(im.activityLog); err != nil {
+		return nil, err
+	}
+
+	if opts.DryRun {
+		return im.report, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit import: %w", err)
+	}
+	return im.report, nil
+}
+
+// importer holds the state of one import
+type importer struct {
+	tx         *sql.Tx
+	opts       Options
+	categories repositories.CategoryRepositoryInterface
+	notes      repositories.NoteRepositoryInterface
+	checklists repositories.ChecklistRepositoryInterface
+	report     *Report
+
+	// categoryIDs maps category IDs of the archive to IDs in the database
+	categoryIDs map[string]string
+	// categoryNames maps the keys of categoryKey to IDs of categories in the
+	// database
+	categoryNames map[string]string
+	// archiveCategory holds the database IDs written from the archive, so a
+	// category is only merged by name into one that was there before
+	archiveCategory map[string]bool
+	noteIDs         map[string]bool
+}
+
+// deleteAll removes the existing data for a replace, recording what is
+// deleted. Notes that cannot be decrypted are deleted as well.
+func (im *importer) deleteAll() error {
+	categories, err := im.categories.GetAll()
+	if err != nil {
+		return err
+	}
+	for _, cat := range categories {
+		im.change("category", cat.ID, "", cat.Name, ActionDelete)
+	}
+	notes, err := im.notes.GetAll()
+	if err != nil {
+		return err
+	}
+	trashed, err := im.notes.GetFiltered(models.NoteFilter{Trashed: true})
+	if err != nil {
+		return err
+	}
+	for _, note := range append(notes, trashed...) {
+		im.change("note", note.ID, "", note.Subject, ActionDelete)
+	}
+
+	// Tags, word indexes and checklists belong to the notes and are
+	// recreated with them
+	for _, table := range []string{"note_tags", "tags", "note_words", "checklist_items"} {
+		if _, err := im.tx.Exec("DELETE FROM " + table); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", table, err)
+		}
+	}
+	// Notes go before the categories they refer to
+	for _, t := range []struct {
+		table  string
+		counts *Counts
+	}{
+		{"notes", &im.report.Notes},
+		{"categories", &im.report.Categories},
+		{"activity_logs", &im.report.ActivityLogs},
+	} {
+		table, counts := t.table, t.counts
+		result, err := im.tx.Exec("DELETE FROM " + table)
+		if err != nil {
+			return fmt.Errorf("failed to delete %s: %w", table, err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get affected rows: %w", err)
+		}
+		counts.Deleted = int(n)
+	}
+	return nil
+}
+
+// loadExisting reads the IDs and category names in the database for a merge
+func (im *importer) loadExisting() error {
+	categories, err := im.categories.GetAll()
+	if err != nil {
+		return err
+	}
+	for _, cat := range categories {
+		im.categoryNames[categoryKey(cat.ParentID, cat.Name)] = cat.ID
+	}
+
+	rows, err := im.tx.Query("SELECT id FROM notes")
+	if err != nil {
+		return fmt.Errorf("failed to get notes: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return fmt.Errorf("failed to scan note: %w", err)
+		}
+		im.noteIDs[id] = true
+	}
+	return rows.Err()
+}
+
+func (im *importer) category(cat models.Category) error {
+	if cat.ID == "" {
+		return fmt.Errorf("category %q has no ID", cat.Name)
+	}
+	counts := &im.report.Categories
+	if cat.ParentID != "" {
+		parentID, ok := im.categoryIDs[cat.ParentID]
+		if !ok {
+			im.report.Warnings = append(im.report.Warnings, fmt.Sprintf("category %s refers to parent %s, which is not in the archive or is one of its subcategories; imported as a top-level category", cat.ID, cat.ParentID))
+		}
+		cat.ParentID = parentID
+	}
+	key := categoryKey(cat.ParentID, cat.Name)
+	existingID, nameTaken := im.categoryNames[key]
+
+	_, err := im.categories.GetByID(cat.ID)
+	switch {
+	case err == nil:
+		switch im.opts.OnConflict {
+		case ConflictSkip:
+			im.categoryIDs[cat.ID] = cat.ID
+			counts.Skipped++
+			im.change("category", cat.ID, "", cat.Name, ActionSkip)
+			return nil
+		case ConflictOverwrite:
+			if err := im.categories.Update(&cat); err != nil {
+				return fmt.Errorf("failed to overwrite category %q: %w", cat.Name, err)
+			}
+			if err := im.categories.Move(cat.ID, cat.ParentID); err != nil {
+				return fmt.Errorf("failed to overwrite category %q: %w", cat.Name, err)
+			}
+			im.categoryIDs[cat.ID] = cat.ID
+			im.categoryNames[key] = cat.ID
+			counts.Overwritten++
+			im.change("category", cat.ID, "", cat.Name, ActionOverwrite)
+			return nil
+		}
+		// new-id: stored as a new category below, unless the name exists
+	case errors.Is(err, utils.ErrCategoryNotFound):
+	default:
+		return err
+	}
+
+	if nameTaken && !im.archiveCategory[existingID] {
+		// Under new-id a category identical to the existing one is skipped
+		im.categoryIDs[cat.ID] = existingID
+		counts.Skipped++
+		if existingID == cat.ID {
+			im.change("category", cat.ID, "", cat.Name, ActionSkip)
+		} else {
+			im.change("category", cat.ID, existingID, cat.Name, ActionMerge)
+		}
+		return nil
+	}
+
+	action := ActionCreate
+	stored := cat
+	if err == nil {
+		action = ActionNewID
+		stored.ID = uuid.New().String()
+	}
+	if err := im.categories.Insert(&stored); err != nil {
+		return fmt.Errorf("failed to import category %q: %w", cat.Name, err)
+	}
+	im.categoryIDs[cat.ID] = stored.ID
+	im.categoryNames[key] = stored.ID
+	im.archiveCategory[stored.ID] = true
+	counts.Created++
+	newID := ""
+	if stored.ID != cat.ID {
+		newID = stored.ID
+	}
+	im.change("category", cat.ID, newID, cat.Name, action)
+	return nil
+}
+
+// categoryKey identifies a category by its parent and its name, which is
+// unique among the subcategories of the parent ignoring case
+func categoryKey(parentID, name string) string {
+	return parentID + "/" + strings.ToLower(strings.TrimSpace(name))
+}
+
+// parentsFirst orders categories so that every category comes after its
+// parent, keeping the archive order otherwise. Categories whose parents are
+// missing or that are their own ancestors stay where they are, and are
+// imported as top-level categories.
+func parentsFirst(categories []models.Category) []models.Category {
+	byID := make(map[string]models.Category, len(categories))
+	for _, cat := range categories {
+		byID[cat.ID] = cat
+	}
+	ordered := make([]models.Category, 0, len(categories))
+	done := make(map[string]bool, len(categories))
+	visiting := make(map[string]bool)
+	var visit func(cat models.Category)
+	visit = func(cat models.Category) {
+		if done[cat.ID] || visiting[cat.ID] {
+			return
+		}
+		visiting[cat.ID] = true
+		if parent, ok := byID[cat.ParentID]; ok {
+			visit(parent)
+		}
+		visiting[cat.ID] = false
+		done[cat.ID] = true
+		ordered = append(ordered, cat)
+	}
+	for _, cat := range categories {
+		visit(cat)
+	}
+	return ordered
+}
+
+func (im *importer) note(note models.Note) error {
+	if note.ID == "" {
+		return fmt.Errorf("note %q has no ID", note.Subject)
+	}
+	counts := &im.report.Notes
+
+	if note.CategoryID != "" {
+		id, ok := im.categoryIDs[note.CategoryID]
+		if !ok {
+			im.report.Warnings = append(im.report.Warnings, fmt.Sprintf("note %s refers to category %s, which is not in the archive; imported without category", note.ID, note.CategoryID))
+		}
+		note.CategoryID = id
+	}
+
+	action := ActionCreate
+	if im.noteIDs[note.ID] {
+		switch im.opts.OnConflict {
+		case ConflictSkip:
+			counts.Skipped++
+			im.change("note", note.ID, "", note.Subject, ActionSkip)
+			return nil
+		case ConflictOverwrite:
+			// Delete and insert rather than update, which would set
+			// updated_at to now
+			if err := im.notes.Delete(note.ID); err != nil {
+				return fmt.Errorf("failed to overwrite note %s: %w", note.ID, err)
+			}
+			action = ActionOverwrite
+		case ConflictNewID:
+			action = ActionNewID
+		}
+	}
+
+	originalID := note.ID
+	if action == ActionNewID {
+		note.ID = uuid.New().String()
+	}
+	checklist := note.Checklist
+	note.Checklist = nil
+	if err := im.notes.Insert(&note); err != nil {
+		return fmt.Errorf("failed to import note %s: %w", originalID, err)
+	}
+	for _, item := range checklist {
+		item.NoteID = note.ID
+		if action == ActionNewID {
+			item.ID = uuid.New().String()
+		}
+		if err := im.checklists.Insert(&item); err != nil {
+			return fmt.Errorf("failed to import checklist of note %s: %w", originalID, err)
+		}
+	}
+	im.noteIDs[note.ID] = true
+
+	newID := ""
+	switch action {
+	case ActionOverwrite:
+		counts.Overwritten++
+	case ActionNewID:
+		counts.Created++
+		newID = note.ID
+	default:
+		counts.Created++
+	}
+	im.change("note", originalID, newID, note.Subject, action)
+	return nil
+}
+
+// activityLog adds a log entry. A replace keeps the IDs of the archive; a
+// merge numbers entries after the existing ones and leaves out entries
+// already in the database.
+func (im *importer) activityLog(entry models.ActivityLog) error {
+	counts := &im.report.ActivityLogs
+	if im.opts.Mode == ModeReplace {
+		_, err := im.tx.Exec(`
+			INSERT INTO activity_logs (id, timestamp, action, entity_type, entity_id, description, user_id, ip_address)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			entry.ID, entry.Timestamp, entry.Action, entry.EntityType, entry.EntityID, entry.Description, entry.UserID, entry.IPAddress)
+		if err != nil {
+			return fmt.Errorf("failed to import activity log %d: %w", entry.ID, err)
+		}
+		counts.Created++
+		return nil
+	}
+
+	var exists bool
+	err := im.tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM activity_logs
+		WHERE timestamp = ? AND action = ? AND entity_type = ? AND entity_id = ? AND description = ?)`,
+		entry.Timestamp, entry.Action, entry.EntityType, entry.EntityID, entry.Description).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check activity log %d: %w", entry.ID, err)
+	}
+	if exists {
+		counts.Skipped++
+		return nil
+	}
+	_, err = im.tx.Exec(`
+		INSERT INTO activity_logs (timestamp, action, entity_type, entity_id, description, user_id, ip_address)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		entry.Timestamp, entry.Action, entry.EntityType, entry.EntityID, entry.Description, entry.UserID, entry.IPAddress)
+	if err != nil {
+		return fmt.Errorf("failed to import activity log %d: %w", entry.ID, err)
+	}
+	counts.Created++
+	return nil
+}
+
+func (im *importer) change(typ, id, newID, name, action string) {
+	im.report.Changes = append(im.report.Changes, Change{Type: typ, ID: id, NewID: newID, Name: name, Action: action})
+}
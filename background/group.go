@@ -0,0 +1,120 @@
+package background
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Group tracks the goroutines started by the server (activity logging,
+// purgers, schedulers) so that shutdown can wait for them to finish before
+// the database is closed.
+type Group struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	closed  bool
+	running map[string]int
+}
+
+// NewGroup creates an empty group
+func NewGroup() *Group {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Group{
+		ctx:     ctx,
+		cancel:  cancel,
+		running: make(map[string]int),
+	}
+}
+
+// Go runs fn in a new goroutine. The context passed to fn is cancelled when
+// Shutdown is called; short tasks may ignore it and simply finish. Tasks
+// submitted after Shutdown has started are not run and Go returns false.
+func (g *Group) Go(name string, fn func(ctx context.Context)) bool {
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		log.Printf("Background task %q dropped: shutting down", name)
+		return false
+	}
+	g.wg.Add(1)
+	g.running[name]++
+	g.mu.Unlock()
+
+	go func() {
+		defer func() {
+			g.mu.Lock()
+			g.running[name]--
+			if g.running[name] == 0 {
+				delete(g.running, name)
+			}
+			g.mu.Unlock()
+			g.wg.Done()
+		}()
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Background task %q panicked: %v", name, r)
+			}
+		}()
+		fn(g.ctx)
+	}()
+	return true
+}
+
+// Every runs fn every interval until Shutdown is called. A run that panics
+// is logged and the next one still runs on time.
+func (g *Group) Every(name string, interval time.Duration, fn func(ctx context.Context)) bool {
+	return g.Go(name, func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				tick(ctx, name, fn)
+			}
+		}
+	})
+}
+
+// tick runs fn once for Every, recovering from a panic
+func tick(ctx context.Context, name string, fn func(ctx context.Context)) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Background task %q panicked: %v", name, r)
+		}
+	}()
+	fn(ctx)
+}
+
+// Shutdown stops accepting new tasks, cancels the context of running tasks
+// and waits until they have all returned or ctx expires. On timeout it
+// returns ctx.Err() and logs the tasks that are still running.
+func (g *Group) Shutdown(ctx context.Context) error {
+	g.mu.Lock()
+	g.closed = true
+	g.mu.Unlock()
+	g.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		g.mu.Lock()
+		for name, count := range g.running {
+			log.Printf("Background task %q still running (%d) at shutdown deadline", name, count)
+		}
+		g.mu.Unlock()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,152 @@
+package background
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// captureLog sends the standard logger to a buffer for the rest of the
+// test
+func captureLog(t *testing.T) *syncBuffer {
+	t.Helper()
+	var buf syncBuffer
+	old := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(old) })
+	return &buf
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestShutdownWaitsForTasks(t *testing.T) {
+	g := NewGroup()
+	var finished atomic.Bool
+	g.Go("worker", func(ctx context.Context) {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		finished.Store(true)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := g.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !finished.Load() {
+		t.Error("Shutdown returned before the task finished")
+	}
+}
+
+func TestGoAfterShutdown(t *testing.T) {
+	captureLog(t)
+	g := NewGroup()
+	if err := g.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var ran atomic.Bool
+	if g.Go("late", func(ctx context.Context) { ran.Store(true) }) {
+		t.Error("Go after Shutdown returned true")
+	}
+	if g.Every("late", time.Millisecond, func(ctx context.Context) { ran.Store(true) }) {
+		t.Error("Every after Shutdown returned true")
+	}
+	time.Sleep(10 * time.Millisecond)
+	if ran.Load() {
+		t.Error("a task submitted after Shutdown ran")
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	logs := captureLog(t)
+	g := NewGroup()
+	release := make(chan struct{})
+	defer close(release)
+	for range 2 {
+		g.Go("stuck", func(ctx context.Context) { <-release })
+	}
+	g.Go("quick", func(ctx context.Context) {})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := g.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown() = %v, want context.DeadlineExceeded", err)
+	}
+	if got := logs.String(); !strings.Contains(got, `"stuck" still running (2)`) || strings.Contains(got, `"quick"`) {
+		t.Errorf("Shutdown logged %q, want only the stuck tasks", got)
+	}
+}
+
+func TestGoRecoversPanic(t *testing.T) {
+	logs := captureLog(t)
+	g := NewGroup()
+	g.Go("broken", func(ctx context.Context) { panic("boom") })
+	if err := g.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), `"broken" panicked: boom`) {
+		t.Errorf("panic was not logged: %q", logs.String())
+	}
+}
+
+func TestEveryKeepsRunningAfterPanic(t *testing.T) {
+	logs := captureLog(t)
+	g := NewGroup()
+	var runs atomic.Int32
+	g.Every("flaky", time.Millisecond, func(ctx context.Context) {
+		if runs.Add(1) == 1 {
+			panic("first run")
+		}
+	})
+
+	deadline := time.Now().Add(time.Second)
+	for runs.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if err := g.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if runs.Load() < 3 {
+		t.Errorf("ran %d times after the first run panicked, want the schedule to go on", runs.Load())
+	}
+	if !strings.Contains(logs.String(), `"flaky" panicked: first run`) {
+		t.Errorf("panic was not logged: %q", logs.String())
+	}
+}
+
+func TestEveryStopsOnShutdown(t *testing.T) {
+	g := NewGroup()
+	var runs atomic.Int32
+	g.Every("ticker", time.Millisecond, func(ctx context.Context) { runs.Add(1) })
+	time.Sleep(10 * time.Millisecond)
+	if err := g.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	after := runs.Load()
+	time.Sleep(10 * time.Millisecond)
+	if runs.Load() != after {
+		t.Error("Every kept running after Shutdown")
+	}
+}
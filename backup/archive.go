@@ -0,0 +1,320 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// An archive is laid out as
+//
+//	magic (8 bytes) | header length (uint32, big endian) | header (JSON) | sealed payload
+//
+// The header holds the key derivation parameters and the nonce. The payload
+// is a gzip-compressed tar file sealed with XChaCha20-Poly1305 under a key
+// derived from the backup passphrase; the magic and header are authenticated
+// as additional data, so they cannot be altered without detection either.
+const (
+	magic         = "NOTESBAK"
+	formatVersion = 1
+	maxHeaderSize = 64 * 1024
+)
+
+// File names inside the archive
+const (
+	ManifestFile = "manifest.json"
+	DatabaseFile = "notes.sqlite3"
+	SettingsFile = "settings.json"
+	SaltFile     = "key.salt"
+)
+
+// MinPassphraseLength is the shortest backup passphrase accepted
+const MinPassphraseLength = 8
+
+// Argon2id parameters for new archives. They are stored in the header so
+// they can be raised later without breaking older archives.
+const (
+	kdfTime    = 3
+	kdfMemory  = 64 * 1024 // KiB
+	kdfThreads = 4
+	kdfSaltLen = 16
+
+	// Upper bounds accepted when reading, so a damaged header cannot make
+	// the key derivation take unbounded time or memory
+	maxKDFTime   = 10
+	maxKDFMemory = 1024 * 1024 // KiB
+)
+
+var errWrongPassphrase = errors.New("wrong passphrase or damaged archive")
+
+// header is stored unencrypted at the start of an archive
+type header struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Cipher    string    `json:"cipher"`
+	Nonce     []byte    `json:"nonce"`
+	KDF       kdfParams `json:"kdf"`
+}
+
+type kdfParams struct {
+	Name    string `json:"name"`
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+// Manifest describes the files in an archive. It is stored encrypted next
+// to them.
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	// KeyProvider and Cipher record the encryption settings of the vault
+	// when the backup was made. The key itself is only included for the
+	// settings provider (in settings.json); the passphrase provider only
+	// needs its salt file.
+	KeyProvider string      `json:"key_provider"`
+	Cipher      string      `json:"cipher"`
+	Files       []FileEntry `json:"files"`
+}
+
+// FileEntry records the size and SHA-256 checksum of an archived file
+type FileEntry struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Archive is the decrypted content of a backup
+type Archive struct {
+	Manifest Manifest
+	files    map[string][]byte
+}
+
+// File returns the content of the named file and whether it is present
+func (a *Archive) File(name string) ([]byte, bool) {
+	data, ok := a.files[name]
+	return data, ok
+}
+
+// seal encrypts the manifest and files into an archive written to w
+func seal(w io.Writer, manifest Manifest, files map[string][]byte, passphrase string) error {
+	if len(passphrase) < MinPassphraseLength {
+		return fmt.Errorf("backup passphrase must be at least %d characters", MinPassphraseLength)
+	}
+
+	manifest.Version = formatVersion
+	manifest.Files = manifest.Files[:0]
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sum := sha256.Sum256(files[name])
+		manifest.Files = append(manifest.Files, FileEntry{Name: name, Size: int64(len(files[name])), SHA256: hex.EncodeToString(sum[:])})
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	var payload bytes.Buffer
+	gz := gzip.NewWriter(&payload)
+	tw := tar.NewWriter(gz)
+	add := func(name string, data []byte) error {
+		hdr := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: manifest.CreatedAt}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	if err := add(ManifestFile, manifestData); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	for _, name := range names {
+		if err := add(name, files[name]); err != nil {
+			return fmt.Errorf("failed to write archive: %w", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to compress archive: %w", err)
+	}
+
+	h := header{
+		Version:   formatVersion,
+		CreatedAt: manifest.CreatedAt,
+		Cipher:    "xchacha20-poly1305",
+		Nonce:     make([]byte, chacha20poly1305.NonceSizeX),
+		KDF: kdfParams{
+			Name:    "argon2id",
+			Salt:    make([]byte, kdfSaltLen),
+			Time:    kdfTime,
+			Memory:  kdfMemory,
+			Threads: kdfThreads,
+		},
+	}
+	if _, err := rand.Read(h.Nonce); err != nil {
+		return err
+	}
+	if _, err := rand.Read(h.KDF.Salt); err != nil {
+		return err
+	}
+	prefix, err := encodeHeader(h)
+	if err != nil {
+		return err
+	}
+
+	aead, err := chacha20poly1305.NewX(h.KDF.key(passphrase))
+	if err != nil {
+		return err
+	}
+	sealed := aead.Seal(nil, h.Nonce, payload.Bytes(), prefix)
+
+	if _, err := w.Write(prefix); err != nil {
+		return err
+	}
+	_, err = w.Write(sealed)
+	return err
+}
+
+// open decrypts an archive and checks every file against the manifest
+func open(r io.Reader, passphrase string) (*Archive, error) {
+	h, prefix, err := decodeHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	aead, err := chacha20poly1305.NewX(h.KDF.key(passphrase))
+	if err != nil {
+		return nil, err
+	}
+	if len(h.Nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid archive header: bad nonce")
+	}
+	payload, err := aead.Open(nil, h.Nonce, sealed, prefix)
+	if err != nil {
+		return nil, errWrongPassphrase
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress archive: %w", err)
+	}
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from archive: %w", hdr.Name, err)
+		}
+		files[hdr.Name] = data
+	}
+
+	manifestData, ok := files[ManifestFile]
+	if !ok {
+		return nil, errors.New("archive has no manifest")
+	}
+	delete(files, ManifestFile)
+	var manifest Manifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	if len(manifest.Files) != len(files) {
+		return nil, fmt.Errorf("archive holds %d files but the manifest lists %d", len(files), len(manifest.Files))
+	}
+	for _, entry := range manifest.Files {
+		data, ok := files[entry.Name]
+		if !ok {
+			return nil, fmt.Errorf("%s is listed in the manifest but missing from the archive", entry.Name)
+		}
+		sum := sha256.Sum256(data)
+		if int64(len(data)) != entry.Size || hex.EncodeToString(sum[:]) != entry.SHA256 {
+			return nil, fmt.Errorf("%s does not match its checksum", entry.Name)
+		}
+	}
+
+	return &Archive{Manifest: manifest, files: files}, nil
+}
+
+// encodeHeader returns the magic, header length and header as written at
+// the start of an archive
+func encodeHeader(h header) ([]byte, error) {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode archive header: %w", err)
+	}
+	prefix := make([]byte, 0, len(magic)+4+len(data))
+	prefix = append(prefix, magic...)
+	prefix = binary.BigEndian.AppendUint32(prefix, uint32(len(data)))
+	return append(prefix, data...), nil
+}
+
+// decodeHeader reads and checks the header, returning it together with the
+// raw bytes it was decoded from
+func decodeHeader(r io.Reader) (header, []byte, error) {
+	var h header
+	fixed := make([]byte, len(magic)+4)
+	if _, err := io.ReadFull(r, fixed); err != nil || string(fixed[:len(magic)]) != magic {
+		return h, nil, errors.New("not a notes backup archive")
+	}
+	size := binary.BigEndian.Uint32(fixed[len(magic):])
+	if size > maxHeaderSize {
+		return h, nil, errors.New("invalid archive header: too large")
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return h, nil, fmt.Errorf("failed to read archive header: %w", err)
+	}
+	if err := json.Unmarshal(data, &h); err != nil {
+		return h, nil, fmt.Errorf("invalid archive header: %w", err)
+	}
+
+	switch {
+	case h.Version != formatVersion:
+		return h, nil, fmt.Errorf("unsupported archive version %d", h.Version)
+	case h.Cipher != "xchacha20-poly1305":
+		return h, nil, fmt.Errorf("unsupported archive cipher %q", h.Cipher)
+	case h.KDF.Name != "argon2id":
+		return h, nil, fmt.Errorf("unsupported key derivation %q", h.KDF.Name)
+	case h.KDF.Time < 1 || h.KDF.Time > maxKDFTime || h.KDF.Memory < 8 || h.KDF.Memory > maxKDFMemory || h.KDF.Threads < 1:
+		return h, nil, errors.New("invalid archive header: key derivation parameters out of range")
+	case len(h.KDF.Salt) < kdfSaltLen:
+		return h, nil, errors.New("invalid archive header: salt too short")
+	}
+	return h, append(fixed, data...), nil
+}
+
+// key derives the archive key from the passphrase
+func (p kdfParams) key(passphrase string) []byte {
+	return argon2.IDKey([]byte(passphrase), p.Salt, p.Time, p.Memory, p.Threads, chacha20poly1305.KeySize)
+}
@@ -0,0 +1,230 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const testPassphrase = "correct horse battery"
+
+var testFiles = map[string][]byte{
+	DatabaseFile: []byte("database content"),
+	SettingsFile: []byte(`{"encryption_key":"abc"}`),
+	SaltFile:     {1, 2, 3, 4},
+}
+
+// sealed returns an archive of testFiles
+func sealed(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	manifest := Manifest{CreatedAt: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC), KeyProvider: "settings", Cipher: "aes-gcm"}
+	if err := seal(&buf, manifest, testFiles, testPassphrase); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// sealRaw seals the given tar entries as they are, without computing a
+// manifest, so that tests can build archives seal would never write. It
+// uses the cheapest key derivation open accepts.
+func sealRaw(t *testing.T, entries map[string][]byte) []byte {
+	t.Helper()
+	var payload bytes.Buffer
+	gz := gzip.NewWriter(&payload)
+	tw := tar.NewWriter(gz)
+	for name, data := range entries {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(data))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	h := header{
+		Version: formatVersion,
+		Cipher:  "xchacha20-poly1305",
+		Nonce:   make([]byte, chacha20poly1305.NonceSizeX),
+		KDF:     kdfParams{Name: "argon2id", Salt: make([]byte, kdfSaltLen), Time: 1, Memory: 8, Threads: 1},
+	}
+	prefix, err := encodeHeader(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := chacha20poly1305.NewX(h.KDF.key(testPassphrase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(prefix, aead.Seal(nil, h.Nonce, payload.Bytes(), prefix)...)
+}
+
+// manifestFor returns the manifest seal would write for files
+func manifestFor(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	manifest := Manifest{Version: formatVersion}
+	for name, data := range files {
+		sum := sha256.Sum256(data)
+		manifest.Files = append(manifest.Files, FileEntry{Name: name, Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])})
+	}
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	a, err := open(bytes.NewReader(sealed(t)), testPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a.Manifest.KeyProvider != "settings" || a.Manifest.Cipher != "aes-gcm" || a.Manifest.Version != formatVersion {
+		t.Errorf("manifest = %+v", a.Manifest)
+	}
+	if len(a.Manifest.Files) != len(testFiles) {
+		t.Errorf("manifest lists %d files, want %d", len(a.Manifest.Files), len(testFiles))
+	}
+	for name, want := range testFiles {
+		got, ok := a.File(name)
+		if !ok || !bytes.Equal(got, want) {
+			t.Errorf("File(%q) = %q, %v, want %q", name, got, ok, want)
+		}
+	}
+	if _, ok := a.File(ManifestFile); ok {
+		t.Error("the manifest is returned as a file")
+	}
+}
+
+func TestSealShortPassphrase(t *testing.T) {
+	var buf bytes.Buffer
+	err := seal(&buf, Manifest{}, testFiles, strings.Repeat("x", MinPassphraseLength-1))
+	if err == nil || !strings.Contains(err.Error(), "passphrase") {
+		t.Errorf("seal() = %v, want an error about the passphrase", err)
+	}
+}
+
+func TestOpenWrongPassphrase(t *testing.T) {
+	_, err := open(bytes.NewReader(sealed(t)), "wrong passphrase")
+	if !errors.Is(err, errWrongPassphrase) {
+		t.Errorf("open() = %v, want errWrongPassphrase", err)
+	}
+}
+
+func TestOpenDamaged(t *testing.T) {
+	archive := sealed(t)
+	headerLen := len(magic) + 4 + int(binary.BigEndian.Uint32(archive[len(magic):]))
+
+	changeHeader := func(change func(h *header)) []byte {
+		h, prefix, err := decodeHeader(bytes.NewReader(archive))
+		if err != nil {
+			t.Fatal(err)
+		}
+		change(&h)
+		changed, err := encodeHeader(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return append(changed, archive[len(prefix):]...)
+	}
+	flip := func(i int) []byte {
+		damaged := bytes.Clone(archive)
+		damaged[i] ^= 1
+		return damaged
+	}
+
+	tests := []struct {
+		name    string
+		archive []byte
+		want    string
+	}{
+		{"empty", nil, "not a notes backup"},
+		{"wrong magic", append([]byte("NOTESBAX"), archive[len(magic):]...), "not a notes backup"},
+		{"truncated header", archive[:headerLen-1], "archive header"},
+		{"truncated payload", archive[:len(archive)-1], errWrongPassphrase.Error()},
+		{"payload missing", archive[:headerLen], errWrongPassphrase.Error()},
+		{"payload byte changed", flip(len(archive) - 20), errWrongPassphrase.Error()},
+		{"created_at changed", changeHeader(func(h *header) { h.CreatedAt = h.CreatedAt.Add(time.Hour) }), errWrongPassphrase.Error()},
+		{"salt changed", changeHeader(func(h *header) { h.KDF.Salt[0] ^= 1 }), errWrongPassphrase.Error()},
+		{"unknown version", changeHeader(func(h *header) { h.Version = 2 }), "unsupported archive version"},
+		{"key derivation too expensive", changeHeader(func(h *header) { h.KDF.Memory = maxKDFMemory + 1 }), "out of range"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := open(bytes.NewReader(tt.archive), testPassphrase)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("open() = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOpenChecksManifest(t *testing.T) {
+	files := map[string][]byte{DatabaseFile: []byte("database content")}
+	tests := []struct {
+		name    string
+		entries map[string][]byte
+		want    string
+	}{
+		{
+			name:    "valid",
+			entries: map[string][]byte{ManifestFile: manifestFor(t, files), DatabaseFile: files[DatabaseFile]},
+		},
+		{
+			name:    "checksum mismatch",
+			entries: map[string][]byte{ManifestFile: manifestFor(t, files), DatabaseFile: []byte("database CONTENT")},
+			want:    DatabaseFile + " does not match its checksum",
+		},
+		{
+			name:    "size mismatch",
+			entries: map[string][]byte{ManifestFile: manifestFor(t, files), DatabaseFile: []byte("database content!")},
+			want:    DatabaseFile + " does not match its checksum",
+		},
+		{
+			name:    "file not in the manifest",
+			entries: map[string][]byte{ManifestFile: manifestFor(t, files), DatabaseFile: files[DatabaseFile], SaltFile: {1}},
+			want:    "archive holds 2 files but the manifest lists 1",
+		},
+		{
+			name:    "file missing from the archive",
+			entries: map[string][]byte{ManifestFile: manifestFor(t, files), SaltFile: {1}},
+			want:    DatabaseFile + " is listed in the manifest but missing",
+		},
+		{
+			name:    "no manifest",
+			entries: files,
+			want:    "archive has no manifest",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := open(bytes.NewReader(sealRaw(t, tt.entries)), testPassphrase)
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("open() = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("open() = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,356 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"personal-notes-with-go/database"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Archives are named notes-<timestamp>.nbak so Prune can tell them apart
+// from other files and sort them by age. The timestamp goes down to the
+// nanosecond, so that two backups made within the same second do not
+// replace one another.
+const (
+	filePrefix      = "notes-"
+	fileExt         = ".nbak"
+	timestampLayout = "20060102-150405.000000000"
+)
+
+// Pages copied per step of the SQLite backup. The source database is only
+// locked during a step, so the server keeps serving writes in between.
+const (
+	stepPages = 256
+	stepPause = 10 * time.Millisecond
+)
+
+// Source describes the vault to back up
+type Source struct {
+	DB *sql.DB
+	// SettingsPath and SaltPath are included when set and the files exist.
+	// Leave both empty to keep the key out of the archive.
+	SettingsPath string
+	SaltPath     string
+	KeyProvider  string
+	Cipher       string
+}
+
+// Target describes where Restore puts the files of an archive
+type Target struct {
+	DBPath string
+	// SettingsPath and SaltPath are restored when set and the archive
+	// contains the file
+	SettingsPath string
+	SaltPath     string
+}
+
+// RestoreResult lists what Restore replaced
+type RestoreResult struct {
+	Restored []string
+	// Previous maps each replaced path to where the old file was moved
+	Previous map[string]string
+}
+
+// Create writes an encrypted archive of src into dir and returns its path.
+// The database is copied with SQLite's online backup API, so a running
+// server does not have to be stopped.
+func Create(ctx context.Context, src Source, dir, passphrase string) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "notes-backup-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	snapshot := filepath.Join(tmpDir, DatabaseFile)
+	if err := Snapshot(ctx, src.DB, snapshot); err != nil {
+		return "", err
+	}
+
+	files := make(map[string][]byte)
+	if files[DatabaseFile], err = os.ReadFile(snapshot); err != nil {
+		return "", fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	for name, path := range map[string]string{SettingsFile: src.SettingsPath, SaltFile: src.SaltPath} {
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		files[name] = data
+	}
+
+	now := time.Now()
+	manifest := Manifest{CreatedAt: now.UTC(), KeyProvider: src.KeyProvider, Cipher: src.Cipher}
+
+	var buf bytes.Buffer
+	if err := seal(&buf, manifest, files, passphrase); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, filePrefix+now.Format(timestampLayout)+fileExt)
+	if err := writeFileAtomic(path, buf.Bytes()); err != nil {
+		return "", fmt.Errorf("failed to write backup: %w", err)
+	}
+	return path, nil
+}
+
+// Snapshot copies db into a new SQLite file at path using the online
+// backup API
+func Snapshot(ctx context.Context, db *sql.DB, path string) error {
+	dest, err := sql.Open("sqlite3", database.DSN(path, ""))
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	defer dest.Close()
+
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	defer destConn.Close()
+	srcConn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer srcConn.Close()
+
+	err = destConn.Raw(func(destDriver any) error {
+		return srcConn.Raw(func(srcDriver any) error {
+			d, ok := destDriver.(*sqlite3.SQLiteConn)
+			s, ok2 := srcDriver.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return errors.New("database is not a SQLite connection")
+			}
+
+			b, err := d.Backup("main", s, "main")
+			if err != nil {
+				return err
+			}
+			for {
+				done, err := b.Step(stepPages)
+				if err != nil {
+					b.Close()
+					return err
+				}
+				if done {
+					return b.Finish()
+				}
+				select {
+				case <-ctx.Done():
+					b.Close()
+					return ctx.Err()
+				case <-time.After(stepPause):
+				}
+			}
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to back up database: %w", err)
+	}
+	return nil
+}
+
+// Open decrypts the archive at path and checks its files against the
+// manifest. It does not validate the database itself; see Verify.
+func Open(path, passphrase string) (*Archive, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer f.Close()
+	return open(f, passphrase)
+}
+
+// Verify writes the database of the archive to a temporary file and runs
+// SQLite's integrity check on it
+func (a *Archive) Verify() error {
+	tmp, err := os.CreateTemp("", "notes-verify-*.sqlite3")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := a.writeDatabase(tmp.Name()); err != nil {
+		return err
+	}
+	return checkDatabase(tmp.Name())
+}
+
+// Restore replaces the database, and the settings and salt files when the
+// archive holds them, with the content of the archive. The database is
+// written next to its destination and checked before anything is replaced;
+// replaced files are kept with a .bak suffix. The server must not be running.
+func (a *Archive) Restore(t Target) (*RestoreResult, error) {
+	dir := filepath.Dir(t.DBPath)
+	tmp, err := os.CreateTemp(dir, ".notes-restore-*.sqlite3")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := a.writeDatabase(tmp.Name()); err != nil {
+		return nil, err
+	}
+	if err := checkDatabase(tmp.Name()); err != nil {
+		return nil, err
+	}
+
+	result := &RestoreResult{Previous: make(map[string]string)}
+	stamp := time.Now().Format(timestampLayout)
+	keep := func(path string) error {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		old := fmt.Sprintf("%s.%s.bak", path, stamp)
+		if err := os.Rename(path, old); err != nil {
+			return fmt.Errorf("failed to keep %s: %w", path, err)
+		}
+		result.Previous[path] = old
+		return nil
+	}
+
+	// Leftover journal files belong to the old database and would be
+	// applied to the restored one
+	for _, path := range []string{t.DBPath, t.DBPath + "-journal", t.DBPath + "-wal", t.DBPath + "-shm"} {
+		if err := keep(path); err != nil {
+			return result, err
+		}
+	}
+	if err := os.Rename(tmp.Name(), t.DBPath); err != nil {
+		return result, fmt.Errorf("failed to move restored database into place: %w", err)
+	}
+	result.Restored = append(result.Restored, t.DBPath)
+
+	for name, path := range map[string]string{SettingsFile: t.SettingsPath, SaltFile: t.SaltPath} {
+		data, ok := a.files[name]
+		if !ok || path == "" {
+			continue
+		}
+		if err := keep(path); err != nil {
+			return result, err
+		}
+		if err := writeFileAtomic(path, data); err != nil {
+			return result, fmt.Errorf("failed to restore %s: %w", path, err)
+		}
+		result.Restored = append(result.Restored, path)
+	}
+	return result, nil
+}
+
+// Prune deletes the oldest archives in dir so that at most keep remain and
+// returns the deleted paths. Other files in dir are left alone.
+func Prune(dir string, keep int) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+
+	var archives []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, filePrefix) && strings.HasSuffix(name, fileExt) {
+			archives = append(archives, name)
+		}
+	}
+	if len(archives) <= keep {
+		return nil, nil
+	}
+
+	// The timestamp in the name sorts chronologically
+	sort.Strings(archives)
+	var removed []string
+	for _, name := range archives[:len(archives)-keep] {
+		path := filepath.Join(dir, name)
+		if err := os.Remove(path); err != nil {
+			return removed, fmt.Errorf("failed to remove old backup: %w", err)
+		}
+		removed = append(removed, path)
+	}
+	return removed, nil
+}
+
+// writeDatabase writes the archived database to path
+func (a *Archive) writeDatabase(path string) error {
+	data, ok := a.files[DatabaseFile]
+	if !ok {
+		return errors.New("archive has no database")
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write database: %w", err)
+	}
+	return nil
+}
+
+// checkDatabase runs SQLite's integrity check on the database at path and
+// makes sure it holds the notes tables
+func checkDatabase(path string) error {
+	db, err := sql.Open("sqlite3", database.DSN(path, "mode=ro"))
+	if err != nil {
+		return fmt.Errorf("failed to open restored database: %w", err)
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&result); err != nil {
+		return fmt.Errorf("integrity check failed: %w", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("integrity check failed: %s", result)
+	}
+
+	for _, table := range []string{"categories", "notes"} {
+		var name string
+		err := db.QueryRow("SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&name)
+		if err != nil {
+			return fmt.Errorf("backup database has no %s table", table)
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it into place, so readers never see a partial file
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,232 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"personal-notes-with-go/database"
+)
+
+// newSource returns a vault with one category, a settings file and a salt
+// file
+func newSource(t *testing.T) Source {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := database.InitDB(filepath.Join(dir, "db.sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err := db.Exec("INSERT INTO categories (id, name) VALUES ('c1', 'Backed up')"); err != nil {
+		t.Fatal(err)
+	}
+
+	src := Source{
+		DB:           db,
+		SettingsPath: filepath.Join(dir, "settings.json"),
+		SaltPath:     filepath.Join(dir, "key.salt"),
+		KeyProvider:  "passphrase",
+		Cipher:       "xchacha20-poly1305",
+	}
+	writeFile(t, src.SettingsPath, "new settings")
+	writeFile(t, src.SaltPath, "new salt")
+	return src
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestCreateDoesNotOverwrite(t *testing.T) {
+	src := newSource(t)
+	dir := t.TempDir()
+
+	first, err := Create(context.Background(), src, dir, testPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Create(context.Background(), src, dir, testPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Fatalf("two backups were both written to %s", first)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("backup directory holds %d files, want 2", len(entries))
+	}
+	for _, path := range []string{first, second} {
+		a, err := Open(path, testPassphrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := a.Verify(); err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+		if a.Manifest.KeyProvider != src.KeyProvider || a.Manifest.Cipher != src.Cipher {
+			t.Errorf("manifest = %+v", a.Manifest)
+		}
+	}
+}
+
+func TestRestoreKeepsReplacedFiles(t *testing.T) {
+	src := newSource(t)
+	path, err := Create(context.Background(), src, t.TempDir(), testPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := Open(path, testPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	target := Target{
+		DBPath:       filepath.Join(dir, "db.sqlite3"),
+		SettingsPath: filepath.Join(dir, "settings.json"),
+		SaltPath:     filepath.Join(dir, "key.salt"),
+	}
+	old := map[string]string{
+		target.DBPath:              "old database",
+		target.DBPath + "-journal": "old journal",
+		target.DBPath + "-wal":     "old wal",
+		target.SettingsPath:        "old settings",
+		target.SaltPath:            "old salt",
+	}
+	for path, content := range old {
+		writeFile(t, path, content)
+	}
+
+	result, err := a.Restore(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored := []string{target.DBPath, target.SettingsPath, target.SaltPath}
+	if !slices.Equal(sorted(result.Restored), sorted(restored)) {
+		t.Errorf("Restored = %v, want %v", result.Restored, restored)
+	}
+	if len(result.Previous) != len(old) {
+		t.Errorf("Previous = %v, want an entry for each of %d old files", result.Previous, len(old))
+	}
+	for path, content := range old {
+		kept, ok := result.Previous[path]
+		if !ok {
+			t.Errorf("%s was not kept", path)
+			continue
+		}
+		if !strings.HasPrefix(kept, path+".") || !strings.HasSuffix(kept, ".bak") {
+			t.Errorf("%s was kept as %s", path, kept)
+		}
+		if got := readFile(t, kept); got != content {
+			t.Errorf("%s holds %q, want %q", kept, got, content)
+		}
+	}
+	for _, journal := range []string{target.DBPath + "-journal", target.DBPath + "-wal"} {
+		if _, err := os.Stat(journal); !os.IsNotExist(err) {
+			t.Errorf("%s is still next to the restored database", journal)
+		}
+	}
+
+	if got := readFile(t, target.SettingsPath); got != "new settings" {
+		t.Errorf("settings = %q", got)
+	}
+	if got := readFile(t, target.SaltPath); got != "new salt" {
+		t.Errorf("salt = %q", got)
+	}
+	if err := checkDatabase(target.DBPath); err != nil {
+		t.Fatal(err)
+	}
+	db, err := database.InitDB(target.DBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var name string
+	if err := db.QueryRow("SELECT name FROM categories WHERE id = 'c1'").Scan(&name); err != nil || name != "Backed up" {
+		t.Errorf("restored category = %q, %v", name, err)
+	}
+}
+
+func TestRestoreRejectsBrokenDatabase(t *testing.T) {
+	a := &Archive{files: map[string][]byte{DatabaseFile: []byte("not a database")}}
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "db.sqlite3")
+	writeFile(t, dbPath, "old database")
+
+	if _, err := a.Restore(Target{DBPath: dbPath}); err == nil {
+		t.Fatal("Restore accepted a broken database")
+	}
+	if got := readFile(t, dbPath); got != "old database" {
+		t.Errorf("database was replaced with %q", got)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Restore left %d files behind", len(entries)-1)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	dir := t.TempDir()
+	archives := []string{
+		"notes-20250101-120000.000000000.nbak",
+		"notes-20250101-120000.500000000.nbak",
+		"notes-20250102-080000.000000000.nbak",
+		"notes-20250103-080000.000000000.nbak",
+	}
+	others := []string{"notes.txt", "other-20250101-120000.nbak", "notes-20250101-120000.nbak.tmp"}
+	for _, name := range append(slices.Clone(archives), others...) {
+		writeFile(t, filepath.Join(dir, name), name)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "notes-20240101-000000.000000000.nbak"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := Prune(dir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, archives[0]), filepath.Join(dir, archives[1])}
+	if !slices.Equal(removed, want) {
+		t.Errorf("Prune removed %v, want %v", removed, want)
+	}
+	for _, name := range append(archives[2:], others...) {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	if removed, err := Prune(dir, 2); err != nil || len(removed) != 0 {
+		t.Errorf("second Prune = %v, %v, want nothing removed", removed, err)
+	}
+}
+
+func sorted(s []string) []string {
+	s = slices.Clone(s)
+	slices.Sort(s)
+	return s
+}
@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"personal-notes-with-go/archive"
+	"personal-notes-with-go/config"
+	"personal-notes-with-go/database"
+	"personal-notes-with-go/utils"
+)
+
+// exportArchive writes a full archive of the database to output, a file
+// or - for standard output
+func exportArchive(v *vault, output string) error {
+	version, err := database.SchemaVersion(v.db)
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = stdout
+	var f *os.File
+	if output != "-" {
+		f, err = os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create export file: %w", err)
+		}
+		w = f
+	}
+
+	manifest, err := archive.Write(w, archive.Source{
+		Notes:         v.notes,
+		Checklists:    v.checklists,
+		Categories:    v.categories,
+		ActivityLogs:  v.activityLogs,
+		SchemaVersion: version,
+	})
+	if f != nil {
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	notes := manifest.Files[archive.NotesFile].Records
+	categories := manifest.Files[archive.CategoriesFile].Records
+	logs := manifest.Files[archive.ActivityLogsFile].Records
+	v.logActivity("export", "note", fmt.Sprintf("Exported archive with %d notes, %d categories and %d activity logs from CLI", notes, categories, logs))
+	if output != "-" {
+		fmt.Fprintf(stderr, "Exported %d notes, %d categories and %d activity logs to %s\n", notes, categories, logs, output)
+	}
+	return nil
+}
+
+// importArchive applies an archive written by exportArchive and prints what
+// changed, or with opts.DryRun what would change
+func importArchive(cfg *config.Config, source string, opts archive.Options, asJSON bool) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	f, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	a, err := archive.NewReader(f, info.Size())
+	if err != nil {
+		return err
+	}
+
+	v, err := openVault(cfg)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	report, err := archive.Import(v.db, utils.DefaultCipher(), utils.DefaultBlindIndex(), a, opts)
+	if err != nil {
+		return fmt.Errorf("failed to import archive: %w", err)
+	}
+	if !opts.DryRun {
+		v.logActivity("import", "note", fmt.Sprintf("Imported archive from CLI (%s): %d notes created, %d overwritten, %d skipped", opts.Mode, report.Notes.Created, report.Notes.Overwritten, report.Notes.Skipped))
+	}
+
+	if asJSON {
+		return writeJSON(stdout, report)
+	}
+	printArchiveReport(report)
+	return nil
+}
+
+// printArchiveReport prints the changes of an archive import and a summary
+func printArchiveReport(report *archive.Report) {
+	for _, c := range report.Changes {
+		if c.Action == archive.ActionSkip {
+			continue
+		}
+		line := fmt.Sprintf("%-9s %-8s %s  %s", c.Action, c.Type, c.ID, c.Name)
+		if c.NewID != "" {
+			line += "  -> " + c.NewID
+		}
+		fmt.Fprintln(stdout, line)
+	}
+	for _, w := range report.Warnings {
+		fmt.Fprintf(stdout, "warning   %s\n", w)
+	}
+
+	for _, row := range []struct {
+		name   string
+		counts archive.Counts
+	}{
+		{"Categories", report.Categories},
+		{"Notes", report.Notes},
+		{"Activity logs", report.ActivityLogs},
+	} {
+		fmt.Fprintf(stdout, "%-14s %d created, %d overwritten, %d skipped, %d deleted\n",
+			row.name+":", row.counts.Created, row.counts.Overwritten, row.counts.Skipped, row.counts.Deleted)
+	}
+	if report.DryRun {
+		fmt.Fprintln(stdout, "Dry run: nothing was changed")
+	}
+}
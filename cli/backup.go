@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"personal-notes-with-go/backup"
+	"personal-notes-with-go/config"
+	"personal-notes-with-go/database"
+	"personal-notes-with-go/utils"
+)
+
+// runBackup writes an encrypted archive holding a consistent snapshot of
+// the database and, by default, the key material needed to read it
+func runBackup(args []string) error {
+	fs := newFlagSet("backup")
+	dir := fs.String("dir", "", "directory to write the archive to (default backup_dir from the configuration)")
+	skipKey := fs.Bool("skip-key", false, "leave settings.json and the salt file out; the key must then be restored separately")
+	keep := fs.Int("keep", 0, "delete the oldest archives in the directory so that at most this many remain, 0 to keep all")
+	cfg, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if *dir == "" {
+		*dir = cfg.BackupDir
+	}
+
+	passphrase, err := readSecret(envBackupPassphrase, "Backup passphrase", true)
+	if err != nil {
+		return err
+	}
+	if len(passphrase) < backup.MinPassphraseLength {
+		return fmt.Errorf("backup passphrase must be at least %d characters", backup.MinPassphraseLength)
+	}
+
+	db, err := database.InitDB(cfg.DBPath)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	path, err := backup.Create(context.Background(), backupSource(cfg, db, !*skipKey), *dir, passphrase)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "Backup written to %s\n", path)
+	if *skipKey || cfg.KeyProvider == utils.KeyProviderEnv || cfg.KeyProvider == utils.KeyProviderFile {
+		fmt.Fprintln(stdout, "The encryption key is not in the archive; keep a copy of it to be able to restore")
+	}
+
+	if *keep > 0 {
+		removed, err := backup.Prune(*dir, *keep)
+		if err != nil {
+			return err
+		}
+		for _, path := range removed {
+			fmt.Fprintf(stdout, "Removed old backup %s\n", path)
+		}
+	}
+	return nil
+}
+
+// runRestore checks a backup archive and replaces the database, and the key
+// material when the archive holds it, with its content
+func runRestore(args []string) error {
+	fs := newFlagSet("restore")
+	dryRun := fs.Bool("dry-run", false, "only decrypt and check the archive, do not replace anything")
+	skipKey := fs.Bool("skip-key", false, "restore the database only, keeping the current settings.json and salt file")
+	cfg, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(stderr, "usage: notes restore [flags] <archive>")
+		return errUsage
+	}
+
+	passphrase, err := readSecret(envBackupPassphrase, "Backup passphrase", false)
+	if err != nil {
+		return err
+	}
+	archive, err := backup.Open(fs.Arg(0), passphrase)
+	if err != nil {
+		return err
+	}
+	if err := archive.Verify(); err != nil {
+		return err
+	}
+
+	m := archive.Manifest
+	fmt.Fprintf(stdout, "Backup from %s is valid (key provider %s, cipher %s)\n", m.CreatedAt.Local().Format("2006-01-02 15:04:05"), m.KeyProvider, m.Cipher)
+	for _, f := range m.Files {
+		fmt.Fprintf(stdout, "  %-14s %10d bytes  sha256 %s\n", f.Name, f.Size, f.SHA256)
+	}
+	if m.KeyProvider != cfg.KeyProvider {
+		fmt.Fprintf(stdout, "Note: the backup was made with the %s key provider but %s is configured\n", m.KeyProvider, cfg.KeyProvider)
+	}
+	if *dryRun {
+		return nil
+	}
+
+	target := backup.Target{DBPath: cfg.DBPath}
+	if !*skipKey {
+		target.SettingsPath = cfg.SettingsPath
+		target.SaltPath = cfg.SaltPath()
+	}
+	result, err := archive.Restore(target)
+	if result != nil {
+		for path, old := range result.Previous {
+			fmt.Fprintf(stdout, "Previous %s kept as %s\n", path, old)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("restore failed: %w", err)
+	}
+	for _, path := range result.Restored {
+		fmt.Fprintf(stdout, "Restored %s\n", path)
+	}
+	fmt.Fprintln(stdout, "Run `notes doctor` to check that the key matches the restored data")
+	return nil
+}
+
+// backupSource describes the vault configured in cfg for backup.Create
+func backupSource(cfg *config.Config, db *sql.DB, withKey bool) backup.Source {
+	src := backup.Source{DB: db, KeyProvider: cfg.KeyProvider, Cipher: cfg.Cipher}
+	if withKey {
+		src.SettingsPath = cfg.SettingsPath
+		if cfg.KeyProvider == utils.KeyProviderPassphrase {
+			src.SaltPath = cfg.SaltPath()
+		}
+	}
+	return src
+}
@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// command is a single subcommand of the notes binary
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(args []string) error
+}
+
+// errUsage is returned by commands when they were invoked incorrectly. The
+// usage text has already been printed at that point.
+var errUsage = errors.New("invalid usage")
+
+// stdout and stderr are variables so output can be redirected
+var (
+	stdout io.Writer = os.Stdout
+	stderr io.Writer = os.Stderr
+)
+
+func commands() []command {
+	return []command{
+		{name: "serve", usage: "serve [flags]", summary: "Start the HTTP server and web frontend (default)", run: runServe},
+		{name: "note", usage: "note <add|list|show|checklist|pin|archive|favorite> [flags]", summary: "Manage notes directly in the database", run: runNote},
+		{name: "tui", usage: "tui [flags]", summary: "Browse and edit notes in a full-screen terminal UI", run: runTUI},
+		{name: "remote", usage: "remote <list|show|create|...> [flags]", summary: "Manage notes on a running server over its HTTP API", run: runRemote},
+		{name: "export", usage: "export [flags]", summary: "Export decrypted notes as JSON, Markdown, a static site or a full archive", run: runExport},
+		{name: "import", usage: "import [flags] <file>", summary: "Import notes from an export file or archive, Markdown, Evernote or Google Keep", run: runImport},
+		{name: "backup", usage: "backup [flags]", summary: "Write an encrypted archive of the database and key material", run: runBackup},
+		{name: "restore", usage: "restore [flags] <archive>", summary: "Check a backup archive and restore it", run: runRestore},
+		{name: "rotate-key", usage: "rotate-key [flags]", summary: "Generate a new encryption key and re-encrypt all data", run: runRotateKey},
+		{name: "reindex", usage: "reindex [flags]", summary: "Rebuild the blind indexes used to search encrypted data", run: runReindex},
+		{name: "migrate-cipher", usage: "migrate-cipher [flags]", summary: "Re-encrypt all data with another algorithm", run: runMigrateCipher},
+		{name: "doctor", usage: "doctor [flags]", summary: "Check configuration, encryption key and database health", run: runDoctor},
+	}
+}
+
+// Run executes the subcommand named in args and returns the process exit code.
+// Without a subcommand, or when args start with a flag, the server is started
+// so existing invocations such as `notes -port 9090` keep working.
+func Run(args []string) int {
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage(stdout)
+		return 0
+	}
+
+	for _, cmd := range commands() {
+		if cmd.name != name {
+			continue
+		}
+		if err := cmd.run(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return 0
+			}
+			if !errors.Is(err, errUsage) {
+				fmt.Fprintf(stderr, "notes %s: %v\n", name, err)
+			}
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Fprintf(stderr, "notes: unknown command %q\n\n", name)
+	printUsage(stderr)
+	return 2
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: notes <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %-38s %s\n", cmd.usage, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'notes <command> -h' for the flags of a command.")
+}
+
+// newFlagSet creates a flag set for a subcommand that reports errors
+// instead of exiting the process
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("notes "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	return fs
+}
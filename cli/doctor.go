@@ -0,0 +1,379 @@
+package cli
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"personal-notes-with-go/config"
+	"personal-notes-with-go/database"
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/repositories"
+	"personal-notes-with-go/settings"
+	"personal-notes-with-go/utils"
+	"slices"
+	"strings"
+)
+
+// doctor collects the results of the health checks
+type doctor struct {
+	failures int
+	warnings int
+}
+
+func (d *doctor) ok(format string, args ...interface{}) {
+	fmt.Fprintf(stdout, "[ OK ] "+format+"\n", args...)
+}
+
+func (d *doctor) warn(format string, args ...interface{}) {
+	d.warnings++
+	fmt.Fprintf(stdout, "[WARN] "+format+"\n", args...)
+}
+
+func (d *doctor) fail(format string, args ...interface{}) {
+	d.failures++
+	fmt.Fprintf(stdout, "[FAIL] "+format+"\n", args...)
+}
+
+// runDoctor checks the configuration, the encryption key and the database
+// without modifying anything, and exits non-zero if a check failed
+func runDoctor(args []string) error {
+	fs := newFlagSet("doctor")
+	cfg, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	d := &doctor{}
+	d.ok("configuration is valid")
+	if err := cfg.ValidateServer(); err != nil {
+		d.warn("server configuration: %v", err)
+	} else {
+		d.ok("server configuration is valid (listening on %s)", cfg.Addr())
+	}
+
+	d.checkKey(cfg)
+	d.checkDatabase(cfg.DBPath)
+
+	fmt.Fprintf(stdout, "\n%d failure(s), %d warning(s)\n", d.failures, d.warnings)
+	if d.failures > 0 {
+		return errors.New("health check failed")
+	}
+	return nil
+}
+
+// checkKey verifies that the configured key provider supplies a key that
+// works with the configured cipher
+func (d *doctor) checkKey(cfg *config.Config) {
+	switch cfg.KeyProvider {
+	case utils.KeyProviderSettings:
+		if !d.checkSettings(cfg.SettingsPath) {
+			return
+		}
+	case utils.KeyProviderFile:
+		if !d.checkPermissions("key file", cfg.KeyFile) {
+			return
+		}
+	case utils.KeyProviderPassphrase:
+		// The provider would create a missing salt file
+		if !d.checkPermissions("salt file", cfg.SaltPath()) {
+			return
+		}
+	}
+
+	d.checkBlindIndexKey(cfg.SettingsPath)
+
+	// initEncryption would create a missing blind index key, so the cipher
+	// is set up on its own
+	settings.SetFilePath(cfg.SettingsPath)
+	if err := utils.InitEncryptionWith(keyProvider(cfg), cfg.Cipher); err != nil {
+		d.fail("encryption self-test failed: %v", err)
+		return
+	}
+	d.ok("encryption key from the %s provider is valid (%s)", cfg.KeyProvider, cfg.Cipher)
+}
+
+// checkBlindIndexKey verifies the blind index key in the settings file and
+// sets up the blind index with it
+func (d *doctor) checkBlindIndexKey(path string) {
+	settings.SetFilePath(path)
+	s, err := settings.ReadSettings()
+	if err != nil {
+		d.fail("settings file cannot be read: %v", err)
+		return
+	}
+	if s.BlindIndexKey == "" {
+		d.warn("settings file has no blind index key; one is created on the next start")
+		return
+	}
+	key, err := s.GetBlindIndexKey()
+	if err != nil {
+		d.fail("%v", err)
+		return
+	}
+	if err := utils.InitBlindIndex(key); err != nil {
+		d.fail("%v", err)
+		return
+	}
+	d.ok("blind index key is valid")
+}
+
+// checkPermissions checks that a secret file exists and is only readable by
+// its owner
+func (d *doctor) checkPermissions(label, path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		d.fail("%s %s: %v", label, path, err)
+		return false
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		d.warn("%s %s is accessible by other users (mode %v), run chmod 600", label, path, info.Mode().Perm())
+	} else {
+		d.ok("%s %s has restrictive permissions", label, path)
+	}
+	return true
+}
+
+// checkSettings verifies the settings file and the encryption key in it
+func (d *doctor) checkSettings(path string) bool {
+	if !d.checkPermissions("settings file", path) {
+		return false
+	}
+
+	// LoadSettings would generate a new key when it is missing, which we
+	// must not do from a read-only check, so inspect the file first
+	data, err := os.ReadFile(path)
+	if err != nil {
+		d.fail("settings file cannot be read: %v", err)
+		return false
+	}
+	var s settings.Settings
+	if err := json.Unmarshal(data, &s); err != nil {
+		d.fail("settings file cannot be parsed: %v", err)
+		return false
+	}
+	if s.EncryptionKey == "" {
+		d.fail("settings file has no encryption key")
+		return false
+	}
+	key, err := s.GetEncryptionKey()
+	if err != nil {
+		d.fail("encryption key is not valid base64: %v", err)
+		return false
+	}
+	if len(key) != utils.KeySize {
+		d.fail("encryption key is %d bytes, expected %d", len(key), utils.KeySize)
+		return false
+	}
+	if s.KeyRotationRecommended() {
+		d.warn("encryption key has no key_source: if an older version generated it, it is predictable and `notes rotate-key` replaces it; if you supplied it, set \"key_source\": \"user\" to keep it")
+	}
+	return true
+}
+
+// checkDatabase verifies the database integrity and that its data can be
+// decrypted with the current key
+func (d *doctor) checkDatabase(path string) {
+	if _, err := os.Stat(path); err != nil {
+		d.fail("database %s: %v", path, err)
+		return
+	}
+
+	db, err := database.InitDB(path)
+	if err != nil {
+		d.fail("database cannot be opened: %v", err)
+		return
+	}
+	defer db.Close()
+
+	if version, err := database.SchemaVersion(db); err != nil {
+		d.fail("%v", err)
+	} else {
+		d.ok("database schema is at version %d", version)
+	}
+
+	var integrity string
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&integrity); err != nil {
+		d.fail("integrity check could not run: %v", err)
+	} else if integrity != "ok" {
+		d.fail("integrity check reported: %s", integrity)
+	} else {
+		d.ok("database integrity check passed")
+	}
+
+	var orphans int
+	err = db.QueryRow(`SELECT COUNT(*) FROM notes
+		WHERE category_id IS NOT NULL AND category_id != ''
+		AND category_id NOT IN (SELECT id FROM categories)`).Scan(&orphans)
+	if err != nil {
+		d.fail("orphan check could not run: %v", err)
+	} else if orphans > 0 {
+		d.warn("%d note(s) reference a category that does not exist", orphans)
+	} else {
+		d.ok("all notes reference existing categories")
+	}
+
+	d.checkForeignKeys(db)
+	d.checkCategoryParents(db)
+	d.checkPriorities(db)
+
+	if !utils.IsEncryptionValid() {
+		d.warn("skipping decryption check because the encryption key is not valid")
+		return
+	}
+	d.checkDecryption(db, "categories", "name", "description")
+	d.checkDecryption(db, "notes", "subject", "content", "tags")
+	d.checkDecryption(db, "tags", "name")
+	d.checkDecryption(db, "checklist_items", "text")
+	d.checkBlindIndexes(db)
+}
+
+// checkBlindIndexes verifies that every tag and note has a blind index
+// computed with the current blind index key
+func (d *doctor) checkBlindIndexes(db *sql.DB) {
+	bi := utils.DefaultBlindIndex()
+	if bi == nil {
+		d.warn("skipping blind index check because there is no valid blind index key")
+		return
+	}
+	unindexed, current, err := repositories.CountUnindexed(db, bi)
+	switch {
+	case err != nil:
+		d.fail("blind index check could not run: %v", err)
+	case !current:
+		d.warn("blind indexes were computed with another key, so searches miss notes; they are rebuilt on the next start or with `notes reindex`")
+	case unindexed > 0:
+		d.warn("%d row(s) have no blind index; they are indexed on the next start or with `notes reindex`", unindexed)
+	default:
+		d.ok("all tags and notes have blind indexes")
+	}
+}
+
+// checkForeignKeys lists the rows that refer to a missing row, which
+// foreign key enforcement keeps from being written
+func (d *doctor) checkForeignKeys(db *sql.DB) {
+	rows, err := db.Query("PRAGMA foreign_key_check")
+	if err != nil {
+		d.fail("foreign key check could not run: %v", err)
+		return
+	}
+	defer rows.Close()
+	violations := make(map[string]int)
+	for rows.Next() {
+		var table, parent string
+		var rowid, fkid sql.NullInt64
+		if err := rows.Scan(&table, &rowid, &parent, &fkid); err != nil {
+			d.fail("foreign key check could not run: %v", err)
+			return
+		}
+		violations[table+" → "+parent]++
+	}
+	if err := rows.Err(); err != nil {
+		d.fail("foreign key check could not run: %v", err)
+		return
+	}
+	if len(violations) == 0 {
+		d.ok("foreign key check passed")
+		return
+	}
+	for _, refs := range slices.Sorted(maps.Keys(violations)) {
+		d.warn("%d row(s) in %s refer to a missing row", violations[refs], refs)
+	}
+}
+
+// checkCategoryParents verifies that every parent category exists and that
+// no category is its own ancestor
+func (d *doctor) checkCategoryParents(db *sql.DB) {
+	rows, err := db.Query("SELECT id, COALESCE(parent_id, '') FROM categories")
+	if err != nil {
+		d.fail("category parent check could not run: %v", err)
+		return
+	}
+	defer rows.Close()
+	parents := make(map[string]string)
+	for rows.Next() {
+		var id, parentID string
+		if err := rows.Scan(&id, &parentID); err != nil {
+			d.fail("category parent check could not run: %v", err)
+			return
+		}
+		parents[id] = parentID
+	}
+	if err := rows.Err(); err != nil {
+		d.fail("category parent check could not run: %v", err)
+		return
+	}
+
+	missing, cyclic := 0, 0
+	for id, parentID := range parents {
+		if _, ok := parents[parentID]; parentID != "" && !ok {
+			missing++
+			continue
+		}
+		for steps, ancestor := 0, parentID; ancestor != "" && steps < len(parents); steps++ {
+			if ancestor == id {
+				cyclic++
+				break
+			}
+			ancestor = parents[ancestor]
+		}
+	}
+	switch {
+	case missing > 0 || cyclic > 0:
+		d.warn("categories with a missing parent: %d, categories that are their own ancestor: %d; they are shown as top-level categories", missing, cyclic)
+	default:
+		d.ok("all categories have valid parents")
+	}
+}
+
+// checkPriorities verifies that every note has one of the configured
+// priority levels
+func (d *doctor) checkPriorities(db *sql.DB) {
+	names := models.CurrentPriorities().Names()
+	args := make([]any, len(names))
+	for i, name := range names {
+		args[i] = name
+	}
+	var unknown int
+	err := db.QueryRow("SELECT COUNT(*) FROM notes WHERE priority NOT IN (?"+strings.Repeat(", ?", len(names)-1)+")", args...).Scan(&unknown)
+	if err != nil {
+		d.fail("priority check could not run: %v", err)
+	} else if unknown > 0 {
+		d.warn("%d note(s) have a priority that is not one of %s; they sort below every level", unknown, strings.Join(names, ", "))
+	} else {
+		d.ok("all notes have a configured priority")
+	}
+}
+
+// checkDecryption tries to decrypt the given columns of every row in table
+func (d *doctor) checkDecryption(db *sql.DB, table string, columns ...string) {
+	total, failed := 0, 0
+	for _, column := range columns {
+		rows, err := db.Query("SELECT COALESCE(" + column + ", '') FROM " + table)
+		if err != nil {
+			d.fail("failed to read %s.%s: %v", table, column, err)
+			return
+		}
+		for rows.Next() {
+			var value string
+			if err := rows.Scan(&value); err != nil {
+				rows.Close()
+				d.fail("failed to read %s.%s: %v", table, column, err)
+				return
+			}
+			total++
+			if _, err := utils.Decrypt(value); err != nil {
+				failed++
+			}
+		}
+		rows.Close()
+	}
+
+	if failed > 0 {
+		d.fail("%d of %d encrypted values in %s cannot be decrypted with the current key", failed, total, table)
+	} else {
+		d.ok("all %d encrypted values in %s decrypt correctly", total, table)
+	}
+}
@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// editorCommand returns the user's preferred editor
+func editorCommand() string {
+	if editor := os.Getenv("VISUAL"); editor != "" {
+		return editor
+	}
+	if editor := os.Getenv("EDITOR"); editor != "" {
+		return editor
+	}
+	if runtime.GOOS == "windows" {
+		return "notepad"
+	}
+	return "vi"
+}
+
+// editText opens initial in the user's editor and returns the saved text.
+// The temporary file is only readable by the current user and is removed
+// afterwards, since it holds decrypted note content.
+func editText(initial string) (string, error) {
+	f, err := os.CreateTemp("", "note-*.md")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	path := f.Name()
+	defer os.Remove(path)
+
+	if _, err := f.WriteString(initial); err != nil {
+		f.Close()
+		return "", fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("failed to write temporary file: %w", err)
+	}
+
+	// The editor setting may contain arguments, e.g. "code --wait"
+	parts := strings.Fields(editorCommand())
+	cmd := exec.Command(parts[0], append(parts[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor failed: %w", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read temporary file: %w", err)
+	}
+	return string(data), nil
+}
+
+// editNoteText lets the user edit a subject and content in their editor.
+// The first line of the file is the subject and the rest is the content,
+// like a git commit message.
+func editNoteText(subject, content string) (string, string, error) {
+	text, err := editText(subject + "\n\n" + content)
+	if err != nil {
+		return "", "", err
+	}
+	return splitNoteText(text)
+}
+
+// splitNoteText splits editor text into a subject and content
+func splitNoteText(text string) (string, string, error) {
+	text = strings.TrimLeft(text, "\r\n")
+	subject, content, _ := strings.Cut(text, "\n")
+	subject = strings.TrimSpace(subject)
+	if subject == "" {
+		return "", "", fmt.Errorf("aborting: the first line (subject) is empty")
+	}
+	return subject, strings.Trim(content, "\r\n"), nil
+}
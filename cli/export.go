@@ -0,0 +1,262 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"personal-notes-with-go/archive"
+	"personal-notes-with-go/exporter"
+	"personal-notes-with-go/models"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// exportFile is the JSON document written by `notes export` and read by
+// `notes import`. All fields are decrypted.
+type exportFile struct {
+	ExportedAt time.Time         `json:"exported_at"`
+	Categories []models.Category `json:"categories"`
+	Notes      []*models.Note    `json:"notes"`
+}
+
+// runExport writes all categories and notes as decrypted JSON or, with
+// -format markdown, as Markdown files. -format archive writes a full
+// archive, including activity logs, for moving to another server, and
+// -format site renders the notes of selected categories as a static site.
+func runExport(args []string) error {
+	fs := newFlagSet("export")
+	output := fs.String("o", "-", "file to write the export to, - for standard output; for markdown and site a directory, or a .zip file")
+	format := fs.String("format", "json", "export format: json, markdown, archive or site")
+	title := fs.String("title", "", "site only: title of the site (default: the category name)")
+	var siteCategories []string
+	fs.Func("category", "site only: category to publish, by ID, path or name; repeat for several", func(s string) error {
+		siteCategories = append(siteCategories, s)
+		return nil
+	})
+	cfg, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if *format != "json" && *format != "markdown" && *format != "archive" && *format != "site" {
+		return fmt.Errorf("unknown export format %q, expected json, markdown, archive or site", *format)
+	}
+
+	v, err := openVault(cfg)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	switch *format {
+	case "markdown":
+		return exportMarkdown(v, *output)
+	case "archive":
+		return exportArchive(v, *output)
+	case "site":
+		return exportSite(v, *output, *title, siteCategories)
+	}
+
+	categories, err := v.categories.GetAll()
+	if err != nil {
+		return err
+	}
+	notes, err := v.notes.GetAll()
+	if err != nil {
+		return err
+	}
+
+	export := exportFile{
+		ExportedAt: time.Now().UTC(),
+		Categories: categories,
+		Notes:      notes,
+	}
+
+	var w io.Writer = stdout
+	if *output != "-" {
+		f, err := os.OpenFile(*output, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create export file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := writeJSON(w, export); err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	v.logActivity("export", "note", fmt.Sprintf("Exported %d notes and %d categories from CLI", len(notes), len(categories)))
+
+	if *output != "-" {
+		fmt.Fprintf(stderr, "Exported %d notes and %d categories to %s\n", len(notes), len(categories), *output)
+	}
+	return nil
+}
+
+// exportMarkdown writes every note as a Markdown file to output, which is
+// a directory unless it ends in .zip or is - for a zip on standard output
+func exportMarkdown(v *vault, output string) error {
+	files, err := exporter.MarkdownFiles(v.notes, v.categories)
+	if err != nil {
+		return err
+	}
+	if err := writeFiles(output, files); err != nil {
+		return err
+	}
+
+	v.logActivity("export", "note", fmt.Sprintf("Exported %d notes as Markdown from CLI", len(files)))
+	if output != "-" {
+		fmt.Fprintf(stderr, "Exported %d notes as Markdown to %s\n", len(files), output)
+	}
+	return nil
+}
+
+// exportSite writes the notes of the given categories, referenced by ID or
+// name, as a static HTML site to output, like exportMarkdown
+func exportSite(v *vault, output, title string, refs []string) error {
+	if len(refs) == 0 {
+		return fmt.Errorf("a static site needs at least one -category")
+	}
+	opts := exporter.SiteOptions{Title: title}
+	notes := 0
+	for _, ref := range refs {
+		category, err := v.findCategory(ref)
+		if err != nil {
+			return fmt.Errorf("category %q: %w", ref, err)
+		}
+		opts.CategoryIDs = append(opts.CategoryIDs, category.ID)
+		if categoryNotes, err := v.notes.GetByCategoryID(category.ID); err == nil {
+			notes += len(categoryNotes)
+		}
+	}
+
+	files, err := exporter.SiteFiles(v.notes, v.categories, opts)
+	if err != nil {
+		return err
+	}
+	if err := writeFiles(output, files); err != nil {
+		return err
+	}
+
+	v.logActivity("export", "note", fmt.Sprintf("Exported %d notes as a static site from CLI", notes))
+	if output != "-" {
+		fmt.Fprintf(stderr, "Exported %d notes as a static site to %s\n", notes, output)
+	}
+	return nil
+}
+
+// writeFiles writes files to output, which is a directory unless it ends
+// in .zip or is - for a zip on standard output
+func writeFiles(output string, files []exporter.File) error {
+	var err error
+	switch {
+	case output == "-":
+		err = exporter.WriteZip(stdout, files)
+	case strings.HasSuffix(strings.ToLower(output), ".zip"):
+		var f *os.File
+		f, err = os.OpenFile(output, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create export file: %w", err)
+		}
+		err = exporter.WriteZip(f, files)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	default:
+		err = exporter.WriteDir(output, files)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	return nil
+}
+
+// runImport reads a file produced by `notes export` and adds its contents to
+// the database. Categories are matched by name so importing into a database
+// that already has them does not create duplicates. Other formats import
+// the notes of other applications: a folder or zip of Markdown files, such
+// as an Obsidian vault, Evernote .enex exports or a Google Keep Takeout.
+// -format archive applies an archive written by `notes export -format
+// archive`, keeping IDs and timestamps.
+func runImport(args []string) error {
+	fs := newFlagSet("import")
+	format := fs.String("format", "json", "import format: json, markdown, enex, keep or archive")
+	category := fs.String("category", "", "category for Evernote and Keep notes (default: the .enex file name, none for Keep)")
+	mode := fs.String("mode", archive.ModeMerge, "archive only: merge into the existing data, or replace it")
+	onConflict := fs.String("on-conflict", archive.ConflictSkip, "archive only: what to do with IDs that already exist: skip, overwrite or new-id")
+	dryRun := fs.Bool("dry-run", false, "archive only: report what would change without changing anything")
+	asJSON := fs.Bool("json", false, "print the report as JSON (not for json)")
+	cfg, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(stderr, "Usage: notes import [flags] <file>")
+		return errUsage
+	}
+	if *format == "archive" {
+		return importArchive(cfg, fs.Arg(0), archive.Options{Mode: *mode, OnConflict: *onConflict, DryRun: *dryRun}, *asJSON)
+	}
+	if _, ok := importFormats[*format]; ok {
+		return importNotes(cfg, *format, fs.Arg(0), *category, *asJSON)
+	}
+	if *format != "json" {
+		return fmt.Errorf("unknown import format %q, expected json, markdown, enex, keep or archive", *format)
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("failed to read import file: %w", err)
+	}
+	var export exportFile
+	if err := json.Unmarshal(data, &export); err != nil {
+		return fmt.Errorf("failed to parse import file: %w", err)
+	}
+
+	v, err := openVault(cfg)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	existing, err := v.categories.GetAll()
+	if err != nil {
+		return err
+	}
+	byName := make(map[string]string, len(existing))
+	for _, cat := range existing {
+		byName[strings.ToLower(cat.Name)] = cat.ID
+	}
+
+	// Map category IDs from the export file to IDs in this database
+	categoryIDs := make(map[string]string, len(export.Categories))
+	createdCategories := 0
+	for _, cat := range export.Categories {
+		if id, ok := byName[strings.ToLower(cat.Name)]; ok {
+			categoryIDs[cat.ID] = id
+			continue
+		}
+		newCat := models.Category{Name: cat.Name}
+		if err := v.categories.Create(&newCat); err != nil {
+			return fmt.Errorf("failed to import category %q: %w", cat.Name, err)
+		}
+		byName[strings.ToLower(cat.Name)] = newCat.ID
+		categoryIDs[cat.ID] = newCat.ID
+		createdCategories++
+	}
+
+	// Notes get new IDs but keep their timestamps and states
+	for _, note := range export.Notes {
+		note.ID = uuid.New().String()
+		note.CategoryID = categoryIDs[note.CategoryID]
+		if err := v.notes.Insert(note); err != nil {
+			return fmt.Errorf("failed to import note: %w", err)
+		}
+	}
+
+	v.logActivity("import", "note", fmt.Sprintf("Imported %d notes and %d categories from CLI", len(export.Notes), createdCategories))
+	fmt.Fprintf(stdout, "Imported %d notes and %d new categories\n", len(export.Notes), createdCategories)
+	return nil
+}
@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"personal-notes-with-go/config"
+	"personal-notes-with-go/importer"
+	"strings"
+)
+
+// importFormats names the formats of importNotes in activity logs
+var importFormats = map[string]string{
+	"markdown": "Markdown",
+	"enex":     "Evernote",
+	"keep":     "Google Keep",
+}
+
+// importNotes imports the notes of another application and prints a report
+// per note. Markdown and Keep sources are a folder or zip archive; Evernote
+// sources are an .enex file or a folder of them. category sets the
+// category of Evernote and Keep notes; Evernote notes default to the name
+// of their .enex file, which is the notebook they were exported from.
+func importNotes(cfg *config.Config, format, source, category string, asJSON bool) error {
+	var run func(im *importer.Importer) error
+	switch format {
+	case "markdown", "keep":
+		fsys, closeFS, err := openImportFS(source)
+		if err != nil {
+			return err
+		}
+		defer closeFS()
+		if format == "markdown" {
+			run = func(im *importer.Importer) error { return im.Markdown(fsys) }
+		} else {
+			run = func(im *importer.Importer) error { return im.Keep(fsys, category) }
+		}
+	case "enex":
+		files, err := enexFiles(source)
+		if err != nil {
+			return err
+		}
+		run = func(im *importer.Importer) error {
+			for _, file := range files {
+				if err := importENEX(im, file, category); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	default:
+		return fmt.Errorf("unknown import format %q", format)
+	}
+
+	v, err := openVault(cfg)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	im, err := importer.New(v.notes, v.categories)
+	if err != nil {
+		return err
+	}
+	if err := run(im); err != nil {
+		return fmt.Errorf("failed to read %s: %w", source, err)
+	}
+	report := im.Report()
+	v.logActivity("import", "note", fmt.Sprintf("Imported %d %s notes from CLI (%d skipped, %d failed)", report.Imported, importFormats[format], report.Skipped, report.Failed))
+
+	if asJSON {
+		return writeJSON(stdout, report)
+	}
+	printImportReport(report)
+	return nil
+}
+
+// openImportFS opens a folder or a .zip file as a file system
+func openImportFS(source string) (fs.FS, func() error, error) {
+	if strings.HasSuffix(strings.ToLower(source), ".zip") {
+		zr, err := zip.OpenReader(source)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open zip archive: %w", err)
+		}
+		return zr, zr.Close, nil
+	}
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !info.IsDir() {
+		return nil, nil, fmt.Errorf("%s is not a directory or .zip file", source)
+	}
+	return os.DirFS(source), func() error { return nil }, nil
+}
+
+// enexFiles returns source when it is a file, or the .enex files in it when
+// it is a folder
+func enexFiles(source string) ([]string, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{source}, nil
+	}
+	files, err := filepath.Glob(filepath.Join(source, "*.enex"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .enex files in %s", source)
+	}
+	return files, nil
+}
+
+// importENEX imports one .enex file, streaming it from disk
+func importENEX(im *importer.Importer, file, category string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	name := filepath.Base(file)
+	if category == "" {
+		category = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	if err := im.ENEX(f, name, category); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// printImportReport prints one line per file that was not imported cleanly
+// and a summary
+func printImportReport(report *importer.Report) {
+	for _, f := range report.Files {
+		switch {
+		case f.Status != importer.StatusImported:
+			fmt.Fprintf(stdout, "%-8s %s: %s\n", f.Status, f.Source, f.Message)
+		case len(f.Warnings) > 0:
+			fmt.Fprintf(stdout, "%-8s %s: %s\n", "warning", f.Source, strings.Join(f.Warnings, "; "))
+		}
+	}
+	for _, name := range report.CategoriesCreated {
+		fmt.Fprintf(stdout, "Created category %s\n", name)
+	}
+	fmt.Fprintf(stdout, "Imported %d notes, skipped %d, failed %d\n", report.Imported, report.Skipped, report.Failed)
+}
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"fmt"
+	"personal-notes-with-go/database"
+	"personal-notes-with-go/utils"
+)
+
+// runMigrateCipher re-encrypts every encrypted value that does not use the
+// target algorithm yet. Values record their algorithm, so the data stays
+// readable during and after the migration whichever cipher is configured;
+// the configured cipher only decides what new values are written with.
+func runMigrateCipher(args []string) error {
+	fs := newFlagSet("migrate-cipher")
+	to := fs.String("to", utils.CipherXChaCha20Poly1305, "algorithm to re-encrypt the data with: aes-256-gcm or xchacha20-poly1305")
+	cfg, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	v, err := openVault(cfg)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	target, err := utils.CipherForAlgorithm(*to)
+	if err != nil {
+		return err
+	}
+
+	converted, unchanged := 0, 0
+	rows, err := database.ReencryptAll(v.db, func(value string) (string, error) {
+		if value == "" {
+			return value, nil
+		}
+		if utils.AlgorithmOf(value) == *to {
+			unchanged++
+			return value, nil
+		}
+		converted++
+		return utils.Reencrypt(value, target)
+	})
+	if err != nil {
+		return fmt.Errorf("migration failed, nothing was changed: %w", err)
+	}
+
+	v.logActivity("migrate", "encryption", fmt.Sprintf("Re-encrypted %d values with %s", converted, *to))
+	fmt.Fprintf(stdout, "Re-encrypted %d values with %s (%d already used it, %d rows checked)\n", converted, *to, unchanged, rows)
+	if cfg.Cipher != *to {
+		fmt.Fprintf(stdout, "New data is still written with %s; set cipher to %s in the configuration to use it for new data as well\n", cfg.Cipher, *to)
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package cli
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/repositories"
+	"personal-notes-with-go/utils"
+)
+
+// runCLI runs the notes command with args and returns what it printed,
+// failing the test when it does not succeed
+func runCLI(t *testing.T, args ...string) string {
+	t.Helper()
+	out, code := runCLICode(args...)
+	if code != 0 {
+		t.Fatalf("notes %s exited with %d:\n%s", strings.Join(args, " "), code, out)
+	}
+	return out
+}
+
+func runCLICode(args ...string) (string, int) {
+	var out bytes.Buffer
+	oldStdout, oldStderr := stdout, stderr
+	stdout, stderr = &out, &out
+	defer func() { stdout, stderr = oldStdout, oldStderr }()
+	code := Run(args)
+	return out.String(), code
+}
+
+// encryptedValues returns every non-empty encrypted value in the database,
+// keyed by table, column and row ID
+func encryptedValues(t *testing.T, dbPath string) map[string]string {
+	t.Helper()
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	values := map[string]string{}
+	for table, columns := range map[string][]string{
+		"notes":           {"subject", "content", "tags"},
+		"tags":            {"name"},
+		"checklist_items": {"text"},
+		"categories":      {"name", "description"},
+	} {
+		for _, column := range columns {
+			rows, err := db.Query("SELECT id, COALESCE(" + column + ", '') FROM " + table)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for rows.Next() {
+				var id, value string
+				if err := rows.Scan(&id, &value); err != nil {
+					t.Fatal(err)
+				}
+				if value != "" {
+					values[table+"."+column+"."+id] = value
+				}
+			}
+			rows.Close()
+		}
+	}
+	return values
+}
+
+// listedNotes returns the subject, content and tags of every note as
+// listed by the CLI, sorted
+func listedNotes(t *testing.T, args ...string) []string {
+	t.Helper()
+	var notes []models.Note
+	out := runCLI(t, append([]string{"note", "list", "-json"}, args...)...)
+	if err := json.Unmarshal([]byte(out), &notes); err != nil {
+		t.Fatalf("note list -json: %v\n%s", err, out)
+	}
+	var listed []string
+	for _, note := range notes {
+		listed = append(listed, note.Subject+"|"+note.Content+"|"+note.Tags)
+	}
+	slices.Sort(listed)
+	return listed
+}
+
+// openCategories opens the categories of the database in dir, encrypted
+// with the key of its settings file and the cipher name
+func openCategories(t *testing.T, dir, name string) (*sql.DB, repositories.CategoryRepositoryInterface) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(dir, "settings.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s struct {
+		EncryptionKey string `json:"encryption_key"`
+	}
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatal(err)
+	}
+	key, err := base64.StdEncoding.DecodeString(s.EncryptionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := utils.NewCipher(name, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "db.sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, repositories.NewEncryptedCategoryRepository(repositories.NewCategoryRepository(db), c)
+}
+
+// addCategory stores a category encrypted with the cipher name and
+// returns its ID
+func addCategory(t *testing.T, dir, name string, category models.Category) string {
+	t.Helper()
+	db, categories := openCategories(t, dir, name)
+	defer db.Close()
+	if err := categories.Create(&category); err != nil {
+		t.Fatal(err)
+	}
+	return category.ID
+}
+
+// listedCategories returns the name and description of every category as
+// read with the cipher name, sorted
+func listedCategories(t *testing.T, dir, name string) []string {
+	t.Helper()
+	db, categories := openCategories(t, dir, name)
+	defer db.Close()
+	all, err := categories.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var listed []string
+	for _, category := range all {
+		listed = append(listed, category.Name+"|"+category.Description)
+	}
+	slices.Sort(listed)
+	return listed
+}
+
+func TestMigrateCipher(t *testing.T) {
+	dir := t.TempDir()
+	common := []string{"-db", filepath.Join(dir, "db.sqlite3"), "-settings", filepath.Join(dir, "settings.json")}
+	withCipher := func(name string, args ...string) []string {
+		return append(append(args, common...), "-cipher", name)
+	}
+
+	// Notes and categories written with both algorithms, as after the
+	// configured cipher was changed
+	runCLI(t, withCipher(utils.CipherAESGCM, "note", "add", "-subject", "Belanja", "-content", "Susu, roti", "-tags", "rumah", "-item", "Susu", "-item", "Roti")...)
+	home := addCategory(t, dir, utils.CipherAESGCM, models.Category{Name: "Rumah", Description: "Urusan rumah"})
+	work := addCategory(t, dir, utils.CipherXChaCha20Poly1305, models.Category{Name: "Kerja", Description: "Kantor"})
+	runCLI(t, withCipher(utils.CipherXChaCha20Poly1305, "note", "add", "-subject", "Rapat", "-content", "Agenda", "-tags", "kerja, rumah", "-item", "Slide", "-category", work)...)
+	runCLI(t, withCipher(utils.CipherAESGCM, "note", "add", "-subject", "Cucian", "-category", home)...)
+	before := encryptedValues(t, filepath.Join(dir, "db.sqlite3"))
+	for _, table := range []string{"notes", "categories"} {
+		found := map[string]bool{}
+		for key, value := range before {
+			if strings.HasPrefix(key, table+".") {
+				found[utils.AlgorithmOf(value)] = true
+			}
+		}
+		if len(found) != 2 {
+			t.Fatalf("expected %s of both algorithms before migrating, got %v", table, found)
+		}
+	}
+	want := listedNotes(t, withCipher(utils.CipherAESGCM)...)
+	wantCategories := []string{"Kerja|Kantor", "Rumah|Urusan rumah"}
+	if got := listedCategories(t, dir, utils.CipherAESGCM); !slices.Equal(got, wantCategories) {
+		t.Fatalf("categories before migrating are %q, want %q", got, wantCategories)
+	}
+
+	out := runCLI(t, withCipher(utils.CipherAESGCM, "migrate-cipher", "-to", utils.CipherXChaCha20Poly1305)...)
+	if !strings.Contains(out, "Re-encrypted") {
+		t.Errorf("unexpected output: %s", out)
+	}
+	after := encryptedValues(t, filepath.Join(dir, "db.sqlite3"))
+	if len(after) != len(before) {
+		t.Errorf("got %d encrypted values after migrating, want %d", len(after), len(before))
+	}
+	for key, value := range after {
+		if utils.AlgorithmOf(value) != utils.CipherXChaCha20Poly1305 {
+			t.Errorf("%s is still %s after migrating", key, utils.AlgorithmOf(value))
+		}
+		if before[key] == value && utils.AlgorithmOf(before[key]) != utils.CipherXChaCha20Poly1305 {
+			t.Errorf("%s was not re-encrypted", key)
+		}
+	}
+
+	// Either configured cipher reads the migrated data
+	for _, name := range []string{utils.CipherAESGCM, utils.CipherXChaCha20Poly1305} {
+		if got := listedNotes(t, withCipher(name)...); !slices.Equal(got, want) {
+			t.Errorf("with %s configured the notes are %q, want %q", name, got, want)
+		}
+		if got := listedCategories(t, dir, name); !slices.Equal(got, wantCategories) {
+			t.Errorf("with %s configured the categories are %q, want %q", name, got, wantCategories)
+		}
+	}
+
+	// Migrating again leaves every value as it is
+	runCLI(t, withCipher(utils.CipherXChaCha20Poly1305, "migrate-cipher", "-to", utils.CipherXChaCha20Poly1305)...)
+	for key, value := range encryptedValues(t, filepath.Join(dir, "db.sqlite3")) {
+		if after[key] != value {
+			t.Errorf("%s changed when migrating to the algorithm it already used", key)
+		}
+	}
+}
+
+func TestMigrateCipherRejectsWrongKey(t *testing.T) {
+	dir := t.TempDir()
+	common := []string{"-db", filepath.Join(dir, "db.sqlite3"), "-settings", filepath.Join(dir, "settings.json")}
+	runCLI(t, append([]string{"note", "add", "-subject", "Belanja", "-content", "Susu", "-tags", "rumah", "-item", "Roti"}, common...)...)
+	before := encryptedValues(t, filepath.Join(dir, "db.sqlite3"))
+
+	keyFile := filepath.Join(dir, "wrong.key")
+	wrongKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, utils.KeySize))
+	if err := os.WriteFile(keyFile, []byte(wrongKey), 0600); err != nil {
+		t.Fatal(err)
+	}
+	args := append([]string{"migrate-cipher", "-to", utils.CipherXChaCha20Poly1305, "-key-provider", utils.KeyProviderFile, "-key-file", keyFile}, common...)
+	out, code := runCLICode(args...)
+	if code == 0 {
+		t.Fatalf("migrate-cipher with the wrong key succeeded:\n%s", out)
+	}
+	if !strings.Contains(out, "nothing was changed") {
+		t.Errorf("unexpected output: %s", out)
+	}
+
+	after := encryptedValues(t, filepath.Join(dir, "db.sqlite3"))
+	if len(after) != len(before) {
+		t.Errorf("got %d encrypted values after the failed migration, want %d", len(after), len(before))
+	}
+	for key, value := range before {
+		if after[key] != value {
+			t.Errorf("%s changed although the migration failed", key)
+		}
+	}
+}
@@ -0,0 +1,505 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/utils"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// runNote dispatches the note subcommands
+func runNote(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, "Usage: notes note <add|list|show|checklist|pin|archive|favorite> [flags]")
+		return errUsage
+	}
+
+	switch args[0] {
+	case "add":
+		return runNoteAdd(args[1:])
+	case "list":
+		return runNoteList(args[1:])
+	case "show":
+		return runNoteShow(args[1:])
+	case "checklist":
+		return runNoteChecklist(args[1:])
+	case "pin":
+		return runNoteState(models.NotePinned, "pin", "unpin", "Pinned note", "Unpinned note", args[1:])
+	case "archive":
+		return runNoteState(models.NoteArchived, "archive", "unarchive", "Archived note", "Unarchived note", args[1:])
+	case "favorite":
+		return runNoteState(models.NoteFavorite, "favorite", "unfavorite", "Added note to favorites", "Removed note from favorites", args[1:])
+	default:
+		fmt.Fprintf(stderr, "notes note: unknown subcommand %q\n", args[0])
+		return errUsage
+	}
+}
+
+// runNoteAdd creates a note. The content is read from -content, from the file
+// given with -file, or from standard input when -file is "-". Each -item
+// adds a line to the checklist of the note.
+func runNoteAdd(args []string) error {
+	fs := newFlagSet("note add")
+	subject := fs.String("subject", "", "subject of the note (required)")
+	content := fs.String("content", "", "content of the note")
+	file := fs.String("file", "", "read the content from a file, - for standard input")
+	priority := fs.String("priority", "", "priority of the note, the configured default when empty")
+	tags := fs.String("tags", "", "comma-separated tags")
+	category := fs.String("category", "", "category ID, path or name")
+	var dueAt, remindAt *time.Time
+	fs.Func("due", "when the note is due, as YYYY-MM-DD, YYYY-MM-DD HH:MM or RFC 3339", noteTimeFlag(&dueAt))
+	fs.Func("remind", "when to be reminded of the note, in the same formats as -due", noteTimeFlag(&remindAt))
+	recur := fs.String("recur", "", "recurrence rule: daily, weekly, monthly or an RRULE such as FREQ=WEEKLY;BYDAY=MO,TH")
+	recurMode := fs.String("recur-mode", models.RecurrenceReset, "what happens when the note recurs: reset unchecks its checklist, clone copies it")
+	var recurAt *time.Time
+	fs.Func("recur-at", "when the note first recurs, in the same formats as -due; its due time or now when not given", noteTimeFlag(&recurAt))
+	var items []string
+	fs.Func("item", "add a checklist item; repeat to add several", func(s string) error {
+		items = append(items, s)
+		return nil
+	})
+	cfg, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(*subject) == "" {
+		return utils.ErrNoteSubjectEmpty
+	}
+	if *priority, err = models.CurrentPriorities().Normalize(*priority); err != nil {
+		return err
+	}
+
+	if *file != "" {
+		var data []byte
+		if *file == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(*file)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read content: %w", err)
+		}
+		*content = string(data)
+	}
+
+	v, err := openVault(cfg)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	note := &models.Note{
+		Subject:  *subject,
+		Content:  *content,
+		Priority: *priority,
+		Tags:     *tags,
+		DueAt:    dueAt,
+		RemindAt: remindAt,
+
+		Recurrence:     *recur,
+		RecurrenceMode: *recurMode,
+		RecurAt:        recurAt,
+	}
+	if err := models.NormalizeRecurrence(note, time.Now()); err != nil {
+		return err
+	}
+	if *category != "" {
+		cat, err := v.findCategory(*category)
+		if err != nil {
+			return fmt.Errorf("category %q: %w", *category, err)
+		}
+		note.CategoryID = cat.ID
+	}
+
+	if err := v.notes.Create(note); err != nil {
+		return err
+	}
+	for _, text := range items {
+		if err := v.checklists.Create(&models.ChecklistItem{NoteID: note.ID, Text: text}); err != nil {
+			return err
+		}
+	}
+	v.logActivity("create", "note", "Created note from CLI: "+*subject)
+
+	fmt.Fprintln(stdout, note.ID)
+	return nil
+}
+
+// runNoteList prints the notes, optionally filtered by category and tags,
+// with the pinned notes first
+func runNoteList(args []string) error {
+	fs := newFlagSet("note list")
+	category := fs.String("category", "", "only list notes of this category ID, path or name")
+	var filter models.NoteFilter
+	fs.BoolVar(&filter.IncludeSubcategories, "recursive", false, "with -category, also list the notes of its subcategories")
+	fs.BoolVar(&filter.Trashed, "trashed", false, "list the notes in the trash instead")
+	fs.BoolVar(&filter.IncludeArchived, "include-archived", false, "also list archived notes")
+	fs.BoolVar(&filter.Favorites, "favorites", false, "only list favorite notes")
+	fs.Func("due-before", "only list notes due before this time, as YYYY-MM-DD, YYYY-MM-DD HH:MM or RFC 3339", noteTimeFlag(&filter.DueBefore))
+	fs.Func("tag", "only list notes with this tag; repeat to require several", func(s string) error {
+		filter.Tags = append(filter.Tags, s)
+		return nil
+	})
+	fs.Func("priority", "only list notes with this priority; repeat to accept several", func(s string) error {
+		filter.Priorities = append(filter.Priorities, s)
+		return nil
+	})
+	fs.StringVar(&filter.Subject, "subject", "", "only list notes with exactly this subject, ignoring case")
+	search := fs.String("search", "", "only list notes whose subject or content contains all of these words")
+	byPriority := fs.Bool("by-priority", false, "list the notes with the highest priority first")
+	limit := fs.Int("limit", 0, "maximum number of notes to list, 0 for all")
+	asJSON := fs.Bool("json", false, "print the notes as JSON")
+	cfg, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	filter.Words = utils.SplitWords(*search)
+	// Levels are only known once the configuration is loaded
+	for i, priority := range filter.Priorities {
+		if filter.Priorities[i], err = models.CurrentPriorities().Normalize(priority); err != nil {
+			return err
+		}
+	}
+
+	v, err := openVault(cfg)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	if *category != "" {
+		cat, err := v.findCategory(*category)
+		if err != nil {
+			return fmt.Errorf("category %q: %w", *category, err)
+		}
+		filter.CategoryID = cat.ID
+	}
+	notes, err := v.notes.GetFiltered(filter)
+	if err != nil {
+		return err
+	}
+	if *byPriority {
+		models.CurrentPriorities().SortNotes(notes, false)
+	}
+	models.SortPinnedFirst(notes)
+
+	if *limit > 0 && len(notes) > *limit {
+		notes = notes[:*limit]
+	}
+
+	if *asJSON {
+		return writeJSON(stdout, notes)
+	}
+
+	categoryNames, err := v.categoryNames()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tPRIORITY\tDUE\tCHECKLIST\tCATEGORY\tSUBJECT")
+	for _, note := range notes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", note.ID, note.Priority, formatNoteTime(note.DueAt), checklistProgress(note), categoryNames[note.CategoryID], note.Subject)
+	}
+	return tw.Flush()
+}
+
+// runNoteShow prints a single note
+func runNoteShow(args []string) error {
+	fs := newFlagSet("note show")
+	asJSON := fs.Bool("json", false, "print the note as JSON")
+	cfg, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(stderr, "Usage: notes note show [flags] <id>")
+		return errUsage
+	}
+
+	v, err := openVault(cfg)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	note, err := v.notes.GetByID(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if note.Checklist, err = v.checklists.GetByNoteID(note.ID); err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return writeJSON(stdout, note)
+	}
+
+	categoryName := ""
+	if note.CategoryID != "" {
+		names, err := v.categoryNames()
+		if err != nil {
+			return err
+		}
+		categoryName = names[note.CategoryID]
+	}
+
+	fmt.Fprintf(stdout, "ID:       %s\n", note.ID)
+	fmt.Fprintf(stdout, "Subject:  %s\n", note.Subject)
+	fmt.Fprintf(stdout, "Priority: %s\n", note.Priority)
+	fmt.Fprintf(stdout, "Tags:     %s\n", note.Tags)
+	fmt.Fprintf(stdout, "Category: %s\n", categoryName)
+	if states := noteStates(note); states != "" {
+		fmt.Fprintf(stdout, "State:    %s\n", states)
+	}
+	if note.DueAt != nil {
+		fmt.Fprintf(stdout, "Due:      %s\n", formatNoteTime(note.DueAt))
+	}
+	if note.RemindAt != nil {
+		reminder := formatNoteTime(note.RemindAt)
+		if note.RemindedAt != nil {
+			reminder += " (sent)"
+		}
+		fmt.Fprintf(stdout, "Remind:   %s\n", reminder)
+	}
+	if note.Recurrence != "" {
+		recurrence := note.Recurrence + " (" + note.RecurrenceMode + ")"
+		if note.RecurAt != nil {
+			recurrence += ", next " + formatNoteTime(note.RecurAt)
+		} else {
+			recurrence += ", ended"
+		}
+		fmt.Fprintf(stdout, "Recurs:   %s\n", recurrence)
+	}
+	fmt.Fprintf(stdout, "Created:  %s\n", note.CreatedAt.Local().Format("2006-01-02 15:04"))
+	fmt.Fprintf(stdout, "Updated:  %s\n", note.UpdatedAt.Local().Format("2006-01-02 15:04"))
+	fmt.Fprintln(stdout)
+	fmt.Fprintln(stdout, note.Content)
+	if len(note.Checklist) > 0 {
+		fmt.Fprintln(stdout)
+		printChecklist(note.Checklist)
+	}
+	return nil
+}
+
+// runNoteChecklist changes the checklist of a note and prints it. Items are
+// numbered from 1 in the order printed; -check, -uncheck and -remove refer
+// to those numbers as they were before the command.
+func runNoteChecklist(args []string) error {
+	fs := newFlagSet("note checklist")
+	var add []string
+	fs.Func("add", "add an item at the end; repeat to add several", func(s string) error {
+		add = append(add, s)
+		return nil
+	})
+	var check, uncheck, remove []int
+	fs.Func("check", "check item number n; repeat for several", checklistNumberFlag(&check))
+	fs.Func("uncheck", "uncheck item number n; repeat for several", checklistNumberFlag(&uncheck))
+	fs.Func("remove", "remove item number n; repeat for several", checklistNumberFlag(&remove))
+	asJSON := fs.Bool("json", false, "print the checklist as JSON")
+	cfg, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(stderr, "Usage: notes note checklist [flags] <id>")
+		return errUsage
+	}
+
+	v, err := openVault(cfg)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	note, err := v.notes.GetByID(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	items, err := v.checklists.GetByNoteID(note.ID)
+	if err != nil {
+		return err
+	}
+	item := func(n int) (*models.ChecklistItem, error) {
+		if n > len(items) {
+			return nil, fmt.Errorf("%w: the checklist has %d item(s), not %d", utils.ErrChecklistItemNotFound, len(items), n)
+		}
+		return &items[n-1], nil
+	}
+
+	for _, change := range []struct {
+		numbers     []int
+		checked     bool
+		action      string
+		description string
+	}{
+		{check, true, "check", "Checked checklist item of note"},
+		{uncheck, false, "uncheck", "Unchecked checklist item of note"},
+	} {
+		for _, n := range change.numbers {
+			it, err := item(n)
+			if err != nil {
+				return err
+			}
+			if err := v.checklists.SetChecked(it.ID, change.checked); err != nil {
+				return err
+			}
+			v.logActivity(change.action, "note", change.description+" from CLI: "+note.Subject)
+		}
+	}
+	for _, n := range remove {
+		it, err := item(n)
+		if err != nil {
+			return err
+		}
+		if err := v.checklists.Delete(it.ID); err != nil && !errors.Is(err, utils.ErrChecklistItemNotFound) {
+			return err
+		}
+		v.logActivity("delete", "note", "Deleted checklist item of note from CLI: "+note.Subject)
+	}
+	for _, text := range add {
+		if err := v.checklists.Create(&models.ChecklistItem{NoteID: note.ID, Text: text}); err != nil {
+			return err
+		}
+		v.logActivity("create", "note", "Added checklist item to note from CLI: "+note.Subject)
+	}
+
+	if items, err = v.checklists.GetByNoteID(note.ID); err != nil {
+		return err
+	}
+	if *asJSON {
+		return writeJSON(stdout, items)
+	}
+	printChecklist(items)
+	return nil
+}
+
+// checklistNumberFlag returns a flag function adding an item number, from
+// 1, to *numbers
+func checklistNumberFlag(numbers *[]int) func(string) error {
+	return func(s string) error {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid item number %q", s)
+		}
+		*numbers = append(*numbers, n)
+		return nil
+	}
+}
+
+// printChecklist prints numbered checklist items, such as "2. [x] Milk"
+func printChecklist(items []models.ChecklistItem) {
+	for i, item := range items {
+		mark := " "
+		if item.Checked {
+			mark = "x"
+		}
+		fmt.Fprintf(stdout, "%d. [%s] %s\n", i+1, mark, item.Text)
+	}
+}
+
+// checklistProgress returns how much of the checklist of a note is
+// checked, such as "2/5", or "" when it has none
+func checklistProgress(note *models.Note) string {
+	if note.ChecklistTotal == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", note.ChecklistDone, note.ChecklistTotal)
+}
+
+// runNoteState turns a state of a note on, or off with -off, logging the
+// change as the handler of the server does
+func runNoteState(state models.NoteState, onAction, offAction, onDescription, offDescription string, args []string) error {
+	fs := newFlagSet("note " + onAction)
+	off := fs.Bool("off", false, offAction+" the note instead")
+	cfg, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintf(stderr, "Usage: notes note %s [flags] <id>\n", onAction)
+		return errUsage
+	}
+
+	v, err := openVault(cfg)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	note, err := v.notes.GetByID(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := v.notes.SetState(note.ID, state, !*off); err != nil {
+		return err
+	}
+	action, description := onAction, onDescription
+	if *off {
+		action, description = offAction, offDescription
+	}
+	v.logActivity(action, "note", description+" from CLI: "+note.Subject)
+	return nil
+}
+
+// noteTimeFlag returns a flag function parsing a due or reminder time into
+// *t
+func noteTimeFlag(t **time.Time) func(string) error {
+	return func(s string) error {
+		parsed, err := models.ParseNoteTime(s)
+		if err != nil {
+			return err
+		}
+		*t = &parsed
+		return nil
+	}
+}
+
+// formatNoteTime formats a due or reminder time in local time, or returns ""
+// for none
+func formatNoteTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// noteStates lists the states a note has, such as "pinned, favorite"
+func noteStates(note *models.Note) string {
+	var states []string
+	for _, state := range []models.NoteState{models.NotePinned, models.NoteArchived, models.NoteFavorite} {
+		if state.Of(note) {
+			states = append(states, string(state))
+		}
+	}
+	return strings.Join(states, ", ")
+}
+
+// categoryNames maps category IDs to the paths of their decrypted names,
+// such as "Work / Projects"
+func (v *vault) categoryNames() (map[string]string, error) {
+	categories, err := v.categories.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]string, len(categories))
+	for _, cat := range categories {
+		names[cat.ID] = models.CategoryPath(categories, cat.ID)
+	}
+	return names, nil
+}
+
+// writeJSON writes v as indented JSON
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"personal-notes-with-go/repositories"
+	"personal-notes-with-go/settings"
+	"personal-notes-with-go/utils"
+	"time"
+)
+
+// runReindex recomputes the blind indexes of every tag and note. With
+// -new-key it first replaces the blind index key, following the same steps
+// as rotate-key: the new settings are written to a temporary file and only
+// moved into place once the new indexes have been committed, and the
+// previous settings file is kept as a backup.
+func runReindex(args []string) error {
+	fs := newFlagSet("reindex")
+	newKey := fs.Bool("new-key", false, "generate a new blind index key before rebuilding the indexes")
+	cfg, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	v, err := openVault(cfg)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	if !*newKey {
+		count, err := repositories.UpdateBlindIndexes(v.db, utils.DefaultCipher(), utils.DefaultBlindIndex(), true)
+		if err != nil {
+			return fmt.Errorf("reindexing failed, nothing was changed: %w", err)
+		}
+		v.logActivity("reindex", "blind_index", fmt.Sprintf("Rebuilt the blind indexes of %d rows", count))
+		fmt.Fprintf(stdout, "Rebuilt the blind indexes of %d rows\n", count)
+		return nil
+	}
+
+	current, err := settings.ReadSettings()
+	if err != nil {
+		return fmt.Errorf("failed to load settings: %w", err)
+	}
+	encoded, err := settings.GenerateEncryptionKey()
+	if err != nil {
+		return err
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return err
+	}
+	bi, err := utils.NewBlindIndex(key)
+	if err != nil {
+		return err
+	}
+
+	updated := *current
+	updated.BlindIndexKey = encoded
+
+	pending := cfg.SettingsPath + ".new"
+	if err := updated.SaveTo(pending); err != nil {
+		return fmt.Errorf("failed to write new settings: %w", err)
+	}
+	count, err := repositories.UpdateBlindIndexes(v.db, utils.DefaultCipher(), bi, true)
+	if err != nil {
+		os.Remove(pending)
+		return fmt.Errorf("reindexing failed, nothing was changed: %w", err)
+	}
+
+	backup := fmt.Sprintf("%s.%s.bak", cfg.SettingsPath, time.Now().Format("20060102-150405"))
+	if err := current.SaveTo(backup); err != nil {
+		return fmt.Errorf("indexes were rebuilt but the old settings could not be backed up; the new key is in %s: %w", pending, err)
+	}
+	if err := os.Rename(pending, cfg.SettingsPath); err != nil {
+		return fmt.Errorf("indexes were rebuilt but the settings could not be replaced; move %s to %s manually: %w", pending, cfg.SettingsPath, err)
+	}
+
+	v.logActivity("reindex", "blind_index", fmt.Sprintf("Replaced the blind index key and rebuilt the indexes of %d rows", count))
+	fmt.Fprintf(stdout, "Rebuilt the blind indexes of %d rows with the new key\n", count)
+	fmt.Fprintf(stdout, "Previous settings saved to %s\n", backup)
+	return nil
+}
@@ -0,0 +1,488 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"personal-notes-with-go/client"
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/utils"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// envServer names the environment variable holding the default server URL
+const envServer = "NOTES_SERVER"
+
+// remoteFlags are the flags shared by every remote subcommand
+type remoteFlags struct {
+	server string
+	output string
+}
+
+func registerRemoteFlags(fs *flag.FlagSet) *remoteFlags {
+	f := &remoteFlags{}
+	server := os.Getenv(envServer)
+	if server == "" {
+		server = "http://localhost:8080"
+	}
+	fs.StringVar(&f.server, "server", server, "URL of the running server (env "+envServer+")")
+	fs.StringVar(&f.output, "output", "table", "output format: table or json")
+	return f
+}
+
+// parseRemoteFlags parses args and validates the shared remote flags
+func parseRemoteFlags(fs *flag.FlagSet, f *remoteFlags, args []string) (*client.Client, error) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, errUsage
+	}
+	if f.output != "table" && f.output != "json" {
+		return nil, fmt.Errorf("unknown output format %q, use table or json", f.output)
+	}
+	return client.New(f.server), nil
+}
+
+// runRemote dispatches the subcommands that work against a running server
+func runRemote(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, "Usage: notes remote <list|show|create|edit|delete|move|tag|categories> [flags]")
+		return errUsage
+	}
+
+	switch args[0] {
+	case "list":
+		return runRemoteList(args[1:])
+	case "show":
+		return runRemoteShow(args[1:])
+	case "create":
+		return runRemoteCreate(args[1:])
+	case "edit":
+		return runRemoteEdit(args[1:])
+	case "delete":
+		return runRemoteDelete(args[1:])
+	case "move":
+		return runRemoteMove(args[1:])
+	case "tag":
+		return runRemoteTag(args[1:])
+	case "categories":
+		return runRemoteCategories(args[1:])
+	default:
+		fmt.Fprintf(stderr, "notes remote: unknown subcommand %q\n", args[0])
+		return errUsage
+	}
+}
+
+// runRemoteList lists notes with optional filters
+func runRemoteList(args []string) error {
+	fs := newFlagSet("remote list")
+	rf := registerRemoteFlags(fs)
+	category := fs.String("category", "", "only list notes of this category ID, path or name")
+	recursive := fs.Bool("recursive", false, "with -category, also list the notes of its subcategories")
+	archived := fs.Bool("include-archived", false, "also list archived notes")
+	favorites := fs.Bool("favorites", false, "only list favorite notes")
+	var dueBefore *time.Time
+	fs.Func("due-before", "only list notes due before this time, as YYYY-MM-DD, YYYY-MM-DD HH:MM or RFC 3339", noteTimeFlag(&dueBefore))
+	priority := fs.String("priority", "", "only list notes with this priority")
+	tag := fs.String("tag", "", "only list notes with this tag")
+	search := fs.String("search", "", "only list notes whose subject or content contains this text")
+	limit := fs.Int("limit", 0, "maximum number of notes to list, 0 for all")
+	c, err := parseRemoteFlags(fs, rf, args)
+	if err != nil {
+		return err
+	}
+
+	categories, err := c.ListCategories()
+	if err != nil {
+		return err
+	}
+
+	opts := client.NoteListOptions{Recursive: *recursive, IncludeArchived: *archived, Favorites: *favorites, DueBefore: dueBefore}
+	if *category != "" {
+		cat, err := matchCategory(categories, *category)
+		if err != nil {
+			return err
+		}
+		opts.CategoryID = cat.ID
+	}
+	if *tag != "" {
+		opts.Tags = []string{*tag}
+	}
+	if *priority != "" {
+		opts.Priorities = []string{*priority}
+	}
+
+	notes, err := c.ListNotes(opts)
+	if err != nil {
+		return err
+	}
+
+	// The server only filters by category, tag, priority and due date, the
+	// rest is done here. Older servers ignore the tag, priority and due
+	// date, so they are checked again.
+	var filtered []models.Note
+	for _, note := range notes {
+		if *priority != "" && !strings.EqualFold(note.Priority, *priority) {
+			continue
+		}
+		if *tag != "" && !hasTag(note.Tags, *tag) {
+			continue
+		}
+		if dueBefore != nil && (note.DueAt == nil || !note.DueAt.Before(*dueBefore)) {
+			continue
+		}
+		if *search != "" && !containsFold(note.Subject, *search) && !containsFold(note.Content, *search) {
+			continue
+		}
+		filtered = append(filtered, note)
+		if *limit > 0 && len(filtered) == *limit {
+			break
+		}
+	}
+
+	if rf.output == "json" {
+		if filtered == nil {
+			filtered = []models.Note{}
+		}
+		return writeJSON(stdout, filtered)
+	}
+	return printNoteTable(filtered, categories)
+}
+
+// runRemoteShow prints a single note
+func runRemoteShow(args []string) error {
+	fs := newFlagSet("remote show")
+	rf := registerRemoteFlags(fs)
+	c, err := parseRemoteFlags(fs, rf, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(stderr, "Usage: notes remote show [flags] <id>")
+		return errUsage
+	}
+
+	note, err := c.GetNote(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	return printNote(c, rf.output, note)
+}
+
+// runRemoteCreate creates a note. Without -subject the note is written in
+// $EDITOR, with the first line as the subject.
+func runRemoteCreate(args []string) error {
+	fs := newFlagSet("remote create")
+	rf := registerRemoteFlags(fs)
+	subject := fs.String("subject", "", "subject of the note; opens $EDITOR when empty")
+	content := fs.String("content", "", "content of the note")
+	priority := fs.String("priority", "", "priority of the note, the server's default when empty")
+	tags := fs.String("tags", "", "comma-separated tags")
+	category := fs.String("category", "", "category ID, path or name")
+	c, err := parseRemoteFlags(fs, rf, args)
+	if err != nil {
+		return err
+	}
+
+	note := &models.Note{
+		Subject:  *subject,
+		Content:  *content,
+		Priority: *priority,
+		Tags:     *tags,
+	}
+	if note.Subject == "" {
+		note.Subject, note.Content, err = editNoteText("", note.Content)
+		if err != nil {
+			return err
+		}
+	}
+	if *category != "" {
+		if note.CategoryID, err = resolveCategoryID(c, *category); err != nil {
+			return err
+		}
+	}
+
+	created, err := c.CreateNote(note)
+	if err != nil {
+		return err
+	}
+	return printNote(c, rf.output, created)
+}
+
+// runRemoteEdit updates a note. Without any of the field flags the subject
+// and content are edited in $EDITOR.
+func runRemoteEdit(args []string) error {
+	fs := newFlagSet("remote edit")
+	rf := registerRemoteFlags(fs)
+	subject := fs.String("subject", "", "new subject")
+	content := fs.String("content", "", "new content")
+	priority := fs.String("priority", "", "new priority")
+	tags := fs.String("tags", "", "new comma-separated tags")
+	c, err := parseRemoteFlags(fs, rf, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(stderr, "Usage: notes remote edit [flags] <id>")
+		return errUsage
+	}
+
+	note, err := c.GetNote(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+
+	if set["subject"] {
+		note.Subject = *subject
+	}
+	if set["content"] {
+		note.Content = *content
+	}
+	if set["priority"] {
+		note.Priority = *priority
+	}
+	if set["tags"] {
+		note.Tags = *tags
+	}
+	if !set["subject"] && !set["content"] && !set["priority"] && !set["tags"] {
+		note.Subject, note.Content, err = editNoteText(note.Subject, note.Content)
+		if err != nil {
+			return err
+		}
+	}
+
+	updated, err := c.UpdateNote(note)
+	if err != nil {
+		return err
+	}
+	return printNote(c, rf.output, updated)
+}
+
+// runRemoteDelete deletes a note
+func runRemoteDelete(args []string) error {
+	fs := newFlagSet("remote delete")
+	rf := registerRemoteFlags(fs)
+	c, err := parseRemoteFlags(fs, rf, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(stderr, "Usage: notes remote delete [flags] <id>")
+		return errUsage
+	}
+
+	if err := c.DeleteNote(fs.Arg(0)); err != nil {
+		return err
+	}
+	if rf.output == "json" {
+		return writeJSON(stdout, map[string]string{"deleted": fs.Arg(0)})
+	}
+	fmt.Fprintf(stdout, "Deleted note %s\n", fs.Arg(0))
+	return nil
+}
+
+// runRemoteMove moves a note to another category, or out of any category
+// when the category is "none"
+func runRemoteMove(args []string) error {
+	fs := newFlagSet("remote move")
+	rf := registerRemoteFlags(fs)
+	c, err := parseRemoteFlags(fs, rf, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fmt.Fprintln(stderr, "Usage: notes remote move [flags] <id> <category|none>")
+		return errUsage
+	}
+
+	note, err := c.GetNote(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	note.CategoryID = ""
+	if fs.Arg(1) != "none" {
+		if note.CategoryID, err = resolveCategoryID(c, fs.Arg(1)); err != nil {
+			return err
+		}
+	}
+
+	updated, err := c.UpdateNote(note)
+	if err != nil {
+		return err
+	}
+	return printNote(c, rf.output, updated)
+}
+
+// runRemoteTag adds (+tag or tag) and removes (-tag) tags on a note
+func runRemoteTag(args []string) error {
+	fs := newFlagSet("remote tag")
+	rf := registerRemoteFlags(fs)
+	c, err := parseRemoteFlags(fs, rf, args)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		fmt.Fprintln(stderr, "Usage: notes remote tag [flags] <id> [+]tag|-tag...")
+		return errUsage
+	}
+
+	note, err := c.GetNote(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	tags := splitTags(note.Tags)
+	for _, change := range fs.Args()[1:] {
+		if name, ok := strings.CutPrefix(change, "-"); ok {
+			tags = removeTag(tags, name)
+			continue
+		}
+		name := strings.TrimPrefix(change, "+")
+		if name != "" && !hasTag(strings.Join(tags, ","), name) {
+			tags = append(tags, name)
+		}
+	}
+	note.Tags = strings.Join(tags, ", ")
+
+	updated, err := c.UpdateNote(note)
+	if err != nil {
+		return err
+	}
+	return printNote(c, rf.output, updated)
+}
+
+// runRemoteCategories lists the categories with their note counts
+func runRemoteCategories(args []string) error {
+	fs := newFlagSet("remote categories")
+	rf := registerRemoteFlags(fs)
+	c, err := parseRemoteFlags(fs, rf, args)
+	if err != nil {
+		return err
+	}
+
+	categories, err := c.ListCategories()
+	if err != nil {
+		return err
+	}
+	if rf.output == "json" {
+		if categories == nil {
+			categories = []models.Category{}
+		}
+		return writeJSON(stdout, categories)
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNOTES\tNAME")
+	for _, cat := range categories {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", cat.ID, cat.NoteCount, models.CategoryPath(categories, cat.ID))
+	}
+	return tw.Flush()
+}
+
+// printNote prints a note in the requested output format
+func printNote(c *client.Client, output string, note *models.Note) error {
+	if output == "json" {
+		return writeJSON(stdout, note)
+	}
+
+	categoryName := ""
+	if note.CategoryID != "" {
+		categories, err := c.ListCategories()
+		if err != nil {
+			return err
+		}
+		categoryName = models.CategoryPath(categories, note.CategoryID)
+	}
+
+	fmt.Fprintf(stdout, "ID:       %s\n", note.ID)
+	fmt.Fprintf(stdout, "Subject:  %s\n", note.Subject)
+	fmt.Fprintf(stdout, "Priority: %s\n", note.Priority)
+	fmt.Fprintf(stdout, "Tags:     %s\n", note.Tags)
+	fmt.Fprintf(stdout, "Category: %s\n", categoryName)
+	fmt.Fprintln(stdout)
+	fmt.Fprintln(stdout, note.Content)
+	return nil
+}
+
+// printNoteTable prints notes as an aligned table
+func printNoteTable(notes []models.Note, categories []models.Category) error {
+	names := make(map[string]string, len(categories))
+	for _, cat := range categories {
+		names[cat.ID] = models.CategoryPath(categories, cat.ID)
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tPRIORITY\tDUE\tCHECKLIST\tCATEGORY\tTAGS\tSUBJECT")
+	for _, note := range notes {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", note.ID, note.Priority, formatNoteTime(note.DueAt), checklistProgress(&note), names[note.CategoryID], note.Tags, note.Subject)
+	}
+	return tw.Flush()
+}
+
+// resolveCategoryID turns a category ID or name into an ID
+func resolveCategoryID(c *client.Client, ref string) (string, error) {
+	categories, err := c.ListCategories()
+	if err != nil {
+		return "", err
+	}
+	cat, err := matchCategory(categories, ref)
+	if err != nil {
+		return "", err
+	}
+	return cat.ID, nil
+}
+
+// matchCategory finds a category by ID, path or case-insensitive name, as
+// lookupCategory does
+func matchCategory(categories []models.Category, ref string) (*models.Category, error) {
+	cat, err := lookupCategory(categories, ref)
+	if errors.Is(err, utils.ErrCategoryNotFound) {
+		return nil, fmt.Errorf("category %q not found", ref)
+	}
+	return cat, err
+}
+
+// splitTags splits a comma-separated tag string
+func splitTags(tags string) []string {
+	var out []string
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			out = append(out, tag)
+		}
+	}
+	return out
+}
+
+// hasTag reports whether the comma-separated tags contain tag
+func hasTag(tags, tag string) bool {
+	for _, t := range splitTags(tags) {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeTag returns tags without tag
+func removeTag(tags []string, tag string) []string {
+	var out []string
+	for _, t := range tags {
+		if !strings.EqualFold(t, tag) {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// containsFold reports whether substr is within s, ignoring case
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
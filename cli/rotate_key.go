@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"personal-notes-with-go/database"
+	"personal-notes-with-go/settings"
+	"personal-notes-with-go/utils"
+	"time"
+)
+
+// runRotateKey replaces the encryption key with a new one and re-encrypts
+// every encrypted value in the database.
+//
+// The new settings are written to a temporary file before the database is
+// touched, and only moved into place once the re-encryption transaction has
+// committed, so a failure at any point leaves either the old or the new key
+// next to matching data. The previous settings file is kept as a backup.
+func runRotateKey(args []string) error {
+	fs := newFlagSet("rotate-key")
+	key := fs.String("key", "", "base64-encoded 32-byte key to rotate to; a random key is generated when empty")
+	cfg, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if cfg.KeyProvider != utils.KeyProviderSettings {
+		return fmt.Errorf("rotate-key only manages keys stored in the settings file; rotate the key of the %s provider outside the application", cfg.KeyProvider)
+	}
+
+	v, err := openVault(cfg)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	current, err := settings.LoadSettings()
+	if err != nil {
+		return fmt.Errorf("failed to load settings: %w", err)
+	}
+
+	newKeyEncoded, keySource := *key, settings.KeySourceUser
+	if newKeyEncoded == "" {
+		newKeyEncoded, err = settings.GenerateEncryptionKey()
+		if err != nil {
+			return err
+		}
+		keySource = settings.KeySourceRandom
+	}
+	newKey, err := base64.StdEncoding.DecodeString(newKeyEncoded)
+	if err != nil {
+		return fmt.Errorf("invalid key: %w", err)
+	}
+	if len(newKey) != utils.KeySize {
+		return fmt.Errorf("invalid key: expected %d bytes, got %d", utils.KeySize, len(newKey))
+	}
+
+	updated := *current
+	updated.EncryptionKey = newKeyEncoded
+	updated.KeySource = keySource
+
+	pending := cfg.SettingsPath + ".new"
+	if err := updated.SaveTo(pending); err != nil {
+		return fmt.Errorf("failed to write new settings: %w", err)
+	}
+
+	target, err := utils.NewCipher(utils.DefaultCipher().Name(), newKey)
+	if err != nil {
+		os.Remove(pending)
+		return err
+	}
+	count, err := database.ReencryptAll(v.db, func(value string) (string, error) {
+		return utils.Reencrypt(value, target)
+	})
+	if err != nil {
+		os.Remove(pending)
+		return fmt.Errorf("re-encryption failed, nothing was changed: %w", err)
+	}
+
+	backup := fmt.Sprintf("%s.%s.bak", cfg.SettingsPath, time.Now().Format("20060102-150405"))
+	if err := current.SaveTo(backup); err != nil {
+		return fmt.Errorf("data was re-encrypted but the old settings could not be backed up; the new key is in %s: %w", pending, err)
+	}
+	if err := os.Rename(pending, cfg.SettingsPath); err != nil {
+		return fmt.Errorf("data was re-encrypted but the settings could not be replaced; move %s to %s manually: %w", pending, cfg.SettingsPath, err)
+	}
+
+	v.logActivity("rotate", "key", fmt.Sprintf("Rotated encryption key and re-encrypted %d rows", count))
+	fmt.Fprintf(stdout, "Re-encrypted %d rows with the new key\n", count)
+	fmt.Fprintf(stdout, "Previous settings saved to %s\n", backup)
+	return nil
+}
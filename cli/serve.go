@@ -0,0 +1,456 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"personal-notes-with-go/background"
+	"personal-notes-with-go/backup"
+	"personal-notes-with-go/database"
+	"personal-notes-with-go/handlers"
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/reminders"
+	"personal-notes-with-go/repositories"
+	"personal-notes-with-go/utils"
+	"runtime"
+	"syscall"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// Middleware to check if encryption is valid before allowing data modification
+func requireValidEncryption() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !utils.IsEncryptionValid() {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "Encryption system is not properly initialized. Data modification is disabled for security reasons.",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// openBrowser opens the specified URL in the default browser
+func openBrowser(url string) {
+	var err error
+
+	switch runtime.GOOS {
+	case "linux":
+		err = exec.Command("xdg-open", url).Start()
+	case "windows":
+		err = exec.Command("rundll32", "url.dll,FileProtocolHandler", url).Start()
+	case "darwin":
+		err = exec.Command("open", url).Start()
+	default:
+		log.Printf("Unsupported platform for auto-opening browser. Please open %s manually.", url)
+		return
+	}
+
+	if err != nil {
+		log.Printf("Failed to open browser: %v", err)
+	}
+}
+
+// runServe starts the HTTP server with the web frontend and blocks until it
+// receives SIGINT or SIGTERM. On shutdown it stops accepting connections
+// and waits for in-flight requests, then for the background tasks, then for
+// the activity log writer, each within the configured shutdown timeout.
+// The database is only closed once all of them have finished.
+func runServe(args []string) error {
+	fs := newFlagSet("serve")
+	cfg, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := cfg.ValidateServer(); err != nil {
+		return err
+	}
+	// Scheduled backups run unattended, so the passphrase can only come
+	// from the environment
+	backupPassphrase := os.Getenv(envBackupPassphrase)
+	if cfg.BackupInterval > 0 && len(backupPassphrase) < backup.MinPassphraseLength {
+		return fmt.Errorf("scheduled backups require a backup passphrase of at least %d characters in %s", backup.MinPassphraseLength, envBackupPassphrase)
+	}
+	// Initialize encryption
+	if err := initEncryption(cfg); err != nil {
+		log.Printf("WARNING: Failed to initialize encryption: %v", err)
+		log.Printf("Data modification will be disabled for security reasons.")
+		// We continue execution but with encryption marked as invalid
+	} else if utils.IsKeyRotationRecommended() {
+		log.Printf("WARNING: The encryption key in %s has no key_source, so it may have been created by an older version whose key generator was predictable.", cfg.SettingsPath)
+		log.Printf("If so, stop the server and run `notes rotate-key` to replace it and re-encrypt the data. If you supplied the key yourself, set \"key_source\": \"user\" in %s to keep it.", cfg.SettingsPath)
+	}
+
+	// Inisialisasi database
+	db, err := database.InitDB(cfg.DBPath)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	// Tasks still running at the shutdown deadline may be using the
+	// database, which is then left for the process exit to close
+	tasksFinished := true
+	defer func() {
+		if tasksFinished {
+			db.Close()
+		}
+	}()
+
+	// Fix any encryption issues in the database
+	if err := database.FixEncryptionIssues(db); err != nil {
+		log.Printf("WARNING: Failed to fix encryption issues: %v", err)
+		log.Printf("Some data may not be accessible.")
+	}
+
+	// Index rows written by older versions or with another blind index
+	// key, then move tags of notes written by older versions to the tags
+	// table
+	if utils.IsEncryptionValid() {
+		if n, err := repositories.UpdateBlindIndexes(db, utils.DefaultCipher(), utils.DefaultBlindIndex(), false); err != nil {
+			log.Printf("WARNING: Failed to update blind indexes: %v", err)
+		} else if n > 0 {
+			log.Printf("Updated the blind indexes of %d rows", n)
+		}
+		if n, err := repositories.MigrateLegacyTags(db, utils.DefaultCipher(), utils.DefaultBlindIndex()); err != nil {
+			log.Printf("WARNING: Failed to migrate note tags: %v", err)
+		} else if n > 0 {
+			log.Printf("Migrated the tags of %d notes to the tags table", n)
+		}
+	}
+
+	// Inisialisasi repository
+	categoryRepo := repositories.NewEncryptedCategoryRepository(repositories.NewCategoryRepository(db), utils.DefaultCipher())
+	tagRepo := repositories.NewEncryptedTagRepository(repositories.NewTagRepository(db), utils.DefaultCipher(), utils.DefaultBlindIndex())
+	noteRepo := repositories.NewTransactionalNoteRepository(db, utils.DefaultCipher(), utils.DefaultBlindIndex())
+	checklistRepo := repositories.NewEncryptedChecklistRepository(repositories.NewChecklistRepository(db), utils.DefaultCipher())
+	activityLogRepo := repositories.NewActivityLogRepository(db)
+
+	// Create activity logs table if it doesn't exist
+	if err := activityLogRepo.CreateTable(); err != nil {
+		log.Printf("WARNING: Failed to create activity logs table: %v", err)
+	}
+
+	// Background tasks must finish before the deferred db.Close runs. The
+	// activity log writer has a group of its own, shut down after the
+	// tasks that enqueue to it.
+	tasks := background.NewGroup()
+	writers := background.NewGroup()
+	if cfg.ActivityLogRetentionDays > 0 {
+		days := cfg.ActivityLogRetentionDays
+		tasks.Every("activity-log-purge", time.Hour, func(ctx context.Context) {
+			if deleted, err := activityLogRepo.DeleteOlderThan(days); err != nil {
+				log.Printf("Failed to purge activity logs: %v", err)
+			} else if deleted > 0 {
+				log.Printf("Purged %d activity logs older than %d days", deleted, days)
+			}
+		})
+	}
+
+	if cfg.BackupInterval > 0 {
+		src := backupSource(cfg, db, true)
+		tasks.Every("backup", cfg.BackupInterval, func(ctx context.Context) {
+			path, err := backup.Create(ctx, src, cfg.BackupDir, backupPassphrase)
+			if err != nil {
+				log.Printf("Scheduled backup failed: %v", err)
+				return
+			}
+			log.Printf("Backup written to %s", path)
+			if cfg.BackupRetention > 0 {
+				removed, err := backup.Prune(cfg.BackupDir, cfg.BackupRetention)
+				if err != nil {
+					log.Printf("Failed to remove old backups: %v", err)
+				}
+				for _, path := range removed {
+					log.Printf("Removed old backup %s", path)
+				}
+			}
+		})
+	}
+
+	// Activity logs are queued and written in batches by a single worker,
+	// which drains the queue when its group shuts down
+	activityLogWriter := repositories.NewActivityLogWriter(activityLogRepo, repositories.ActivityLogWriterOptions{
+		QueueSize:     cfg.ActivityLogQueueSize,
+		BatchSize:     cfg.ActivityLogBatchSize,
+		FlushInterval: cfg.ActivityLogFlushInterval,
+		Policy:        cfg.ActivityLogQueuePolicy,
+	})
+	writers.Go("activity-log-writer", activityLogWriter.Run)
+
+	// Reminders go to the open frontends and to the configured webhook and
+	// command. Subjects are decrypted, so nothing is sent without a valid
+	// key.
+	broadcaster := reminders.NewBroadcaster()
+	if cfg.ReminderInterval > 0 {
+		notifiers := []reminders.Notifier{broadcaster}
+		if cfg.ReminderWebhookURL != "" {
+			notifiers = append(notifiers, reminders.NewWebhookNotifier(cfg.ReminderWebhookURL))
+		}
+		if cfg.ReminderCommand != "" {
+			notifiers = append(notifiers, reminders.NewCommandNotifier(cfg.ReminderCommand))
+		}
+		scheduler := reminders.NewScheduler(noteRepo, activityLogWriter, notifiers...)
+		tasks.Every("reminders", cfg.ReminderInterval, func(ctx context.Context) {
+			if !utils.IsEncryptionValid() {
+				return
+			}
+			if sent, err := scheduler.Check(ctx); err != nil {
+				log.Printf("Failed to send reminders: %v", err)
+			} else if sent > 0 {
+				log.Printf("Sent %d reminders", sent)
+			}
+		})
+	}
+
+	// Recurring notes are rewritten encrypted, so nothing recurs without a
+	// valid key
+	if cfg.RecurrenceInterval > 0 {
+		tasks.Every("recurrence", cfg.RecurrenceInterval, func(ctx context.Context) {
+			if !utils.IsEncryptionValid() {
+				return
+			}
+			recurred, err := repositories.RecurNotes(db, utils.DefaultCipher(), utils.DefaultBlindIndex(), time.Now())
+			if err != nil {
+				log.Printf("Failed to move on recurring notes: %v", err)
+			}
+			for _, note := range recurred {
+				description := "Reset recurring note: " + note.Subject
+				switch {
+				case note.Next == nil:
+					description = "Ended recurrence of note: " + note.Subject
+				case note.CloneID != "":
+					description = "Cloned recurring note: " + note.Subject
+				}
+				activityLogWriter.Enqueue(&models.ActivityLog{
+					Action:      "recur",
+					EntityType:  "note",
+					Description: description,
+					UserID:      1,
+					IPAddress:   "scheduler",
+				})
+			}
+			if len(recurred) > 0 {
+				log.Printf("Moved on %d recurring notes", len(recurred))
+			}
+		})
+	}
+
+	// Inisialisasi Gin
+	r := gin.Default()
+
+	// Configure CORS
+	corsConfig := cors.DefaultConfig()
+	if cfg.AllowAllOrigins() {
+		corsConfig.AllowAllOrigins = true
+	} else {
+		corsConfig.AllowOrigins = cfg.CORSOrigins
+	}
+	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Authorization"}
+	r.Use(cors.New(corsConfig))
+
+	// Serve static files for frontend
+	r.Static("/frontend", cfg.FrontendDir)
+
+	// Serve the SPA
+	r.GET("/", func(c *gin.Context) {
+		c.Redirect(301, "/frontend")
+	})
+
+	// Inisialisasi handler
+	categoryHandler := handlers.NewCategoryHandler(db, categoryRepo)
+	noteHandler := handlers.NewNoteHandler(noteRepo, checklistRepo)
+	tagHandler := handlers.NewTagHandler(tagRepo)
+	keyHandler := handlers.NewKeyHandler()
+	encryptionHandler := handlers.NewEncryptionHandler()
+	exportHandler := handlers.NewExportHandler(noteRepo, categoryRepo)
+	importHandler := handlers.NewImportHandler(noteRepo, categoryRepo)
+	archiveHandler := handlers.NewArchiveHandler(db, noteRepo, checklistRepo, categoryRepo, activityLogRepo)
+	checklistHandler := handlers.NewChecklistHandler(noteRepo, checklistRepo)
+	reminderHandler := handlers.NewReminderHandler(noteRepo, broadcaster, cfg.ReminderSnooze)
+	activityLogHandler := handlers.NewActivityLogHandler(activityLogRepo)
+	activityLogHandler.SetWriter(activityLogWriter)
+
+	// Set activity logger for each handler
+	categoryHandler.SetActivityLogger(activityLogHandler)
+	noteHandler.SetActivityLogger(activityLogHandler)
+	tagHandler.SetActivityLogger(activityLogHandler)
+	keyHandler.SetActivityLogger(activityLogHandler)
+	encryptionHandler.SetActivityLogger(activityLogHandler)
+	exportHandler.SetActivityLogger(activityLogHandler)
+	importHandler.SetActivityLogger(activityLogHandler)
+	archiveHandler.SetActivityLogger(activityLogHandler)
+	reminderHandler.SetActivityLogger(activityLogHandler)
+	checklistHandler.SetActivityLogger(activityLogHandler)
+
+	// Encryption status endpoint
+	r.GET("/encryption/status", encryptionHandler.GetStatus)
+
+	// Routing with encryption validation middleware for data modification endpoints
+	categoryGroup := r.Group("/categories")
+	{
+		categoryGroup.POST("", requireValidEncryption(), categoryHandler.CreateCategory)
+		categoryGroup.GET("", categoryHandler.GetCategories)
+		categoryGroup.PUT("/reorder", requireValidEncryption(), categoryHandler.ReorderCategories)
+		categoryGroup.PUT("/:id", requireValidEncryption(), categoryHandler.UpdateCategory)
+		categoryGroup.PUT("/:id/move", requireValidEncryption(), categoryHandler.MoveCategory)
+		categoryGroup.DELETE("/:id", requireValidEncryption(), categoryHandler.DeleteCategory)
+	}
+
+	noteGroup := r.Group("/notes")
+	{
+		noteGroup.POST("", requireValidEncryption(), noteHandler.CreateNote)
+		noteGroup.GET("", noteHandler.GetNotes)
+		noteGroup.GET("/:id", noteHandler.GetNote)
+		noteGroup.PUT("/:id", requireValidEncryption(), noteHandler.UpdateNote)
+		noteGroup.DELETE("/:id", requireValidEncryption(), noteHandler.DeleteNote)
+		noteGroup.POST("/:id/pin", requireValidEncryption(), noteHandler.PinNote)
+		noteGroup.POST("/:id/archive", requireValidEncryption(), noteHandler.ArchiveNote)
+		noteGroup.POST("/:id/favorite", requireValidEncryption(), noteHandler.FavoriteNote)
+		noteGroup.POST("/:id/snooze", requireValidEncryption(), reminderHandler.SnoozeNote)
+		noteGroup.POST("/:id/dismiss", requireValidEncryption(), reminderHandler.DismissNote)
+		noteGroup.GET("/:id/checklist", checklistHandler.GetChecklist)
+		noteGroup.POST("/:id/checklist", requireValidEncryption(), checklistHandler.AddChecklistItem)
+		noteGroup.PUT("/:id/checklist/reorder", requireValidEncryption(), checklistHandler.ReorderChecklist)
+		noteGroup.PUT("/:id/checklist/:itemId", requireValidEncryption(), checklistHandler.UpdateChecklistItem)
+		noteGroup.POST("/:id/checklist/:itemId/toggle", requireValidEncryption(), checklistHandler.ToggleChecklistItem)
+		noteGroup.DELETE("/:id/checklist/:itemId", requireValidEncryption(), checklistHandler.DeleteChecklistItem)
+	}
+
+	// Reminders are pushed to the frontend as server-sent events
+	r.GET("/reminders/events", reminderHandler.Events)
+
+	r.GET("/priorities", noteHandler.GetPriorities)
+
+	trashGroup := r.Group("/trash")
+	{
+		trashGroup.GET("", noteHandler.GetTrash)
+		trashGroup.POST("/:id/restore", requireValidEncryption(), noteHandler.RestoreNote)
+		trashGroup.DELETE("", requireValidEncryption(), noteHandler.EmptyTrash)
+	}
+
+	tagGroup := r.Group("/tags")
+	{
+		tagGroup.GET("", tagHandler.GetTags)
+		tagGroup.PUT("/:id", requireValidEncryption(), tagHandler.RenameTag)
+		tagGroup.POST("/:id/merge", requireValidEncryption(), tagHandler.MergeTag)
+	}
+
+	// Export endpoints; everything is decrypted, so a valid key is required
+	r.GET("/export/markdown", requireValidEncryption(), exportHandler.ExportMarkdown)
+	r.GET("/export/site", requireValidEncryption(), exportHandler.ExportSite)
+	r.GET("/export/archive", requireValidEncryption(), archiveHandler.ExportArchive)
+
+	// Import endpoints
+	r.POST("/import/markdown", requireValidEncryption(), importHandler.ImportMarkdown)
+	r.POST("/import/enex", requireValidEncryption(), importHandler.ImportENEX)
+	r.POST("/import/keep", requireValidEncryption(), importHandler.ImportKeep)
+	r.POST("/import/archive", requireValidEncryption(), archiveHandler.ImportArchive)
+
+	// Key generation endpoint
+	r.POST("/generate-key", keyHandler.GenerateKey)
+
+	// Activity logs endpoints
+	activityLogGroup := r.Group("/activity-logs")
+	{
+		activityLogGroup.GET("", requireValidEncryption(), activityLogHandler.GetLogs)
+		activityLogGroup.GET("/count", requireValidEncryption(), activityLogHandler.GetLogsCount)
+		activityLogGroup.GET("/stats", activityLogHandler.GetStats)
+		activityLogGroup.GET("/entity-type/:entityType", requireValidEncryption(), activityLogHandler.GetLogsByEntityType)
+		activityLogGroup.GET("/entity-type/:entityType/count", requireValidEncryption(), activityLogHandler.GetLogsByEntityTypeCount)
+		activityLogGroup.GET("/action/:action", requireValidEncryption(), activityLogHandler.GetLogsByAction)
+		activityLogGroup.GET("/action/:action/count", requireValidEncryption(), activityLogHandler.GetLogsByActionCount)
+		activityLogGroup.DELETE("/older-than/:days", requireValidEncryption(), activityLogHandler.DeleteOldLogs)
+	}
+
+	// Open browser after a short delay
+	if cfg.OpenBrowser {
+		tasks.Go("open-browser", func(ctx context.Context) {
+			// Wait for server to start
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(500 * time.Millisecond):
+			}
+			frontendURL := cfg.BaseURL() + "/frontend"
+			log.Printf("Opening browser at %s", frontendURL)
+			openBrowser(frontendURL)
+		})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Jalankan server
+	srv := &http.Server{
+		Addr:    cfg.Addr(),
+		Handler: r,
+	}
+	// Event streams stay open until closed, which would hold up Shutdown
+	srv.RegisterOnShutdown(broadcaster.Close)
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Server starting at %s", cfg.BaseURL())
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		// The server failed before any shutdown was requested
+		if shutdownErr := shutdownTasks(cfg.ShutdownTimeout, tasks, writers); shutdownErr != nil {
+			tasksFinished = false
+			log.Printf("WARNING: %v", shutdownErr)
+		}
+		return fmt.Errorf("failed to run server: %w", err)
+	case <-ctx.Done():
+	}
+	stop()
+
+	log.Printf("Shutting down, waiting up to %s for requests and background tasks", cfg.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	var shutdownErr error
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		shutdownErr = fmt.Errorf("failed to stop HTTP server: %w", err)
+	}
+	if err := <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		shutdownErr = errors.Join(shutdownErr, fmt.Errorf("failed to run server: %w", err))
+	}
+	if err := shutdownTasks(cfg.ShutdownTimeout, tasks, writers); err != nil {
+		tasksFinished = false
+		shutdownErr = errors.Join(shutdownErr, err)
+	}
+
+	if shutdownErr == nil {
+		log.Println("Server stopped")
+	}
+	return shutdownErr
+}
+
+// shutdownTasks shuts down the background tasks and then the activity log
+// writer, so that the entries the tasks log last are still written. Each
+// group gets timeout to finish.
+func shutdownTasks(timeout time.Duration, tasks, writers *background.Group) error {
+	var errs []error
+	tasksCtx, cancelTasks := context.WithTimeout(context.Background(), timeout)
+	defer cancelTasks()
+	if err := tasks.Shutdown(tasksCtx); err != nil {
+		errs = append(errs, fmt.Errorf("background tasks did not finish: %w", err))
+	}
+
+	writersCtx, cancelWriters := context.WithTimeout(context.Background(), timeout)
+	defer cancelWriters()
+	if err := writers.Shutdown(writersCtx); err != nil {
+		errs = append(errs, fmt.Errorf("activity log writer did not finish: %w", err))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"personal-notes-with-go/background"
+)
+
+// events records what happened, in order, from several goroutines
+type events struct {
+	mu   sync.Mutex
+	list []string
+}
+
+func (e *events) add(event string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.list = append(e.list, event)
+}
+
+func (e *events) get() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return slices.Clone(e.list)
+}
+
+func TestShutdownTasksStopsWritersLast(t *testing.T) {
+	var got events
+	tasks, writers := background.NewGroup(), background.NewGroup()
+
+	// A task still enqueues activity logs while it stops, so the writer
+	// must only be told to stop once every task has returned
+	tasks.Go("reminders", func(ctx context.Context) {
+		<-ctx.Done()
+		time.Sleep(20 * time.Millisecond)
+		got.add("task finished")
+	})
+	writers.Go("activity-log-writer", func(ctx context.Context) {
+		<-ctx.Done()
+		got.add("writer stopped")
+	})
+
+	if err := shutdownTasks(time.Second, tasks, writers); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"task finished", "writer stopped"}; !slices.Equal(got.get(), want) {
+		t.Errorf("shutdown order = %q, want %q", got.get(), want)
+	}
+}
+
+func TestShutdownTasksTimeouts(t *testing.T) {
+	old := log.Writer()
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(old)
+
+	release := make(chan struct{})
+	defer close(release)
+	stuck := func(ctx context.Context) { <-release }
+	stops := func(ctx context.Context) { <-ctx.Done() }
+
+	tests := []struct {
+		name          string
+		task, writer  func(ctx context.Context)
+		tasksFailed   bool
+		writersFailed bool
+	}{
+		{"tasks time out", stuck, stops, true, false},
+		{"writer times out", stops, stuck, false, true},
+		{"both time out", stuck, stuck, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tasks, writers := background.NewGroup(), background.NewGroup()
+			tasks.Go("task", tt.task)
+			writers.Go("writer", tt.writer)
+
+			// Each group gets the whole timeout, so a stuck task does not
+			// take the time of the writer
+			start := time.Now()
+			err := shutdownTasks(30*time.Millisecond, tasks, writers)
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("shutdownTasks() = %v, want context.DeadlineExceeded", err)
+			}
+			if got := strings.Contains(err.Error(), "background tasks did not finish"); got != tt.tasksFailed {
+				t.Errorf("error %q reports the tasks: %v, want %v", err, got, tt.tasksFailed)
+			}
+			if got := strings.Contains(err.Error(), "activity log writer did not finish"); got != tt.writersFailed {
+				t.Errorf("error %q reports the writer: %v, want %v", err, got, tt.writersFailed)
+			}
+			if tt.tasksFailed && tt.writersFailed && time.Since(start) < 60*time.Millisecond {
+				t.Errorf("both groups timed out within %s, want a timeout each", time.Since(start))
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package cli
+
+import (
+	"personal-notes-with-go/tui"
+)
+
+// runTUI opens the full-screen terminal UI on the local database
+func runTUI(args []string) error {
+	fs := newFlagSet("tui")
+	cfg, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+
+	v, err := openVault(cfg)
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	return tui.New(v.categories, v.notes, editNoteText).Run()
+}
@@ -0,0 +1,238 @@
+package cli
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"personal-notes-with-go/config"
+	"personal-notes-with-go/database"
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/repositories"
+	"personal-notes-with-go/settings"
+	"personal-notes-with-go/utils"
+	"slices"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// vault gives commands access to the SQLite database through the same
+// encrypting repositories used by the HTTP handlers
+type vault struct {
+	cfg          *config.Config
+	db           *sql.DB
+	categories   repositories.CategoryRepositoryInterface
+	notes        repositories.NoteRepositoryInterface
+	checklists   repositories.ChecklistRepositoryInterface
+	activityLogs *repositories.ActivityLogRepository
+}
+
+// parseFlags parses args into fs, including the configuration flags,
+// resolves the configuration and applies its priority levels
+func parseFlags(fs *flag.FlagSet, args []string) (*config.Config, error) {
+	cfgFlags := config.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		// The flag package has already printed the error and usage
+		return nil, errUsage
+	}
+	cfg, err := cfgFlags.Load()
+	if err != nil {
+		return nil, err
+	}
+	priorities, err := cfg.PriorityLevels()
+	if err != nil {
+		return nil, err
+	}
+	models.SetPriorities(priorities)
+	return cfg, nil
+}
+
+// openVault initializes encryption and opens the database described by cfg.
+// Commands working on encrypted data must not continue with an invalid key,
+// so an encryption failure is returned as an error.
+func openVault(cfg *config.Config) (*vault, error) {
+	if err := initEncryption(cfg); err != nil {
+		return nil, fmt.Errorf("failed to initialize encryption: %w", err)
+	}
+
+	db, err := database.InitDB(cfg.DBPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize database: %w", err)
+	}
+
+	activityLogRepo := repositories.NewActivityLogRepository(db)
+	if err := activityLogRepo.CreateTable(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create activity logs table: %w", err)
+	}
+	if _, err := repositories.UpdateBlindIndexes(db, utils.DefaultCipher(), utils.DefaultBlindIndex(), false); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if _, err := repositories.MigrateLegacyTags(db, utils.DefaultCipher(), utils.DefaultBlindIndex()); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &vault{
+		cfg:          cfg,
+		db:           db,
+		categories:   repositories.NewEncryptedCategoryRepository(repositories.NewCategoryRepository(db), utils.DefaultCipher()),
+		notes:        repositories.NewTransactionalNoteRepository(db, utils.DefaultCipher(), utils.DefaultBlindIndex()),
+		checklists:   repositories.NewEncryptedChecklistRepository(repositories.NewChecklistRepository(db), utils.DefaultCipher()),
+		activityLogs: activityLogRepo,
+	}, nil
+}
+
+// Environment variables holding passphrases when a command is not run from
+// a terminal: the one of the passphrase key provider and the one protecting
+// backup archives
+const (
+	envPassphrase       = "NOTES_PASSPHRASE"
+	envBackupPassphrase = "NOTES_BACKUP_PASSPHRASE"
+)
+
+// initEncryption sets up the cipher and key provider selected in cfg, and
+// the blind index with its key from the settings file. The blind index is
+// set up first, so that encryption is not valid without it.
+func initEncryption(cfg *config.Config) error {
+	settings.SetFilePath(cfg.SettingsPath)
+	key, err := settings.LoadBlindIndexKey()
+	if err != nil {
+		return fmt.Errorf("failed to load blind index key: %w", err)
+	}
+	if err := utils.InitBlindIndex(key); err != nil {
+		return err
+	}
+	return utils.InitEncryptionWith(keyProvider(cfg), cfg.Cipher)
+}
+
+// keyProvider returns the key provider selected in cfg
+func keyProvider(cfg *config.Config) utils.KeyProvider {
+	switch cfg.KeyProvider {
+	case utils.KeyProviderEnv:
+		return utils.EnvKeyProvider{Variable: cfg.KeyEnv}
+	case utils.KeyProviderFile:
+		return utils.KeyFileProvider{Path: cfg.KeyFile}
+	case utils.KeyProviderPassphrase:
+		return utils.PassphraseKeyProvider{Passphrase: readPassphrase, SaltPath: cfg.SaltPath()}
+	default:
+		return utils.SettingsKeyProvider{}
+	}
+}
+
+// readPassphrase reads the passphrase of the passphrase key provider
+func readPassphrase() (string, error) {
+	return readSecret(envPassphrase, "Passphrase", false)
+}
+
+// readSecret reads a secret from the environment variable env or, failing
+// that, asks for it on the terminal without echoing it. With confirm the
+// secret has to be typed twice.
+func readSecret(env, prompt string, confirm bool) (string, error) {
+	if secret := os.Getenv(env); secret != "" {
+		return secret, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("no %s: set %s or run from a terminal", strings.ToLower(prompt), env)
+	}
+	read := func(prompt string) (string, error) {
+		fmt.Fprint(stderr, prompt+": ")
+		secret, err := term.ReadPassword(fd)
+		fmt.Fprintln(stderr)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", strings.ToLower(prompt), err)
+		}
+		return string(secret), nil
+	}
+
+	secret, err := read(prompt)
+	if err != nil || !confirm {
+		return secret, err
+	}
+	again, err := read("Repeat " + strings.ToLower(prompt))
+	if err != nil {
+		return "", err
+	}
+	if again != secret {
+		return "", fmt.Errorf("%ss do not match", strings.ToLower(prompt))
+	}
+	return secret, nil
+}
+
+// Close closes the underlying database
+func (v *vault) Close() error {
+	return v.db.Close()
+}
+
+// logActivity records an activity performed from the command line
+func (v *vault) logActivity(action, entityType, description string) {
+	v.activityLogs.LogActivity(action, entityType, 0, description, 1, "cli")
+}
+
+// findCategory looks a category up by ID, path or name, as lookupCategory
+// does
+func (v *vault) findCategory(ref string) (*models.Category, error) {
+	if category, err := v.categories.GetByID(ref); err == nil {
+		return category, nil
+	}
+
+	categories, err := v.categories.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	return lookupCategory(categories, ref)
+}
+
+// lookupCategory finds a category by ID or, failing that, by its path of
+// names separated by "/", such as "Work/Projects", or by its name alone.
+// Names are compared ignoring case. A name shared by categories under
+// different parents is ambiguous and has to be given as a path.
+func lookupCategory(categories []models.Category, ref string) (*models.Category, error) {
+	for i := range categories {
+		if categories[i].ID == ref {
+			return &categories[i], nil
+		}
+	}
+
+	want := splitCategoryPath(ref)
+	var matches []*models.Category
+	for i := range categories {
+		path := splitCategoryPath(models.CategoryPath(categories, categories[i].ID))
+		if len(want) > 1 && slices.EqualFunc(path, want, strings.EqualFold) {
+			return &categories[i], nil
+		}
+		if len(want) == 1 && strings.EqualFold(categories[i].Name, want[0]) {
+			matches = append(matches, &categories[i])
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, utils.ErrCategoryNotFound
+	case 1:
+		return matches[0], nil
+	}
+	paths := make([]string, len(matches))
+	for i, cat := range matches {
+		paths[i] = strings.ReplaceAll(models.CategoryPath(categories, cat.ID), " / ", "/")
+	}
+	sort.Strings(paths)
+	return nil, fmt.Errorf("category name %q is ambiguous, use one of %s", ref, strings.Join(paths, ", "))
+}
+
+// splitCategoryPath splits a category path into trimmed names
+func splitCategoryPath(path string) []string {
+	names := strings.Split(path, "/")
+	for i := range names {
+		names[i] = strings.TrimSpace(names[i])
+	}
+	return names
+}
@@ -0,0 +1,183 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"personal-notes-with-go/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client talks to a running server over its HTTP API. The wire format is
+// the same models used by the handlers.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// APIError is returned when the server answers with a non-2xx status
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// NoteListOptions are the filters supported by GET /notes
+type NoteListOptions struct {
+	CategoryID string
+	// Recursive extends CategoryID to its subcategories
+	Recursive bool
+	// Tags limits the list to notes carrying all of these tags
+	Tags []string
+	// Priorities limits the list to notes with any of these priorities
+	Priorities []string
+	// IncludeArchived also lists archived notes
+	IncludeArchived bool
+	// Favorites limits the list to favorite notes
+	Favorites bool
+	// DueBefore limits the list to notes due before this time
+	DueBefore *time.Time
+	// Limit is the maximum number of notes to return, 0 returns all notes
+	Limit int
+}
+
+// New creates a client for the server at baseURL, e.g. http://localhost:8080
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// ListNotes returns the notes matching opts
+func (c *Client) ListNotes(opts NoteListOptions) ([]models.Note, error) {
+	query := url.Values{}
+	if opts.CategoryID != "" {
+		query.Set("category_id", opts.CategoryID)
+		if opts.Recursive {
+			query.Set("recursive", "true")
+		}
+	}
+	for _, tag := range opts.Tags {
+		query.Add("tag", tag)
+	}
+	for _, priority := range opts.Priorities {
+		query.Add("priority", priority)
+	}
+	if opts.IncludeArchived {
+		query.Set("include_archived", "true")
+	}
+	if opts.Favorites {
+		query.Set("favorite", "true")
+	}
+	if opts.DueBefore != nil {
+		query.Set("due_before", opts.DueBefore.Format(time.RFC3339))
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	} else {
+		query.Set("all", "true")
+	}
+
+	var notes []models.Note
+	if err := c.do(http.MethodGet, "/notes?"+query.Encode(), nil, &notes); err != nil {
+		return nil, err
+	}
+	return notes, nil
+}
+
+// GetNote returns a single note
+func (c *Client) GetNote(id string) (*models.Note, error) {
+	var note models.Note
+	if err := c.do(http.MethodGet, "/notes/"+url.PathEscape(id), nil, &note); err != nil {
+		return nil, err
+	}
+	return &note, nil
+}
+
+// CreateNote creates a note and returns it as stored by the server
+func (c *Client) CreateNote(note *models.Note) (*models.Note, error) {
+	var created models.Note
+	if err := c.do(http.MethodPost, "/notes", note, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdateNote replaces all fields of the note with the given ID
+func (c *Client) UpdateNote(note *models.Note) (*models.Note, error) {
+	var updated models.Note
+	if err := c.do(http.MethodPut, "/notes/"+url.PathEscape(note.ID), note, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// DeleteNote deletes the note with the given ID
+func (c *Client) DeleteNote(id string) error {
+	return c.do(http.MethodDelete, "/notes/"+url.PathEscape(id), nil, nil)
+}
+
+// ListCategories returns all categories
+func (c *Client) ListCategories() ([]models.Category, error) {
+	var categories []models.Category
+	if err := c.do(http.MethodGet, "/categories", nil, &categories); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+// do sends a request with an optional JSON body and decodes the JSON
+// response into out when it is not nil
+func (c *Client) do(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach server: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var errBody struct {
+			Error string `json:"error"`
+		}
+		data, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(data, &errBody) != nil || errBody.Error == "" {
+			errBody.Error = strings.TrimSpace(string(data))
+		}
+		return &APIError{StatusCode: resp.StatusCode, Message: errBody.Error}
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,869 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"personal-notes-with-go/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the runtime configuration of the server.
+//
+// Values are resolved with the following precedence (highest first):
+// command-line flags, environment variables, the JSON config file and
+// finally the built-in defaults.
+type Config struct {
+	Host         string   `json:"host"`
+	Port         int      `json:"port"`
+	DBPath       string   `json:"db_path"`
+	SettingsPath string   `json:"settings_path"`
+	FrontendDir  string   `json:"frontend_dir"`
+	CORSOrigins  []string `json:"cors_origins"`
+	OpenBrowser  bool     `json:"open_browser"`
+
+	// ShutdownTimeout bounds how long the server waits for in-flight
+	// requests and background tasks when stopping
+	ShutdownTimeout time.Duration `json:"shutdown_timeout"`
+	// ActivityLogRetentionDays enables a background job deleting activity
+	// logs older than this many days; 0 keeps logs forever
+	ActivityLogRetentionDays int `json:"activity_log_retention_days"`
+
+	// Activity logs are queued and written in batches. When the queue is
+	// full the policy either blocks the request ("block") or drops the
+	// entry and counts it ("drop").
+	ActivityLogQueueSize     int           `json:"activity_log_queue_size"`
+	ActivityLogBatchSize     int           `json:"activity_log_batch_size"`
+	ActivityLogFlushInterval time.Duration `json:"activity_log_flush_interval"`
+	ActivityLogQueuePolicy   string        `json:"activity_log_queue_policy"`
+
+	// Cipher is the algorithm used to encrypt notes and categories and
+	// KeyProvider where its key comes from: "settings" (settings.json),
+	// "env" (the variable named by KeyEnv), "file" (KeyFile) or
+	// "passphrase" (derived from a passphrase with the salt in KeySaltFile)
+	Cipher      string `json:"cipher"`
+	KeyProvider string `json:"key_provider"`
+	KeyEnv      string `json:"key_env"`
+	KeyFile     string `json:"key_file"`
+	KeySaltFile string `json:"key_salt_file"`
+
+	// BackupDir is where backup archives are written. When BackupInterval
+	// is positive the server writes one every interval and keeps the
+	// newest BackupRetention archives; 0 keeps them all.
+	BackupDir       string        `json:"backup_dir"`
+	BackupInterval  time.Duration `json:"backup_interval"`
+	BackupRetention int           `json:"backup_retention"`
+
+	// ReminderInterval is how often the server looks for reminders that are
+	// due, 0 to never deliver them. Reminders go to the browsers showing the
+	// frontend, to ReminderWebhookURL as a JSON POST and to ReminderCommand,
+	// when those are set. ReminderSnooze is how far a reminder is put off
+	// when snoozed without a duration.
+	ReminderInterval   time.Duration `json:"reminder_interval"`
+	ReminderWebhookURL string        `json:"reminder_webhook_url"`
+	ReminderCommand    string        `json:"reminder_command"`
+	ReminderSnooze     time.Duration `json:"reminder_snooze"`
+
+	// RecurrenceInterval is how often the server moves on recurring notes
+	// whose time has come, 0 to never move them on
+	RecurrenceInterval time.Duration `json:"recurrence_interval"`
+
+	// Priorities lists the priority levels notes may have, from lowest to
+	// highest, and DefaultPriority the one given to notes without a
+	// priority
+	Priorities      []string `json:"priorities"`
+	DefaultPriority string   `json:"default_priority"`
+}
+
+// fileConfig mirrors Config with pointer fields so we can tell which keys
+// were actually present in the config file.
+type fileConfig struct {
+	Host         *string  `json:"host"`
+	Port         *int     `json:"port"`
+	DBPath       *string  `json:"db_path"`
+	SettingsPath *string  `json:"settings_path"`
+	FrontendDir  *string  `json:"frontend_dir"`
+	CORSOrigins  []string `json:"cors_origins"`
+	OpenBrowser  *bool    `json:"open_browser"`
+
+	ShutdownTimeout          *string `json:"shutdown_timeout"`
+	ActivityLogRetentionDays *int    `json:"activity_log_retention_days"`
+
+	ActivityLogQueueSize     *int    `json:"activity_log_queue_size"`
+	ActivityLogBatchSize     *int    `json:"activity_log_batch_size"`
+	ActivityLogFlushInterval *string `json:"activity_log_flush_interval"`
+	ActivityLogQueuePolicy   *string `json:"activity_log_queue_policy"`
+
+	Cipher      *string `json:"cipher"`
+	KeyProvider *string `json:"key_provider"`
+	KeyEnv      *string `json:"key_env"`
+	KeyFile     *string `json:"key_file"`
+	KeySaltFile *string `json:"key_salt_file"`
+
+	BackupDir       *string `json:"backup_dir"`
+	BackupInterval  *string `json:"backup_interval"`
+	BackupRetention *int    `json:"backup_retention"`
+
+	ReminderInterval   *string `json:"reminder_interval"`
+	ReminderWebhookURL *string `json:"reminder_webhook_url"`
+	ReminderCommand    *string `json:"reminder_command"`
+	ReminderSnooze     *string `json:"reminder_snooze"`
+
+	RecurrenceInterval *string `json:"recurrence_interval"`
+
+	Priorities      []string `json:"priorities"`
+	DefaultPriority *string  `json:"default_priority"`
+}
+
+// Environment variables recognised by Flags.Load
+const (
+	EnvConfigFile   = "NOTES_CONFIG"
+	EnvHost         = "NOTES_HOST"
+	EnvPort         = "NOTES_PORT"
+	EnvDBPath       = "NOTES_DB_PATH"
+	EnvSettingsPath = "NOTES_SETTINGS_PATH"
+	EnvFrontendDir  = "NOTES_FRONTEND_DIR"
+	EnvCORSOrigins  = "NOTES_CORS_ORIGINS"
+	EnvOpenBrowser  = "NOTES_OPEN_BROWSER"
+
+	EnvShutdownTimeout          = "NOTES_SHUTDOWN_TIMEOUT"
+	EnvActivityLogRetentionDays = "NOTES_ACTIVITY_LOG_RETENTION_DAYS"
+	EnvActivityLogQueueSize     = "NOTES_ACTIVITY_LOG_QUEUE_SIZE"
+	EnvActivityLogBatchSize     = "NOTES_ACTIVITY_LOG_BATCH_SIZE"
+	EnvActivityLogFlushInterval = "NOTES_ACTIVITY_LOG_FLUSH_INTERVAL"
+	EnvActivityLogQueuePolicy   = "NOTES_ACTIVITY_LOG_QUEUE_POLICY"
+
+	EnvCipher      = "NOTES_CIPHER"
+	EnvKeyProvider = "NOTES_KEY_PROVIDER"
+	EnvKeyEnv      = "NOTES_KEY_ENV"
+	EnvKeyFile     = "NOTES_KEY_FILE"
+	EnvKeySaltFile = "NOTES_KEY_SALT_FILE"
+
+	EnvBackupDir       = "NOTES_BACKUP_DIR"
+	EnvBackupInterval  = "NOTES_BACKUP_INTERVAL"
+	EnvBackupRetention = "NOTES_BACKUP_RETENTION"
+
+	EnvReminderInterval   = "NOTES_REMINDER_INTERVAL"
+	EnvReminderWebhookURL = "NOTES_REMINDER_WEBHOOK_URL"
+	EnvReminderCommand    = "NOTES_REMINDER_COMMAND"
+	EnvReminderSnooze     = "NOTES_REMINDER_SNOOZE"
+
+	EnvRecurrenceInterval = "NOTES_RECURRENCE_INTERVAL"
+
+	EnvPriorities      = "NOTES_PRIORITIES"
+	EnvDefaultPriority = "NOTES_DEFAULT_PRIORITY"
+
+	// envNoBrowser is kept for backwards compatibility with older setups
+	envNoBrowser = "NO_BROWSER"
+)
+
+// Default returns the configuration used when nothing else is specified
+func Default() *Config {
+	return &Config{
+		Host:         "",
+		Port:         8080,
+		DBPath:       "./db.sqlite3",
+		SettingsPath: "settings.json",
+		FrontendDir:  "./frontend",
+		CORSOrigins:  []string{"*"},
+		OpenBrowser:  true,
+
+		ShutdownTimeout:          15 * time.Second,
+		ActivityLogRetentionDays: 0,
+
+		ActivityLogQueueSize:     1024,
+		ActivityLogBatchSize:     64,
+		ActivityLogFlushInterval: time.Second,
+		ActivityLogQueuePolicy:   "block",
+
+		Cipher:      "aes-256-gcm",
+		KeyProvider: "settings",
+		KeyEnv:      "NOTES_ENCRYPTION_KEY",
+
+		BackupDir:       "backups",
+		BackupInterval:  0,
+		BackupRetention: 7,
+
+		ReminderInterval: time.Minute,
+		ReminderSnooze:   10 * time.Minute,
+
+		RecurrenceInterval: time.Minute,
+
+		Priorities:      append([]string(nil), models.DefaultPriorityNames...),
+		DefaultPriority: models.DefaultPriority,
+	}
+}
+
+// Flags holds the configuration flags registered on a flag set
+type Flags struct {
+	fs           *flag.FlagSet
+	configFile   string
+	host         string
+	port         int
+	dbPath       string
+	settingsPath string
+	frontendDir  string
+	corsOrigins  string
+	openBrowser  bool
+
+	shutdownTimeout          time.Duration
+	activityLogRetentionDays int
+	activityLogQueueSize     int
+	activityLogBatchSize     int
+	activityLogFlushInterval time.Duration
+	activityLogQueuePolicy   string
+
+	cipher      string
+	keyProvider string
+	keyEnv      string
+	keyFile     string
+	keySaltFile string
+
+	backupDir       string
+	backupInterval  time.Duration
+	backupRetention int
+
+	reminderInterval   time.Duration
+	reminderWebhookURL string
+	reminderCommand    string
+	reminderSnooze     time.Duration
+	recurrenceInterval time.Duration
+
+	priorities      string
+	defaultPriority string
+}
+
+// RegisterFlags registers the configuration flags on fs. After fs has been
+// parsed, call Load on the result to resolve the final configuration.
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	def := Default()
+	f := &Flags{fs: fs}
+	fs.StringVar(&f.configFile, "config", "", "path to a JSON config file (env "+EnvConfigFile+")")
+	fs.StringVar(&f.host, "host", def.Host, "address to bind to, empty for all interfaces (env "+EnvHost+")")
+	fs.IntVar(&f.port, "port", def.Port, "port to listen on (env "+EnvPort+")")
+	fs.StringVar(&f.dbPath, "db", def.DBPath, "path to the SQLite database (env "+EnvDBPath+")")
+	fs.StringVar(&f.settingsPath, "settings", def.SettingsPath, "path to settings.json holding the encryption key (env "+EnvSettingsPath+")")
+	fs.StringVar(&f.frontendDir, "frontend", def.FrontendDir, "directory with the frontend files (env "+EnvFrontendDir+")")
+	fs.StringVar(&f.corsOrigins, "cors-origins", strings.Join(def.CORSOrigins, ","), "comma-separated list of allowed CORS origins, * for any (env "+EnvCORSOrigins+")")
+	fs.BoolVar(&f.openBrowser, "open-browser", def.OpenBrowser, "open the frontend in a browser on startup (env "+EnvOpenBrowser+")")
+	fs.DurationVar(&f.shutdownTimeout, "shutdown-timeout", def.ShutdownTimeout, "time to wait for requests and background tasks on shutdown (env "+EnvShutdownTimeout+")")
+	fs.IntVar(&f.activityLogRetentionDays, "activity-log-retention-days", def.ActivityLogRetentionDays, "delete activity logs older than this many days, 0 to keep them (env "+EnvActivityLogRetentionDays+")")
+	fs.IntVar(&f.activityLogQueueSize, "activity-log-queue-size", def.ActivityLogQueueSize, "number of activity logs that can wait to be written (env "+EnvActivityLogQueueSize+")")
+	fs.IntVar(&f.activityLogBatchSize, "activity-log-batch-size", def.ActivityLogBatchSize, "maximum number of activity logs written per transaction (env "+EnvActivityLogBatchSize+")")
+	fs.DurationVar(&f.activityLogFlushInterval, "activity-log-flush-interval", def.ActivityLogFlushInterval, "how often queued activity logs are written (env "+EnvActivityLogFlushInterval+")")
+	fs.StringVar(&f.activityLogQueuePolicy, "activity-log-queue-policy", def.ActivityLogQueuePolicy, "what to do when the activity log queue is full: block or drop (env "+EnvActivityLogQueuePolicy+")")
+	fs.StringVar(&f.cipher, "cipher", def.Cipher, "encryption algorithm: aes-256-gcm or xchacha20-poly1305 (env "+EnvCipher+")")
+	fs.StringVar(&f.keyProvider, "key-provider", def.KeyProvider, "where the encryption key comes from: settings, env, file or passphrase (env "+EnvKeyProvider+")")
+	fs.StringVar(&f.keyEnv, "key-env", def.KeyEnv, "environment variable holding the base64 key for the env key provider (env "+EnvKeyEnv+")")
+	fs.StringVar(&f.keyFile, "key-file", def.KeyFile, "file holding the key for the file key provider (env "+EnvKeyFile+")")
+	fs.StringVar(&f.keySaltFile, "key-salt-file", def.KeySaltFile, "salt file for the passphrase key provider, default key.salt next to the settings file (env "+EnvKeySaltFile+")")
+	fs.StringVar(&f.backupDir, "backup-dir", def.BackupDir, "directory backup archives are written to (env "+EnvBackupDir+")")
+	fs.DurationVar(&f.backupInterval, "backup-interval", def.BackupInterval, "write a backup archive this often while serving, 0 to disable (env "+EnvBackupInterval+")")
+	fs.IntVar(&f.backupRetention, "backup-retention", def.BackupRetention, "number of scheduled backup archives to keep, 0 to keep all (env "+EnvBackupRetention+")")
+	fs.DurationVar(&f.reminderInterval, "reminder-interval", def.ReminderInterval, "look for due reminders this often while serving, 0 to disable (env "+EnvReminderInterval+")")
+	fs.StringVar(&f.reminderWebhookURL, "reminder-webhook-url", def.ReminderWebhookURL, "URL reminders are POSTed to as JSON (env "+EnvReminderWebhookURL+")")
+	fs.StringVar(&f.reminderCommand, "reminder-command", def.ReminderCommand, "command run for each reminder with the note subject as last argument (env "+EnvReminderCommand+")")
+	fs.DurationVar(&f.reminderSnooze, "reminder-snooze", def.ReminderSnooze, "how long a reminder is snoozed by default (env "+EnvReminderSnooze+")")
+	fs.DurationVar(&f.recurrenceInterval, "recurrence-interval", def.RecurrenceInterval, "move on recurring notes this often while serving, 0 to disable (env "+EnvRecurrenceInterval+")")
+	fs.StringVar(&f.priorities, "priorities", strings.Join(def.Priorities, ","), "comma-separated priority levels of notes, from lowest to highest (env "+EnvPriorities+")")
+	fs.StringVar(&f.defaultPriority, "default-priority", def.DefaultPriority, "priority of notes created without one (env "+EnvDefaultPriority+")")
+	return f
+}
+
+// Load resolves the final configuration from the parsed flags, the
+// environment and the config file. The returned config has been checked
+// with Validate; commands that serve HTTP must call ValidateServer as well.
+func (f *Flags) Load() (*Config, error) {
+	cfg := Default()
+
+	// Config file
+	configFile := f.configFile
+	if configFile == "" {
+		configFile = os.Getenv(EnvConfigFile)
+	}
+	if configFile != "" {
+		if err := cfg.loadFile(configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	// Environment variables
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	// Command-line flags, only the ones that were explicitly set
+	f.fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "host":
+			cfg.Host = f.host
+		case "port":
+			cfg.Port = f.port
+		case "db":
+			cfg.DBPath = f.dbPath
+		case "settings":
+			cfg.SettingsPath = f.settingsPath
+		case "frontend":
+			cfg.FrontendDir = f.frontendDir
+		case "cors-origins":
+			cfg.CORSOrigins = splitList(f.corsOrigins)
+		case "open-browser":
+			cfg.OpenBrowser = f.openBrowser
+		case "shutdown-timeout":
+			cfg.ShutdownTimeout = f.shutdownTimeout
+		case "activity-log-retention-days":
+			cfg.ActivityLogRetentionDays = f.activityLogRetentionDays
+		case "activity-log-queue-size":
+			cfg.ActivityLogQueueSize = f.activityLogQueueSize
+		case "activity-log-batch-size":
+			cfg.ActivityLogBatchSize = f.activityLogBatchSize
+		case "activity-log-flush-interval":
+			cfg.ActivityLogFlushInterval = f.activityLogFlushInterval
+		case "activity-log-queue-policy":
+			cfg.ActivityLogQueuePolicy = f.activityLogQueuePolicy
+		case "cipher":
+			cfg.Cipher = f.cipher
+		case "key-provider":
+			cfg.KeyProvider = f.keyProvider
+		case "key-env":
+			cfg.KeyEnv = f.keyEnv
+		case "key-file":
+			cfg.KeyFile = f.keyFile
+		case "key-salt-file":
+			cfg.KeySaltFile = f.keySaltFile
+		case "backup-dir":
+			cfg.BackupDir = f.backupDir
+		case "backup-interval":
+			cfg.BackupInterval = f.backupInterval
+		case "backup-retention":
+			cfg.BackupRetention = f.backupRetention
+		case "reminder-interval":
+			cfg.ReminderInterval = f.reminderInterval
+		case "reminder-webhook-url":
+			cfg.ReminderWebhookURL = f.reminderWebhookURL
+		case "reminder-command":
+			cfg.ReminderCommand = f.reminderCommand
+		case "reminder-snooze":
+			cfg.ReminderSnooze = f.reminderSnooze
+		case "recurrence-interval":
+			cfg.RecurrenceInterval = f.recurrenceInterval
+		case "priorities":
+			cfg.Priorities = splitList(f.priorities)
+		case "default-priority":
+			cfg.DefaultPriority = f.defaultPriority
+		}
+	})
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// loadFile applies the values found in a JSON config file. Relative paths
+// in the file are resolved against the directory of the file itself so the
+// server behaves the same regardless of the working directory.
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var fc fileConfig
+	if err := json.Unmarshal(data, &fc); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	baseDir := filepath.Dir(path)
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(baseDir, p)
+	}
+
+	if fc.Host != nil {
+		c.Host = *fc.Host
+	}
+	if fc.Port != nil {
+		c.Port = *fc.Port
+	}
+	if fc.DBPath != nil {
+		c.DBPath = resolve(*fc.DBPath)
+	}
+	if fc.SettingsPath != nil {
+		c.SettingsPath = resolve(*fc.SettingsPath)
+	}
+	if fc.FrontendDir != nil {
+		c.FrontendDir = resolve(*fc.FrontendDir)
+	}
+	if fc.CORSOrigins != nil {
+		c.CORSOrigins = fc.CORSOrigins
+	}
+	if fc.OpenBrowser != nil {
+		c.OpenBrowser = *fc.OpenBrowser
+	}
+	if fc.ShutdownTimeout != nil {
+		timeout, err := time.ParseDuration(*fc.ShutdownTimeout)
+		if err != nil {
+			return fmt.Errorf("invalid shutdown_timeout in %s: %w", path, err)
+		}
+		c.ShutdownTimeout = timeout
+	}
+	if fc.ActivityLogRetentionDays != nil {
+		c.ActivityLogRetentionDays = *fc.ActivityLogRetentionDays
+	}
+	if fc.ActivityLogQueueSize != nil {
+		c.ActivityLogQueueSize = *fc.ActivityLogQueueSize
+	}
+	if fc.ActivityLogBatchSize != nil {
+		c.ActivityLogBatchSize = *fc.ActivityLogBatchSize
+	}
+	if fc.ActivityLogFlushInterval != nil {
+		interval, err := time.ParseDuration(*fc.ActivityLogFlushInterval)
+		if err != nil {
+			return fmt.Errorf("invalid activity_log_flush_interval in %s: %w", path, err)
+		}
+		c.ActivityLogFlushInterval = interval
+	}
+	if fc.ActivityLogQueuePolicy != nil {
+		c.ActivityLogQueuePolicy = *fc.ActivityLogQueuePolicy
+	}
+	if fc.Cipher != nil {
+		c.Cipher = *fc.Cipher
+	}
+	if fc.KeyProvider != nil {
+		c.KeyProvider = *fc.KeyProvider
+	}
+	if fc.KeyEnv != nil {
+		c.KeyEnv = *fc.KeyEnv
+	}
+	if fc.KeyFile != nil {
+		c.KeyFile = resolve(*fc.KeyFile)
+	}
+	if fc.KeySaltFile != nil {
+		c.KeySaltFile = resolve(*fc.KeySaltFile)
+	}
+	if fc.BackupDir != nil {
+		c.BackupDir = resolve(*fc.BackupDir)
+	}
+	if fc.BackupInterval != nil {
+		interval, err := time.ParseDuration(*fc.BackupInterval)
+		if err != nil {
+			return fmt.Errorf("invalid backup_interval in %s: %w", path, err)
+		}
+		c.BackupInterval = interval
+	}
+	if fc.BackupRetention != nil {
+		c.BackupRetention = *fc.BackupRetention
+	}
+	if fc.ReminderInterval != nil {
+		interval, err := time.ParseDuration(*fc.ReminderInterval)
+		if err != nil {
+			return fmt.Errorf("invalid reminder_interval in %s: %w", path, err)
+		}
+		c.ReminderInterval = interval
+	}
+	if fc.ReminderWebhookURL != nil {
+		c.ReminderWebhookURL = *fc.ReminderWebhookURL
+	}
+	if fc.ReminderCommand != nil {
+		c.ReminderCommand = *fc.ReminderCommand
+	}
+	if fc.ReminderSnooze != nil {
+		snooze, err := time.ParseDuration(*fc.ReminderSnooze)
+		if err != nil {
+			return fmt.Errorf("invalid reminder_snooze in %s: %w", path, err)
+		}
+		c.ReminderSnooze = snooze
+	}
+	if fc.RecurrenceInterval != nil {
+		interval, err := time.ParseDuration(*fc.RecurrenceInterval)
+		if err != nil {
+			return fmt.Errorf("invalid recurrence_interval in %s: %w", path, err)
+		}
+		c.RecurrenceInterval = interval
+	}
+	if fc.Priorities != nil {
+		c.Priorities = fc.Priorities
+	}
+	if fc.DefaultPriority != nil {
+		c.DefaultPriority = *fc.DefaultPriority
+	}
+
+	return nil
+}
+
+// loadEnv applies the values found in environment variables
+func (c *Config) loadEnv() error {
+	if v, ok := os.LookupEnv(EnvHost); ok {
+		c.Host = v
+	}
+	if v := os.Getenv(EnvPort); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %q is not a number", EnvPort, v)
+		}
+		c.Port = port
+	}
+	if v := os.Getenv(EnvDBPath); v != "" {
+		c.DBPath = v
+	}
+	if v := os.Getenv(EnvSettingsPath); v != "" {
+		c.SettingsPath = v
+	}
+	if v := os.Getenv(EnvFrontendDir); v != "" {
+		c.FrontendDir = v
+	}
+	if v, ok := os.LookupEnv(EnvCORSOrigins); ok {
+		c.CORSOrigins = splitList(v)
+	}
+	if os.Getenv(envNoBrowser) == "1" {
+		c.OpenBrowser = false
+	}
+	if v := os.Getenv(EnvOpenBrowser); v != "" {
+		open, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %q is not a boolean", EnvOpenBrowser, v)
+		}
+		c.OpenBrowser = open
+	}
+	if v := os.Getenv(EnvShutdownTimeout); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvShutdownTimeout, err)
+		}
+		c.ShutdownTimeout = timeout
+	}
+	if v := os.Getenv(EnvActivityLogRetentionDays); v != "" {
+		days, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %q is not a number", EnvActivityLogRetentionDays, v)
+		}
+		c.ActivityLogRetentionDays = days
+	}
+	if v := os.Getenv(EnvActivityLogQueueSize); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %q is not a number", EnvActivityLogQueueSize, v)
+		}
+		c.ActivityLogQueueSize = size
+	}
+	if v := os.Getenv(EnvActivityLogBatchSize); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %q is not a number", EnvActivityLogBatchSize, v)
+		}
+		c.ActivityLogBatchSize = size
+	}
+	if v := os.Getenv(EnvActivityLogFlushInterval); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvActivityLogFlushInterval, err)
+		}
+		c.ActivityLogFlushInterval = interval
+	}
+	if v := os.Getenv(EnvActivityLogQueuePolicy); v != "" {
+		c.ActivityLogQueuePolicy = v
+	}
+	if v := os.Getenv(EnvCipher); v != "" {
+		c.Cipher = v
+	}
+	if v := os.Getenv(EnvKeyProvider); v != "" {
+		c.KeyProvider = v
+	}
+	if v := os.Getenv(EnvKeyEnv); v != "" {
+		c.KeyEnv = v
+	}
+	if v := os.Getenv(EnvKeyFile); v != "" {
+		c.KeyFile = v
+	}
+	if v := os.Getenv(EnvKeySaltFile); v != "" {
+		c.KeySaltFile = v
+	}
+	if v := os.Getenv(EnvBackupDir); v != "" {
+		c.BackupDir = v
+	}
+	if v := os.Getenv(EnvBackupInterval); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvBackupInterval, err)
+		}
+		c.BackupInterval = interval
+	}
+	if v := os.Getenv(EnvBackupRetention); v != "" {
+		retention, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %q is not a number", EnvBackupRetention, v)
+		}
+		c.BackupRetention = retention
+	}
+	if v := os.Getenv(EnvReminderInterval); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvReminderInterval, err)
+		}
+		c.ReminderInterval = interval
+	}
+	if v, ok := os.LookupEnv(EnvReminderWebhookURL); ok {
+		c.ReminderWebhookURL = v
+	}
+	if v, ok := os.LookupEnv(EnvReminderCommand); ok {
+		c.ReminderCommand = v
+	}
+	if v := os.Getenv(EnvReminderSnooze); v != "" {
+		snooze, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvReminderSnooze, err)
+		}
+		c.ReminderSnooze = snooze
+	}
+	if v := os.Getenv(EnvRecurrenceInterval); v != "" {
+		interval, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", EnvRecurrenceInterval, err)
+		}
+		c.RecurrenceInterval = interval
+	}
+	if v := os.Getenv(EnvPriorities); v != "" {
+		c.Priorities = splitList(v)
+	}
+	if v := os.Getenv(EnvDefaultPriority); v != "" {
+		c.DefaultPriority = v
+	}
+	return nil
+}
+
+// Validate checks the paths shared by every command for values that would
+// make them fail later on, so that problems are reported at startup.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.DBPath == "" {
+		errs = append(errs, errors.New("database path cannot be empty"))
+	} else if err := checkParentDir(c.DBPath); err != nil {
+		errs = append(errs, fmt.Errorf("database path: %w", err))
+	}
+
+	if c.SettingsPath == "" {
+		errs = append(errs, errors.New("settings path cannot be empty"))
+	} else if err := checkParentDir(c.SettingsPath); err != nil {
+		errs = append(errs, fmt.Errorf("settings path: %w", err))
+	}
+
+	switch c.Cipher {
+	case "aes-256-gcm", "xchacha20-poly1305":
+	default:
+		errs = append(errs, fmt.Errorf("cipher must be aes-256-gcm or xchacha20-poly1305, got %q", c.Cipher))
+	}
+
+	switch c.KeyProvider {
+	case "settings", "passphrase":
+	case "env":
+		if c.KeyEnv == "" {
+			errs = append(errs, errors.New("the env key provider requires key_env"))
+		}
+	case "file":
+		if c.KeyFile == "" {
+			errs = append(errs, errors.New("the file key provider requires key_file"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("key provider must be settings, env, file or passphrase, got %q", c.KeyProvider))
+	}
+
+	if _, err := c.PriorityLevels(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// ValidateServer checks the settings that are only used when serving HTTP
+func (c *Config) ValidateServer() error {
+	var errs []error
+
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port must be between 1 and 65535, got %d", c.Port))
+	}
+
+	// Host names are resolved by net.Listen, so only their form is checked
+	if c.Host != "" && !validHost(c.Host) {
+		errs = append(errs, fmt.Errorf("host %q is not a valid host name or IP address", c.Host))
+	}
+
+	if c.FrontendDir == "" {
+		errs = append(errs, errors.New("frontend directory cannot be empty"))
+	} else if info, err := os.Stat(c.FrontendDir); err != nil {
+		errs = append(errs, fmt.Errorf("frontend directory: %w", err))
+	} else if !info.IsDir() {
+		errs = append(errs, fmt.Errorf("frontend directory %s is not a directory", c.FrontendDir))
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("shutdown timeout must be positive, got %s", c.ShutdownTimeout))
+	}
+
+	if c.ActivityLogRetentionDays < 0 {
+		errs = append(errs, fmt.Errorf("activity log retention must be 0 or more days, got %d", c.ActivityLogRetentionDays))
+	}
+
+	if c.ActivityLogQueueSize < 1 {
+		errs = append(errs, fmt.Errorf("activity log queue size must be at least 1, got %d", c.ActivityLogQueueSize))
+	}
+	if c.ActivityLogBatchSize < 1 {
+		errs = append(errs, fmt.Errorf("activity log batch size must be at least 1, got %d", c.ActivityLogBatchSize))
+	}
+	if c.ActivityLogFlushInterval <= 0 {
+		errs = append(errs, fmt.Errorf("activity log flush interval must be positive, got %s", c.ActivityLogFlushInterval))
+	}
+	if c.ActivityLogQueuePolicy != "block" && c.ActivityLogQueuePolicy != "drop" {
+		errs = append(errs, fmt.Errorf("activity log queue policy must be block or drop, got %q", c.ActivityLogQueuePolicy))
+	}
+
+	if c.BackupInterval < 0 {
+		errs = append(errs, fmt.Errorf("backup interval must be 0 or positive, got %s", c.BackupInterval))
+	} else if c.BackupInterval > 0 && c.BackupInterval < time.Minute {
+		errs = append(errs, fmt.Errorf("backup interval must be at least 1m, got %s", c.BackupInterval))
+	}
+	if c.BackupRetention < 0 {
+		errs = append(errs, fmt.Errorf("backup retention must be 0 or more archives, got %d", c.BackupRetention))
+	}
+	if c.BackupInterval > 0 && c.BackupDir == "" {
+		errs = append(errs, errors.New("scheduled backups require a backup directory"))
+	}
+
+	if c.ReminderInterval < 0 {
+		errs = append(errs, fmt.Errorf("reminder interval must be 0 or positive, got %s", c.ReminderInterval))
+	} else if c.ReminderInterval > 0 && c.ReminderInterval < time.Second {
+		errs = append(errs, fmt.Errorf("reminder interval must be at least 1s, got %s", c.ReminderInterval))
+	}
+	if c.ReminderSnooze <= 0 {
+		errs = append(errs, fmt.Errorf("reminder snooze must be positive, got %s", c.ReminderSnooze))
+	}
+	if c.RecurrenceInterval < 0 {
+		errs = append(errs, fmt.Errorf("recurrence interval must be 0 or positive, got %s", c.RecurrenceInterval))
+	} else if c.RecurrenceInterval > 0 && c.RecurrenceInterval < time.Second {
+		errs = append(errs, fmt.Errorf("recurrence interval must be at least 1s, got %s", c.RecurrenceInterval))
+	}
+	if c.ReminderWebhookURL != "" {
+		u, err := url.Parse(c.ReminderWebhookURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid reminder webhook URL %q, expected an http or https URL", c.ReminderWebhookURL))
+		}
+	}
+
+	if len(c.CORSOrigins) == 0 {
+		errs = append(errs, errors.New("at least one CORS origin is required, use * to allow any"))
+	}
+	for _, origin := range c.CORSOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid CORS origin %q, expected scheme://host[:port]", origin))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid server configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// Addr returns the address the HTTP server should listen on
+func (c *Config) Addr() string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+}
+
+// BaseURL returns the URL at which the server can be reached locally
+func (c *Config) BaseURL() string {
+	host := c.Host
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, strconv.Itoa(c.Port))
+}
+
+// SaltPath returns the salt file of the passphrase key provider
+func (c *Config) SaltPath() string {
+	if c.KeySaltFile != "" {
+		return c.KeySaltFile
+	}
+	return filepath.Join(filepath.Dir(c.SettingsPath), "key.salt")
+}
+
+// PriorityLevels returns the priority levels of Priorities and
+// DefaultPriority
+func (c *Config) PriorityLevels() (*models.Priorities, error) {
+	return models.NewPriorities(c.Priorities, c.DefaultPriority)
+}
+
+// AllowAllOrigins reports whether CORS should accept any origin
+func (c *Config) AllowAllOrigins() bool {
+	for _, origin := range c.CORSOrigins {
+		if origin == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// validHost reports whether host is an IP address, optionally with an IPv6
+// zone, or a host name as described by RFC 1123
+func validHost(host string) bool {
+	if _, err := netip.ParseAddr(host); err == nil {
+		return true
+	}
+	name := strings.TrimSuffix(host, ".")
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '-' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// checkParentDir makes sure the directory that will contain path exists
+func checkParentDir(path string) error {
+	dir := filepath.Dir(path)
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("directory %s does not exist", dir)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return nil
+}
+
+// splitList splits a comma-separated list and drops empty entries
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
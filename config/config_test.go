@@ -0,0 +1,256 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearEnv unsets every variable Load reads for the rest of the test
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(name, "NOTES_") || name == envNoBrowser {
+			t.Setenv(name, "")
+			os.Unsetenv(name)
+		}
+	}
+}
+
+// load resolves the configuration for the command-line args as Load does
+// for the serve command
+func load(t *testing.T, args ...string) (*Config, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	f := RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return f.Load()
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "data"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(dir, "config.json")
+	err := os.WriteFile(configFile, []byte(`{
+		"host": "file.lan",
+		"port": 8001,
+		"db_path": "data/file.db",
+		"shutdown_timeout": "20s",
+		"cors_origins": ["http://file.example"],
+		"open_browser": false
+	}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileDB := filepath.Join(dir, "data", "file.db")
+	envDB := filepath.Join(dir, "env.db")
+	flagDB := filepath.Join(dir, "flag.db")
+
+	type want struct {
+		host        string
+		port        int
+		db          string
+		timeout     time.Duration
+		cors        []string
+		openBrowser bool
+	}
+	defaults := want{"", 8080, "./db.sqlite3", 15 * time.Second, []string{"*"}, true}
+	fromFile := want{"file.lan", 8001, fileDB, 20 * time.Second, []string{"http://file.example"}, false}
+	fromEnv := want{"env.lan", 8002, envDB, 30 * time.Second, []string{"http://env.example"}, true}
+	fromFlags := want{"flag.lan", 8003, flagDB, 40 * time.Second, []string{"http://flag.example"}, false}
+
+	allEnv := map[string]string{
+		EnvHost:            "env.lan",
+		EnvPort:            "8002",
+		EnvDBPath:          envDB,
+		EnvShutdownTimeout: "30s",
+		EnvCORSOrigins:     "http://env.example",
+		EnvOpenBrowser:     "true",
+	}
+	allFlags := []string{
+		"-host", "flag.lan",
+		"-port", "8003",
+		"-db", flagDB,
+		"-shutdown-timeout", "40s",
+		"-cors-origins", " http://flag.example, ",
+		"-open-browser=false",
+	}
+
+	tests := []struct {
+		name  string
+		env   map[string]string
+		flags []string
+		want  want
+	}{
+		{"defaults", nil, nil, defaults},
+		{"file", map[string]string{EnvConfigFile: configFile}, nil, fromFile},
+		{"file from the config flag", nil, []string{"-config", configFile}, fromFile},
+		{"env", allEnv, nil, fromEnv},
+		{"env over file", merge(allEnv, map[string]string{EnvConfigFile: configFile}), nil, fromEnv},
+		{"flags", nil, allFlags, fromFlags},
+		{"flags over file", nil, append([]string{"-config", configFile}, allFlags...), fromFlags},
+		{"flags over env and file", merge(allEnv, map[string]string{EnvConfigFile: configFile}), allFlags, fromFlags},
+		{
+			name:  "each key from its highest source",
+			env:   map[string]string{EnvConfigFile: configFile, EnvPort: "8002", EnvOpenBrowser: "true"},
+			flags: []string{"-host", "flag.lan"},
+			want:  want{"flag.lan", 8002, fileDB, 20 * time.Second, []string{"http://file.example"}, true},
+		},
+		{
+			name: "an empty host from env means all interfaces",
+			env:  map[string]string{EnvConfigFile: configFile, EnvHost: ""},
+			want: want{"", 8001, fileDB, 20 * time.Second, []string{"http://file.example"}, false},
+		},
+		{
+			name: "NO_BROWSER still turns the browser off",
+			env:  map[string]string{envNoBrowser: "1"},
+			want: want{"", 8080, "./db.sqlite3", 15 * time.Second, []string{"*"}, false},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			cfg, err := load(t, tt.flags...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := want{cfg.Host, cfg.Port, cfg.DBPath, cfg.ShutdownTimeout, cfg.CORSOrigins, cfg.OpenBrowser}
+			if got.host != tt.want.host || got.port != tt.want.port || got.db != tt.want.db || got.timeout != tt.want.timeout ||
+				!slices.Equal(got.cors, tt.want.cors) || got.openBrowser != tt.want.openBrowser {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func merge(maps ...map[string]string) map[string]string {
+	merged := map[string]string{}
+	for _, m := range maps {
+		for k, v := range m {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+func TestLoadErrors(t *testing.T) {
+	dir := t.TempDir()
+	badFile := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(badFile, []byte(`{"shutdown_timeout": "soon"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		env   map[string]string
+		flags []string
+		want  string
+	}{
+		{"port from env is not a number", map[string]string{EnvPort: "http"}, nil, EnvPort},
+		{"duration in the file", map[string]string{EnvConfigFile: badFile}, nil, "shutdown_timeout"},
+		{"missing config file", nil, []string{"-config", filepath.Join(dir, "missing.json")}, "config file"},
+		{"unknown cipher", nil, []string{"-cipher", "rot13"}, "cipher"},
+		{"file key provider without a file", nil, []string{"-key-provider", "file"}, "key_file"},
+		{"database directory does not exist", nil, []string{"-db", filepath.Join(dir, "missing", "db.sqlite3")}, "database path"},
+		{"default priority is not a level", nil, []string{"-priorities", "low,high", "-default-priority", "medium"}, "medium"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearEnv(t)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			_, err := load(t, tt.flags...)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() error = %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateServerHost(t *testing.T) {
+	tests := []struct {
+		host  string
+		valid bool
+	}{
+		{"", true},
+		{"localhost", true},
+		{"notes.lan", true},
+		{"notes.example.com.", true},
+		{"my-host-01", true},
+		{"127.0.0.1", true},
+		{"0.0.0.0", true},
+		{"::", true},
+		{"::1", true},
+		{"fe80::1%eth0", true},
+		{strings.Repeat("a", 63) + ".lan", true},
+
+		{"[::1]", false},
+		{"foo bar", false},
+		{"http://x", false},
+		{"notes.lan:8080", false},
+		{"-notes.lan", false},
+		{"notes-.lan", false},
+		{"notes..lan", false},
+		{".", false},
+		{"notes_lan", false},
+		{"nötes.lan", false},
+		{strings.Repeat("a", 64) + ".lan", false},
+		{strings.Repeat("a.", 127) + "aa", false},
+	}
+	for _, tt := range tests {
+		cfg := Default()
+		cfg.FrontendDir = t.TempDir()
+		cfg.Host = tt.host
+		err := cfg.ValidateServer()
+		if tt.valid && err != nil {
+			t.Errorf("host %q: %v", tt.host, err)
+		}
+		if !tt.valid && (err == nil || !strings.Contains(err.Error(), "host")) {
+			t.Errorf("host %q was accepted", tt.host)
+		}
+	}
+}
+
+func TestValidateServer(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   string
+	}{
+		{"port too low", func(c *Config) { c.Port = 0 }, "port"},
+		{"port too high", func(c *Config) { c.Port = 65536 }, "port"},
+		{"no frontend", func(c *Config) { c.FrontendDir = "" }, "frontend"},
+		{"shutdown timeout", func(c *Config) { c.ShutdownTimeout = 0 }, "shutdown timeout"},
+		{"queue policy", func(c *Config) { c.ActivityLogQueuePolicy = "wait" }, "queue policy"},
+		{"backup interval", func(c *Config) { c.BackupInterval = time.Second }, "backup interval"},
+		{"webhook URL", func(c *Config) { c.ReminderWebhookURL = "ftp://example.com" }, "webhook"},
+		{"CORS origin", func(c *Config) { c.CORSOrigins = []string{"example.com"} }, "CORS origin"},
+		{"no CORS origin", func(c *Config) { c.CORSOrigins = nil }, "CORS origin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			cfg.FrontendDir = t.TempDir()
+			if err := cfg.ValidateServer(); err != nil {
+				t.Fatalf("default config: %v", err)
+			}
+			tt.change(cfg)
+			if err := cfg.ValidateServer(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ValidateServer() = %v, want an error about %s", err, tt.want)
+			}
+		})
+	}
+}
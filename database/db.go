@@ -2,16 +2,29 @@ package database
 
 import (
 	"database/sql"
-	"encoding/base64"
 	"fmt"
 	"log"
-	"strings"
+	"net/url"
+	"personal-notes-with-go/utils"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// DSN returns the SQLite data source name for the file at path with the
+// given connection parameters. The path is escaped into a file: URI so that
+// a ? or # in it is not taken for the start of the parameters.
+func DSN(path, params string) string {
+	dsn := "file:" + (&url.URL{Path: path}).EscapedPath()
+	if params != "" {
+		dsn += "?" + params
+	}
+	return dsn
+}
+
+// InitDB opens the database at dbPath, creating and migrating it as needed.
+// Every connection enforces foreign keys.
 func InitDB(dbPath string) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+	db, err := sql.Open("sqlite3", DSN(dbPath, "_foreign_keys=on"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -24,6 +37,10 @@ func InitDB(dbPath string) (*sql.DB, error) {
 		return nil, fmt.Errorf("failed to create tables: %w", err)
 	}
 
+	if err := migrate(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
 	return db, nil
 }
 
@@ -106,9 +123,9 @@ func FixEncryptionIssues(db *sql.DB) error {
 			return fmt.Errorf("failed to scan note: %w", err)
 		}
 
-		// Check if any of the fields are not base64 encoded
+		// Check if any of the fields are not encrypted
 		needsUpdate := false
-		if !isBase64(subject) || !isBase64(content) || !isBase64(tags) {
+		if !utils.IsCiphertext(subject) || !utils.IsCiphertext(content) || !utils.IsCiphertext(tags) {
 			log.Printf("Found note with ID %s that has encryption issues", id)
 			needsUpdate = true
 		}
@@ -130,16 +147,3 @@ func FixEncryptionIssues(db *sql.DB) error {
 	log.Println("Encryption issues check completed")
 	return nil
 }
-
-// isBase64 checks if a string is base64 encoded
-func isBase64(s string) bool {
-	// Empty strings are considered valid
-	if s == "" {
-		return true
-	}
-
-	// Check if the string is base64 encoded
-	s = strings.TrimSpace(s)
-	_, err := base64.StdEncoding.DecodeString(s)
-	return err == nil
-}
@@ -0,0 +1,318 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// migration changes the schema from version-1 to version. The schema
+// version is kept in SQLite's user_version pragma; the tables created by
+// createTables are version 0.
+type migration struct {
+	version     int
+	description string
+	up          func(tx *sql.Tx) error
+}
+
+// migrations must be kept in version order and never be changed once
+// released; add a new migration instead
+var migrations = []migration{
+	{version: 1, description: "add note timestamps", up: addNoteTimestamps},
+	{version: 2, description: "add tags tables", up: addTagsTables},
+	{version: 3, description: "add blind indexes", up: addBlindIndexes},
+	{version: 4, description: "normalize note priorities", up: normalizePriorities},
+	{version: 5, description: "nest categories", up: nestCategories},
+	{version: 6, description: "clear dangling references and add the trash", up: clearDanglingReferences},
+	{version: 7, description: "add category metadata", up: addCategoryMetadata},
+	{version: 8, description: "add note states", up: addNoteStates},
+	{version: 9, description: "add due dates and reminders", up: addNoteReminders},
+	{version: 10, description: "add checklists and recurrence", up: addChecklistsAndRecurrence},
+}
+
+// SchemaVersion returns the schema version of the database
+func SchemaVersion(db *sql.DB) (int, error) {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// LatestSchemaVersion returns the schema version this build migrates to
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// migrate applies the migrations the database has not seen yet, each in its
+// own transaction together with the version bump
+func migrate(db *sql.DB) error {
+	current, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if current > LatestSchemaVersion() {
+		return fmt.Errorf("database schema version %d is newer than this build supports (%d)", current, LatestSchemaVersion())
+	}
+
+	if current == LatestSchemaVersion() {
+		return nil
+	}
+
+	// Connections enforce foreign keys, but rebuilding a table drops a table
+	// others refer to, so migrations run on a connection of their own with
+	// enforcement turned off until they are done
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, "PRAGMA foreign_keys = ON")
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := applyMigration(ctx, conn, m); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.description, err)
+		}
+		log.Printf("Applied database migration %d: %s", m.version, m.description)
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, conn *sql.Conn, m migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.up(tx); err != nil {
+		return err
+	}
+	// PRAGMA does not accept bound parameters
+	if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", m.version)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// addNoteTimestamps adds created_at and updated_at to notes. The real
+// creation time of existing notes is unknown, so they get the time of the
+// migration.
+func addNoteTimestamps(tx *sql.Tx) error {
+	statements := []string{
+		"ALTER TABLE notes ADD COLUMN created_at DATETIME",
+		"ALTER TABLE notes ADD COLUMN updated_at DATETIME",
+		"UPDATE notes SET created_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addTagsTables adds tags and the note_tags links between notes and tags.
+// Tag names are encrypted, so they cannot be unique in SQL; the repository
+// keeps them unique. Tags of existing notes are still in notes.tags and are
+// moved over by repositories.MigrateLegacyTags once the key is known.
+func addTagsTables(tx *sql.Tx) error {
+	statements := []string{
+		`CREATE TABLE tags (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL
+		)`,
+		`CREATE TABLE note_tags (
+			note_id TEXT NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+			tag_id TEXT NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+			position INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (note_id, tag_id)
+		)`,
+		"CREATE INDEX idx_note_tags_tag_id ON note_tags(tag_id)",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addBlindIndexes adds the blind indexes used to search encrypted fields:
+// tag names, note subjects and the words of notes. blind_index records
+// which key the indexes were computed with. The indexes are filled in by
+// repositories.UpdateBlindIndexes once the key is known.
+func addBlindIndexes(tx *sql.Tx) error {
+	statements := []string{
+		"ALTER TABLE tags ADD COLUMN name_index TEXT",
+		"CREATE INDEX idx_tags_name_index ON tags(name_index)",
+		"ALTER TABLE notes ADD COLUMN subject_index TEXT",
+		"CREATE INDEX idx_notes_subject_index ON notes(subject_index)",
+		`CREATE TABLE note_words (
+			note_id TEXT NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+			word_index TEXT NOT NULL,
+			PRIMARY KEY (note_id, word_index)
+		)`,
+		"CREATE INDEX idx_note_words_word_index ON note_words(word_index)",
+		"CREATE TABLE blind_index (key_check TEXT NOT NULL)",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizePriorities stores priorities in lower case without surrounding
+// space, the form used when filtering by priority, and indexes them.
+// Values that are not a configured level are kept; they sort below every
+// level and are reported by doctor.
+func normalizePriorities(tx *sql.Tx) error {
+	statements := []string{
+		"UPDATE notes SET priority = LOWER(TRIM(COALESCE(priority, '')))",
+		"CREATE INDEX idx_notes_priority ON notes(priority)",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nestCategories adds the parent of a category. Names only have to be
+// unique among the subcategories of one parent, which is checked by the
+// encrypted category repository since names are encrypted; SQLite cannot
+// drop the old UNIQUE constraint on name, so the table is rebuilt.
+func nestCategories(tx *sql.Tx) error {
+	statements := []string{
+		`CREATE TABLE categories_new (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			parent_id TEXT REFERENCES categories(id)
+		)`,
+		"INSERT INTO categories_new (id, name) SELECT id, name FROM categories",
+		"DROP TABLE categories",
+		"ALTER TABLE categories_new RENAME TO categories",
+		"CREATE INDEX idx_categories_parent_id ON categories(parent_id)",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clearDanglingReferences prepares the data for foreign key enforcement,
+// which used to be off: notes without a category get NULL instead of an
+// empty category_id, references to categories that were deleted are
+// cleared, and tags and word indexes of deleted notes are removed. It also
+// adds trashed_at, set on the notes of categories deleted into the trash.
+func clearDanglingReferences(tx *sql.Tx) error {
+	statements := []string{
+		`UPDATE notes SET category_id = NULL
+			WHERE category_id = '' OR category_id NOT IN (SELECT id FROM categories)`,
+		`UPDATE categories SET parent_id = NULL
+			WHERE parent_id = '' OR parent_id NOT IN (SELECT id FROM categories)`,
+		"DELETE FROM note_tags WHERE note_id NOT IN (SELECT id FROM notes) OR tag_id NOT IN (SELECT id FROM tags)",
+		"DELETE FROM note_words WHERE note_id NOT IN (SELECT id FROM notes)",
+		"ALTER TABLE notes ADD COLUMN trashed_at DATETIME",
+		"CREATE INDEX idx_notes_trashed_at ON notes(trashed_at)",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addCategoryMetadata adds the description, color, icon and position of a
+// category. The description is encrypted like the name. Existing categories
+// all get position 0, so they keep being listed by name until reordered.
+func addCategoryMetadata(tx *sql.Tx) error {
+	statements := []string{
+		"ALTER TABLE categories ADD COLUMN description TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE categories ADD COLUMN color TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE categories ADD COLUMN icon TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE categories ADD COLUMN position INTEGER NOT NULL DEFAULT 0",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addNoteStates adds the pinned, archived and favorite flags of notes.
+// Archived notes are left out of most lists, so that flag is indexed.
+func addNoteStates(tx *sql.Tx) error {
+	statements := []string{
+		"ALTER TABLE notes ADD COLUMN pinned INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE notes ADD COLUMN archived INTEGER NOT NULL DEFAULT 0",
+		"ALTER TABLE notes ADD COLUMN favorite INTEGER NOT NULL DEFAULT 0",
+		"CREATE INDEX idx_notes_archived ON notes(archived)",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addNoteReminders adds the due date and reminder of notes. RemindedAt is
+// set once a reminder has been delivered, so the scheduler does not send it
+// again; both dates that are searched by are indexed.
+func addNoteReminders(tx *sql.Tx) error {
+	statements := []string{
+		"ALTER TABLE notes ADD COLUMN due_at DATETIME",
+		"ALTER TABLE notes ADD COLUMN remind_at DATETIME",
+		"ALTER TABLE notes ADD COLUMN reminded_at DATETIME",
+		"CREATE INDEX idx_notes_due_at ON notes(due_at)",
+		"CREATE INDEX idx_notes_remind_at ON notes(remind_at)",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addChecklistsAndRecurrence adds the checklist items of notes, which go
+// with their note, and the recurrence rule of notes. RecurAt, when a note
+// next recurs, is indexed for the scheduler.
+func addChecklistsAndRecurrence(tx *sql.Tx) error {
+	statements := []string{
+		`CREATE TABLE checklist_items (
+			id TEXT PRIMARY KEY,
+			note_id TEXT NOT NULL REFERENCES notes(id) ON DELETE CASCADE,
+			text TEXT NOT NULL,
+			checked INTEGER NOT NULL DEFAULT 0,
+			position INTEGER NOT NULL DEFAULT 0
+		)`,
+		"CREATE INDEX idx_checklist_items_note_id ON checklist_items(note_id, position)",
+		"ALTER TABLE notes ADD COLUMN recurrence TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE notes ADD COLUMN recurrence_mode TEXT NOT NULL DEFAULT ''",
+		"ALTER TABLE notes ADD COLUMN recur_at DATETIME",
+		"CREATE INDEX idx_notes_recur_at ON notes(recur_at)",
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// encryptedColumns lists every column holding encrypted data, per table
+var encryptedColumns = map[string][]string{
+	"categories":      {"name", "description"},
+	"checklist_items": {"text"},
+	"notes":           {"subject", "content", "tags"},
+	"tags":            {"name"},
+}
+
+// ReencryptAll rewrites every encrypted column in the database with the
+// result of transform, inside a single transaction. If transform fails for
+// any value the transaction is rolled back and nothing is changed.
+func ReencryptAll(db *sql.DB, transform func(string) (string, error)) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	total := 0
+	for table, columns := range encryptedColumns {
+		n, err := reencryptTable(tx, table, columns, transform)
+		if err != nil {
+			return 0, err
+		}
+		total += n
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return total, nil
+}
+
+// reencryptTable transforms the given columns of every row in table
+func reencryptTable(tx *sql.Tx, table string, columns []string, transform func(string) (string, error)) (int, error) {
+	type row struct {
+		id     string
+		values []string
+	}
+
+	selectQuery := "SELECT id"
+	updateQuery := "UPDATE " + table + " SET "
+	for i, column := range columns {
+		selectQuery += ", COALESCE(" + column + ", '')"
+		if i > 0 {
+			updateQuery += ", "
+		}
+		updateQuery += column + " = ?"
+	}
+	selectQuery += " FROM " + table
+	updateQuery += " WHERE id = ?"
+
+	rows, err := tx.Query(selectQuery)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query %s: %w", table, err)
+	}
+
+	var pending []row
+	for rows.Next() {
+		r := row{values: make([]string, len(columns))}
+		dest := []interface{}{&r.id}
+		for i := range r.values {
+			dest = append(dest, &r.values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan %s row: %w", table, err)
+		}
+		pending = append(pending, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating %s rows: %w", table, err)
+	}
+
+	for _, r := range pending {
+		args := make([]interface{}, 0, len(columns)+1)
+		for i, value := range r.values {
+			transformed, err := transform(value)
+			if err != nil {
+				return 0, fmt.Errorf("failed to re-encrypt %s.%s for id %s: %w", table, columns[i], r.id, err)
+			}
+			args = append(args, transformed)
+		}
+		args = append(args, r.id)
+
+		if _, err := tx.Exec(updateQuery, args...); err != nil {
+			return 0, fmt.Errorf("failed to update %s row %s: %w", table, r.id, err)
+		}
+	}
+
+	return len(pending), nil
+}
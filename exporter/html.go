@@ -0,0 +1,496 @@
+package exporter
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// linkResolver returns the href of the note a link points to, given a note
+// title or a Markdown file name. ok is false when the note is not exported.
+type linkResolver func(target string) (href string, ok bool)
+
+// mdRenderer converts the Markdown used in notes to HTML. It covers
+// headings, paragraphs, emphasis, code, links and images, [[wikilinks]],
+// block quotes, nested and task lists, tables and rules; raw HTML in a note
+// is escaped rather than passed through.
+type mdRenderer struct {
+	resolve linkResolver
+}
+
+var (
+	atxHeading   = regexp.MustCompile(`^(#{1,6})(?:[ \t]+(.*?))?[ \t#]*$`)
+	ruleLine     = regexp.MustCompile(`^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	listItem     = regexp.MustCompile(`^( *)([-*+]|\d{1,9}[.)])(?:[ \t]+|$)`)
+	taskMarker   = regexp.MustCompile(`^\[([ xX])\](?:[ \t]+|$)`)
+	tableDivider = regexp.MustCompile(`^ *\|? *:?-+:? *(\| *:?-+:? *)*\|? *$`)
+	bareURL      = regexp.MustCompile(`^https?://[^\s<>"]+[^\s<>".,:;!?)\]'*_~]`)
+)
+
+// render converts a Markdown document to HTML
+func (r *mdRenderer) render(src string) string {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	src = strings.ReplaceAll(src, "\t", "    ")
+	var b strings.Builder
+	r.blocks(&b, strings.Split(src, "\n"))
+	return b.String()
+}
+
+// blocks renders a sequence of lines as block elements
+func (r *mdRenderer) blocks(b *strings.Builder, lines []string) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			i++
+
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			fence := trimmed[:3]
+			lang := strings.TrimSpace(strings.TrimLeft(trimmed, fence[:1]))
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), fence); i++ {
+				code = append(code, lines[i])
+			}
+			i++ // closing fence
+			if lang != "" {
+				fmt.Fprintf(b, "<pre><code class=\"language-%s\">", html.EscapeString(strings.Fields(lang)[0]))
+			} else {
+				b.WriteString("<pre><code>")
+			}
+			b.WriteString(html.EscapeString(strings.Join(code, "\n")))
+			b.WriteString("</code></pre>\n")
+
+		case atxHeading.MatchString(trimmed):
+			m := atxHeading.FindStringSubmatch(trimmed)
+			level := len(m[1])
+			fmt.Fprintf(b, "<h%d>%s</h%d>\n", level, r.inline(m[2]), level)
+			i++
+
+		case ruleLine.MatchString(line):
+			b.WriteString("<hr>\n")
+			i++
+
+		case strings.HasPrefix(trimmed, ">"):
+			var quote []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				q := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quote = append(quote, strings.TrimPrefix(q, " "))
+			}
+			b.WriteString("<blockquote>\n")
+			r.blocks(b, quote)
+			b.WriteString("</blockquote>\n")
+
+		case listItem.MatchString(line):
+			i = r.list(b, lines, i)
+
+		case strings.Contains(line, "|") && i+1 < len(lines) && tableDivider.MatchString(lines[i+1]) && strings.Contains(lines[i+1], "-"):
+			i = r.table(b, lines, i)
+
+		default:
+			var para []string
+			for ; i < len(lines) && strings.TrimSpace(lines[i]) != "" && (len(para) == 0 || !r.startsBlock(lines[i])); i++ {
+				para = append(para, lines[i])
+			}
+			b.WriteString("<p>")
+			r.paragraph(b, para)
+			b.WriteString("</p>\n")
+		}
+	}
+}
+
+// startsBlock reports whether line interrupts a paragraph
+func (r *mdRenderer) startsBlock(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") ||
+		strings.HasPrefix(trimmed, ">") || atxHeading.MatchString(trimmed) ||
+		ruleLine.MatchString(line) || listItem.MatchString(line)
+}
+
+// paragraph renders the lines of a paragraph, turning lines that end in
+// two spaces or a backslash into hard line breaks
+func (r *mdRenderer) paragraph(b *strings.Builder, lines []string) {
+	for j, line := range lines {
+		hardBreak := strings.HasSuffix(line, "  ") || strings.HasSuffix(line, "\\")
+		line = strings.TrimSpace(line)
+		if hardBreak {
+			line = strings.TrimSuffix(line, "\\")
+		}
+		b.WriteString(r.inline(line))
+		if j < len(lines)-1 {
+			if hardBreak {
+				b.WriteString("<br>")
+			}
+			b.WriteString("\n")
+		}
+	}
+}
+
+// list renders the list starting at lines[start] and returns the index of
+// the first line after it. Lines indented past the marker belong to the
+// item, which is how nested lists are written.
+func (r *mdRenderer) list(b *strings.Builder, lines []string, start int) int {
+	first := listItem.FindStringSubmatch(lines[start])
+	indent := len(first[1])
+	ordered := first[2][0] >= '0' && first[2][0] <= '9'
+	if ordered {
+		if n, _ := strconv.Atoi(strings.TrimRight(first[2], ".)")); n != 1 {
+			fmt.Fprintf(b, "<ol start=\"%d\">\n", n)
+		} else {
+			b.WriteString("<ol>\n")
+		}
+	} else {
+		b.WriteString("<ul>\n")
+	}
+
+	i := start
+	for i < len(lines) {
+		m := listItem.FindStringSubmatch(lines[i])
+		if m == nil || len(m[1]) != indent || (m[2][0] >= '0' && m[2][0] <= '9') != ordered {
+			break
+		}
+		content := []string{lines[i][len(m[0]):]}
+		loose := false
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			if strings.TrimSpace(line) == "" {
+				// A blank line continues the item only when indented lines follow
+				if i+1 < len(lines) && leadingSpaces(lines[i+1]) > indent && strings.TrimSpace(lines[i+1]) != "" {
+					content = append(content, "")
+					loose = true
+					continue
+				}
+				break
+			}
+			if leadingSpaces(line) <= indent {
+				if listItem.MatchString(line) || r.startsBlock(line) {
+					break
+				}
+				// A lazy continuation of the item's paragraph
+			}
+			content = append(content, dedent(line, indent+2))
+		}
+
+		b.WriteString("<li>")
+		if task := taskMarker.FindStringSubmatch(content[0]); task != nil {
+			checked := ""
+			if task[1] != " " {
+				checked = " checked"
+			}
+			fmt.Fprintf(b, "<input type=\"checkbox\" disabled%s> ", checked)
+			content[0] = content[0][len(task[0]):]
+		}
+		r.item(b, content, loose)
+		b.WriteString("</li>\n")
+
+		// Blank lines between items of the same list
+		if i < len(lines) && strings.TrimSpace(lines[i]) == "" && i+1 < len(lines) {
+			if next := listItem.FindStringSubmatch(lines[i+1]); next != nil && len(next[1]) == indent {
+				i++
+			}
+		}
+	}
+
+	if ordered {
+		b.WriteString("</ol>\n")
+	} else {
+		b.WriteString("</ul>\n")
+	}
+	return i
+}
+
+// item renders the content of a list item. The text of a tight item is not
+// wrapped in a paragraph.
+func (r *mdRenderer) item(b *strings.Builder, content []string, loose bool) {
+	if loose {
+		b.WriteString("\n")
+		r.blocks(b, content)
+		return
+	}
+	end := 0
+	for end < len(content) && strings.TrimSpace(content[end]) != "" && (end == 0 || !r.startsBlock(content[end])) {
+		end++
+	}
+	r.paragraph(b, content[:end])
+	if end < len(content) {
+		b.WriteString("\n")
+		r.blocks(b, content[end:])
+	}
+}
+
+// table renders a pipe table and returns the index of the line after it
+func (r *mdRenderer) table(b *strings.Builder, lines []string, start int) int {
+	header := tableCells(lines[start])
+	dividers := tableCells(lines[start+1])
+	aligns := make([]string, len(header))
+	for j := range aligns {
+		if j >= len(dividers) {
+			break
+		}
+		d := dividers[j]
+		switch {
+		case strings.HasPrefix(d, ":") && strings.HasSuffix(d, ":"):
+			aligns[j] = ` style="text-align:center"`
+		case strings.HasSuffix(d, ":"):
+			aligns[j] = ` style="text-align:right"`
+		case strings.HasPrefix(d, ":"):
+			aligns[j] = ` style="text-align:left"`
+		}
+	}
+
+	b.WriteString("<table>\n<thead>\n<tr>")
+	for j, cell := range header {
+		fmt.Fprintf(b, "<th%s>%s</th>", aligns[j], r.inline(cell))
+	}
+	b.WriteString("</tr>\n</thead>\n<tbody>\n")
+	i := start + 2
+	for ; i < len(lines) && strings.Contains(lines[i], "|") && strings.TrimSpace(lines[i]) != ""; i++ {
+		cells := tableCells(lines[i])
+		b.WriteString("<tr>")
+		for j := range header {
+			cell := ""
+			if j < len(cells) {
+				cell = cells[j]
+			}
+			fmt.Fprintf(b, "<td%s>%s</td>", aligns[j], r.inline(cell))
+		}
+		b.WriteString("</tr>\n")
+	}
+	b.WriteString("</tbody>\n</table>\n")
+	return i
+}
+
+// tableCells splits a table row on unescaped pipes
+func tableCells(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	if strings.HasSuffix(line, "|") && !strings.HasSuffix(line, `\|`) {
+		line = line[:len(line)-1]
+	}
+	var cells []string
+	var cur strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+			cur.WriteByte('|')
+			i++
+		case line[i] == '|':
+			cells = append(cells, strings.TrimSpace(cur.String()))
+			cur.Reset()
+		default:
+			cur.WriteByte(line[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cur.String()))
+}
+
+// inline renders the inline elements of a line of text
+func (r *mdRenderer) inline(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		rest := s[i:]
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s) && strings.ContainsRune("\\`*_{}[]()#+-.!|~<>", rune(s[i+1])):
+			b.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+
+		case c == '`':
+			ticks := len(rest) - len(strings.TrimLeft(rest, "`"))
+			end := strings.Index(rest[ticks:], rest[:ticks])
+			if end < 0 {
+				b.WriteString(rest[:ticks])
+				i += ticks
+				continue
+			}
+			fmt.Fprintf(&b, "<code>%s</code>", html.EscapeString(strings.TrimSpace(rest[ticks:ticks+end])))
+			i += 2*ticks + end
+
+		case strings.HasPrefix(rest, "[["):
+			end := strings.Index(rest, "]]")
+			if end < 0 {
+				b.WriteString("[[")
+				i += 2
+				continue
+			}
+			b.WriteString(r.wikilink(rest[2:end]))
+			i += end + 2
+
+		case c == '!' && strings.HasPrefix(rest, "!["):
+			if text, href, n, ok := linkParts(rest[1:]); ok {
+				fmt.Fprintf(&b, `<img src="%s" alt="%s">`, html.EscapeString(safeURL(href)), html.EscapeString(text))
+				i += 1 + n
+				continue
+			}
+			b.WriteString("!")
+			i++
+
+		case c == '[':
+			if text, href, n, ok := linkParts(rest); ok {
+				b.WriteString(r.link(text, href))
+				i += n
+				continue
+			}
+			b.WriteString("[")
+			i++
+
+		case c == '<':
+			if end := strings.IndexByte(rest, '>'); end > 0 {
+				if target := rest[1:end]; bareURL.MatchString(target) || strings.HasPrefix(target, "mailto:") {
+					fmt.Fprintf(&b, `<a href="%s">%s</a>`, html.EscapeString(safeURL(target)), html.EscapeString(strings.TrimPrefix(target, "mailto:")))
+					i += end + 1
+					continue
+				}
+			}
+			b.WriteString("&lt;")
+			i++
+
+		case c == 'h' && bareURL.MatchString(rest) && (i == 0 || !isWordByte(s[i-1])):
+			u := bareURL.FindString(rest)
+			fmt.Fprintf(&b, `<a href="%s">%s</a>`, html.EscapeString(u), html.EscapeString(u))
+			i += len(u)
+
+		case strings.HasPrefix(rest, "**") || strings.HasPrefix(rest, "__") || strings.HasPrefix(rest, "~~"):
+			delim := rest[:2]
+			end := strings.Index(rest[2:], delim)
+			if end <= 0 || (delim == "__" && i > 0 && isWordByte(s[i-1])) {
+				b.WriteString(html.EscapeString(delim))
+				i += 2
+				continue
+			}
+			tag := "strong"
+			if delim == "~~" {
+				tag = "del"
+			}
+			fmt.Fprintf(&b, "<%s>%s</%s>", tag, r.inline(rest[2:2+end]), tag)
+			i += end + 4
+
+		case c == '*' || c == '_':
+			end := strings.IndexByte(rest[1:], c)
+			if end <= 0 || rest[1] == ' ' || rest[end] == ' ' || (c == '_' && i > 0 && isWordByte(s[i-1])) {
+				b.WriteByte(c)
+				i++
+				continue
+			}
+			fmt.Fprintf(&b, "<em>%s</em>", r.inline(rest[1:1+end]))
+			i += end + 2
+
+		default:
+			// Copy plain text up to the next character that may start markup
+			n := strings.IndexAny(rest[1:], "\\`[!<h*_~")
+			if n < 0 {
+				n = len(rest)
+			} else {
+				n++
+			}
+			b.WriteString(html.EscapeString(rest[:n]))
+			i += n
+		}
+	}
+	return b.String()
+}
+
+// link renders [text](href). Links to Markdown files of exported notes,
+// such as the ones written by the Markdown export, point to their pages.
+func (r *mdRenderer) link(text, href string) string {
+	if u, err := url.Parse(href); err == nil && u.Scheme == "" && u.Host == "" && strings.HasSuffix(strings.ToLower(u.Path), ".md") {
+		name := u.Path[strings.LastIndex(u.Path, "/")+1:]
+		if target, ok := r.resolve(name[:len(name)-len(".md")]); ok {
+			href = target
+		}
+	}
+	return fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(safeURL(href)), r.inline(text))
+}
+
+// wikilink renders [[Title]], [[Title|label]] or [[Title#Heading]]. Links
+// to notes that are not part of the export are rendered as plain text.
+func (r *mdRenderer) wikilink(inner string) string {
+	target, label, hasLabel := strings.Cut(inner, "|")
+	target, _, _ = strings.Cut(target, "#")
+	target = strings.TrimSpace(target)
+	if !hasLabel {
+		label = inner
+	}
+	label = strings.TrimSpace(label)
+	if href, ok := r.resolve(target); ok {
+		return fmt.Sprintf(`<a class="note-link" href="%s">%s</a>`, html.EscapeString(href), html.EscapeString(label))
+	}
+	return fmt.Sprintf(`<span class="missing-link">%s</span>`, html.EscapeString(label))
+}
+
+// linkParts parses [text](href "title") at the start of s, returning the
+// text, the href and the length of the link
+func linkParts(s string) (text, href string, n int, ok bool) {
+	depth := 0
+	closeText := -1
+	for i := 0; i < len(s) && closeText < 0; i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				closeText = i
+			}
+		}
+	}
+	if closeText < 0 || closeText+1 >= len(s) || s[closeText+1] != '(' {
+		return "", "", 0, false
+	}
+	// The destination ends at the first unbalanced closing parenthesis
+	end, parens := -1, 0
+	for i := closeText + 2; i < len(s) && end < 0; i++ {
+		switch s[i] {
+		case '(':
+			parens++
+		case ')':
+			if parens == 0 {
+				end = i - closeText - 2
+			}
+			parens--
+		}
+	}
+	if end < 0 {
+		return "", "", 0, false
+	}
+	dest := strings.TrimSpace(s[closeText+2 : closeText+2+end])
+	// Drop an optional title
+	if j := strings.IndexAny(dest, " \t"); j >= 0 {
+		dest = dest[:j]
+	}
+	dest = strings.TrimSuffix(strings.TrimPrefix(dest, "<"), ">")
+	return s[1:closeText], dest, closeText + 3 + end, true
+}
+
+// safeURL replaces URLs with schemes that can run code in the browser
+func safeURL(u string) string {
+	scheme, _, ok := strings.Cut(u, ":")
+	if !ok || strings.ContainsAny(scheme, "/?#") {
+		return u
+	}
+	switch strings.ToLower(strings.TrimSpace(scheme)) {
+	case "http", "https", "mailto":
+		return u
+	}
+	return "#"
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func leadingSpaces(s string) int {
+	return len(s) - len(strings.TrimLeft(s, " "))
+}
+
+// dedent removes up to n leading spaces
+func dedent(s string, n int) string {
+	if m := leadingSpaces(s); m < n {
+		n = m
+	}
+	return s[n:]
+}
@@ -0,0 +1,185 @@
+package exporter
+
+import (
+	"strings"
+	"testing"
+)
+
+// testRenderer resolves links to the notes "Groceries" and "Meeting notes"
+func testRenderer() *mdRenderer {
+	pages := map[string]string{
+		"groceries":     "../notes/groceries.html",
+		"meeting notes": "../notes/meeting-notes.html",
+	}
+	return &mdRenderer{resolve: func(target string) (string, bool) {
+		href, ok := pages[strings.ToLower(strings.TrimSpace(target))]
+		return href, ok
+	}}
+}
+
+func TestRenderEscapesHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"script tag", `<script>alert(1)</script>`, "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"script tag after text", `hi <script src="x.js"></script>`, "<p>hi &lt;script src=&#34;x.js&#34;&gt;&lt;/script&gt;</p>\n"},
+		{"event handler", `<img src=x onerror=alert(1)>`, "<p>&lt;img src=x onerror=alert(1)&gt;</p>\n"},
+		{"html block", "<div>\n<iframe src=\"https://example.com\"></iframe>\n</div>", "<p>&lt;div&gt;\n&lt;iframe src=&#34;<a href=\"https://example.com\">https://example.com</a>&#34;&gt;&lt;/iframe&gt;\n&lt;/div&gt;</p>\n"},
+		{"in a heading", `# <b onclick="x()">Title</b>`, "<h1>&lt;b onclick=&#34;x()&#34;&gt;Title&lt;/b&gt;</h1>\n"},
+		{"in a list", `- <script>x</script>`, "<ul>\n<li>&lt;script&gt;x&lt;/script&gt;</li>\n</ul>\n"},
+		{"in a table", "| a |\n|---|\n| <script>x</script> |", "<table>\n<thead>\n<tr><th>a</th></tr>\n</thead>\n<tbody>\n<tr><td>&lt;script&gt;x&lt;/script&gt;</td></tr>\n</tbody>\n</table>\n"},
+		{"in link text", `[<script>x</script>](https://example.com)`, "<p><a href=\"https://example.com\">&lt;script&gt;x&lt;/script&gt;</a></p>\n"},
+		{"in emphasis", `**<script>x</script>**`, "<p><strong>&lt;script&gt;x&lt;/script&gt;</strong></p>\n"},
+		{"escaped angle bracket", `\<script>`, "<p>&lt;script&gt;</p>\n"},
+		{"entity", `&lt;script&gt;`, "<p>&amp;lt;script&amp;gt;</p>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := testRenderer().render(tt.src); got != tt.want {
+				t.Errorf("render(%q)\n got %q\nwant %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderLinkSchemes(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"https", `[x](https://example.com/a?b=1&c=2)`, `<a href="https://example.com/a?b=1&amp;c=2">x</a>`},
+		{"mailto", `[x](mailto:me@example.com)`, `<a href="mailto:me@example.com">x</a>`},
+		{"relative", `[x](files/a.pdf)`, `<a href="files/a.pdf">x</a>`},
+		{"fragment", `[x](#top)`, `<a href="#top">x</a>`},
+		{"javascript", `[x](javascript:alert(1))`, `<a href="#">x</a>`},
+		{"mixed case", `[x](JaVaScRiPt:alert(1))`, `<a href="#">x</a>`},
+		{"leading space", `[x](  javascript:alert(1))`, `<a href="#">x</a>`},
+		{"angle brackets", `[x](<javascript:alert(1)>)`, `<a href="#">x</a>`},
+		{"tab inside the scheme", "[x](java\tscript:alert(1))", `<a href="java">x</a>`},
+		{"control character", "[x](\x01javascript:alert(1))", `<a href="#">x</a>`},
+		{"vbscript", `[x](vbscript:msgbox(1))`, `<a href="#">x</a>`},
+		{"data", `[x](data:text/html;base64,PHNjcmlwdD4=)`, `<a href="#">x</a>`},
+		{"numeric entity", `[x](&#106;avascript:alert(1))`, `<a href="&amp;#106;avascript:alert(1)">x</a>`},
+		{"hex entity", `[x](&#x6A;avascript:alert(1))`, `<a href="&amp;#x6A;avascript:alert(1)">x</a>`},
+		{"named colon entity", `[x](javascript&colon;alert(1))`, `<a href="javascript&amp;colon;alert(1)">x</a>`},
+		{"quote in href", `[x](https://example.com/"onmouseover="alert(1))`, `<a href="https://example.com/&#34;onmouseover=&#34;alert(1)">x</a>`},
+		{"autolink", `<https://example.com>`, `<a href="https://example.com">https://example.com</a>`},
+		{"javascript autolink", `<javascript:alert(1)>`, `&lt;javascript:alert(1)&gt;`},
+		{"mailto autolink with a quote", `<mailto:a"onclick="x>`, `<a href="mailto:a&#34;onclick=&#34;x">a&#34;onclick=&#34;x</a>`},
+		{"bare URL", `see https://example.com/a"b`, `see <a href="https://example.com/a">https://example.com/a</a>&#34;b`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := "<p>" + tt.want + "</p>\n"
+			if got := testRenderer().render(tt.src); got != want {
+				t.Errorf("render(%q)\n got %q\nwant %q", tt.src, got, want)
+			}
+		})
+	}
+}
+
+func TestRenderImages(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"plain", `![A cat](img/cat.png)`, `<img src="img/cat.png" alt="A cat">`},
+		{"quotes in alt", `![a" onerror="alert(1)](x.png)`, `<img src="x.png" alt="a&#34; onerror=&#34;alert(1)">`},
+		{"markup in alt", `![<script>x</script>](x.png)`, `<img src="x.png" alt="&lt;script&gt;x&lt;/script&gt;">`},
+		{"quote in src", `![a](x.png"onerror="alert(1))`, `<img src="x.png&#34;onerror=&#34;alert(1)" alt="a">`},
+		{"javascript src", `![a](JAVASCRIPT:alert(1))`, `<img src="#" alt="a">`},
+		{"data src", `![a](data:image/svg+xml;base64,PHN2Zz4=)`, `<img src="#" alt="a">`},
+		{"title is dropped", `![a](x.png "A title")`, `<img src="x.png" alt="a">`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := "<p>" + tt.want + "</p>\n"
+			if got := testRenderer().render(tt.src); got != want {
+				t.Errorf("render(%q)\n got %q\nwant %q", tt.src, got, want)
+			}
+		})
+	}
+}
+
+func TestRenderCode(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"span", "run `<script>` now", "<p>run <code>&lt;script&gt;</code> now</p>\n"},
+		{"span keeps markup", "`**not bold** [x](javascript:y)`", "<p><code>**not bold** [x](javascript:y)</code></p>\n"},
+		{"double backticks", "``a ` b``", "<p><code>a ` b</code></p>\n"},
+		{"unclosed span", "`<b>", "<p>`&lt;b&gt;</p>\n"},
+		{"block", "```\n<script>alert(1)</script>\n& done\n```", "<pre><code>&lt;script&gt;alert(1)&lt;/script&gt;\n&amp; done</code></pre>\n"},
+		{"block with language", "```go\nif a < b {}\n```", "<pre><code class=\"language-go\">if a &lt; b {}</code></pre>\n"},
+		{"language with a quote", "```x\"onclick=\"y\nz\n```", "<pre><code class=\"language-x&#34;onclick=&#34;y\">z</code></pre>\n"},
+		{"tilde fence", "~~~\n```\n~~~", "<pre><code>```</code></pre>\n"},
+		{"unclosed block", "```\n<b>", "<pre><code>&lt;b&gt;</code></pre>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := testRenderer().render(tt.src); got != tt.want {
+				t.Errorf("render(%q)\n got %q\nwant %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderNoteLinks(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"wikilink", `[[Groceries]]`, `<a class="note-link" href="../notes/groceries.html">Groceries</a>`},
+		{"case and spaces", `[[ meeting NOTES ]]`, `<a class="note-link" href="../notes/meeting-notes.html">meeting NOTES</a>`},
+		{"label", `[[Groceries|the list]]`, `<a class="note-link" href="../notes/groceries.html">the list</a>`},
+		{"heading", `[[Groceries#Fruit]]`, `<a class="note-link" href="../notes/groceries.html">Groceries#Fruit</a>`},
+		{"missing note", `[[Elsewhere]]`, `<span class="missing-link">Elsewhere</span>`},
+		{"markup in label", `[[Groceries|<script>x</script>]]`, `<a class="note-link" href="../notes/groceries.html">&lt;script&gt;x&lt;/script&gt;</a>`},
+		{"markup in missing note", `[[<img src=x onerror=y>]]`, `<span class="missing-link">&lt;img src=x onerror=y&gt;</span>`},
+		{"unclosed", `[[Groceries`, `[[Groceries`},
+		{"markdown file link", `[list](Groceries.md)`, `<a href="../notes/groceries.html">list</a>`},
+		{"markdown file link in a folder", `[list](../Home/Groceries.md)`, `<a href="../notes/groceries.html">list</a>`},
+		{"markdown file of a missing note", `[other](Elsewhere.md)`, `<a href="Elsewhere.md">other</a>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := "<p>" + tt.want + "</p>\n"
+			if got := testRenderer().render(tt.src); got != want {
+				t.Errorf("render(%q)\n got %q\nwant %q", tt.src, got, want)
+			}
+		})
+	}
+}
+
+func TestSafeURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://example.com", "https://example.com"},
+		{"HTTP://example.com", "HTTP://example.com"},
+		{"mailto:me@example.com", "mailto:me@example.com"},
+		{"notes/a.html", "notes/a.html"},
+		{"a/b:c", "a/b:c"},
+		{"?q=a:b", "?q=a:b"},
+		{"#x:y", "#x:y"},
+		{"javascript:alert(1)", "#"},
+		{" JavaScript :alert(1)", "#"},
+		{"java\tscript:alert(1)", "#"},
+		{"\x00javascript:alert(1)", "#"},
+		{"file:///etc/passwd", "#"},
+		{"ftp://example.com", "#"},
+	}
+	for _, tt := range tests {
+		if got := safeURL(tt.url); got != tt.want {
+			t.Errorf("safeURL(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
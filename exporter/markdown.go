@@ -0,0 +1,177 @@
+package exporter
+
+import (
+	"fmt"
+	"path"
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/repositories"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MarkdownFiles renders every note as a Markdown file with YAML front matter,
+// in a folder named after its category, nested in the folders of the parent
+// categories. The front matter holds the category path, such as
+// "Work/Projects", which the Markdown importer turns back into nested
+// categories. The repositories are expected to decrypt, as the ones built
+// with NewEncrypted*Repository do.
+func MarkdownFiles(notes repositories.NoteRepositoryInterface, categories repositories.CategoryRepositoryInterface) ([]File, error) {
+	cats, err := categories.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	all, err := notes.GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	// Folder names are unique within their parent folder even when two
+	// category names only differ in characters that are not allowed in file
+	// names
+	folderOf := make(map[string]string, len(cats))
+	pathOf := make(map[string]string, len(cats))
+	var addFolders func(parent, parentPath string, nodes []*models.CategoryNode)
+	addFolders = func(parent, parentPath string, nodes []*models.CategoryNode) {
+		folders := newNamer()
+		for _, node := range nodes {
+			folderOf[node.ID] = path.Join(parent, folders.unique(fileName(node.Name, "category"), ""))
+			pathOf[node.ID] = node.Name
+			if parentPath != "" {
+				pathOf[node.ID] = parentPath + "/" + node.Name
+			}
+			addFolders(folderOf[node.ID], pathOf[node.ID], node.Children)
+		}
+	}
+	addFolders("", "", models.BuildCategoryTree(cats))
+
+	// Export in creation order so repeated exports pick the same names
+	sort.SliceStable(all, func(i, j int) bool {
+		if !all[i].CreatedAt.Equal(all[j].CreatedAt) {
+			return all[i].CreatedAt.Before(all[j].CreatedAt)
+		}
+		return all[i].ID < all[j].ID
+	})
+
+	names := make(map[string]*namer)
+	files := make([]File, 0, len(all))
+	for _, note := range all {
+		// Notes without a category go to the top level
+		dir, category := "", ""
+		if folder, ok := folderOf[note.CategoryID]; ok {
+			dir, category = folder, pathOf[note.CategoryID]
+		}
+		if names[dir] == nil {
+			names[dir] = newNamer()
+		}
+		name := names[dir].unique(fileName(note.Subject, note.ID), ".md")
+
+		files = append(files, File{
+			Path:    path.Join(dir, name),
+			ModTime: note.UpdatedAt,
+			Content: []byte(renderNote(note, category)),
+		})
+	}
+	return files, nil
+}
+
+// renderNote returns the Markdown document for a note
+func renderNote(note *models.Note, category string) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	fmt.Fprintf(&b, "id: %s\n", yamlString(note.ID))
+	fmt.Fprintf(&b, "title: %s\n", yamlString(note.Subject))
+	if note.Priority != "" {
+		fmt.Fprintf(&b, "priority: %s\n", yamlString(note.Priority))
+	}
+	tags := SplitTags(note.Tags)
+	quoted := make([]string, len(tags))
+	for i, tag := range tags {
+		quoted[i] = yamlString(tag)
+	}
+	fmt.Fprintf(&b, "tags: [%s]\n", strings.Join(quoted, ", "))
+	if category != "" {
+		fmt.Fprintf(&b, "category: %s\n", yamlString(category))
+	}
+	fmt.Fprintf(&b, "created_at: %s\n", note.CreatedAt.UTC().Format(time.RFC3339))
+	fmt.Fprintf(&b, "updated_at: %s\n", note.UpdatedAt.UTC().Format(time.RFC3339))
+	b.WriteString("---\n\n")
+
+	b.WriteString(note.Content)
+	if !strings.HasSuffix(note.Content, "\n") {
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// SplitTags splits the comma-separated tags of a note
+func SplitTags(tags string) []string {
+	return models.SplitTags(tags)
+}
+
+// yamlString quotes s as a YAML double-quoted scalar. Go's escape
+// sequences are a subset of the ones YAML understands.
+func yamlString(s string) string {
+	return strconv.Quote(s)
+}
+
+// fileName turns s into a name that is valid on common file systems,
+// falling back to fallback when nothing usable is left
+func fileName(s, fallback string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r < 0x20 || r == 0x7f:
+			b.WriteRune(' ')
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			b.WriteRune('-')
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	name := strings.Join(strings.Fields(b.String()), " ")
+	// Leading dots hide files, trailing dots and spaces are dropped on Windows
+	name = strings.TrimLeft(name, ".")
+	name = strings.TrimRight(name, ". ")
+	if len(name) > 100 {
+		name = truncate(name, 100)
+	}
+	if name == "" {
+		return fallback
+	}
+	return name
+}
+
+// truncate cuts s to at most n bytes without splitting a UTF-8 sequence
+func truncate(s string, n int) string {
+	cut := 0
+	for i := range s {
+		if i > n {
+			break
+		}
+		cut = i
+	}
+	return strings.TrimRight(s[:cut], ". ")
+}
+
+// namer hands out names that are unique within one folder, ignoring case
+// since not every file system distinguishes it
+type namer struct {
+	used map[string]bool
+}
+
+func newNamer() *namer {
+	return &namer{used: make(map[string]bool)}
+}
+
+// unique returns base+ext, or base (2)+ext, base (3)+ext, ... if taken
+func (n *namer) unique(base, ext string) string {
+	name := base + ext
+	for i := 2; n.used[strings.ToLower(name)]; i++ {
+		name = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+	n.used[strings.ToLower(name)] = true
+	return name
+}
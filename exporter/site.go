@@ -0,0 +1,372 @@
+package exporter
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"path"
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/repositories"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SiteOptions selects what SiteFiles publishes
+type SiteOptions struct {
+	// Title is shown on every page; it defaults to the name of the only
+	// category, or "Notes"
+	Title string
+	// CategoryIDs are the categories to publish, in the order they are
+	// listed on the index page
+	CategoryIDs []string
+}
+
+// Paths in a site that category folders must not take
+const (
+	siteIndex = "index.html"
+	siteStyle = "style.css"
+	siteTags  = "tags"
+)
+
+// siteNote is a note with the location of its page
+type siteNote struct {
+	*models.Note
+	Path     string
+	Category *siteCategory
+	TagPages []*siteTag
+	Body     template.HTML
+	// LinkedFrom lists the notes linking to this one
+	LinkedFrom []*siteNote
+}
+
+type siteCategory struct {
+	Name  string
+	Path  string
+	Notes []*siteNote
+}
+
+type siteTag struct {
+	Name  string
+	Path  string
+	Notes []*siteNote
+}
+
+// sitePage is the data of one page. Root is the relative path from the
+// page to the root of the site, so the site works from any location,
+// including straight from disk.
+type sitePage struct {
+	Site       string
+	Title      string
+	Root       string
+	Categories []*siteCategory
+	Category   *siteCategory
+	Tags       []*siteTag
+	Tag        *siteTag
+	Note       *siteNote
+}
+
+// SiteFiles renders the notes of the selected categories as a static HTML
+// site: an index page, a page per category, note and tag, and a style
+// sheet. Note bodies are converted from Markdown, and [[wikilinks]] and
+// links to .md files of other published notes point to their pages; links
+// to notes that are not published are rendered as text. The site has no
+// external resources. The repositories are expected to decrypt.
+func SiteFiles(notes repositories.NoteRepositoryInterface, categories repositories.CategoryRepositoryInterface, opts SiteOptions) ([]File, error) {
+	folders := newNamer()
+	for _, reserved := range []string{siteIndex, siteStyle, siteTags} {
+		folders.unique(reserved, "")
+	}
+
+	var cats []*siteCategory
+	var all []*siteNote
+	seen := make(map[string]bool)
+	for _, id := range opts.CategoryIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		cat, err := categories.GetByID(id)
+		if err != nil {
+			return nil, err
+		}
+		catNotes, err := notes.GetByCategoryID(id)
+		if err != nil {
+			return nil, err
+		}
+
+		sc := &siteCategory{Name: cat.Name, Path: folders.slug(cat.Name, "category", "")}
+		sort.SliceStable(catNotes, func(i, j int) bool {
+			a, b := strings.ToLower(catNotes[i].Subject), strings.ToLower(catNotes[j].Subject)
+			if a != b {
+				return a < b
+			}
+			return catNotes[i].ID < catNotes[j].ID
+		})
+		names := newNamer()
+		names.unique("index", ".html")
+		for _, note := range catNotes {
+			sn := &siteNote{Note: note, Category: sc}
+			sn.Path = path.Join(sc.Path, names.slug(note.Subject, "note", ".html"))
+			sc.Notes = append(sc.Notes, sn)
+			all = append(all, sn)
+		}
+		cats = append(cats, sc)
+	}
+
+	title := opts.Title
+	if title == "" {
+		title = "Notes"
+		if len(cats) == 1 {
+			title = cats[0].Name
+		}
+	}
+
+	tags := groupTags(all)
+
+	// Titles of published notes, for resolving links; the first note with
+	// a title wins
+	byTitle := make(map[string]*siteNote)
+	for _, sn := range all {
+		if key := strings.ToLower(strings.TrimSpace(sn.Subject)); byTitle[key] == nil {
+			byTitle[key] = sn
+		}
+	}
+	for _, sn := range all {
+		from := sn
+		linked := make(map[*siteNote]bool)
+		r := &mdRenderer{resolve: func(target string) (string, bool) {
+			to := byTitle[strings.ToLower(strings.TrimSpace(target))]
+			if to == nil {
+				return "", false
+			}
+			if to != from && !linked[to] {
+				linked[to] = true
+				to.LinkedFrom = append(to.LinkedFrom, from)
+			}
+			return "../" + to.Path, true
+		}}
+		sn.Body = template.HTML(r.render(stripTitle(sn.Content, sn.Subject)))
+	}
+
+	var files []File
+	latest := time.Time{}
+	add := func(p, tmpl string, page sitePage, modTime time.Time) error {
+		page.Site = title
+		if strings.Contains(p, "/") {
+			page.Root = "../"
+		}
+		var buf bytes.Buffer
+		if err := siteTemplates.ExecuteTemplate(&buf, tmpl, page); err != nil {
+			return err
+		}
+		files = append(files, File{Path: p, ModTime: modTime, Content: buf.Bytes()})
+		return nil
+	}
+
+	for _, sn := range all {
+		if sn.UpdatedAt.After(latest) {
+			latest = sn.UpdatedAt
+		}
+		if err := add(sn.Path, "note", sitePage{Title: sn.Subject, Note: sn}, sn.UpdatedAt); err != nil {
+			return nil, err
+		}
+	}
+	for _, sc := range cats {
+		if err := add(path.Join(sc.Path, siteIndex), "category", sitePage{Title: sc.Name, Category: sc}, newest(sc.Notes)); err != nil {
+			return nil, err
+		}
+	}
+	for _, tag := range tags {
+		if err := add(tag.Path, "tag", sitePage{Title: "#" + tag.Name, Tag: tag}, newest(tag.Notes)); err != nil {
+			return nil, err
+		}
+	}
+	if err := add(siteIndex, "index", sitePage{Title: title, Categories: cats, Tags: tags}, latest); err != nil {
+		return nil, err
+	}
+	files = append(files, File{Path: siteStyle, ModTime: latest, Content: []byte(siteCSS)})
+	return files, nil
+}
+
+// groupTags groups notes by tag, ignoring case, sorted by name
+func groupTags(notes []*siteNote) []*siteTag {
+	byName := make(map[string]*siteTag)
+	names := newNamer()
+	var tags []*siteTag
+	for _, sn := range notes {
+		for _, name := range SplitTags(sn.Tags) {
+			key := strings.ToLower(name)
+			tag := byName[key]
+			if tag == nil {
+				tag = &siteTag{Name: name}
+				byName[key] = tag
+				tags = append(tags, tag)
+			}
+			if n := len(tag.Notes); n == 0 || tag.Notes[n-1] != sn {
+				tag.Notes = append(tag.Notes, sn)
+				sn.TagPages = append(sn.TagPages, tag)
+			}
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool { return strings.ToLower(tags[i].Name) < strings.ToLower(tags[j].Name) })
+	for _, tag := range tags {
+		tag.Path = path.Join(siteTags, names.slug(tag.Name, "tag", ".html"))
+	}
+	return tags
+}
+
+// stripTitle removes a first-line "# title" heading from content, which
+// Markdown imports and editors often add, since the page shows the title
+func stripTitle(content, title string) string {
+	first, rest, _ := strings.Cut(strings.TrimLeft(content, "\r\n"), "\n")
+	if m := atxHeading.FindStringSubmatch(strings.TrimSpace(first)); m != nil && len(m[1]) == 1 && strings.EqualFold(strings.TrimSpace(m[2]), strings.TrimSpace(title)) {
+		return rest
+	}
+	return content
+}
+
+// newest returns the latest update time of notes
+func newest(notes []*siteNote) time.Time {
+	var t time.Time
+	for _, sn := range notes {
+		if sn.UpdatedAt.After(t) {
+			t = sn.UpdatedAt
+		}
+	}
+	return t
+}
+
+// slug returns the slug of s with ext, or the slug followed by -2, -3, ...
+// if taken, so that names stay free of characters that need escaping
+func (n *namer) slug(s, fallback, ext string) string {
+	base := slug(s, fallback)
+	name := base + ext
+	for i := 2; n.used[name]; i++ {
+		name = fmt.Sprintf("%s-%d%s", base, i, ext)
+	}
+	n.used[name] = true
+	return name
+}
+
+// slug turns s into a lower-case name made of ASCII letters, digits and
+// dashes, which is safe in URLs and file names without escaping
+func slug(s, fallback string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	name := b.String()
+	if len(name) > 80 {
+		name = strings.TrimRight(name[:80], "-")
+	}
+	if name == "" {
+		return fallback
+	}
+	return name
+}
+
+var siteTemplates = template.Must(template.New("site").Funcs(template.FuncMap{
+	"date": func(t time.Time) string { return t.UTC().Format("2006-01-02") },
+}).Parse(`
+{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{if ne .Title .Site}}{{.Title}} · {{end}}{{.Site}}</title>
+<link rel="stylesheet" href="{{.Root}}style.css">
+</head>
+<body>
+<header><a href="{{.Root}}index.html">{{.Site}}</a></header>
+<main>
+{{end}}
+
+{{define "footer"}}</main>
+</body>
+</html>
+{{end}}
+
+{{define "index"}}{{template "header" .}}<h1>{{.Site}}</h1>
+{{range .Categories}}<section>
+<h2><a href="{{.Path}}/index.html">{{.Name}}</a></h2>
+<ul class="notes">
+{{range .Notes}}<li><a href="{{.Path}}">{{.Subject}}</a></li>
+{{else}}<li class="empty">No notes</li>
+{{end}}</ul>
+</section>
+{{end}}{{if .Tags}}<section>
+<h2>Tags</h2>
+<p class="tags">{{range .Tags}}<a href="{{.Path}}">#{{.Name}}</a> {{end}}</p>
+</section>
+{{end}}{{template "footer" .}}{{end}}
+
+{{define "category"}}{{template "header" .}}<h1>{{.Category.Name}}</h1>
+<ul class="notes">
+{{range .Category.Notes}}<li><a href="{{$.Root}}{{.Path}}">{{.Subject}}</a> <time>{{date .UpdatedAt}}</time></li>
+{{else}}<li class="empty">No notes</li>
+{{end}}</ul>
+{{template "footer" .}}{{end}}
+
+{{define "tag"}}{{template "header" .}}<h1>#{{.Tag.Name}}</h1>
+<ul class="notes">
+{{range .Tag.Notes}}<li><a href="{{$.Root}}{{.Path}}">{{.Subject}}</a> <span class="category">{{.Category.Name}}</span></li>
+{{end}}</ul>
+{{template "footer" .}}{{end}}
+
+{{define "note"}}{{template "header" .}}<article>
+<p class="breadcrumb"><a href="{{.Root}}{{.Note.Category.Path}}/index.html">{{.Note.Category.Name}}</a></p>
+<h1>{{.Note.Subject}}</h1>
+<p class="meta">Updated <time datetime="{{.Note.UpdatedAt.UTC.Format "2006-01-02T15:04:05Z07:00"}}">{{date .Note.UpdatedAt}}</time>{{if .Note.TagPages}} ·{{range .Note.TagPages}} <a href="{{$.Root}}{{.Path}}">#{{.Name}}</a>{{end}}{{end}}</p>
+<div class="content">
+{{.Note.Body}}</div>
+{{if .Note.LinkedFrom}}<aside>
+<h2>Linked from</h2>
+<ul>
+{{range .Note.LinkedFrom}}<li><a href="{{$.Root}}{{.Path}}">{{.Subject}}</a></li>
+{{end}}</ul>
+</aside>
+{{end}}</article>
+{{template "footer" .}}{{end}}
+`))
+
+const siteCSS = `body {
+  margin: 0;
+  font: 16px/1.6 -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif;
+  color: #222;
+  background: #fff;
+}
+header {
+  padding: 0.75rem 1.5rem;
+  border-bottom: 1px solid #e5e5e5;
+  font-weight: 600;
+}
+header a { color: inherit; text-decoration: none; }
+main { max-width: 46rem; margin: 0 auto; padding: 1.5rem; }
+a { color: #0b5cad; }
+h1, h2, h3 { line-height: 1.25; }
+ul.notes { list-style: none; padding: 0; }
+ul.notes li { padding: 0.3rem 0; border-bottom: 1px solid #f0f0f0; }
+time, .meta, .category, .breadcrumb, .empty { color: #777; font-size: 0.875rem; }
+.breadcrumb { margin-bottom: 0; }
+.tags a { margin-right: 0.5rem; }
+.missing-link { color: #a33; }
+pre { background: #f6f8fa; padding: 0.75rem 1rem; overflow-x: auto; border-radius: 4px; }
+code { font-family: SFMono-Regular, Consolas, "Liberation Mono", monospace; font-size: 0.9em; }
+blockquote { margin: 0; padding-left: 1rem; border-left: 3px solid #ddd; color: #555; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ddd; padding: 0.3rem 0.6rem; }
+li > input[type=checkbox] { margin-right: 0.3rem; }
+img { max-width: 100%; }
+aside { margin-top: 2rem; padding-top: 1rem; border-top: 1px solid #e5e5e5; }
+aside h2 { font-size: 1rem; }
+`
@@ -0,0 +1,58 @@
+package exporter
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// File is a single file of an export, with a slash-separated path relative
+// to the root of the export
+type File struct {
+	Path    string
+	ModTime time.Time
+	Content []byte
+}
+
+// WriteDir writes files below dir, creating it when needed. Existing files
+// with the same paths are overwritten; other files in dir are left alone.
+func WriteDir(dir string, files []File) error {
+	for _, f := range files {
+		target := filepath.Join(dir, filepath.FromSlash(f.Path))
+		if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		if err := os.WriteFile(target, f.Content, 0600); err != nil {
+			return fmt.Errorf("failed to write %s: %w", f.Path, err)
+		}
+		if !f.ModTime.IsZero() {
+			// The content is what matters; a wrong modification time is not
+			// worth failing the export for
+			_ = os.Chtimes(target, f.ModTime, f.ModTime)
+		}
+	}
+	return nil
+}
+
+// WriteZip writes files as a zip archive to w. The archive is streamed, so
+// w can be an HTTP response.
+func WriteZip(w io.Writer, files []File) error {
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		hdr := &zip.FileHeader{Name: f.Path, Method: zip.Deflate, Modified: f.ModTime}
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return fmt.Errorf("failed to add %s: %w", f.Path, err)
+		}
+		if _, err := fw.Write(f.Content); err != nil {
+			return fmt.Errorf("failed to write %s: %w", f.Path, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to finish zip archive: %w", err)
+	}
+	return nil
+}
@@ -12,8 +12,13 @@ class CategoriesComponent {
         this.categoryModalTitle = document.getElementById('category-modal-title');
         this.categoryIdInput = document.getElementById('category-id');
         this.categoryNameInput = document.getElementById('category-name');
+        this.categoryParentInput = document.getElementById('category-parent');
+        this.categoryDescriptionInput = document.getElementById('category-description');
+        this.categoryColorInput = document.getElementById('category-color');
+        this.categoryIconInput = document.getElementById('category-icon');
         this.confirmModal = document.getElementById('confirm-modal');
         this.confirmMessage = document.getElementById('confirm-message');
+        this.confirmOptions = document.getElementById('confirm-options');
         this.confirmYesBtn = document.getElementById('confirm-yes');
         
         // State
@@ -43,15 +48,16 @@ class CategoriesComponent {
     }
     
     /**
-     * Load all categories from the API
+     * Load the category tree from the API
      */
     async loadCategories() {
         try {
             this.categoriesContainer.innerHTML = '<div class="loading">Loading categories...</div>';
-            const categories = await apiService.getCategories();
+            const tree = await apiService.getCategoryTree();
             
-            // Ensure categories is always an array, even if API returns null or undefined
-            this.categories = Array.isArray(categories) ? categories : [];
+            // Flatten the tree so subcategories follow their parent
+            this.categories = [];
+            this.flattenTree(Array.isArray(tree) ? tree : [], 0);
             
             this.renderCategories();
         } catch (error) {
@@ -68,6 +74,52 @@ class CategoriesComponent {
         }
     }
     
+    /**
+     * Add the nodes of a category tree to this.categories in display order
+     * @param {Array} nodes - Categories with their children
+     * @param {number} depth - Nesting depth of the nodes
+     */
+    flattenTree(nodes, depth) {
+        nodes.forEach(node => {
+            this.categories.push({ ...node, depth });
+            this.flattenTree(node.children || [], depth + 1);
+        });
+    }
+    
+    /**
+     * Return the IDs of a category and all its subcategories
+     * @param {string} categoryId - The ID of the category
+     * @returns {Set<string>} - The IDs
+     */
+    subtreeIds(categoryId) {
+        const ids = new Set([categoryId]);
+        // Subcategories follow their parent, so one pass is enough
+        this.categories.forEach(category => {
+            if (ids.has(category.parent_id)) {
+                ids.add(category.id);
+            }
+        });
+        return ids;
+    }
+    
+    /**
+     * Fill the parent dropdown, leaving out the category being edited and
+     * its subcategories
+     * @param {string|null} categoryId - The ID of the category being edited
+     */
+    populateParentDropdown(categoryId) {
+        const excluded = categoryId ? this.subtreeIds(categoryId) : new Set();
+        this.categoryParentInput.innerHTML = '<option value="">None (top level)</option>';
+        
+        this.categories.forEach(category => {
+            if (excluded.has(category.id)) return;
+            const option = document.createElement('option');
+            option.value = category.id;
+            option.textContent = '\u00a0\u00a0'.repeat(category.depth) + category.name;
+            this.categoryParentInput.appendChild(option);
+        });
+    }
+    
     /**
      * Render all categories in the container
      */
@@ -90,11 +142,29 @@ class CategoriesComponent {
         this.categoriesContainer.innerHTML = '';
         
         this.categories.forEach(category => {
+            const siblings = this.siblingIds(category);
+            const index = siblings.indexOf(category.id);
             const categoryElement = document.createElement('div');
             categoryElement.className = 'category-card';
+            categoryElement.style.marginLeft = `${category.depth * 1.5}rem`;
+            if (category.color) {
+                categoryElement.style.borderLeft = `4px solid ${category.color}`;
+            }
             categoryElement.innerHTML = `
-                <h3 class="category-name">${this.escapeHtml(category.name)}</h3>
+                <div class="category-info">
+                    <h3 class="category-name">
+                        ${this.renderIcon(category.icon)}${this.escapeHtml(category.name)}
+                        <span class="category-count">${category.note_count || 0} note${category.note_count === 1 ? '' : 's'}</span>
+                    </h3>
+                    ${category.description ? `<p class="category-description">${this.escapeHtml(category.description)}</p>` : ''}
+                </div>
                 <div class="card-actions">
+                    <button class="btn btn-sm btn-secondary move-up-category" title="Move up" ${index === 0 ? 'disabled' : ''}>
+                        <i class="fas fa-arrow-up"></i>
+                    </button>
+                    <button class="btn btn-sm btn-secondary move-down-category" title="Move down" ${index === siblings.length - 1 ? 'disabled' : ''}>
+                        <i class="fas fa-arrow-down"></i>
+                    </button>
                     <button class="btn btn-sm btn-secondary edit-category" data-id="${category.id}">
                         <i class="fas fa-edit"></i>
                     </button>
@@ -110,11 +180,67 @@ class CategoriesComponent {
             
             editBtn.addEventListener('click', () => this.openEditCategoryModal(category.id));
             deleteBtn.addEventListener('click', () => this.confirmDeleteCategory(category.id));
+            categoryElement.querySelector('.move-up-category')
+                .addEventListener('click', () => this.moveCategoryBy(category, -1));
+            categoryElement.querySelector('.move-down-category')
+                .addEventListener('click', () => this.moveCategoryBy(category, 1));
             
             this.categoriesContainer.appendChild(categoryElement);
         });
     }
     
+    /**
+     * Return the IDs of a category and the other subcategories of its
+     * parent, in display order
+     * @param {object} category - The category
+     * @returns {Array<string>} - The IDs
+     */
+    siblingIds(category) {
+        return this.categories
+            .filter(c => (c.parent_id || '') === (category.parent_id || ''))
+            .map(c => c.id);
+    }
+    
+    /**
+     * Move a category up or down among the subcategories of its parent
+     * @param {object} category - The category to move
+     * @param {number} offset - -1 to move up, 1 to move down
+     */
+    async moveCategoryBy(category, offset) {
+        const ids = this.siblingIds(category);
+        const index = ids.indexOf(category.id);
+        const swapWith = index + offset;
+        if (swapWith < 0 || swapWith >= ids.length) return;
+        [ids[index], ids[swapWith]] = [ids[swapWith], ids[index]];
+        
+        try {
+            await apiService.reorderCategories(category.parent_id || '', ids);
+            await this.loadCategories();
+            
+            // If notes component exists, reload categories there too
+            if (typeof notesComponent !== 'undefined') {
+                await notesComponent.loadCategories();
+            }
+        } catch (error) {
+            toastService.error(`We were unable to reorder your categories: ${error.message}`);
+            console.error('Error reordering categories:', error);
+        }
+    }
+    
+    /**
+     * Render the icon of a category: a Font Awesome icon for names such as
+     * fa-briefcase, otherwise the icon text itself, such as an emoji
+     * @param {string} icon - The icon of the category
+     * @returns {string} - HTML for the icon
+     */
+    renderIcon(icon) {
+        if (!icon) return '';
+        if (/^fa-[a-z0-9-]+$/.test(icon)) {
+            return `<i class="fas ${icon} category-icon"></i>`;
+        }
+        return `<span class="category-icon">${this.escapeHtml(icon)}</span>`;
+    }
+    
     /**
      * Escape HTML to prevent XSS
      * @param {string} unsafe - Unsafe string
@@ -138,6 +264,7 @@ class CategoriesComponent {
         this.categoryForm.reset();
         this.categoryIdInput.value = '';
         this.currentCategoryId = null;
+        this.populateParentDropdown(null);
         this.categoryModal.classList.add('active');
     }
     
@@ -159,6 +286,11 @@ class CategoriesComponent {
             // Populate the form
             this.categoryIdInput.value = category.id;
             this.categoryNameInput.value = category.name || '';
+            this.categoryDescriptionInput.value = category.description || '';
+            this.categoryColorInput.value = category.color || '';
+            this.categoryIconInput.value = category.icon || '';
+            this.populateParentDropdown(category.id);
+            this.categoryParentInput.value = category.parent_id || '';
             
             this.currentCategoryId = categoryId;
             this.categoryModal.classList.add('active');
@@ -184,17 +316,26 @@ class CategoriesComponent {
         
         try {
             const categoryData = {
-                name: this.categoryNameInput.value
+                name: this.categoryNameInput.value,
+                description: this.categoryDescriptionInput.value,
+                color: this.categoryColorInput.value,
+                icon: this.categoryIconInput.value
             };
+            const parentId = this.categoryParentInput.value;
             
             let result;
             
             if (this.currentCategoryId) {
-                // Update existing category
+                // Update existing category, moving it when the parent changed
                 result = await apiService.updateCategory(this.currentCategoryId, categoryData);
+                const category = this.categories.find(c => c.id === this.currentCategoryId);
+                if (category && (category.parent_id || '') !== parentId) {
+                    result = await apiService.moveCategory(this.currentCategoryId, parentId);
+                }
                 toastService.success('Your category has been updated successfully.');
             } else {
                 // Create new category
+                categoryData.parent_id = parentId;
                 result = await apiService.createCategory(categoryData);
                 toastService.success('Your category has been created successfully.');
             }
@@ -208,7 +349,7 @@ class CategoriesComponent {
                 await notesComponent.loadCategories();
             }
         } catch (error) {
-            toastService.error('We were unable to save your category. Please try again later.');
+            toastService.error(`We were unable to save your category: ${error.message}`);
             console.error('Error saving category:', error);
         }
     }
@@ -222,6 +363,7 @@ class CategoriesComponent {
         if (!category) return;
         
         this.confirmMessage.textContent = `Are you sure you want to delete the category "${category.name}"?`;
+        this.renderDeleteOptions(categoryId);
         
         // Remove previous event listeners
         const newConfirmYesBtn = this.confirmYesBtn.cloneNode(true);
@@ -230,7 +372,9 @@ class CategoriesComponent {
         
         // Add new event listener
         this.confirmYesBtn.addEventListener('click', async () => {
-            await this.deleteCategory(categoryId);
+            const mode = document.getElementById('delete-mode').value;
+            const targetId = document.getElementById('delete-target').value;
+            await this.deleteCategory(categoryId, mode, targetId);
             this.closeConfirmModal();
         });
         
@@ -243,6 +387,36 @@ class CategoriesComponent {
         this.confirmModal.classList.add('active');
     }
     
+    /**
+     * Show the choice of what happens to the notes and subcategories of a
+     * category that is deleted
+     * @param {string} categoryId - The ID of the category to delete
+     */
+    renderDeleteOptions(categoryId) {
+        const targets = this.categories
+            .filter(c => c.id !== categoryId)
+            .map(c => `<option value="${c.id}">${'&nbsp;&nbsp;'.repeat(c.depth)}${this.escapeHtml(c.name)}</option>`)
+            .join('');
+        this.confirmOptions.innerHTML = `
+            <div class="form-group">
+                <label for="delete-mode">Notes and subcategories</label>
+                <select id="delete-mode">
+                    <option value="refuse">Only delete the category if it is empty</option>
+                    ${targets ? '<option value="move">Move its notes to another category</option>' : ''}
+                    <option value="trash">Delete its subcategories and move all notes to the trash</option>
+                </select>
+            </div>
+            <div class="form-group" id="delete-target-group" hidden>
+                <label for="delete-target">Move notes to</label>
+                <select id="delete-target">${targets}</select>
+            </div>
+        `;
+        const modeInput = document.getElementById('delete-mode');
+        modeInput.addEventListener('change', () => {
+            document.getElementById('delete-target-group').hidden = modeInput.value !== 'move';
+        });
+    }
+    
     /**
      * Close the confirmation modal
      */
@@ -253,10 +427,12 @@ class CategoriesComponent {
     /**
      * Delete a category
      * @param {string} categoryId - The ID of the category to delete
+     * @param {string} mode - refuse, move or trash
+     * @param {string} targetId - The category notes move to with move
      */
-    async deleteCategory(categoryId) {
+    async deleteCategory(categoryId, mode, targetId) {
         try {
-            await apiService.deleteCategory(categoryId);
+            await apiService.deleteCategory(categoryId, mode, mode === 'move' ? targetId : '');
             toastService.success('Your category has been deleted successfully.');
             await this.loadCategories();
             
@@ -267,7 +443,7 @@ class CategoriesComponent {
                 await notesComponent.loadNotes();
             }
         } catch (error) {
-            toastService.error('We were unable to delete your category. Please try again later.');
+            toastService.error(`We were unable to delete your category: ${error.message}`);
             console.error('Error deleting category:', error);
         }
     }
@@ -11,6 +11,7 @@ class KeyGeneratorComponent {
         this.keyInput = document.getElementById('key-input');
         this.generatedKeyInput = document.getElementById('generated-key');
         this.copyKeyBtn = document.getElementById('copy-key-btn');
+        this.randomKeyBtn = document.getElementById('random-key-btn');
 
         // Initialize
         this.init();
@@ -24,6 +25,7 @@ class KeyGeneratorComponent {
         this.keyGeneratorBtn.addEventListener('click', () => this.openModal());
         this.keyGeneratorForm.addEventListener('submit', (e) => this.handleGenerateKey(e));
         this.copyKeyBtn.addEventListener('click', () => this.copyGeneratedKey());
+        this.randomKeyBtn.addEventListener('click', () => this.handleRandomKey());
 
         // Close modal buttons
         const closeButtons = this.keyGeneratorModal.querySelectorAll('.close-modal');
@@ -55,8 +57,12 @@ class KeyGeneratorComponent {
     async handleGenerateKey(event) {
         event.preventDefault();
 
+        const inputText = this.keyInput.value;
+        if (!inputText) {
+            return this.handleRandomKey();
+        }
+
         try {
-            const inputText = this.keyInput.value;
             const response = await apiService.generateKey(inputText);
             this.generatedKeyInput.value = response.key;
             toastService.success('Key generated successfully');
@@ -65,6 +71,19 @@ class KeyGeneratorComponent {
         }
     }
 
+    /**
+     * Generate a key from the server's secure random source
+     */
+    async handleRandomKey() {
+        try {
+            const response = await apiService.generateRandomKey();
+            this.generatedKeyInput.value = response.key;
+            toastService.success('Random key generated successfully');
+        } catch (error) {
+            toastService.error('Failed to generate key: ' + error.message);
+        }
+    }
+
     /**
      * Copy the generated key to clipboard
      */
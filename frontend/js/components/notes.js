@@ -16,6 +16,10 @@ class NotesComponent {
         this.notePriorityInput = document.getElementById('note-priority');
         this.noteTagsInput = document.getElementById('note-tags');
         this.noteCategoryInput = document.getElementById('note-category');
+        this.noteDueInput = document.getElementById('note-due');
+        this.noteRemindInput = document.getElementById('note-remind');
+        this.noteRecurrenceInput = document.getElementById('note-recurrence');
+        this.noteRecurrenceModeInput = document.getElementById('note-recurrence-mode');
         this.confirmModal = document.getElementById('confirm-modal');
         this.confirmMessage = document.getElementById('confirm-message');
         this.confirmYesBtn = document.getElementById('confirm-yes');
@@ -24,6 +28,9 @@ class NotesComponent {
         this.searchInput = document.getElementById('search-notes');
         this.searchClearBtn = document.getElementById('search-clear-btn');
         this.showAllBtn = document.getElementById('show-all-notes-btn');
+        this.favoritesBtn = document.getElementById('favorites-btn');
+        this.dueSoonBtn = document.getElementById('due-soon-btn');
+        this.showArchivedBtn = document.getElementById('show-archived-btn');
         
         // State
         this.notes = [];
@@ -32,6 +39,13 @@ class NotesComponent {
         this.searchQuery = '';
         this.searchTimeout = null;
         this.showAllNotes = false;
+        this.favoritesOnly = false;
+        this.dueSoonOnly = false;
+        this.includeArchived = false;
+        this.defaultPriority = 'medium';
+        // Checklists shown under their note, and their items by note ID
+        this.openChecklists = new Set();
+        this.checklists = {};
         
         // Initialize
         this.init();
@@ -49,6 +63,21 @@ class NotesComponent {
         this.searchInput.addEventListener('input', () => this.handleSearchInput());
         this.searchClearBtn.addEventListener('click', () => this.clearSearch());
         this.showAllBtn.addEventListener('click', () => this.toggleShowAll());
+        this.favoritesBtn.addEventListener('click', () => {
+            this.favoritesOnly = !this.favoritesOnly;
+            this.favoritesBtn.classList.toggle('active', this.favoritesOnly);
+            this.loadNotes();
+        });
+        this.dueSoonBtn.addEventListener('click', () => {
+            this.dueSoonOnly = !this.dueSoonOnly;
+            this.dueSoonBtn.classList.toggle('active', this.dueSoonOnly);
+            this.loadNotes();
+        });
+        this.showArchivedBtn.addEventListener('click', () => {
+            this.includeArchived = !this.includeArchived;
+            this.showArchivedBtn.classList.toggle('active', this.includeArchived);
+            this.loadNotes();
+        });
         
         // Close modal buttons
         const closeButtons = this.noteModal.querySelectorAll('.close-modal');
@@ -57,8 +86,29 @@ class NotesComponent {
         });
         
         // Load data
+        await this.loadPriorities();
         await this.loadCategories();
         await this.loadNotes();
+        this.listenForReminders();
+    }
+    
+    /**
+     * Show the reminders pushed by the server while the page is open. The
+     * browser reconnects by itself when the connection drops.
+     */
+    listenForReminders() {
+        if (!window.EventSource) return;
+        const events = apiService.reminderEvents();
+        events.addEventListener('reminder', (event) => {
+            try {
+                const reminder = JSON.parse(event.data);
+                const due = reminder.due_at ? ` (due ${this.formatDate(reminder.due_at)})` : '';
+                toastService.warning(`Reminder: ${reminder.subject}${due}`, 10000);
+                this.loadNotes();
+            } catch (error) {
+                console.error('Error reading reminder:', error);
+            }
+        });
     }
     
     /**
@@ -130,6 +180,20 @@ class NotesComponent {
                 params.append('all', 'true');
             }
             
+            if (this.favoritesOnly) {
+                params.append('favorite', 'true');
+            }
+            
+            if (this.dueSoonOnly) {
+                // Overdue notes and the notes due in the next seven days
+                const dueBefore = new Date(Date.now() + 7 * 24 * 60 * 60 * 1000);
+                params.append('due_before', dueBefore.toISOString());
+            }
+            
+            if (this.includeArchived) {
+                params.append('include_archived', 'true');
+            }
+            
             const queryString = params.toString();
             if (queryString) {
                 url += `?${queryString}`;
@@ -170,20 +234,75 @@ class NotesComponent {
         }
     }
     
+    /**
+     * Load the configured priority levels into the priority dropdown. The
+     * built-in options are kept if the server does not provide them.
+     */
+    async loadPriorities() {
+        try {
+            const priorities = await apiService.getPriorities();
+            if (!priorities || !Array.isArray(priorities.levels) || priorities.levels.length === 0) {
+                return;
+            }
+            this.notePriorityInput.innerHTML = '';
+            priorities.levels.forEach(level => {
+                const option = document.createElement('option');
+                option.value = level.name;
+                option.textContent = level.name.charAt(0).toUpperCase() + level.name.slice(1);
+                this.notePriorityInput.appendChild(option);
+            });
+            this.defaultPriority = priorities.default;
+        } catch (error) {
+            console.error('Error loading priorities:', error);
+        }
+    }
+    
     /**
      * Populate the category dropdown in the note form
      */
     populateCategoryDropdown() {
         this.noteCategoryInput.innerHTML = '<option value="">Select a category</option>';
         
-        this.categories.forEach(category => {
-            const option = document.createElement('option');
-            option.value = category.id;
-            option.textContent = category.name;
-            this.noteCategoryInput.appendChild(option);
-        });
+        this.categories
+            .map(category => ({ id: category.id, path: this.categoryPath(category.id) }))
+            .sort((a, b) => a.path.localeCompare(b.path))
+            .forEach(category => {
+                const option = document.createElement('option');
+                option.value = category.id;
+                option.textContent = category.path;
+                this.noteCategoryInput.appendChild(option);
+            });
     }
     
+    /**
+     * Return the names from the top-level category down to a category
+     * @param {string} categoryId - The ID of the category
+     * @returns {string} - The names joined by " / "
+     */
+    categoryPath(categoryId) {
+        const names = [];
+        const seen = new Set();
+        let category = this.categories.find(c => c.id === categoryId);
+        while (category && !seen.has(category.id)) {
+            seen.add(category.id);
+            names.unshift(category.name);
+            category = this.categories.find(c => c.id === category.parent_id);
+        }
+        return names.join(' / ');
+    }
+
+    /**
+     * Return a style attribute coloring a category badge with the color of
+     * its category, or nothing when the category has no color
+     * @param {string} categoryId - The ID of the category
+     * @returns {string} - The style attribute
+     */
+    categoryColorStyle(categoryId) {
+        const category = this.categories.find(c => c.id === categoryId);
+        if (!category || !/^#[0-9a-f]{3,6}$/.test(category.color || '')) return '';
+        return ` style="border: 1px solid ${category.color}"`;
+    }
+
     /**
      * Render all notes in the container
      */
@@ -238,10 +357,7 @@ class NotesComponent {
             // Find category name if available
             let categoryName = '';
             if (note.category_id) {
-                const category = this.categories.find(c => c.id === note.category_id);
-                if (category) {
-                    categoryName = category.name;
-                }
+                categoryName = this.categoryPath(note.category_id);
             }
             
             // Highlight search matches if search query exists
@@ -254,10 +370,29 @@ class NotesComponent {
             }
             
             html += `
-                <div class="card note-card">
+                <div class="card note-card${note.pinned ? ' pinned' : ''}${note.archived ? ' archived' : ''}">
                     <div class="card-header">
                         <h3 class="card-title">${subject}</h3>
                         <div class="card-actions">
+                            <button class="btn btn-secondary btn-sm${note.pinned ? ' active' : ''}" title="${note.pinned ? 'Unpin' : 'Pin'}" onclick="notesComponent.toggleState('${note.id}', 'pin')">
+                                <i class="fas fa-thumbtack"></i>
+                            </button>
+                            <button class="btn btn-secondary btn-sm${note.favorite ? ' active' : ''}" title="${note.favorite ? 'Remove from favorites' : 'Add to favorites'}" onclick="notesComponent.toggleState('${note.id}', 'favorite')">
+                                <i class="${note.favorite ? 'fas' : 'far'} fa-star"></i>
+                            </button>
+                            <button class="btn btn-secondary btn-sm${note.archived ? ' active' : ''}" title="${note.archived ? 'Unarchive' : 'Archive'}" onclick="notesComponent.toggleState('${note.id}', 'archive')">
+                                <i class="fas fa-box-archive"></i>
+                            </button>
+                            <button class="btn btn-secondary btn-sm${this.openChecklists.has(note.id) ? ' active' : ''}" title="Checklist" onclick="notesComponent.toggleChecklist('${note.id}')">
+                                <i class="fas fa-list-check"></i>
+                            </button>
+                            ${note.remind_at ? `
+                            <button class="btn btn-secondary btn-sm" title="Snooze reminder" onclick="notesComponent.snoozeReminder('${note.id}')">
+                                <i class="fas fa-clock"></i>
+                            </button>
+                            <button class="btn btn-secondary btn-sm" title="Dismiss reminder" onclick="notesComponent.dismissReminder('${note.id}')">
+                                <i class="fas fa-bell-slash"></i>
+                            </button>` : ''}
                             <button class="btn btn-secondary btn-sm" onclick="notesComponent.openEditNoteModal('${note.id}')">
                                 <i class="fas fa-edit"></i>
                             </button>
@@ -268,11 +403,16 @@ class NotesComponent {
                     </div>
                     <div class="card-content">
                         ${content}
+                        ${this.openChecklists.has(note.id) ? this.renderChecklist(note.id) : ''}
                     </div>
                     <div class="card-footer">
                         <div>
-                            <span class="priority priority-${note.priority || 'medium'}">${note.priority || 'Medium'}</span>
-                            ${categoryName ? `<span class="category-badge">${this.escapeHtml(categoryName)}</span>` : ''}
+                            <span class="priority priority-${this.escapeHtml(note.priority || this.defaultPriority)}">${this.escapeHtml(note.priority || this.defaultPriority)}</span>
+                            ${categoryName ? `<span class="category-badge"${this.categoryColorStyle(note.category_id)}>${this.escapeHtml(categoryName)}</span>` : ''}
+                            ${note.due_at ? `<span class="due-badge${new Date(note.due_at) < new Date() ? ' overdue' : ''}" title="Due"><i class="far fa-calendar"></i> ${this.formatDate(note.due_at)}</span>` : ''}
+                            ${note.remind_at && !note.reminded_at ? `<span class="reminder-badge" title="Reminder"><i class="far fa-bell"></i> ${this.formatDate(note.remind_at)}</span>` : ''}
+                            ${note.checklist_total ? `<span class="checklist-badge${note.checklist_done === note.checklist_total ? ' complete' : ''}" title="Checklist"><i class="far fa-square-check"></i> ${note.checklist_done}/${note.checklist_total}</span>` : ''}
+                            ${note.recurrence ? `<span class="recurrence-badge" title="${this.escapeHtml(note.recurrence)}"><i class="fas fa-repeat"></i> ${note.recur_at ? this.formatDate(note.recur_at) : 'ended'}</span>` : ''}
                         </div>
                         <div class="tags">
                             ${this.renderTags(note.tags)}
@@ -285,6 +425,224 @@ class NotesComponent {
         this.notesContainer.innerHTML = html;
     }
     
+    /**
+     * Toggle whether a note is pinned, a favorite or archived
+     * @param {string} noteId - The ID of the note
+     * @param {string} state - pin, favorite or archive
+     */
+    async toggleState(noteId, state) {
+        try {
+            await apiService.toggleNoteState(noteId, state);
+            await this.loadNotes();
+        } catch (error) {
+            toastService.error(`We were unable to update your note: ${error.message}`);
+            console.error('Error updating note state:', error);
+        }
+    }
+    
+    /**
+     * Put off the reminder of a note by the default snooze of the server
+     * @param {string} noteId - The ID of the note
+     */
+    async snoozeReminder(noteId) {
+        try {
+            const note = await apiService.snoozeNote(noteId);
+            toastService.info(`Reminder snoozed until ${this.formatDate(note.remind_at)}.`);
+            await this.loadNotes();
+        } catch (error) {
+            toastService.error(`We were unable to snooze the reminder: ${error.message}`);
+            console.error('Error snoozing reminder:', error);
+        }
+    }
+    
+    /**
+     * Remove the reminder of a note
+     * @param {string} noteId - The ID of the note
+     */
+    async dismissReminder(noteId) {
+        try {
+            await apiService.dismissReminder(noteId);
+            await this.loadNotes();
+        } catch (error) {
+            toastService.error(`We were unable to dismiss the reminder: ${error.message}`);
+            console.error('Error dismissing reminder:', error);
+        }
+    }
+    
+    /**
+     * Show the checklist of a note under it, or hide it when it is shown
+     * @param {string} noteId - The ID of the note
+     */
+    async toggleChecklist(noteId) {
+        if (this.openChecklists.has(noteId)) {
+            this.openChecklists.delete(noteId);
+            this.renderNotes();
+            return;
+        }
+        try {
+            this.checklists[noteId] = await apiService.getChecklist(noteId);
+            this.openChecklists.add(noteId);
+            this.renderNotes();
+        } catch (error) {
+            toastService.error(`We were unable to load the checklist: ${error.message}`);
+            console.error('Error loading checklist:', error);
+        }
+    }
+    
+    /**
+     * Render the checklist of a note with controls to check, move, delete
+     * and add items
+     * @param {string} noteId - The ID of the note
+     * @returns {string} - HTML for the checklist
+     */
+    renderChecklist(noteId) {
+        const items = this.checklists[noteId] || [];
+        const rows = items.map((item, index) => `
+            <div class="checklist-item${item.checked ? ' checked' : ''}">
+                <input type="checkbox" id="item-${item.id}"${item.checked ? ' checked' : ''} onchange="notesComponent.toggleChecklistItem('${noteId}', '${item.id}')">
+                <label for="item-${item.id}">${this.escapeHtml(item.text)}</label>
+                <button class="btn btn-secondary btn-sm" title="Move up" onclick="notesComponent.moveChecklistItem('${noteId}', ${index}, -1)"${index === 0 ? ' disabled' : ''}>
+                    <i class="fas fa-arrow-up"></i>
+                </button>
+                <button class="btn btn-secondary btn-sm" title="Move down" onclick="notesComponent.moveChecklistItem('${noteId}', ${index}, 1)"${index === items.length - 1 ? ' disabled' : ''}>
+                    <i class="fas fa-arrow-down"></i>
+                </button>
+                <button class="btn btn-danger btn-sm" title="Delete item" onclick="notesComponent.deleteChecklistItem('${noteId}', '${item.id}')">
+                    <i class="fas fa-times"></i>
+                </button>
+            </div>
+        `).join('');
+        return `
+            <div class="checklist">
+                ${rows}
+                <form class="checklist-add" onsubmit="notesComponent.addChecklistItem(event, '${noteId}')">
+                    <input type="text" placeholder="Add an item" required>
+                    <button type="submit" class="btn btn-secondary btn-sm"><i class="fas fa-plus"></i></button>
+                </form>
+            </div>
+        `;
+    }
+    
+    /**
+     * Keep the progress of a note in step with its changed checklist and
+     * render the notes again
+     * @param {string} noteId - The ID of the note
+     */
+    updateChecklistProgress(noteId) {
+        const items = this.checklists[noteId] || [];
+        const note = this.notes.find(n => n.id === noteId);
+        if (note) {
+            note.checklist_total = items.length;
+            note.checklist_done = items.filter(item => item.checked).length;
+        }
+        this.renderNotes();
+    }
+    
+    /**
+     * Check or uncheck an item of a checklist
+     * @param {string} noteId - The ID of the note
+     * @param {string} itemId - The ID of the item
+     */
+    async toggleChecklistItem(noteId, itemId) {
+        try {
+            const updated = await apiService.toggleChecklistItem(noteId, itemId);
+            this.checklists[noteId] = this.checklists[noteId].map(item => item.id === itemId ? updated : item);
+        } catch (error) {
+            toastService.error(`We were unable to update the checklist: ${error.message}`);
+            console.error('Error toggling checklist item:', error);
+        }
+        this.updateChecklistProgress(noteId);
+    }
+    
+    /**
+     * Add an item at the end of a checklist from its add form
+     * @param {Event} event - The form submit event
+     * @param {string} noteId - The ID of the note
+     */
+    async addChecklistItem(event, noteId) {
+        event.preventDefault();
+        const input = event.target.querySelector('input');
+        try {
+            const item = await apiService.addChecklistItem(noteId, input.value);
+            this.checklists[noteId] = [...(this.checklists[noteId] || []), item];
+            this.updateChecklistProgress(noteId);
+        } catch (error) {
+            toastService.error(`We were unable to add the item: ${error.message}`);
+            console.error('Error adding checklist item:', error);
+        }
+    }
+    
+    /**
+     * Move an item of a checklist one place up or down
+     * @param {string} noteId - The ID of the note
+     * @param {number} index - The index of the item
+     * @param {number} offset - -1 to move it up, 1 to move it down
+     */
+    async moveChecklistItem(noteId, index, offset) {
+        const ids = this.checklists[noteId].map(item => item.id);
+        [ids[index], ids[index + offset]] = [ids[index + offset], ids[index]];
+        try {
+            this.checklists[noteId] = await apiService.reorderChecklist(noteId, ids);
+            this.renderNotes();
+        } catch (error) {
+            toastService.error(`We were unable to reorder the checklist: ${error.message}`);
+            console.error('Error reordering checklist:', error);
+        }
+    }
+    
+    /**
+     * Delete an item of a checklist
+     * @param {string} noteId - The ID of the note
+     * @param {string} itemId - The ID of the item
+     */
+    async deleteChecklistItem(noteId, itemId) {
+        try {
+            await apiService.deleteChecklistItem(noteId, itemId);
+            this.checklists[noteId] = this.checklists[noteId].filter(item => item.id !== itemId);
+            this.updateChecklistProgress(noteId);
+        } catch (error) {
+            toastService.error(`We were unable to delete the item: ${error.message}`);
+            console.error('Error deleting checklist item:', error);
+        }
+    }
+    
+    /**
+     * Format a date from the server for display in local time
+     * @param {string} value - The date as sent by the server
+     * @returns {string} - The formatted date
+     */
+    formatDate(value) {
+        return new Date(value).toLocaleString([], { dateStyle: 'medium', timeStyle: 'short' });
+    }
+    
+    /**
+     * Convert a date from the server to the value of a datetime-local input
+     * @param {string} value - The date as sent by the server
+     * @returns {string} - The local date and time as YYYY-MM-DDTHH:MM, or '' for none
+     */
+    toDateTimeInput(value) {
+        if (!value) return '';
+        const date = new Date(value);
+        date.setMinutes(date.getMinutes() - date.getTimezoneOffset());
+        return date.toISOString().slice(0, 16);
+    }
+    
+    /**
+     * Convert the value of a datetime-local input to a date for the server.
+     * The input drops seconds, so an unchanged value keeps the date of the
+     * note being edited; otherwise a delivered reminder would fire again.
+     * @param {string} value - The local date and time
+     * @param {string} field - due_at or remind_at
+     * @returns {string|null} - The date in ISO format, or null for none
+     */
+    fromDateTimeInput(value, field) {
+        const note = this.notes.find(n => n.id === this.currentNoteId);
+        if (note && note[field] && value === this.toDateTimeInput(note[field])) {
+            return note[field];
+        }
+        return value ? new Date(value).toISOString() : null;
+    }
+    
     /**
      * Highlight search text in content
      * @param {string} text - The text to search in
@@ -335,6 +693,7 @@ class NotesComponent {
     openAddNoteModal() {
         this.noteModalTitle.textContent = 'Add New Note';
         this.noteForm.reset();
+        this.notePriorityInput.value = this.defaultPriority;
         this.noteIdInput.value = '';
         this.currentNoteId = null;
         this.noteModal.classList.add('active');
@@ -359,9 +718,13 @@ class NotesComponent {
             this.noteIdInput.value = note.id;
             this.noteSubjectInput.value = note.subject || '';
             this.noteContentInput.value = note.content || '';
-            this.notePriorityInput.value = note.priority || 'medium';
+            this.notePriorityInput.value = note.priority || this.defaultPriority;
             this.noteTagsInput.value = note.tags || '';
             this.noteCategoryInput.value = note.category_id || '';
+            this.noteDueInput.value = this.toDateTimeInput(note.due_at);
+            this.noteRemindInput.value = this.toDateTimeInput(note.remind_at);
+            this.noteRecurrenceInput.value = note.recurrence || '';
+            this.noteRecurrenceModeInput.value = note.recurrence_mode || 'reset';
             
             this.currentNoteId = noteId;
             this.noteModal.classList.add('active');
@@ -391,7 +754,11 @@ class NotesComponent {
                 content: this.noteContentInput.value,
                 priority: this.notePriorityInput.value,
                 tags: this.noteTagsInput.value,
-                category_id: this.noteCategoryInput.value || null
+                category_id: this.noteCategoryInput.value || null,
+                due_at: this.fromDateTimeInput(this.noteDueInput.value, 'due_at'),
+                remind_at: this.fromDateTimeInput(this.noteRemindInput.value, 'remind_at'),
+                recurrence: this.noteRecurrenceInput.value.trim(),
+                recurrence_mode: this.noteRecurrenceModeInput.value
             };
             
             let result;
@@ -410,7 +777,7 @@ class NotesComponent {
             await this.loadNotes();
             this.closeNoteModal();
         } catch (error) {
-            toastService.error('We were unable to save your note. Please try again later.');
+            toastService.error(`We were unable to save your note: ${error.message}`);
             console.error('Error saving note:', error);
         }
     }
@@ -424,6 +791,7 @@ class NotesComponent {
         if (!note) return;
         
         this.confirmMessage.textContent = `Are you sure you want to delete the note "${note.subject}"?`;
+        document.getElementById('confirm-options').innerHTML = '';
         
         // Remove previous event listeners
         const newConfirmYesBtn = this.confirmYesBtn.cloneNode(true);
@@ -112,11 +112,88 @@ class ApiService {
         return this.request(`/notes/${id}`, 'DELETE');
     }
 
+    /**
+     * Toggle a state of a note
+     * @param {string} id - The ID of the note
+     * @param {string} state - pin, archive or favorite
+     * @returns {Promise} - Promise with the updated note
+     */
+    async toggleNoteState(id, state) {
+        return this.request(`/notes/${id}/${state}`, 'POST');
+    }
+
+    /**
+     * Put off the reminder of a note
+     * @param {string} id - The ID of the note
+     * @param {string} duration - How long to snooze, such as 15m; the server default when empty
+     * @returns {Promise} - Promise with the updated note
+     */
+    async snoozeNote(id, duration = '') {
+        const query = duration ? `?duration=${encodeURIComponent(duration)}` : '';
+        return this.request(`/notes/${id}/snooze${query}`, 'POST');
+    }
+
+    /**
+     * Remove the reminder of a note
+     * @param {string} id - The ID of the note
+     * @returns {Promise} - Promise with the updated note
+     */
+    async dismissReminder(id) {
+        return this.request(`/notes/${id}/dismiss`, 'POST');
+    }
+
+    /**
+     * Open the stream of reminders sent by the server as they fire
+     * @returns {EventSource} - The event source emitting "reminder" events
+     */
+    reminderEvents() {
+        return new EventSource(`${this.baseUrl}/reminders/events`);
+    }
+
+    // Checklist API methods
+    async getChecklist(noteId) {
+        return this.request(`/notes/${noteId}/checklist`);
+    }
+
+    async addChecklistItem(noteId, text) {
+        return this.request(`/notes/${noteId}/checklist`, 'POST', { text });
+    }
+
+    async updateChecklistItem(noteId, itemId, itemData) {
+        return this.request(`/notes/${noteId}/checklist/${itemId}`, 'PUT', itemData);
+    }
+
+    /**
+     * Check an unchecked item of a checklist, or uncheck a checked one
+     * @param {string} noteId - The ID of the note
+     * @param {string} itemId - The ID of the item
+     * @returns {Promise} - Promise with the updated item
+     */
+    async toggleChecklistItem(noteId, itemId) {
+        return this.request(`/notes/${noteId}/checklist/${itemId}/toggle`, 'POST');
+    }
+
+    async reorderChecklist(noteId, ids) {
+        return this.request(`/notes/${noteId}/checklist/reorder`, 'PUT', { ids });
+    }
+
+    async deleteChecklistItem(noteId, itemId) {
+        return this.request(`/notes/${noteId}/checklist/${itemId}`, 'DELETE');
+    }
+
+    async getPriorities() {
+        return this.request('/priorities');
+    }
+
     // Categories API methods
     async getCategories() {
         return this.request('/categories');
     }
 
+    async getCategoryTree() {
+        return this.request('/categories?tree=true');
+    }
+
     async getCategoryById(id) {
         return this.request(`/categories/${id}`);
     }
@@ -129,13 +206,29 @@ class ApiService {
         return this.request(`/categories/${id}`, 'PUT', categoryData);
     }
 
-    async deleteCategory(id) {
-        return this.request(`/categories/${id}`, 'DELETE');
+    async moveCategory(id, parentId) {
+        return this.request(`/categories/${id}/move`, 'PUT', { parent_id: parentId });
+    }
+
+    async reorderCategories(parentId, ids) {
+        return this.request('/categories/reorder', 'PUT', { parent_id: parentId, ids });
+    }
+
+    async deleteCategory(id, mode = 'refuse', targetId = '') {
+        const params = new URLSearchParams({ mode });
+        if (targetId) {
+            params.set('target_id', targetId);
+        }
+        return this.request(`/categories/${id}?${params}`, 'DELETE');
     }
 
     // Key Generator
     async generateKey(inputText) {
-        return this.request('/generate-key', 'POST', { text: inputText });
+        return this.request('/generate-key', 'POST', { mode: 'text', text: inputText });
+    }
+
+    async generateRandomKey() {
+        return this.request('/generate-key', 'POST', { mode: 'random' });
     }
 
     // Encryption status
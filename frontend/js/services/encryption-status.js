@@ -21,6 +21,11 @@ class EncryptionStatusService {
             
             this.isValid = response.encryption_valid;
             this.statusMessage = response.message;
+            this.keyRotationRecommended = response.key_rotation_recommended === true;
+
+            if (this.keyRotationRecommended) {
+                toastService.warning('The origin of the encryption key is not recorded. If an older version generated it, it is predictable: run "notes rotate-key". If you supplied it yourself, set "key_source": "user" in settings.json.', 10000);
+            }
             
             // Notify all listeners of the status change
             this.notifyListeners();
@@ -11,7 +11,8 @@ import (
 
 // ActivityLogHandler handles HTTP requests for activity logs
 type ActivityLogHandler struct {
-	repo *repositories.ActivityLogRepository
+	repo   *repositories.ActivityLogRepository
+	writer *repositories.ActivityLogWriter
 }
 
 // NewActivityLogHandler creates a new ActivityLogHandler
@@ -19,6 +20,12 @@ func NewActivityLogHandler(repo *repositories.ActivityLogRepository) *ActivityLo
 	return &ActivityLogHandler{repo: repo}
 }
 
+// SetWriter sets the buffered writer used by LogActivity. Without a writer
+// activities are written synchronously.
+func (h *ActivityLogHandler) SetWriter(writer *repositories.ActivityLogWriter) {
+	h.writer = writer
+}
+
 // GetLogs handles GET /activity-logs
 func (h *ActivityLogHandler) GetLogs(c *gin.Context) {
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
@@ -123,10 +130,29 @@ func (h *ActivityLogHandler) LogActivity(c *gin.Context, action, entityType stri
 		entityIDInt = 0
 	}
 
-	// Log the activity asynchronously to not block the request
-	go func() {
-		h.repo.LogActivity(action, entityType, entityIDInt, description, userID, ipAddress)
-	}()
+	// Queue the activity so the request is not blocked by the insert
+	if h.writer != nil {
+		h.writer.Enqueue(&models.ActivityLog{
+			Action:      action,
+			EntityType:  entityType,
+			EntityID:    entityIDInt,
+			Description: description,
+			UserID:      userID,
+			IPAddress:   ipAddress,
+		})
+		return
+	}
+	h.repo.LogActivity(action, entityType, entityIDInt, description, userID, ipAddress)
+}
+
+// GetStats handles GET /activity-logs/stats
+func (h *ActivityLogHandler) GetStats(c *gin.Context) {
+	if h.writer == nil {
+		c.JSON(http.StatusOK, gin.H{"buffered": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"buffered": true, "writer": h.writer.Stats()})
 }
 
 // GetLogsCount handles GET /activity-logs/count
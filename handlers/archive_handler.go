@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"personal-notes-with-go/archive"
+	"personal-notes-with-go/database"
+	"personal-notes-with-go/repositories"
+	"personal-notes-with-go/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ArchiveHandler handles the full archive export and import used to move
+// the data to another server
+type ArchiveHandler struct {
+	db              *sql.DB
+	noteRepo        repositories.NoteRepositoryInterface
+	checklistRepo   repositories.ChecklistRepositoryInterface
+	categoryRepo    repositories.CategoryRepositoryInterface
+	activityLogRepo *repositories.ActivityLogRepository
+	activityLogger  *ActivityLogHandler
+}
+
+// NewArchiveHandler creates a new archive handler. Imports write to db in a
+// transaction of their own, encrypting with the default cipher.
+func NewArchiveHandler(db *sql.DB, noteRepo repositories.NoteRepositoryInterface, checklistRepo repositories.ChecklistRepositoryInterface, categoryRepo repositories.CategoryRepositoryInterface, activityLogRepo *repositories.ActivityLogRepository) *ArchiveHandler {
+	return &ArchiveHandler{db: db, noteRepo: noteRepo, checklistRepo: checklistRepo, categoryRepo: categoryRepo, activityLogRepo: activityLogRepo}
+}
+
+// SetActivityLogger sets the activity logger for this handler
+func (h *ArchiveHandler) SetActivityLogger(logger *ActivityLogHandler) {
+	h.activityLogger = logger
+}
+
+// ExportArchive streams a full archive of categories, notes, tags and
+// activity logs
+func (h *ArchiveHandler) ExportArchive(c *gin.Context) {
+	version, err := database.SchemaVersion(h.db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export archive"})
+		return
+	}
+
+	filename := fmt.Sprintf("notes-archive-%s.zip", time.Now().Format("20060102-150405"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	// Headers have been sent, so a failure can only be logged; the client
+	// sees a truncated archive
+	manifest, err := archive.Write(c.Writer, archive.Source{
+		Notes:         h.noteRepo,
+		Checklists:    h.checklistRepo,
+		Categories:    h.categoryRepo,
+		ActivityLogs:  h.activityLogRepo,
+		SchemaVersion: version,
+	})
+	if err != nil {
+		log.Printf("Archive export failed: %v", err)
+		return
+	}
+
+	if h.activityLogger != nil {
+		h.activityLogger.LogActivity(c, "export", "note", 0, fmt.Sprintf("Exported archive with %d notes and %d categories", manifest.Files[archive.NotesFile].Records, manifest.Files[archive.CategoriesFile].Records))
+	}
+}
+
+// ImportArchive applies an archive uploaded in the "file" form field. The
+// mode (merge or replace), on_conflict (skip, overwrite or new-id) and
+// dry_run query parameters control the import; the report lists every
+// category and note that was, or with dry_run would be, changed.
+func (h *ArchiveHandler) ImportArchive(c *gin.Context) {
+	opts := archive.Options{
+		Mode:       c.DefaultQuery("mode", archive.ModeMerge),
+		OnConflict: c.DefaultQuery("on_conflict", archive.ConflictSkip),
+		DryRun:     c.Query("dry_run") == "true",
+	}
+	if err := opts.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	file, header, ok := openUpload(c)
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	a, err := archive.NewReader(file, header.Size)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	report, err := archive.Import(h.db, utils.DefaultCipher(), utils.DefaultBlindIndex(), a, opts)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to import archive: " + err.Error()})
+		return
+	}
+
+	if h.activityLogger != nil && !opts.DryRun {
+		h.activityLogger.LogActivity(c, "import", "note", 0, fmt.Sprintf("Imported archive (%s): %d notes created, %d overwritten, %d skipped", opts.Mode, report.Notes.Created, report.Notes.Overwritten, report.Notes.Skipped))
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -1,20 +1,27 @@
 package handlers
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
 	"personal-notes-with-go/models"
 	"personal-notes-with-go/repositories"
+	"personal-notes-with-go/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
 type CategoryHandler struct {
+	db             *sql.DB
 	repo           repositories.CategoryRepositoryInterface
 	activityLogger *ActivityLogHandler
 }
 
-func NewCategoryHandler(repo repositories.CategoryRepositoryInterface) *CategoryHandler {
-	return &CategoryHandler{repo: repo}
+// NewCategoryHandler creates a new category handler. Deletions write to db
+// in a transaction of their own, decrypting with the default cipher.
+func NewCategoryHandler(db *sql.DB, repo repositories.CategoryRepositoryInterface) *CategoryHandler {
+	return &CategoryHandler{db: db, repo: repo}
 }
 
 // SetActivityLogger sets the activity logger for this handler
@@ -29,9 +36,12 @@ func (h *CategoryHandler) CreateCategory(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
+	if !normalizeCategoryStyle(c, &category) {
+		return
+	}
 
 	if err := h.repo.Create(&category); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create category"})
+		handleCategoryError(c, err, "Failed to create category")
 		return
 	}
 
@@ -44,13 +54,19 @@ func (h *CategoryHandler) CreateCategory(c *gin.Context) {
 	c.JSON(http.StatusCreated, category)
 }
 
-// GetCategories returns all categories
+// GetCategories returns all categories with their note counts, ordered by
+// position and name, or with tree=true the top-level categories with their
+// subcategories nested under children
 func (h *CategoryHandler) GetCategories(c *gin.Context) {
 	categories, err := h.repo.GetAll()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get categories"})
 		return
 	}
+	if categories == nil {
+		categories = []models.Category{}
+	}
+	models.SortCategories(categories)
 
 	// Log activity
 	if h.activityLogger != nil {
@@ -58,10 +74,15 @@ func (h *CategoryHandler) GetCategories(c *gin.Context) {
 		h.activityLogger.LogActivity(c, "read", "category", 0, description)
 	}
 
+	if c.Query("tree") == "true" {
+		c.JSON(http.StatusOK, models.BuildCategoryTree(categories))
+		return
+	}
 	c.JSON(http.StatusOK, categories)
 }
 
-// UpdateCategory updates a category by ID
+// UpdateCategory changes the name, description, color and icon of a
+// category by ID; it keeps its parent and position
 func (h *CategoryHandler) UpdateCategory(c *gin.Context) {
 	id := c.Param("id")
 	var category models.Category
@@ -69,9 +90,12 @@ func (h *CategoryHandler) UpdateCategory(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
+	if !normalizeCategoryStyle(c, &category) {
+		return
+	}
 
 	// Check if category exists
-	_, err := h.repo.GetByID(id)
+	existing, err := h.repo.GetByID(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
 		return
@@ -79,9 +103,11 @@ func (h *CategoryHandler) UpdateCategory(c *gin.Context) {
 
 	category.ID = id
 	if err := h.repo.Update(&category); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update category"})
+		handleCategoryError(c, err, "Failed to update category")
 		return
 	}
+	category.Position = existing.Position
+	category.NoteCount = existing.NoteCount
 
 	// Log activity
 	if h.activityLogger != nil {
@@ -92,9 +118,101 @@ func (h *CategoryHandler) UpdateCategory(c *gin.Context) {
 	c.JSON(http.StatusOK, category)
 }
 
-// DeleteCategory deletes a category by ID
+// MoveCategory moves a category under the parent_id given in the body, or
+// to the top level when parent_id is empty
+func (h *CategoryHandler) MoveCategory(c *gin.Context) {
+	id := c.Param("id")
+	var body struct {
+		ParentID string `json:"parent_id"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if err := h.repo.Move(id, body.ParentID); err != nil {
+		handleCategoryError(c, err, "Failed to move category")
+		return
+	}
+	category, err := h.repo.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get category"})
+		return
+	}
+
+	// Log activity
+	if h.activityLogger != nil {
+		description := "Moved category " + category.Name + " to the top level"
+		if parent, err := h.repo.GetByID(category.ParentID); err == nil {
+			description = "Moved category " + category.Name + " under " + parent.Name
+		}
+		h.activityLogger.LogActivity(c, "move", "category", id, description)
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+// ReorderCategories orders the subcategories of parent_id, or the top-level
+// categories when parent_id is empty, as listed in ids. ids must contain
+// every one of them exactly once. It responds with them in the new order.
+func (h *CategoryHandler) ReorderCategories(c *gin.Context) {
+	var body struct {
+		ParentID string   `json:"parent_id"`
+		IDs      []string `json:"ids"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if err := h.repo.Reorder(body.ParentID, body.IDs); err != nil {
+		handleCategoryError(c, err, "Failed to reorder categories")
+		return
+	}
+	categories, err := h.repo.GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get categories"})
+		return
+	}
+	siblings := []models.Category{}
+	for _, cat := range categories {
+		if cat.ParentID == body.ParentID {
+			siblings = append(siblings, cat)
+		}
+	}
+	models.SortCategories(siblings)
+
+	// Log activity
+	if h.activityLogger != nil {
+		description := fmt.Sprintf("Reordered %d top-level categories", len(siblings))
+		if parent, err := h.repo.GetByID(body.ParentID); err == nil {
+			description = fmt.Sprintf("Reordered %d subcategories of %s", len(siblings), parent.Name)
+		}
+		h.activityLogger.LogActivity(c, "reorder", "category", body.ParentID, description)
+	}
+
+	c.JSON(http.StatusOK, siblings)
+}
+
+// DeleteCategory deletes a category by ID. The mode query parameter says
+// what happens to its contents: refuse (the default) only deletes an empty
+// category, move moves its notes to the category target_id and its
+// subcategories up to its parent, and trash deletes its subcategories too
+// and moves all their notes to the trash.
 func (h *CategoryHandler) DeleteCategory(c *gin.Context) {
 	id := c.Param("id")
+	opts := repositories.CategoryDeleteOptions{
+		Mode:     c.DefaultQuery("mode", repositories.CategoryDeleteRefuse),
+		TargetID: c.Query("target_id"),
+	}
+	if err := opts.Validate(); err != nil {
+		field := &utils.FieldError{Message: err.Error(), Field: "mode", Value: opts.Mode, Allowed: []string{repositories.CategoryDeleteRefuse, repositories.CategoryDeleteMove, repositories.CategoryDeleteTrash}}
+		if opts.Mode == repositories.CategoryDeleteMove {
+			field = &utils.FieldError{Message: err.Error(), Field: "target_id"}
+		}
+		utils.HandleFieldError(c, field)
+		return
+	}
 
 	// Check if category exists
 	category, err := h.repo.GetByID(id)
@@ -103,16 +221,70 @@ func (h *CategoryHandler) DeleteCategory(c *gin.Context) {
 		return
 	}
 
-	if err := h.repo.Delete(id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category"})
+	result, err := repositories.DeleteCategory(h.db, utils.DefaultCipher(), id, opts)
+	if err != nil {
+		handleCategoryError(c, err, "Failed to delete category")
 		return
 	}
 
 	// Log activity
 	if h.activityLogger != nil {
 		description := "Deleted category: " + category.Name
+		switch {
+		case opts.Mode == repositories.CategoryDeleteMove:
+			if target, err := h.repo.GetByID(opts.TargetID); err == nil {
+				description += fmt.Sprintf(", moved %d note(s) to %s", result.NotesMoved, target.Name)
+			}
+		case result.NotesTrashed > 0 || result.CategoriesDeleted > 1:
+			description += fmt.Sprintf(" with %d subcategory(ies), moved %d note(s) to the trash", result.CategoriesDeleted-1, result.NotesTrashed)
+		}
 		h.activityLogger.LogActivity(c, "delete", "category", id, description)
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Category deleted successfully"})
+	c.JSON(http.StatusOK, gin.H{
+		"message":            "Category deleted successfully",
+		"categories_deleted": result.CategoriesDeleted,
+		"notes_moved":        result.NotesMoved,
+		"notes_trashed":      result.NotesTrashed,
+	})
+}
+
+// handleCategoryError responds to an error from the category repository
+// with the matching status, or with 500 and message
+func handleCategoryError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, utils.ErrCategoryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+	case errors.Is(err, utils.ErrCategoryNameConflict),
+		errors.Is(err, utils.ErrCategoryNotEmpty):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, utils.ErrCategoryNameEmpty),
+		errors.Is(err, utils.ErrCategoryParentNotFound),
+		errors.Is(err, utils.ErrCategoryCycle),
+		errors.Is(err, utils.ErrCategoryMoveTarget),
+		errors.Is(err, utils.ErrCategoryTargetNotFound),
+		errors.Is(err, utils.ErrCategoryOrderMismatch):
+		utils.HandleBadRequestError(c, err)
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// normalizeCategoryStyle replaces the color and icon of category with their
+// stored forms, responding with a field error and returning false when one
+// is invalid
+func normalizeCategoryStyle(c *gin.Context, category *models.Category) bool {
+	color, err := models.NormalizeCategoryColor(category.Color)
+	if err != nil {
+		utils.HandleFieldError(c, &utils.FieldError{Message: err.Error(), Field: "color", Value: category.Color})
+		return false
+	}
+	icon, err := models.NormalizeCategoryIcon(category.Icon)
+	if err != nil {
+		utils.HandleFieldError(c, &utils.FieldError{Message: err.Error(), Field: "icon", Value: category.Icon})
+		return false
+	}
+	category.Color = color
+	category.Icon = icon
+	return true
 }
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/repositories"
+	"personal-notes-with-go/utils"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ChecklistHandler manages the checklist items of notes
+type ChecklistHandler struct {
+	notes          repositories.NoteRepositoryInterface
+	repo           repositories.ChecklistRepositoryInterface
+	activityLogger *ActivityLogHandler
+}
+
+func NewChecklistHandler(notes repositories.NoteRepositoryInterface, repo repositories.ChecklistRepositoryInterface) *ChecklistHandler {
+	return &ChecklistHandler{notes: notes, repo: repo}
+}
+
+// SetActivityLogger sets the activity logger for this handler
+func (h *ChecklistHandler) SetActivityLogger(logger *ActivityLogHandler) {
+	h.activityLogger = logger
+}
+
+// GetChecklist returns the checklist of a note in order
+func (h *ChecklistHandler) GetChecklist(c *gin.Context) {
+	note, ok := h.note(c)
+	if !ok {
+		return
+	}
+	items, err := h.repo.GetByNoteID(note.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get checklist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, items)
+}
+
+// AddChecklistItem adds an item at the end of the checklist of a note
+func (h *ChecklistHandler) AddChecklistItem(c *gin.Context) {
+	note, ok := h.note(c)
+	if !ok {
+		return
+	}
+	var item models.ChecklistItem
+	if err := c.ShouldBindJSON(&item); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	item.NoteID = note.ID
+
+	if err := h.repo.Create(&item); err != nil {
+		handleChecklistError(c, err, "Failed to add checklist item")
+		return
+	}
+
+	h.logActivity(c, "create", note, "Added checklist item to note")
+	c.JSON(http.StatusCreated, item)
+}
+
+// UpdateChecklistItem changes the text of an item and whether it is
+// checked
+func (h *ChecklistHandler) UpdateChecklistItem(c *gin.Context) {
+	note, existing, ok := h.item(c)
+	if !ok {
+		return
+	}
+	var item models.ChecklistItem
+	if err := c.ShouldBindJSON(&item); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+	item.ID, item.NoteID, item.Position = existing.ID, existing.NoteID, existing.Position
+
+	if err := h.repo.Update(&item); err != nil {
+		handleChecklistError(c, err, "Failed to update checklist item")
+		return
+	}
+
+	h.logActivity(c, "update", note, "Updated checklist item of note")
+	c.JSON(http.StatusOK, item)
+}
+
+// ToggleChecklistItem checks an item when it is unchecked and unchecks it
+// when it is checked, or sets it to the value query parameter when one is
+// given, responding with the item
+func (h *ChecklistHandler) ToggleChecklistItem(c *gin.Context) {
+	note, item, ok := h.item(c)
+	if !ok {
+		return
+	}
+	checked := !item.Checked
+	if value := c.Query("value"); value != "" {
+		var err error
+		if checked, err = strconv.ParseBool(value); err != nil {
+			utils.HandleFieldError(c, &utils.FieldError{Message: "invalid value " + strconv.Quote(value) + ", expected true or false", Field: "value", Value: value, Allowed: []string{"true", "false"}})
+			return
+		}
+	}
+
+	if err := h.repo.SetChecked(item.ID, checked); err != nil {
+		handleChecklistError(c, err, "Failed to update checklist item")
+		return
+	}
+	item.Checked = checked
+
+	if checked {
+		h.logActivity(c, "check", note, "Checked checklist item of note")
+	} else {
+		h.logActivity(c, "uncheck", note, "Unchecked checklist item of note")
+	}
+	c.JSON(http.StatusOK, item)
+}
+
+// ReorderChecklist orders the checklist of a note as listed in ids, which
+// must contain every item exactly once. It responds with the items in the
+// new order.
+func (h *ChecklistHandler) ReorderChecklist(c *gin.Context) {
+	note, ok := h.note(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		IDs []string `json:"ids"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if err := h.repo.Reorder(note.ID, body.IDs); err != nil {
+		handleChecklistError(c, err, "Failed to reorder checklist")
+		return
+	}
+	items, err := h.repo.GetByNoteID(note.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get checklist"})
+		return
+	}
+
+	h.logActivity(c, "reorder", note, fmt.Sprintf("Reordered %d checklist items of note", len(items)))
+	c.JSON(http.StatusOK, items)
+}
+
+// DeleteChecklistItem removes an item from the checklist of a note
+func (h *ChecklistHandler) DeleteChecklistItem(c *gin.Context) {
+	note, item, ok := h.item(c)
+	if !ok {
+		return
+	}
+	if err := h.repo.Delete(item.ID); err != nil {
+		handleChecklistError(c, err, "Failed to delete checklist item")
+		return
+	}
+
+	h.logActivity(c, "delete", note, "Deleted checklist item of note")
+	c.JSON(http.StatusOK, gin.H{"message": "Checklist item deleted successfully"})
+}
+
+// note returns the note with the ID in the path, responding with 404 and
+// returning false when there is none
+func (h *ChecklistHandler) note(c *gin.Context) (*models.Note, bool) {
+	note, err := h.notes.GetByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+		return nil, false
+	}
+	return note, true
+}
+
+// item returns the note and the checklist item with the IDs in the path,
+// responding with 404 and returning false unless the item belongs to the
+// note
+func (h *ChecklistHandler) item(c *gin.Context) (*models.Note, *models.ChecklistItem, bool) {
+	note, ok := h.note(c)
+	if !ok {
+		return nil, nil, false
+	}
+	item, err := h.repo.GetByID(c.Param("itemId"))
+	if err != nil || item.NoteID != note.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Checklist item not found"})
+		return nil, nil, false
+	}
+	return note, item, true
+}
+
+// logActivity logs a change to the checklist of note
+func (h *ChecklistHandler) logActivity(c *gin.Context, action string, note *models.Note, description string) {
+	if h.activityLogger != nil {
+		noteID, _ := strconv.Atoi(note.ID)
+		h.activityLogger.LogActivity(c, action, "note", noteID, description+": "+note.Subject)
+	}
+}
+
+// handleChecklistError responds to a checklist repository error, with
+// message for unexpected ones
+func handleChecklistError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, utils.ErrChecklistItemNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Checklist item not found"})
+	case errors.Is(err, utils.ErrNoteNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+	case errors.Is(err, utils.ErrChecklistItemEmpty),
+		errors.Is(err, utils.ErrChecklistOrderMismatch):
+		utils.HandleBadRequestError(c, err)
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -36,12 +36,24 @@ func (h *EncryptionHandler) GetStatus(c *gin.Context) {
 		h.activityLogger.LogActivity(c, "check", "encryption", 0, description)
 	}
 
+	rotationRecommended := utils.IsKeyRotationRecommended()
+	message := getEncryptionStatusMessage(isValid)
+	if rotationRecommended {
+		message += " " + keyRotationMessage
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"encryption_valid": isValid,
-		"message":          getEncryptionStatusMessage(isValid),
+		"encryption_valid":         isValid,
+		"cipher":                   utils.DefaultCipher().Name(),
+		"key_rotation_recommended": rotationRecommended,
+		"message":                  message,
 	})
 }
 
+// keyRotationMessage explains why a key of unknown origin should be replaced,
+// and how to keep it when it was supplied by the user
+const keyRotationMessage = "The origin of the encryption key is not recorded. Keys generated by older versions are predictable; run `notes rotate-key` to replace such a key, or set \"key_source\": \"user\" in settings.json if you supplied the key yourself."
+
 // Helper function to get a user-friendly message based on encryption status
 func getEncryptionStatusMessage(isValid bool) string {
 	if isValid {
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"personal-notes-with-go/exporter"
+	"personal-notes-with-go/repositories"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportHandler handles endpoints that export the notes in other formats
+type ExportHandler struct {
+	noteRepo       repositories.NoteRepositoryInterface
+	categoryRepo   repositories.CategoryRepositoryInterface
+	activityLogger *ActivityLogHandler
+}
+
+// NewExportHandler creates a new export handler
+func NewExportHandler(noteRepo repositories.NoteRepositoryInterface, categoryRepo repositories.CategoryRepositoryInterface) *ExportHandler {
+	return &ExportHandler{noteRepo: noteRepo, categoryRepo: categoryRepo}
+}
+
+// SetActivityLogger sets the activity logger for this handler
+func (h *ExportHandler) SetActivityLogger(logger *ActivityLogHandler) {
+	h.activityLogger = logger
+}
+
+// ExportMarkdown streams all notes as a zip of Markdown files, one folder
+// per category
+func (h *ExportHandler) ExportMarkdown(c *gin.Context) {
+	files, err := exporter.MarkdownFiles(h.noteRepo, h.categoryRepo)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export notes"})
+		return
+	}
+
+	filename := fmt.Sprintf("notes-markdown-%s.zip", time.Now().Format("20060102-150405"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	// Headers have been sent, so a failure can only be logged; the client
+	// sees a truncated archive
+	if err := exporter.WriteZip(c.Writer, files); err != nil {
+		log.Printf("Markdown export failed: %v", err)
+		return
+	}
+
+	if h.activityLogger != nil {
+		h.activityLogger.LogActivity(c, "export", "note", 0, fmt.Sprintf("Exported %d notes as Markdown", len(files)))
+	}
+}
+
+// ExportSite streams the notes of the categories given by the repeatable
+// category query parameter as a zip of a static HTML site. The optional
+// title parameter sets the site title.
+func (h *ExportHandler) ExportSite(c *gin.Context) {
+	ids := c.QueryArray("category")
+	if len(ids) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "At least one category is required"})
+		return
+	}
+	for _, id := range ids {
+		if _, err := h.categoryRepo.GetByID(id); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found: " + id})
+			return
+		}
+	}
+
+	files, err := exporter.SiteFiles(h.noteRepo, h.categoryRepo, exporter.SiteOptions{Title: c.Query("title"), CategoryIDs: ids})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export site"})
+		return
+	}
+
+	filename := fmt.Sprintf("notes-site-%s.zip", time.Now().Format("20060102-150405"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	if err := exporter.WriteZip(c.Writer, files); err != nil {
+		log.Printf("Site export failed: %v", err)
+		return
+	}
+
+	if h.activityLogger != nil {
+		h.activityLogger.LogActivity(c, "export", "note", 0, fmt.Sprintf("Exported %d categories as a static site", len(ids)))
+	}
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"personal-notes-with-go/importer"
+	"personal-notes-with-go/repositories"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MaxImportSize is the largest upload accepted by the import endpoints
+const MaxImportSize = 64 << 20
+
+// ImportHandler handles endpoints that import notes from other formats
+type ImportHandler struct {
+	noteRepo       repositories.NoteRepositoryInterface
+	categoryRepo   repositories.CategoryRepositoryInterface
+	activityLogger *ActivityLogHandler
+}
+
+// NewImportHandler creates a new import handler
+func NewImportHandler(noteRepo repositories.NoteRepositoryInterface, categoryRepo repositories.CategoryRepositoryInterface) *ImportHandler {
+	return &ImportHandler{noteRepo: noteRepo, categoryRepo: categoryRepo}
+}
+
+// SetActivityLogger sets the activity logger for this handler
+func (h *ImportHandler) SetActivityLogger(logger *ActivityLogHandler) {
+	h.activityLogger = logger
+}
+
+// ImportMarkdown imports the Markdown files of a zip archive uploaded in
+// the "file" form field and returns a report per file
+func (h *ImportHandler) ImportMarkdown(c *gin.Context) {
+	h.importZip(c, "Markdown", func(im *importer.Importer, zr *zip.Reader) error {
+		return im.Markdown(zr)
+	})
+}
+
+// ImportKeep imports a Google Keep Takeout zip archive uploaded in the
+// "file" form field. The optional "category" form field sets the category
+// of the imported notes.
+func (h *ImportHandler) ImportKeep(c *gin.Context) {
+	h.importZip(c, "Google Keep", func(im *importer.Importer, zr *zip.Reader) error {
+		return im.Keep(zr, c.PostForm("category"))
+	})
+}
+
+// ImportENEX imports an Evernote .enex export uploaded in the "file" form
+// field. The notes go to the category named in the "category" form field,
+// or to one named after the uploaded file, which Evernote names after the
+// notebook.
+func (h *ImportHandler) ImportENEX(c *gin.Context) {
+	file, header, ok := openUpload(c)
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	name := filepath.Base(header.Filename)
+	category := c.PostForm("category")
+	if category == "" {
+		category = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	h.runImport(c, "Evernote", func(im *importer.Importer) error {
+		return im.ENEX(file, name, category)
+	})
+}
+
+// importZip opens the zip archive uploaded in the "file" form field and
+// imports it with run
+func (h *ImportHandler) importZip(c *gin.Context, format string, run func(*importer.Importer, *zip.Reader) error) {
+	file, header, ok := openUpload(c)
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	zr, err := zip.NewReader(file, header.Size)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is not a valid zip archive"})
+		return
+	}
+	h.runImport(c, format, func(im *importer.Importer) error { return run(im, zr) })
+}
+
+// runImport imports with run and responds with the report
+func (h *ImportHandler) runImport(c *gin.Context, format string, run func(*importer.Importer) error) {
+	im, err := importer.New(h.noteRepo, h.categoryRepo)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare import"})
+		return
+	}
+	if err := run(im); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read upload: " + err.Error()})
+		return
+	}
+	report := im.Report()
+
+	if h.activityLogger != nil {
+		h.activityLogger.LogActivity(c, "import", "note", 0, fmt.Sprintf("Imported %d %s notes (%d skipped, %d failed)", report.Imported, format, report.Skipped, report.Failed))
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// openUpload opens the "file" form field, responding with an error and
+// returning false when it is missing or too large. Large uploads are kept
+// in a temporary file rather than in memory.
+func openUpload(c *gin.Context) (multipart.File, *multipart.FileHeader, bool) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, MaxImportSize)
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Upload is larger than %d MiB", MaxImportSize>>20)})
+		} else {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Missing file upload in form field \"file\""})
+		}
+		return nil, nil, false
+	}
+	return file, header, true
+}
@@ -4,12 +4,23 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"net/http"
+	"personal-notes-with-go/settings"
 
 	"github.com/gin-gonic/gin"
 )
 
+// Key generation modes
+const (
+	// KeyModeRandom returns a key from the secure random source
+	KeyModeRandom = "random"
+	// KeyModeText returns the SHA-256 of the given text; the key is only as
+	// strong as the text
+	KeyModeText = "text"
+)
+
 type KeyGenerateRequest struct {
-	Text string `json:"text" binding:"required"`
+	Mode string `json:"mode"`
+	Text string `json:"text"`
 }
 
 type KeyHandler struct {
@@ -32,24 +43,45 @@ func (h *KeyHandler) GenerateKey(c *gin.Context) {
 		return
 	}
 
-	if req.Text == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Text cannot be empty"})
-		return
+	// A key from text is only as strong as the text, so it has to be asked
+	// for by name
+	if req.Mode == "" {
+		req.Mode = KeyModeRandom
 	}
 
-	// Generate a consistent key using SHA-256 and Base64
-	hasher := sha256.New()
-	hasher.Write([]byte(req.Text))
-	hash := hasher.Sum(nil)
-	key := base64.StdEncoding.EncodeToString(hash)
+	var key string
+	switch req.Mode {
+	case KeyModeRandom:
+		generated, err := settings.GenerateEncryptionKey()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate key"})
+			return
+		}
+		key = generated
+	case KeyModeText:
+		if req.Text == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Text cannot be empty"})
+			return
+		}
+
+		// Generate a consistent key using SHA-256 and Base64
+		hasher := sha256.New()
+		hasher.Write([]byte(req.Text))
+		hash := hasher.Sum(nil)
+		key = base64.StdEncoding.EncodeToString(hash)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Mode must be random or text"})
+		return
+	}
 
 	// Log activity
 	if h.activityLogger != nil {
-		description := "Generated encryption key"
+		description := "Generated encryption key (" + req.Mode + ")"
 		h.activityLogger.LogActivity(c, "generate", "key", 0, description)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"key": key,
+		"key":  key,
+		"mode": req.Mode,
 	})
 }
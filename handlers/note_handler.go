@@ -1,23 +1,25 @@
 package handlers
 
 import (
-	"fmt"
+	"errors"
 	"net/http"
 	"personal-notes-with-go/models"
 	"personal-notes-with-go/repositories"
 	"personal-notes-with-go/utils"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type NoteHandler struct {
 	repo           repositories.NoteRepositoryInterface
+	checklists     repositories.ChecklistRepositoryInterface
 	activityLogger *ActivityLogHandler
 }
 
-func NewNoteHandler(repo repositories.NoteRepositoryInterface) *NoteHandler {
-	return &NoteHandler{repo: repo}
+func NewNoteHandler(repo repositories.NoteRepositoryInterface, checklists repositories.ChecklistRepositoryInterface) *NoteHandler {
+	return &NoteHandler{repo: repo, checklists: checklists}
 }
 
 // SetActivityLogger sets the activity logger for this handler
@@ -32,30 +34,23 @@ func (h *NoteHandler) CreateNote(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
 		return
 	}
-
-	// Encrypt sensitive data
-	encryptedSubject, err := utils.Encrypt(note.Subject)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt subject"})
-		return
-	}
-	note.Subject = encryptedSubject
-
-	encryptedContent, err := utils.Encrypt(note.Content)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt content"})
+	if !normalizePriority(c, &note) {
 		return
 	}
-	note.Content = encryptedContent
-
-	encryptedTags, err := utils.Encrypt(note.Tags)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt tags"})
+	if !normalizeRecurrence(c, &note) {
 		return
 	}
-	note.Tags = encryptedTags
+	// Only the scheduler marks reminders delivered, notes reach the trash
+	// and change state through endpoints of their own, and so does the
+	// checklist
+	note.RemindedAt, note.TrashedAt, note.Checklist = nil, nil, nil
+	note.Pinned, note.Archived, note.Favorite = false, false, false
 
 	if err := h.repo.Create(&note); err != nil {
+		if errors.Is(err, utils.ErrCategoryNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Category not found"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create note"})
 		return
 	}
@@ -63,38 +58,59 @@ func (h *NoteHandler) CreateNote(c *gin.Context) {
 	// Log the activity
 	if h.activityLogger != nil {
 		noteID, _ := strconv.Atoi(note.ID)
-		decryptedSubject, _ := utils.Decrypt(note.Subject)
-		h.activityLogger.LogActivity(c, "create", "note", noteID, "Created note: "+decryptedSubject)
+		h.activityLogger.LogActivity(c, "create", "note", noteID, "Created note: "+note.Subject)
 	}
 
-	// Decrypt for response
-	decryptedSubject, err := utils.Decrypt(note.Subject)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decrypt subject"})
-		return
-	}
-	note.Subject = decryptedSubject
+	c.JSON(http.StatusCreated, note)
+}
 
-	decryptedContent, err := utils.Decrypt(note.Content)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decrypt content"})
+// GetNotes returns all notes, optionally filtered by category_id, which
+// with recursive=true also takes in its subcategories, by tag, which may be
+// repeated to require several tags, and by priority, which may be repeated
+// to accept several levels. With sort=priority the notes are ranked by
+// priority, highest first unless order=asc. Pinned notes always come first.
+// Archived notes are left out unless include_archived=true, and
+// favorite=true lists only favorite notes. due_before lists the notes due
+// before a time, given as accepted by models.ParseNoteTime.
+func (h *NoteHandler) GetNotes(c *gin.Context) {
+	filter := models.NoteFilter{
+		CategoryID:           c.Query("category_id"),
+		IncludeSubcategories: c.Query("recursive") == "true",
+		IncludeArchived:      c.Query("include_archived") == "true",
+		Favorites:            c.Query("favorite") == "true",
+		Tags:                 c.QueryArray("tag"),
+		Subject:              c.Query("subject"),
+		Words:                utils.SplitWords(c.Query("q")),
+	}
+	priorities := models.CurrentPriorities()
+	for _, value := range c.QueryArray("priority") {
+		if value == "" {
+			continue
+		}
+		priority, err := priorities.Normalize(value)
+		if err != nil {
+			utils.HandleFieldError(c, &utils.FieldError{Message: err.Error(), Field: "priority", Value: value, Allowed: priorities.Names()})
+			return
+		}
+		filter.Priorities = append(filter.Priorities, priority)
+	}
+	if value := c.Query("due_before"); value != "" {
+		dueBefore, err := models.ParseNoteTime(value)
+		if err != nil {
+			utils.HandleFieldError(c, &utils.FieldError{Message: err.Error(), Field: "due_before", Value: value})
+			return
+		}
+		filter.DueBefore = &dueBefore
+	}
+	sortBy, order := c.Query("sort"), c.DefaultQuery("order", "desc")
+	if sortBy != "" && sortBy != "priority" {
+		utils.HandleFieldError(c, &utils.FieldError{Message: "invalid sort " + strconv.Quote(sortBy) + ", expected priority", Field: "sort", Value: sortBy, Allowed: []string{"priority"}})
 		return
 	}
-	note.Content = decryptedContent
-
-	decryptedTags, err := utils.Decrypt(note.Tags)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decrypt tags"})
+	if order != "asc" && order != "desc" {
+		utils.HandleFieldError(c, &utils.FieldError{Message: "invalid order " + strconv.Quote(order) + ", expected asc or desc", Field: "order", Value: order, Allowed: []string{"asc", "desc"}})
 		return
 	}
-	note.Tags = decryptedTags
-
-	c.JSON(http.StatusCreated, note)
-}
-
-// GetNotes returns all notes or filtered by category
-func (h *NoteHandler) GetNotes(c *gin.Context) {
-	categoryID := c.Query("category_id")
 	limit := 10 // Default limit
 
 	// Check if all notes are requested
@@ -108,60 +124,53 @@ func (h *NoteHandler) GetNotes(c *gin.Context) {
 		}
 	}
 
-	var notes []*models.Note
-	var err error
-
-	if categoryID != "" {
-		notes, err = h.repo.GetByCategoryID(categoryID)
-	} else {
-		notes, err = h.repo.GetAll()
-	}
-
+	notes, err := h.repo.GetFiltered(filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get notes"})
 		return
 	}
+	if notes == nil {
+		notes = []*models.Note{}
+	}
+	if sortBy == "priority" {
+		priorities.SortNotes(notes, order == "asc")
+	}
+	models.SortPinnedFirst(notes)
 
 	// Apply limit if needed
 	if limit > 0 && len(notes) > limit {
 		notes = notes[:limit]
 	}
 
-	// Decrypt sensitive data
-	var decryptedNotes []*models.Note
-	for _, note := range notes {
-		decryptedSubject, err := utils.Decrypt(note.Subject)
-		if err != nil {
-			// Log error but continue with other notes
-			fmt.Printf("Error decrypting subject for note %s: %v\n", note.ID, err)
-			continue
-		}
-		note.Subject = decryptedSubject
+	// Log the activity
+	if h.activityLogger != nil {
+		h.activityLogger.LogActivity(c, "read", "note", 0, "Retrieved notes")
+	}
 
-		decryptedContent, err := utils.Decrypt(note.Content)
-		if err != nil {
-			fmt.Printf("Error decrypting content for note %s: %v\n", note.ID, err)
-			continue
-		}
-		note.Content = decryptedContent
+	c.JSON(http.StatusOK, notes)
+}
 
-		decryptedTags, err := utils.Decrypt(note.Tags)
-		if err != nil {
-			fmt.Printf("Error decrypting tags for note %s: %v\n", note.ID, err)
-			continue
-		}
-		note.Tags = decryptedTags
+// GetNote returns a single note by ID with its checklist
+func (h *NoteHandler) GetNote(c *gin.Context) {
+	id := c.Param("id")
 
-		// Add successfully decrypted note to the result
-		decryptedNotes = append(decryptedNotes, note)
+	note, err := h.repo.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+		return
+	}
+	if note.Checklist, err = h.checklists.GetByNoteID(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get checklist"})
+		return
 	}
 
 	// Log the activity
 	if h.activityLogger != nil {
-		h.activityLogger.LogActivity(c, "read", "note", 0, "Retrieved notes")
+		noteID, _ := strconv.Atoi(id)
+		h.activityLogger.LogActivity(c, "read", "note", noteID, "Retrieved note: "+note.Subject)
 	}
 
-	c.JSON(http.StatusOK, decryptedNotes)
+	c.JSON(http.StatusOK, note)
 }
 
 // UpdateNote updates a note by ID
@@ -174,94 +183,233 @@ func (h *NoteHandler) UpdateNote(c *gin.Context) {
 	}
 
 	// Check if note exists
-	_, err := h.repo.GetByID(id)
+	existing, err := h.repo.GetByID(id)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
 		return
 	}
 
 	note.ID = id
-
-	// Encrypt sensitive data
-	encryptedSubject, err := utils.Encrypt(note.Subject)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt subject"})
+	note.CreatedAt = existing.CreatedAt
+	note.Pinned, note.Archived, note.Favorite = existing.Pinned, existing.Archived, existing.Favorite
+	// The repository delivers a moved reminder again; the checklist has
+	// endpoints of its own
+	note.RemindedAt, note.Checklist = nil, nil
+	note.ChecklistTotal, note.ChecklistDone = existing.ChecklistTotal, existing.ChecklistDone
+	if sameTime(note.RemindAt, existing.RemindAt) {
+		note.RemindedAt = existing.RemindedAt
+	}
+	// A note that keeps its due time goes on recurring when it did before;
+	// otherwise it recurs from its new due time
+	if note.RecurAt == nil && note.Recurrence != "" && sameTime(note.DueAt, existing.DueAt) {
+		note.RecurAt = existing.RecurAt
+	}
+	if !normalizePriority(c, &note) || !normalizeRecurrence(c, &note) {
 		return
 	}
-	note.Subject = encryptedSubject
 
-	encryptedContent, err := utils.Encrypt(note.Content)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt content"})
+	if err := h.repo.Update(&note); err != nil {
+		if errors.Is(err, utils.ErrCategoryNotFound) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Category not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update note"})
 		return
 	}
-	note.Content = encryptedContent
 
-	encryptedTags, err := utils.Encrypt(note.Tags)
+	// Log the activity
+	if h.activityLogger != nil {
+		noteID, _ := strconv.Atoi(note.ID)
+		h.activityLogger.LogActivity(c, "update", "note", noteID, "Updated note: "+note.Subject)
+	}
+
+	c.JSON(http.StatusOK, note)
+}
+
+// DeleteNote deletes a note by ID
+func (h *NoteHandler) DeleteNote(c *gin.Context) {
+	id := c.Param("id")
+
+	// Check if note exists
+	_, err := h.repo.GetByID(id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt tags"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
 		return
 	}
-	note.Tags = encryptedTags
 
-	if err := h.repo.Update(&note); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update note"})
+	if err := h.repo.Delete(id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete note"})
 		return
 	}
 
 	// Log the activity
 	if h.activityLogger != nil {
-		noteID, _ := strconv.Atoi(note.ID)
-		decryptedSubject, _ := utils.Decrypt(note.Subject)
-		h.activityLogger.LogActivity(c, "update", "note", noteID, "Updated note: "+decryptedSubject)
+		noteID, _ := strconv.Atoi(id)
+		h.activityLogger.LogActivity(c, "delete", "note", noteID, "Deleted note with ID: "+id)
 	}
 
-	// Decrypt for response
-	decryptedSubject, err := utils.Decrypt(note.Subject)
+	c.JSON(http.StatusOK, gin.H{"message": "Note deleted successfully"})
+}
+
+// PinNote toggles whether a note is pinned; see setNoteState
+func (h *NoteHandler) PinNote(c *gin.Context) {
+	h.setNoteState(c, models.NotePinned, "pin", "unpin", "Pinned note", "Unpinned note")
+}
+
+// ArchiveNote toggles whether a note is archived; see setNoteState
+func (h *NoteHandler) ArchiveNote(c *gin.Context) {
+	h.setNoteState(c, models.NoteArchived, "archive", "unarchive", "Archived note", "Unarchived note")
+}
+
+// FavoriteNote toggles whether a note is a favorite; see setNoteState
+func (h *NoteHandler) FavoriteNote(c *gin.Context) {
+	h.setNoteState(c, models.NoteFavorite, "favorite", "unfavorite", "Added note to favorites", "Removed note from favorites")
+}
+
+// setNoteState turns state of the note with the ID in the path on when it
+// is off and off when it is on, or to the value query parameter when one
+// is given, responding with the updated note. The change is logged with
+// the on or off action.
+func (h *NoteHandler) setNoteState(c *gin.Context, state models.NoteState, onAction, offAction, onDescription, offDescription string) {
+	id := c.Param("id")
+	note, err := h.repo.GetByID(id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decrypt subject"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
 		return
 	}
-	note.Subject = decryptedSubject
 
-	decryptedContent, err := utils.Decrypt(note.Content)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decrypt content"})
+	on := !state.Of(note)
+	if value := c.Query("value"); value != "" {
+		if on, err = strconv.ParseBool(value); err != nil {
+			utils.HandleFieldError(c, &utils.FieldError{Message: "invalid value " + strconv.Quote(value) + ", expected true or false", Field: "value", Value: value, Allowed: []string{"true", "false"}})
+			return
+		}
+	}
+
+	if err := h.repo.SetState(id, state, on); err != nil {
+		if errors.Is(err, utils.ErrNoteNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update note"})
 		return
 	}
-	note.Content = decryptedContent
+	state.Set(note, on)
+
+	// Log the activity
+	if h.activityLogger != nil {
+		action, description := offAction, offDescription
+		if on {
+			action, description = onAction, onDescription
+		}
+		noteID, _ := strconv.Atoi(id)
+		h.activityLogger.LogActivity(c, action, "note", noteID, description+": "+note.Subject)
+	}
 
-	decryptedTags, err := utils.Decrypt(note.Tags)
+	c.JSON(http.StatusOK, note)
+}
+
+// GetTrash returns the notes in the trash
+func (h *NoteHandler) GetTrash(c *gin.Context) {
+	notes, err := h.repo.GetFiltered(models.NoteFilter{Trashed: true})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decrypt tags"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get trash"})
 		return
 	}
-	note.Tags = decryptedTags
+	if notes == nil {
+		notes = []*models.Note{}
+	}
 
-	c.JSON(http.StatusOK, note)
+	// Log the activity
+	if h.activityLogger != nil {
+		h.activityLogger.LogActivity(c, "read", "note", 0, "Retrieved the trash")
+	}
+
+	c.JSON(http.StatusOK, notes)
 }
 
-// DeleteNote deletes a note by ID
-func (h *NoteHandler) DeleteNote(c *gin.Context) {
+// RestoreNote takes a note out of the trash. Notes are trashed together
+// with their category, so the restored note has no category.
+func (h *NoteHandler) RestoreNote(c *gin.Context) {
 	id := c.Param("id")
-
-	// Check if note exists
-	_, err := h.repo.GetByID(id)
+	if err := h.repo.Restore(id); err != nil {
+		if errors.Is(err, utils.ErrNoteNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Note not found in the trash"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore note"})
+		return
+	}
+	note, err := h.repo.GetByID(id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get note"})
 		return
 	}
 
-	if err := h.repo.Delete(id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete note"})
+	// Log the activity
+	if h.activityLogger != nil {
+		noteID, _ := strconv.Atoi(id)
+		h.activityLogger.LogActivity(c, "restore", "note", noteID, "Restored note from the trash: "+note.Subject)
+	}
+
+	c.JSON(http.StatusOK, note)
+}
+
+// EmptyTrash permanently deletes the notes in the trash
+func (h *NoteHandler) EmptyTrash(c *gin.Context) {
+	notes, err := h.repo.GetFiltered(models.NoteFilter{Trashed: true})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get trash"})
 		return
 	}
+	for _, note := range notes {
+		if err := h.repo.Delete(note.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to empty trash"})
+			return
+		}
+	}
 
 	// Log the activity
 	if h.activityLogger != nil {
-		noteID, _ := strconv.Atoi(id)
-		h.activityLogger.LogActivity(c, "delete", "note", noteID, "Deleted note with ID: "+id)
+		h.activityLogger.LogActivity(c, "delete", "note", 0, "Emptied the trash of "+strconv.Itoa(len(notes))+" note(s)")
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Note deleted successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Trash emptied successfully", "deleted": len(notes)})
+}
+
+// GetPriorities returns the priority levels from lowest to highest rank and
+// the default level
+func (h *NoteHandler) GetPriorities(c *gin.Context) {
+	priorities := models.CurrentPriorities()
+	c.JSON(http.StatusOK, gin.H{"levels": priorities.Levels(), "default": priorities.Default()})
+}
+
+// normalizePriority replaces the priority of note with its stored form,
+// responding with a field error and returning false when it is not one of
+// the configured levels
+func normalizePriority(c *gin.Context, note *models.Note) bool {
+	priorities := models.CurrentPriorities()
+	priority, err := priorities.Normalize(note.Priority)
+	if err != nil {
+		utils.HandleFieldError(c, &utils.FieldError{Message: err.Error(), Field: "priority", Value: note.Priority, Allowed: priorities.Names()})
+		return false
+	}
+	note.Priority = priority
+	return true
+}
+
+// normalizeRecurrence puts the recurrence of note in its stored form,
+// responding with a field error and returning false when the rule or mode
+// is invalid
+func normalizeRecurrence(c *gin.Context, note *models.Note) bool {
+	err := models.NormalizeRecurrence(note, time.Now())
+	switch {
+	case errors.Is(err, models.ErrInvalidRecurrenceMode):
+		utils.HandleFieldError(c, &utils.FieldError{Message: err.Error(), Field: "recurrence_mode", Value: note.RecurrenceMode, Allowed: []string{models.RecurrenceReset, models.RecurrenceClone}})
+		return false
+	case err != nil:
+		utils.HandleFieldError(c, &utils.FieldError{Message: err.Error(), Field: "recurrence", Value: note.Recurrence})
+		return false
+	}
+	return true
 }
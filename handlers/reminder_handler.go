@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/reminders"
+	"personal-notes-with-go/repositories"
+	"personal-notes-with-go/utils"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// eventsHeartbeat is how often an idle event stream sends a comment, so
+// proxies and browsers keep the connection open
+const eventsHeartbeat = 30 * time.Second
+
+// ReminderHandler snoozes and dismisses the reminders of notes and streams
+// reminders to the frontend as they fire
+type ReminderHandler struct {
+	repo           repositories.NoteRepositoryInterface
+	broadcaster    *reminders.Broadcaster
+	snooze         time.Duration
+	activityLogger *ActivityLogHandler
+}
+
+// NewReminderHandler creates a reminder handler. Reminders are snoozed by
+// snooze unless a request says otherwise.
+func NewReminderHandler(repo repositories.NoteRepositoryInterface, broadcaster *reminders.Broadcaster, snooze time.Duration) *ReminderHandler {
+	return &ReminderHandler{repo: repo, broadcaster: broadcaster, snooze: snooze}
+}
+
+// SetActivityLogger sets the activity logger for this handler
+func (h *ReminderHandler) SetActivityLogger(logger *ActivityLogHandler) {
+	h.activityLogger = logger
+}
+
+// SnoozeNote moves the reminder of a note to until, a time as accepted by
+// models.ParseNoteTime, or to duration from now, such as 15m or 1h, or by
+// the configured snooze when neither is given. The reminder fires again at
+// its new time.
+func (h *ReminderHandler) SnoozeNote(c *gin.Context) {
+	remindAt := time.Now().Add(h.snooze)
+	if value := c.Query("until"); value != "" {
+		until, err := models.ParseNoteTime(value)
+		if err != nil {
+			utils.HandleFieldError(c, &utils.FieldError{Message: err.Error(), Field: "until", Value: value})
+			return
+		}
+		remindAt = until
+	} else if value := c.Query("duration"); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration <= 0 {
+			utils.HandleFieldError(c, &utils.FieldError{Message: "invalid duration " + strconv.Quote(value) + ", expected a positive duration such as 15m or 1h", Field: "duration", Value: value})
+			return
+		}
+		remindAt = time.Now().Add(duration)
+	}
+
+	h.setReminder(c, &remindAt, "snooze", "Snoozed reminder for note")
+}
+
+// DismissNote removes the reminder of a note
+func (h *ReminderHandler) DismissNote(c *gin.Context) {
+	h.setReminder(c, nil, "dismiss", "Dismissed reminder for note")
+}
+
+// setReminder moves the reminder of the note with the ID in the path to
+// remindAt, or removes it when remindAt is nil, responding with the note
+func (h *ReminderHandler) setReminder(c *gin.Context, remindAt *time.Time, action, description string) {
+	id := c.Param("id")
+	note, err := h.repo.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+		return
+	}
+
+	if err := h.repo.SetReminder(id, remindAt); err != nil {
+		if errors.Is(err, utils.ErrNoteNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Note not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update reminder"})
+		return
+	}
+	note, err = h.repo.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get note"})
+		return
+	}
+
+	// Log the activity
+	if h.activityLogger != nil {
+		noteID, _ := strconv.Atoi(id)
+		h.activityLogger.LogActivity(c, action, "note", noteID, description+": "+note.Subject)
+	}
+
+	c.JSON(http.StatusOK, note)
+}
+
+// Events streams reminders as server-sent "reminder" events carrying a
+// reminders.Reminder as JSON, until the client goes away or the server
+// shuts down
+func (h *ReminderHandler) Events(c *gin.Context) {
+	events, unsubscribe := h.broadcaster.Subscribe()
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case reminder, ok := <-events:
+			if !ok {
+				return false
+			}
+			c.SSEvent("reminder", reminder)
+			return true
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": ping\n\n")
+			return err == nil
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// sameTime reports whether a and b are both nil or the same time to the
+// second, the precision due and reminder times are stored with
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Truncate(time.Second).Equal(b.Truncate(time.Second))
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/repositories"
+	"personal-notes-with-go/utils"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TagHandler struct {
+	repo           repositories.TagRepositoryInterface
+	activityLogger *ActivityLogHandler
+}
+
+func NewTagHandler(repo repositories.TagRepositoryInterface) *TagHandler {
+	return &TagHandler{repo: repo}
+}
+
+// SetActivityLogger sets the activity logger for this handler
+func (h *TagHandler) SetActivityLogger(logger *ActivityLogHandler) {
+	h.activityLogger = logger
+}
+
+// GetTags returns all tags sorted by name, each with the number of notes
+// carrying it
+func (h *TagHandler) GetTags(c *gin.Context) {
+	tags, err := h.repo.GetAll()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get tags"})
+		return
+	}
+	if tags == nil {
+		tags = []models.Tag{}
+	}
+	sort.Slice(tags, func(i, j int) bool { return strings.ToLower(tags[i].Name) < strings.ToLower(tags[j].Name) })
+
+	// Log activity
+	if h.activityLogger != nil {
+		h.activityLogger.LogActivity(c, "read", "tag", 0, "Retrieved all tags")
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+// RenameTag renames a tag on every note carrying it
+func (h *TagHandler) RenameTag(c *gin.Context) {
+	id := c.Param("id")
+	var request struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	tag, err := h.repo.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		return
+	}
+	oldName := tag.Name
+
+	tag.Name = request.Name
+	if err := h.repo.Update(tag); err != nil {
+		switch {
+		case errors.Is(err, utils.ErrTagNameEmpty):
+			utils.HandleBadRequestError(c, err)
+		case errors.Is(err, utils.ErrTagNameConflict):
+			c.JSON(http.StatusConflict, gin.H{"error": "Another tag is already named " + tag.Name + "; merge the tags instead"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename tag"})
+		}
+		return
+	}
+
+	// Log activity
+	if h.activityLogger != nil {
+		h.activityLogger.LogActivity(c, "update", "tag", id, "Renamed tag "+oldName+" to "+tag.Name)
+	}
+
+	c.JSON(http.StatusOK, tag)
+}
+
+// MergeTag moves the notes of a tag to the tag given as target_id in the
+// body and deletes it. The response is the target tag.
+func (h *TagHandler) MergeTag(c *gin.Context) {
+	id := c.Param("id")
+	var request struct {
+		TargetID string `json:"target_id"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil || request.TargetID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "target_id is required"})
+		return
+	}
+	if request.TargetID == id {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A tag cannot be merged into itself"})
+		return
+	}
+
+	source, err := h.repo.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		return
+	}
+	if _, err := h.repo.GetByID(request.TargetID); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Target tag not found"})
+		return
+	}
+
+	if err := h.repo.Merge(id, request.TargetID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge tags"})
+		return
+	}
+	target, err := h.repo.GetByID(request.TargetID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to merge tags"})
+		return
+	}
+
+	// Log activity
+	if h.activityLogger != nil {
+		h.activityLogger.LogActivity(c, "update", "tag", target.ID, "Merged tag "+source.Name+" into "+target.Name)
+	}
+
+	c.JSON(http.StatusOK, target)
+}
@@ -0,0 +1,106 @@
+package importer
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// enexTime is the timestamp layout of Evernote exports
+const enexTime = "20060102T150405Z"
+
+// enexNote is a <note> of an Evernote export. Resources (attachments) are
+// left out so the decoder skips their base64 data instead of keeping it.
+type enexNote struct {
+	Title   string   `xml:"title"`
+	Content string   `xml:"content"`
+	Created string   `xml:"created"`
+	Updated string   `xml:"updated"`
+	Tags    []string `xml:"tag"`
+}
+
+// ENEX imports the notes of an Evernote .enex export read from r. Evernote
+// exports one notebook per file without naming it inside, so the notebook
+// name, usually the file name, is passed in and becomes the category of
+// every note. Tags are kept and the ENML content is converted to Markdown.
+//
+// The export is decoded one note at a time, so its size is not limited by
+// memory. Notes are reported as source#n, counting from 1.
+func (im *Importer) ENEX(r io.Reader, source, notebook string) error {
+	dec := xml.NewDecoder(r)
+	// Older exports use HTML entities such as &nbsp; outside the content
+	dec.Entity = xml.HTMLEntity
+	count := 0
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read ENEX: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "note" {
+			continue
+		}
+
+		count++
+		noteSource := fmt.Sprintf("%s#%d", source, count)
+		var en enexNote
+		if err := dec.DecodeElement(&en, &start); err != nil {
+			return fmt.Errorf("failed to read note %d: %w", count, err)
+		}
+		note, err := parseENEXNote(en)
+		if err != nil {
+			im.Fail(noteSource, err)
+			continue
+		}
+		note.Category = notebook
+		im.Add(noteSource, note)
+	}
+	if count == 0 {
+		return errors.New("no notes found, is this an Evernote .enex export?")
+	}
+	return nil
+}
+
+// parseENEXNote converts a decoded Evernote note
+func parseENEXNote(en enexNote) (Note, error) {
+	content, err := HTMLToMarkdown(en.Content)
+	if err != nil {
+		return Note{}, err
+	}
+	n := Note{
+		Title:   strings.TrimSpace(en.Title),
+		Content: content,
+		Tags:    uniqueTags(en.Tags),
+	}
+	n.CreatedAt = parseENEXTime(en.Created, "created", &n)
+	n.UpdatedAt = parseENEXTime(en.Updated, "updated", &n)
+	if n.UpdatedAt.IsZero() {
+		n.UpdatedAt = n.CreatedAt
+	}
+	if n.CreatedAt.IsZero() || n.CreatedAt.After(n.UpdatedAt) {
+		n.CreatedAt = n.UpdatedAt
+	}
+	return n, nil
+}
+
+// parseENEXTime parses an Evernote timestamp, adding a warning to n when it
+// is malformed. A missing timestamp is the zero time; the repository then
+// uses the current time.
+func parseENEXTime(value, field string, n *Note) time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(enexTime, value)
+	if err != nil {
+		n.Warnings = append(n.Warnings, fmt.Sprintf("cannot parse %s date %q", field, value))
+		return time.Time{}
+	}
+	return t
+}
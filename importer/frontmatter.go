@@ -0,0 +1,206 @@
+package importer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// fmValue is a front matter value: a scalar or a list of scalars
+type fmValue struct {
+	scalar string
+	list   []string
+	isList bool
+}
+
+// values returns the value as a list; a scalar is a list of one
+func (v fmValue) values() []string {
+	if v.isList {
+		return v.list
+	}
+	if v.scalar == "" {
+		return nil
+	}
+	return []string{v.scalar}
+}
+
+// frontMatter holds the top-level keys of a YAML front matter block
+type frontMatter map[string]fmValue
+
+// first returns the scalar value of the first of keys that is present
+func (fm frontMatter) first(keys ...string) (string, bool) {
+	for _, key := range keys {
+		if v, ok := fm[key]; ok {
+			if values := v.values(); len(values) > 0 {
+				return values[0], true
+			}
+		}
+	}
+	return "", false
+}
+
+// splitFrontMatter separates a leading front matter block, delimited by
+// "---" lines, from the body of a Markdown document. Without front matter
+// the whole document is the body.
+func splitFrontMatter(doc string) (frontMatter, string, error) {
+	doc = strings.TrimPrefix(doc, "\uFEFF")
+	doc = strings.ReplaceAll(doc, "\r\n", "\n")
+	if !strings.HasPrefix(doc, "---\n") {
+		return frontMatter{}, doc, nil
+	}
+
+	lines := strings.Split(doc[len("---\n"):], "\n")
+	for i, line := range lines {
+		if line == "---" || line == "..." {
+			fm, err := parseFrontMatter(lines[:i])
+			if err != nil {
+				return nil, "", err
+			}
+			return fm, strings.Join(lines[i+1:], "\n"), nil
+		}
+	}
+	// An unterminated block is a horizontal rule at the top of the body
+	return frontMatter{}, doc, nil
+}
+
+// parseFrontMatter parses the subset of YAML used in front matter: keys
+// with scalar values, flow lists ([a, b]), block lists ("- a" lines) and
+// block scalars (| and >). Nested mappings are skipped.
+func parseFrontMatter(lines []string) (frontMatter, error) {
+	fm := frontMatter{}
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			// Belongs to a nested mapping we do not support
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid front matter on line %d: %q", i+2, line)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		// Collect the indented lines that belong to this key
+		var block []string
+		for i+1 < len(lines) && (lines[i+1] == "" || lines[i+1][0] == ' ' || lines[i+1][0] == '\t' || strings.HasPrefix(lines[i+1], "- ")) {
+			i++
+			block = append(block, lines[i])
+		}
+
+		switch {
+		case value == "|" || value == "|-" || value == ">" || value == ">-":
+			fm[key] = fmValue{scalar: blockScalar(block, value[0] == '>')}
+		case value == "" || strings.HasPrefix(value, "#"):
+			var items []string
+			for _, b := range block {
+				item, ok := strings.CutPrefix(strings.TrimSpace(b), "- ")
+				if !ok {
+					item, ok = strings.CutPrefix(strings.TrimSpace(b), "-")
+				}
+				if ok {
+					items = append(items, unquote(strings.TrimSpace(item)))
+				}
+			}
+			if len(items) > 0 {
+				fm[key] = fmValue{list: items, isList: true}
+			} else {
+				fm[key] = fmValue{}
+			}
+		case strings.HasPrefix(value, "["):
+			fm[key] = fmValue{list: flowList(value), isList: true}
+		default:
+			fm[key] = fmValue{scalar: unquote(value)}
+		}
+	}
+	return fm, nil
+}
+
+// blockScalar joins the lines of a literal (|) or folded (>) block scalar
+func blockScalar(lines []string, folded bool) string {
+	indent := -1
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		n := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent < 0 || n < indent {
+			indent = n
+		}
+	}
+
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		if len(line) >= indent && indent >= 0 {
+			line = line[indent:]
+		}
+		out[i] = strings.TrimRight(line, " \t")
+	}
+	sep := "\n"
+	if folded {
+		sep = " "
+	}
+	return strings.TrimSpace(strings.Join(out, sep))
+}
+
+// flowList parses a list written as [a, "b, c", 'd']
+func flowList(value string) []string {
+	value = strings.TrimSpace(value)
+	value = strings.TrimPrefix(value, "[")
+	value = strings.TrimSuffix(value, "]")
+
+	var items []string
+	var cur strings.Builder
+	var quote rune
+	for _, r := range value {
+		switch {
+		case quote != 0:
+			cur.WriteRune(r)
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			cur.WriteRune(r)
+		case r == ',':
+			items = append(items, cur.String())
+			cur.Reset()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	items = append(items, cur.String())
+
+	out := items[:0]
+	for _, item := range items {
+		if item = unquote(strings.TrimSpace(item)); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// unquote returns the value of a plain, single-quoted or double-quoted
+// YAML scalar
+func unquote(s string) string {
+	switch {
+	case len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"':
+		if v, err := strconv.Unquote(s); err == nil {
+			return v
+		}
+		return s[1 : len(s)-1]
+	case len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'':
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'")
+	default:
+		// Plain scalars end at a comment
+		if i := strings.Index(s, " #"); i >= 0 {
+			s = strings.TrimSpace(s[:i])
+		}
+		return s
+	}
+}
@@ -0,0 +1,331 @@
+package importer
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HTMLToMarkdown converts HTML, including Evernote's ENML, to Markdown.
+// It covers the elements notes are written with: headings, paragraphs,
+// emphasis, links, lists, checkboxes, quotes, code and simple tables.
+// Anything else contributes its text.
+func HTMLToMarkdown(s string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(s))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse HTML: %w", err)
+	}
+	c := &mdConverter{}
+	c.children(doc)
+	return c.result(), nil
+}
+
+var (
+	blankLines = regexp.MustCompile(`\n{3,}`)
+	spaces     = regexp.MustCompile(`[ \t\r\n]+`)
+)
+
+// mdConverter writes Markdown while walking an HTML tree
+type mdConverter struct {
+	b strings.Builder
+	// lists holds the open lists, innermost last; the value is the next
+	// number of an ordered list or 0 for a bulleted one
+	lists []int
+	pre   bool
+}
+
+func (c *mdConverter) result() string {
+	out := blankLines.ReplaceAllString(c.b.String(), "\n\n")
+	lines := strings.Split(out, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// block makes sure what follows starts a new paragraph
+func (c *mdConverter) block() {
+	s := c.b.String()
+	switch {
+	case s == "" || strings.HasSuffix(s, "\n\n"):
+	case strings.HasSuffix(s, "\n"):
+		c.b.WriteString("\n")
+	default:
+		c.b.WriteString("\n\n")
+	}
+}
+
+// line makes sure what follows starts on a new line
+func (c *mdConverter) line() {
+	if s := c.b.String(); s != "" && !strings.HasSuffix(s, "\n") {
+		c.b.WriteString("\n")
+	}
+}
+
+func (c *mdConverter) children(n *html.Node) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		c.node(child)
+	}
+}
+
+func (c *mdConverter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		c.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		c.children(n)
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Head, atom.Title:
+		return
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		c.block()
+		c.b.WriteString(strings.Repeat("#", int(n.Data[1]-'0')) + " ")
+		c.b.WriteString(strings.TrimSpace(c.inline(n)))
+		c.block()
+	case atom.P, atom.Div:
+		c.block()
+		c.children(n)
+		c.block()
+	case atom.Br:
+		if c.pre {
+			c.b.WriteString("\n")
+		} else {
+			c.b.WriteString("  \n")
+		}
+	case atom.Hr:
+		c.block()
+		c.b.WriteString("---")
+		c.block()
+	case atom.Strong, atom.B:
+		c.wrap(n, "**")
+	case atom.Em, atom.I:
+		c.wrap(n, "*")
+	case atom.S, atom.Strike, atom.Del:
+		c.wrap(n, "~~")
+	case atom.Code:
+		if c.pre {
+			c.children(n)
+		} else {
+			c.wrap(n, "`")
+		}
+	case atom.Pre:
+		c.block()
+		c.b.WriteString("```\n")
+		c.pre = true
+		c.children(n)
+		c.pre = false
+		c.line()
+		c.b.WriteString("```")
+		c.block()
+	case atom.A:
+		href := attr(n, "href")
+		text := c.inline(n)
+		switch {
+		case href == "" || strings.HasPrefix(href, "javascript:"):
+			c.b.WriteString(text)
+		case text == "" || text == href:
+			c.b.WriteString("<" + href + ">")
+		default:
+			c.b.WriteString("[" + text + "](" + href + ")")
+		}
+	case atom.Img:
+		if src := attr(n, "src"); src != "" && !strings.HasPrefix(src, "data:") {
+			c.b.WriteString("![" + attr(n, "alt") + "](" + src + ")")
+		}
+	case atom.Ul, atom.Ol:
+		start := 0
+		if n.DataAtom == atom.Ol {
+			start = 1
+		}
+		if len(c.lists) == 0 {
+			c.block()
+		} else {
+			c.line()
+		}
+		c.lists = append(c.lists, start)
+		c.children(n)
+		c.lists = c.lists[:len(c.lists)-1]
+		if len(c.lists) == 0 {
+			c.block()
+		}
+	case atom.Li:
+		c.line()
+		depth := len(c.lists)
+		if depth == 0 {
+			depth = 1
+			c.lists = append(c.lists, 0)
+			defer func() { c.lists = c.lists[:0] }()
+		}
+		c.b.WriteString(strings.Repeat("  ", depth-1))
+		if next := c.lists[depth-1]; next > 0 {
+			fmt.Fprintf(&c.b, "%d. ", next)
+			c.lists[depth-1]++
+		} else {
+			c.b.WriteString("- ")
+		}
+		c.children(n)
+		c.line()
+	case atom.Blockquote:
+		c.block()
+		inner := &mdConverter{}
+		inner.children(n)
+		for _, line := range strings.Split(inner.result(), "\n") {
+			c.b.WriteString(strings.TrimRight("> "+line, " ") + "\n")
+		}
+		c.block()
+	case atom.Table:
+		c.block()
+		c.table(n)
+		c.block()
+	case atom.Input:
+		if attr(n, "type") == "checkbox" {
+			c.checkbox(hasAttr(n, "checked"))
+		}
+	default:
+		// The HTML parser ignores the self-closing slash of unknown
+		// elements, so whatever follows <en-todo/> ends up as its children
+		switch n.Data {
+		case "en-todo":
+			// Evernote's checkbox
+			c.checkbox(attr(n, "checked") == "true")
+		case "en-media":
+			// Attachments are not imported
+			c.b.WriteString("[attachment]")
+		case "en-crypt":
+			c.b.WriteString("[encrypted content]")
+			return
+		}
+		c.children(n)
+	}
+}
+
+// checkbox writes a task list marker, starting a list item when the
+// checkbox is not already in one
+func (c *mdConverter) checkbox(checked bool) {
+	s := c.b.String()
+	if !strings.HasSuffix(s, "- ") {
+		// Evernote puts every checkbox in its own <div>; keep them in one
+		// list instead of a paragraph each
+		if trimmed := strings.TrimSuffix(s, "\n\n"); trimmed != s {
+			if last := trimmed[strings.LastIndex(trimmed, "\n")+1:]; strings.HasPrefix(strings.TrimLeft(last, " "), "- [") {
+				c.b.Reset()
+				c.b.WriteString(trimmed + "\n")
+			}
+		}
+		c.line()
+		c.b.WriteString("- ")
+	}
+	if checked {
+		c.b.WriteString("[x] ")
+	} else {
+		c.b.WriteString("[ ] ")
+	}
+}
+
+// text writes a text node, collapsing whitespace outside <pre>
+func (c *mdConverter) text(s string) {
+	if c.pre {
+		c.b.WriteString(s)
+		return
+	}
+	s = spaces.ReplaceAllString(s, " ")
+	if cur := c.b.String(); cur == "" || strings.HasSuffix(cur, "\n") || strings.HasSuffix(cur, " ") {
+		s = strings.TrimLeft(s, " ")
+	}
+	c.b.WriteString(s)
+}
+
+// wrap writes the content of n between marker, keeping surrounding spaces
+// outside the markers as Markdown requires
+func (c *mdConverter) wrap(n *html.Node, marker string) {
+	text := c.inline(n)
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		c.b.WriteString(text)
+		return
+	}
+	if strings.HasPrefix(text, " ") {
+		c.b.WriteString(" ")
+	}
+	c.b.WriteString(marker + trimmed + marker)
+	if strings.HasSuffix(text, " ") {
+		c.b.WriteString(" ")
+	}
+}
+
+// inline converts the children of n on their own and returns them as a
+// single line
+func (c *mdConverter) inline(n *html.Node) string {
+	inner := &mdConverter{pre: c.pre}
+	inner.children(n)
+	return strings.ReplaceAll(inner.b.String(), "\n", " ")
+}
+
+// table writes a table as a Markdown table, using the first row as header
+func (c *mdConverter) table(n *html.Node) {
+	var rows [][]string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			if child.DataAtom != atom.Tr {
+				walk(child)
+				continue
+			}
+			var row []string
+			for cell := child.FirstChild; cell != nil; cell = cell.NextSibling {
+				if cell.DataAtom == atom.Td || cell.DataAtom == atom.Th {
+					text := strings.TrimSpace(c.inline(cell))
+					row = append(row, strings.ReplaceAll(text, "|", `\|`))
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+	walk(n)
+	if len(rows) == 0 {
+		return
+	}
+
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+	for i, row := range rows {
+		for len(row) < width {
+			row = append(row, "")
+		}
+		c.b.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		if i == 0 {
+			c.b.WriteString("|" + strings.Repeat(" --- |", width) + "\n")
+		}
+	}
+}
+
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, name string) bool {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,240 @@
+package importer
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/repositories"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Statuses of a file in the report
+const (
+	StatusImported = "imported"
+	StatusSkipped  = "skipped"
+	StatusFailed   = "failed"
+)
+
+// Note is a note read from an import source, before it is stored
+type Note struct {
+	Title    string
+	Content  string
+	Priority string
+	Tags     []string
+	// Category is the path of the category, its name preceded by the names
+	// of its parents and separated by "/", such as "Work/Projects". Missing
+	// categories along the path are created.
+	Category  string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// Warnings found while reading the note, passed on to the report
+	Warnings []string
+}
+
+// FileResult reports what happened to one note of the import
+type FileResult struct {
+	Source   string   `json:"source"`
+	Status   string   `json:"status"`
+	NoteID   string   `json:"note_id,omitempty"`
+	Title    string   `json:"title,omitempty"`
+	Message  string   `json:"message,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// Report summarizes an import
+type Report struct {
+	Imported          int          `json:"imported"`
+	Skipped           int          `json:"skipped"`
+	Failed            int          `json:"failed"`
+	CategoriesCreated []string     `json:"categories_created"`
+	Files             []FileResult `json:"files"`
+}
+
+// Importer stores imported notes through the repositories, so they are
+// encrypted like any other note. It creates missing categories by path and
+// skips notes whose title and content are already in the database, which
+// makes importing the same source twice harmless.
+type Importer struct {
+	notes      repositories.NoteRepositoryInterface
+	categories repositories.CategoryRepositoryInterface
+
+	categoryIDs  map[string]string // lower-case path -> category ID
+	fingerprints map[[32]byte]string
+	report       Report
+}
+
+// New returns an importer writing to the given repositories, which are
+// expected to encrypt
+func New(notes repositories.NoteRepositoryInterface, categories repositories.CategoryRepositoryInterface) (*Importer, error) {
+	im := &Importer{
+		notes:        notes,
+		categories:   categories,
+		categoryIDs:  make(map[string]string),
+		fingerprints: make(map[[32]byte]string),
+		report:       Report{CategoriesCreated: []string{}, Files: []FileResult{}},
+	}
+
+	cats, err := categories.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[string]models.Category, len(cats))
+	for _, cat := range cats {
+		byID[cat.ID] = cat
+	}
+	for _, cat := range cats {
+		im.categoryIDs[categoryKey(categoryNames(byID, cat.ID))] = cat.ID
+	}
+
+	existing, err := notes.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, note := range existing {
+		im.fingerprints[fingerprint(note.Subject, note.Content)] = note.ID
+	}
+	return im, nil
+}
+
+// Add stores n and records the outcome under source, usually the path of
+// the file the note was read from
+func (im *Importer) Add(source string, n Note) {
+	result := FileResult{Source: source, Title: n.Title, Warnings: n.Warnings}
+
+	n.Title = strings.TrimSpace(n.Title)
+	if n.Title == "" {
+		im.Fail(source, errors.New("note has no title"))
+		return
+	}
+	result.Title = n.Title
+
+	fp := fingerprint(n.Title, n.Content)
+	if id, ok := im.fingerprints[fp]; ok {
+		result.Status = StatusSkipped
+		result.NoteID = id
+		result.Message = "a note with the same title and content already exists"
+		im.record(result)
+		return
+	}
+
+	// Notes without a priority or with one that is not a configured level
+	// get the default level, the latter with a warning
+	priorities := models.CurrentPriorities()
+	priority, err := priorities.Normalize(n.Priority)
+	if err != nil {
+		result.Warnings = append(result.Warnings, fmt.Sprintf("unknown priority %q, using %s", n.Priority, priorities.Default()))
+		priority = priorities.Default()
+	}
+
+	categoryID, err := im.categoryID(n.Category)
+	if err != nil {
+		im.Fail(source, fmt.Errorf("failed to create category %q: %w", n.Category, err))
+		return
+	}
+
+	// Inserted under a new ID so the timestamps of the source are kept
+	note := &models.Note{
+		ID:         uuid.New().String(),
+		Subject:    n.Title,
+		Content:    n.Content,
+		Priority:   priority,
+		Tags:       strings.Join(n.Tags, ", "),
+		CategoryID: categoryID,
+		CreatedAt:  n.CreatedAt,
+		UpdatedAt:  n.UpdatedAt,
+	}
+	if err := im.notes.Insert(note); err != nil {
+		im.Fail(source, err)
+		return
+	}
+	im.fingerprints[fp] = note.ID
+
+	result.Status = StatusImported
+	result.NoteID = note.ID
+	im.record(result)
+}
+
+// Fail records that the note read from source could not be imported
+func (im *Importer) Fail(source string, err error) {
+	im.record(FileResult{Source: source, Status: StatusFailed, Message: err.Error()})
+}
+
+// Skip records that the note read from source was left out on purpose
+func (im *Importer) Skip(source, title, reason string) {
+	im.record(FileResult{Source: source, Status: StatusSkipped, Title: title, Message: reason})
+}
+
+// Report returns the outcome of everything added so far
+func (im *Importer) Report() *Report {
+	return &im.report
+}
+
+func (im *Importer) record(result FileResult) {
+	switch result.Status {
+	case StatusImported:
+		im.report.Imported++
+	case StatusSkipped:
+		im.report.Skipped++
+	case StatusFailed:
+		im.report.Failed++
+	}
+	im.report.Files = append(im.report.Files, result)
+}
+
+// categoryID returns the ID of the category at path, walking down from
+// the top level and creating the categories that do not exist yet. Names
+// are matched case-insensitively; empty names in the path are ignored.
+func (im *Importer) categoryID(path string) (string, error) {
+	var names []string
+	for _, name := range strings.Split(path, "/") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	parentID := ""
+	for i := range names {
+		key := categoryKey(names[:i+1])
+		if id, ok := im.categoryIDs[key]; ok {
+			parentID = id
+			continue
+		}
+		cat := &models.Category{Name: names[i], ParentID: parentID}
+		if err := im.categories.Create(cat); err != nil {
+			return "", err
+		}
+		im.categoryIDs[key] = cat.ID
+		im.report.CategoriesCreated = append(im.report.CategoriesCreated, strings.Join(names[:i+1], "/"))
+		parentID = cat.ID
+	}
+	return parentID, nil
+}
+
+// categoryNames returns the names from the top-level category down to the
+// category with ID id
+func categoryNames(byID map[string]models.Category, id string) []string {
+	var names []string
+	for steps := 0; id != "" && steps <= len(byID); steps++ {
+		cat, ok := byID[id]
+		if !ok {
+			break
+		}
+		names = append([]string{cat.Name}, names...)
+		id = cat.ParentID
+	}
+	return names
+}
+
+// categoryKey is the key of a category path in Importer.categoryIDs
+func categoryKey(names []string) string {
+	return strings.ToLower(strings.Join(names, "/"))
+}
+
+// fingerprint identifies a note by its title and content
+func fingerprint(title, content string) [32]byte {
+	return sha256.Sum256([]byte(strings.TrimSpace(title) + "\x00" + strings.TrimSpace(content)))
+}
@@ -0,0 +1,204 @@
+package importer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// keepNote is a note of a Google Keep Takeout export, one JSON file per note
+type keepNote struct {
+	Title           string `json:"title"`
+	TextContent     string `json:"textContent"`
+	TextContentHTML string `json:"textContentHtml"`
+	ListContent     []struct {
+		Text      string `json:"text"`
+		IsChecked bool   `json:"isChecked"`
+	} `json:"listContent"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	Annotations []struct {
+		URL   string `json:"url"`
+		Title string `json:"title"`
+	} `json:"annotations"`
+	Attachments []json.RawMessage `json:"attachments"`
+	IsTrashed   bool              `json:"isTrashed"`
+	// Timestamps are microseconds since the Unix epoch
+	CreatedTimestampUsec    *int64 `json:"createdTimestampUsec"`
+	UserEditedTimestampUsec *int64 `json:"userEditedTimestampUsec"`
+}
+
+// maxTitleLength is the length of titles taken from the first line of a
+// note without one
+const maxTitleLength = 80
+
+// Keep imports the notes of a Google Keep Takeout export in fsys, a Takeout
+// folder or zip archive, reading the JSON file of every note. Keep has no
+// notebooks, so labels become tags and every note gets category, which may
+// be empty. Checklists become Markdown task lists, rich text is converted
+// to Markdown and trashed notes are skipped. Attachments are not imported.
+//
+// Notes are read one file at a time, so the size of the export is not
+// limited by memory.
+func (im *Importer) Keep(fsys fs.FS, category string) error {
+	found := false
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == "." {
+				return err
+			}
+			im.Fail(p, err)
+			return nil
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if p != "." && (strings.HasPrefix(name, ".") || name == "__MACOSX") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(name, ".") || strings.ToLower(path.Ext(name)) != ".json" {
+			return nil
+		}
+
+		kn, err := readKeepNote(fsys, p)
+		if err != nil {
+			im.Fail(p, err)
+			return nil
+		}
+		found = true
+		note, err := parseKeepNote(kn)
+		if err != nil {
+			im.Fail(p, err)
+			return nil
+		}
+		if kn.IsTrashed {
+			im.Skip(p, note.Title, "note is in the Keep trash")
+			return nil
+		}
+		note.Category = category
+		im.Add(p, note)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return errors.New("no notes found, is this a Google Keep Takeout export?")
+	}
+	return nil
+}
+
+// readKeepNote decodes the Keep note in file p
+func readKeepNote(fsys fs.FS, p string) (keepNote, error) {
+	f, err := fsys.Open(p)
+	if err != nil {
+		return keepNote{}, err
+	}
+	defer f.Close()
+
+	var kn keepNote
+	dec := json.NewDecoder(io.LimitReader(f, MaxFileSize))
+	if err := dec.Decode(&kn); err != nil {
+		return keepNote{}, fmt.Errorf("not a Google Keep note: %w", err)
+	}
+	if kn.CreatedTimestampUsec == nil && kn.UserEditedTimestampUsec == nil {
+		return keepNote{}, errors.New("not a Google Keep note")
+	}
+	return kn, nil
+}
+
+// parseKeepNote converts a decoded Keep note
+func parseKeepNote(kn keepNote) (Note, error) {
+	var body string
+	switch {
+	case len(kn.ListContent) > 0:
+		var b strings.Builder
+		for _, item := range kn.ListContent {
+			mark := "[ ]"
+			if item.IsChecked {
+				mark = "[x]"
+			}
+			fmt.Fprintf(&b, "- %s %s\n", mark, strings.TrimSpace(item.Text))
+		}
+		body = b.String()
+	case kn.TextContentHTML != "":
+		var err error
+		if body, err = HTMLToMarkdown(kn.TextContentHTML); err != nil {
+			return Note{}, err
+		}
+	default:
+		body = kn.TextContent
+	}
+
+	if len(kn.Annotations) > 0 {
+		var b strings.Builder
+		b.WriteString(strings.TrimRight(body, "\n"))
+		b.WriteString("\n\n")
+		for _, a := range kn.Annotations {
+			if a.Title != "" {
+				fmt.Fprintf(&b, "- [%s](%s)\n", a.Title, a.URL)
+			} else {
+				fmt.Fprintf(&b, "- <%s>\n", a.URL)
+			}
+		}
+		body = b.String()
+	}
+
+	n := Note{Title: strings.TrimSpace(kn.Title), Content: strings.Trim(body, "\n")}
+	if n.Title == "" {
+		// The plain text has no Markdown markers to strip
+		if n.Title = firstLine(kn.TextContent); n.Title == "" {
+			n.Title = firstLine(n.Content)
+		}
+	}
+
+	var tags []string
+	for _, label := range kn.Labels {
+		tags = append(tags, label.Name)
+	}
+	n.Tags = uniqueTags(tags)
+
+	if kn.CreatedTimestampUsec != nil {
+		n.CreatedAt = time.UnixMicro(*kn.CreatedTimestampUsec).UTC()
+	}
+	if kn.UserEditedTimestampUsec != nil {
+		n.UpdatedAt = time.UnixMicro(*kn.UserEditedTimestampUsec).UTC()
+	}
+	if n.UpdatedAt.IsZero() {
+		n.UpdatedAt = n.CreatedAt
+	}
+	if n.CreatedAt.IsZero() || n.CreatedAt.After(n.UpdatedAt) {
+		n.CreatedAt = n.UpdatedAt
+	}
+
+	if len(kn.Attachments) > 0 {
+		n.Warnings = append(n.Warnings, fmt.Sprintf("%d attachment(s) not imported", len(kn.Attachments)))
+	}
+	return n, nil
+}
+
+// firstLine returns the first non-empty line of s, without Markdown list
+// and heading markers, shortened to maxTitleLength characters. Keep notes
+// often have no title of their own.
+func firstLine(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimLeft(strings.TrimSpace(line), "#-* ")
+		line = strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(line, "[ ]"), "[x]"))
+		if line == "" {
+			continue
+		}
+		if utf8.RuneCountInString(line) > maxTitleLength {
+			line = string([]rune(line)[:maxTitleLength-1]) + "…"
+		}
+		return line
+	}
+	return ""
+}
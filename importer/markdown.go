@@ -0,0 +1,219 @@
+package importer
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MaxFileSize is the largest file that is read during an import
+const MaxFileSize = 10 << 20
+
+// Front matter keys, in order of preference. Obsidian and other tools use
+// different names for the same thing.
+var (
+	titleKeys    = []string{"title"}
+	priorityKeys = []string{"priority"}
+	categoryKeys = []string{"category", "categories"}
+	tagKeys      = []string{"tags", "tag"}
+	createdKeys  = []string{"created_at", "created", "date", "creation_date"}
+	updatedKeys  = []string{"updated_at", "updated", "modified", "last_modified"}
+)
+
+// inlineTag matches Obsidian's #tags in the body of a note
+var inlineTag = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_/-]+)`)
+
+// timeLayouts are tried in order when parsing front matter dates
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// Markdown imports every .md file in fsys, such as an Obsidian vault opened
+// with os.DirFS or a zip archive opened with zip.NewReader. Hidden files and
+// folders (.obsidian, .trash) are skipped.
+//
+// The title, priority, tags, category and timestamps are read from the front
+// matter, where the category may be a path such as "Work/Projects". Without
+// them the file name is the title, the folder path is the category path, so
+// nested folders become subcategories, the tags are collected from #tags in
+// the body and the timestamps come from the file's modification time. New
+// IDs are assigned; notes whose title and content already exist are skipped.
+func (im *Importer) Markdown(fsys fs.FS) error {
+	return fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == "." {
+				return err
+			}
+			im.Fail(p, err)
+			return nil
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if p != "." && (strings.HasPrefix(name, ".") || name == "__MACOSX") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		ext := strings.ToLower(path.Ext(name))
+		if strings.HasPrefix(name, ".") || (ext != ".md" && ext != ".markdown") {
+			return nil
+		}
+
+		data, modTime, err := readFile(fsys, p, d)
+		if err != nil {
+			im.Fail(p, err)
+			return nil
+		}
+		note, err := parseMarkdown(p, string(data), modTime)
+		if err != nil {
+			im.Fail(p, err)
+			return nil
+		}
+		im.Add(p, note)
+		return nil
+	})
+}
+
+// readFile reads a file of at most MaxFileSize bytes
+func readFile(fsys fs.FS, p string, d fs.DirEntry) ([]byte, time.Time, error) {
+	info, err := d.Info()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if info.Size() > MaxFileSize {
+		return nil, time.Time{}, fmt.Errorf("file is larger than %d MiB", MaxFileSize>>20)
+	}
+
+	f, err := fsys.Open(p)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, MaxFileSize+1))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if len(data) > MaxFileSize {
+		return nil, time.Time{}, fmt.Errorf("file is larger than %d MiB", MaxFileSize>>20)
+	}
+	return data, info.ModTime(), nil
+}
+
+// parseMarkdown turns the Markdown document read from p into a note
+func parseMarkdown(p, doc string, modTime time.Time) (Note, error) {
+	fm, body, err := splitFrontMatter(doc)
+	if err != nil {
+		return Note{}, err
+	}
+
+	n := Note{Content: strings.Trim(body, "\n")}
+
+	n.Title, _ = fm.first(titleKeys...)
+	if n.Title == "" {
+		n.Title = strings.TrimSuffix(path.Base(p), path.Ext(p))
+	}
+	n.Priority, _ = fm.first(priorityKeys...)
+
+	var ok bool
+	if n.Category, ok = fm.first(categoryKeys...); !ok {
+		if dir := path.Dir(p); dir != "." {
+			n.Category = dir
+		}
+	}
+	n.Category = strings.Trim(strings.TrimSpace(n.Category), "[]")
+
+	// Tags in the front matter win; only notes without them get the #tags
+	// of the body, so exported notes come back with the same tags
+	var tags []string
+	hasTags := false
+	for _, key := range tagKeys {
+		v, ok := fm[key]
+		if !ok {
+			continue
+		}
+		hasTags = true
+		if v.isList {
+			tags = append(tags, v.list...)
+		} else {
+			// Obsidian accepts "a, b" and "a b" as well as lists
+			tags = append(tags, strings.FieldsFunc(v.scalar, func(r rune) bool { return r == ',' || r == ' ' })...)
+		}
+	}
+	if !hasTags {
+		tags = bodyTags(n.Content)
+	}
+	n.Tags = uniqueTags(tags)
+
+	n.CreatedAt = parseTime(fm, createdKeys, &n)
+	n.UpdatedAt = parseTime(fm, updatedKeys, &n)
+	if n.UpdatedAt.IsZero() {
+		n.UpdatedAt = modTime
+	}
+	if n.CreatedAt.IsZero() || n.CreatedAt.After(n.UpdatedAt) {
+		n.CreatedAt = n.UpdatedAt
+	}
+	return n, nil
+}
+
+// parseTime reads the first of keys as a timestamp, adding a warning to n
+// when it cannot be parsed
+func parseTime(fm frontMatter, keys []string, n *Note) time.Time {
+	value, ok := fm.first(keys...)
+	if !ok {
+		return time.Time{}
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t.UTC()
+		}
+	}
+	n.Warnings = append(n.Warnings, fmt.Sprintf("cannot parse date %q", value))
+	return time.Time{}
+}
+
+// bodyTags returns the #tags in a note body, ignoring code blocks and tags
+// made of digits only, which Obsidian does not treat as tags either
+func bodyTags(body string) []string {
+	var tags []string
+	inCode := false
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCode = !inCode
+			continue
+		}
+		if inCode {
+			continue
+		}
+		for _, m := range inlineTag.FindAllStringSubmatch(line, -1) {
+			if strings.Trim(m[1], "0123456789") != "" {
+				tags = append(tags, m[1])
+			}
+		}
+	}
+	return tags
+}
+
+// uniqueTags strips the # prefix and drops empty and repeated tags,
+// ignoring case and keeping the first spelling
+func uniqueTags(tags []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		out = append(out, tag)
+	}
+	return out
+}
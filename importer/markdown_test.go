@@ -0,0 +1,222 @@
+package importer
+
+import (
+	"bytes"
+	"maps"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"personal-notes-with-go/database"
+	"personal-notes-with-go/exporter"
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/repositories"
+	"personal-notes-with-go/utils"
+)
+
+type testVault struct {
+	notes      repositories.NoteRepositoryInterface
+	categories repositories.CategoryRepositoryInterface
+}
+
+func newTestVault(t *testing.T) *testVault {
+	t.Helper()
+	db, err := database.InitDB(filepath.Join(t.TempDir(), "db.sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	c, err := utils.NewCipher(utils.CipherXChaCha20Poly1305, bytes.Repeat([]byte{1}, utils.KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bi, err := utils.NewBlindIndex(bytes.Repeat([]byte{2}, utils.KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testVault{
+		notes:      repositories.NewTransactionalNoteRepository(db, c, bi),
+		categories: repositories.NewEncryptedCategoryRepository(repositories.NewCategoryRepository(db), c),
+	}
+}
+
+// addCategory creates the category name under parentID
+func (v *testVault) addCategory(t *testing.T, name, parentID string) string {
+	t.Helper()
+	cat := &models.Category{Name: name, ParentID: parentID}
+	if err := v.categories.Create(cat); err != nil {
+		t.Fatal(err)
+	}
+	return cat.ID
+}
+
+// categoryPaths returns the path of every category, sorted
+func (v *testVault) categoryPaths(t *testing.T) []string {
+	t.Helper()
+	cats, err := v.categories.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	for _, cat := range cats {
+		paths = append(paths, models.CategoryPath(cats, cat.ID))
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+// noteCategories maps the subject of every note to its category path
+func (v *testVault) noteCategories(t *testing.T) map[string]string {
+	t.Helper()
+	cats, err := v.categories.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	notes, err := v.notes.GetAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, note := range notes {
+		got[note.Subject] = models.CategoryPath(cats, note.CategoryID)
+	}
+	return got
+}
+
+// importFiles imports the Markdown files into v and returns the report
+func (v *testVault) importFiles(t *testing.T, files fstest.MapFS) *Report {
+	t.Helper()
+	im, err := New(v.notes, v.categories)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := im.Markdown(files); err != nil {
+		t.Fatal(err)
+	}
+	report := im.Report()
+	if report.Failed > 0 {
+		t.Fatalf("import failed: %+v", report.Files)
+	}
+	return report
+}
+
+func TestMarkdownRoundTripKeepsNestedCategories(t *testing.T) {
+	src := newTestVault(t)
+	work := src.addCategory(t, "Kerja", "")
+	workProjects := src.addCategory(t, "Proyek", work)
+	alpha := src.addCategory(t, "Alpha", workProjects)
+	home := src.addCategory(t, "Rumah", "")
+	homeProjects := src.addCategory(t, "Proyek", home)
+	src.addCategory(t, "Kosong", home)
+
+	notes := map[string]string{
+		"Rapat":      work,
+		"Rencana":    workProjects,
+		"Peluncuran": alpha,
+		"Renovasi":   homeProjects,
+		"Bebas":      "",
+	}
+	for subject, categoryID := range notes {
+		note := &models.Note{Subject: subject, Content: "Isi " + subject, Priority: "medium", CategoryID: categoryID}
+		if err := src.notes.Create(note); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := exporter.MarkdownFiles(src.notes, src.categories)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{}
+	for _, f := range files {
+		fsys[f.Path] = &fstest.MapFile{Data: f.Content, ModTime: f.ModTime}
+	}
+
+	dst := newTestVault(t)
+	report := dst.importFiles(t, fsys)
+	if report.Imported != len(notes) {
+		t.Errorf("imported %d notes, want %d", report.Imported, len(notes))
+	}
+
+	// Only categories holding notes, and their parents, come back
+	want := []string{"Kerja", "Kerja / Proyek", "Kerja / Proyek / Alpha", "Rumah", "Rumah / Proyek"}
+	if got := dst.categoryPaths(t); !slices.Equal(got, want) {
+		t.Errorf("categories = %q, want %q", got, want)
+	}
+	if got, want := dst.noteCategories(t), src.noteCategories(t); !maps.Equal(got, want) {
+		t.Errorf("note categories = %q, want %q", got, want)
+	}
+
+	// A second import finds everything in place
+	report = dst.importFiles(t, fsys)
+	if report.Imported != 0 || len(report.CategoriesCreated) != 0 {
+		t.Errorf("second import = %d imported, created %q", report.Imported, report.CategoriesCreated)
+	}
+}
+
+func TestMarkdownCategoryPaths(t *testing.T) {
+	modTime := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	file := func(content string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(content), ModTime: modTime}
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		content string
+		want    string
+		created []string
+	}{
+		{
+			name:    "folder path",
+			path:    "Kerja/Proyek/Alpha/Catatan.md",
+			content: "Isi",
+			want:    "Kerja / Proyek / Alpha",
+			created: []string{"Kerja/Proyek/Alpha"},
+		},
+		{
+			name:    "front matter path",
+			path:    "Catatan.md",
+			content: "---\ncategory: \"kerja / PROYEK\"\n---\nIsi",
+			want:    "Kerja / Proyek",
+		},
+		{
+			name:    "front matter path wins over the folder",
+			path:    "Lain/Catatan.md",
+			content: "---\ncategory: Rumah/Proyek\n---\nIsi",
+			want:    "Rumah / Proyek",
+			created: []string{"Rumah/Proyek"},
+		},
+		{
+			name:    "a name is a top-level category",
+			path:    "Catatan.md",
+			content: "---\ncategory: proyek\n---\nIsi",
+			want:    "proyek",
+			created: []string{"proyek"},
+		},
+		{
+			name:    "empty names are ignored",
+			path:    "Catatan.md",
+			content: "---\ncategory: \"/Kerja//Proyek/\"\n---\nIsi",
+			want:    "Kerja / Proyek",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newTestVault(t)
+			work := v.addCategory(t, "Kerja", "")
+			v.addCategory(t, "Proyek", work)
+			v.addCategory(t, "Rumah", "")
+
+			report := v.importFiles(t, fstest.MapFS{tt.path: file(tt.content)})
+			if got := v.noteCategories(t)["Catatan"]; got != tt.want {
+				t.Errorf("category = %q, want %q", got, tt.want)
+			}
+			if len(report.CategoriesCreated)+len(tt.created) > 0 && !slices.Equal(report.CategoriesCreated, tt.created) {
+				t.Errorf("created %q, want %q", report.CategoriesCreated, tt.created)
+			}
+		})
+	}
+}
@@ -1,6 +1,160 @@
 package models
 
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Category groups notes. Categories form a tree: ParentID is the ID of the
+// parent category, or empty for a top-level category. Position orders the
+// subcategories of one parent, lowest first. NoteCount is the number of
+// notes directly in the category, not counting the trash; it is filled in
+// when reading and ignored when writing.
 type Category struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	ParentID    string `json:"parent_id"`
+	Description string `json:"description"`
+	Color       string `json:"color"`
+	Icon        string `json:"icon"`
+	Position    int    `json:"position"`
+	NoteCount   int    `json:"note_count"`
+}
+
+// MaxCategoryIconLength is the maximum number of characters in an icon,
+// enough for an icon name such as "fa-briefcase" or a few emoji
+const MaxCategoryIconLength = 32
+
+var (
+	// ErrInvalidCategoryColor is returned for a color that is not a hex
+	// color such as #3a7bd5
+	ErrInvalidCategoryColor = errors.New("invalid category color")
+	// ErrInvalidCategoryIcon is returned for an icon that is too long or
+	// contains spaces or control characters
+	ErrInvalidCategoryIcon = errors.New("invalid category icon")
+)
+
+var categoryColorPattern = regexp.MustCompile(`^#([0-9a-f]{3}|[0-9a-f]{6})$`)
+
+// NormalizeCategoryColor returns the stored form of a color: a hex color
+// like #3a7bd5 or #fff in lower case, or empty for no color
+func NormalizeCategoryColor(color string) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(color))
+	if normalized == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(normalized, "#") {
+		normalized = "#" + normalized
+	}
+	if !categoryColorPattern.MatchString(normalized) {
+		return "", fmt.Errorf("%w %q, expected a hex color such as #3a7bd5", ErrInvalidCategoryColor, color)
+	}
+	return normalized, nil
+}
+
+// NormalizeCategoryIcon returns the stored form of an icon: the icon
+// without surrounding space, or empty for no icon
+func NormalizeCategoryIcon(icon string) (string, error) {
+	icon = strings.TrimSpace(icon)
+	if utf8.RuneCountInString(icon) > MaxCategoryIconLength {
+		return "", fmt.Errorf("%w: longer than %d characters", ErrInvalidCategoryIcon, MaxCategoryIconLength)
+	}
+	if strings.IndexFunc(icon, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0 {
+		return "", fmt.Errorf("%w %q: spaces are not allowed", ErrInvalidCategoryIcon, icon)
+	}
+	return icon, nil
+}
+
+// SortCategories orders categories by position, then by name ignoring case
+func SortCategories(categories []Category) {
+	sort.SliceStable(categories, func(i, j int) bool {
+		return categoryLess(categories[i], categories[j])
+	})
+}
+
+func categoryLess(a, b Category) bool {
+	if a.Position != b.Position {
+		return a.Position < b.Position
+	}
+	return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+}
+
+// CategoryNode is a category with its subcategories, as returned by
+// GET /categories?tree=true
+type CategoryNode struct {
+	Category
+	Children []*CategoryNode `json:"children"`
+}
+
+// BuildCategoryTree arranges categories into trees of top-level categories
+// and their subcategories, sorted by position and then name at every
+// level. A category whose parent is not among categories, or that is its
+// own ancestor, is treated as top-level.
+func BuildCategoryTree(categories []Category) []*CategoryNode {
+	nodes := make(map[string]*CategoryNode, len(categories))
+	for _, cat := range categories {
+		nodes[cat.ID] = &CategoryNode{Category: cat, Children: []*CategoryNode{}}
+	}
+	roots := []*CategoryNode{}
+	for _, cat := range categories {
+		node := nodes[cat.ID]
+		if parent, ok := nodes[cat.ParentID]; ok && !isAncestor(nodes, cat.ID, cat.ParentID) {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+	sortCategoryNodes(roots)
+	return roots
+}
+
+// isAncestor reports whether id is the category with ID of or one of its
+// ancestors
+func isAncestor(nodes map[string]*CategoryNode, id, of string) bool {
+	for steps := 0; of != "" && steps <= len(nodes); steps++ {
+		if of == id {
+			return true
+		}
+		node, ok := nodes[of]
+		if !ok {
+			return false
+		}
+		of = node.ParentID
+	}
+	return false
+}
+
+func sortCategoryNodes(nodes []*CategoryNode) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return categoryLess(nodes[i].Category, nodes[j].Category)
+	})
+	for _, node := range nodes {
+		sortCategoryNodes(node.Children)
+	}
+}
+
+// CategoryPath returns the names from the top-level category down to the
+// category with ID id, joined by " / ", or "" when id is not in categories
+func CategoryPath(categories []Category, id string) string {
+	byID := make(map[string]Category, len(categories))
+	for _, cat := range categories {
+		byID[cat.ID] = cat
+	}
+	var names []string
+	seen := make(map[string]bool)
+	for id != "" && !seen[id] {
+		cat, ok := byID[id]
+		if !ok {
+			break
+		}
+		seen[id] = true
+		names = append([]string{cat.Name}, names...)
+		id = cat.ParentID
+	}
+	return strings.Join(names, " / ")
 }
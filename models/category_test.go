@@ -0,0 +1,105 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+// treeString renders category trees as "name(child child)" for comparison
+func treeString(nodes []*CategoryNode) string {
+	parts := make([]string, len(nodes))
+	for i, node := range nodes {
+		parts[i] = node.Name
+		if len(node.Children) > 0 {
+			parts[i] += "(" + treeString(node.Children) + ")"
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestBuildCategoryTree(t *testing.T) {
+	tests := []struct {
+		name       string
+		categories []Category
+		want       string
+	}{
+		{"empty", nil, ""},
+		{
+			name: "nested",
+			categories: []Category{
+				{ID: "alpha", Name: "Alpha", ParentID: "proyek"},
+				{ID: "kerja", Name: "Kerja"},
+				{ID: "proyek", Name: "Proyek", ParentID: "kerja"},
+				{ID: "rumah", Name: "Rumah"},
+				{ID: "dapur", Name: "Dapur", ParentID: "rumah"},
+			},
+			want: "Kerja(Proyek(Alpha)) Rumah(Dapur)",
+		},
+		{
+			name: "sorted by position, then by name ignoring case",
+			categories: []Category{
+				{ID: "c", Name: "c", Position: 1},
+				{ID: "b", Name: "B", Position: 1},
+				{ID: "z", Name: "Z", Position: 0},
+				{ID: "y", Name: "y", ParentID: "z", Position: 2},
+				{ID: "x", Name: "X", ParentID: "z", Position: 1},
+				{ID: "w", Name: "w", ParentID: "z", Position: 1},
+			},
+			want: "Z(w X y) B c",
+		},
+		{
+			name: "missing parent is top-level",
+			categories: []Category{
+				{ID: "a", Name: "A", ParentID: "deleted"},
+				{ID: "b", Name: "B", ParentID: "a"},
+			},
+			want: "A(B)",
+		},
+		{
+			name:       "own parent is top-level",
+			categories: []Category{{ID: "a", Name: "A", ParentID: "a"}},
+			want:       "A",
+		},
+		{
+			name: "categories in a cycle are top-level",
+			categories: []Category{
+				{ID: "a", Name: "A", ParentID: "c"},
+				{ID: "b", Name: "B", ParentID: "a"},
+				{ID: "c", Name: "C", ParentID: "b"},
+				{ID: "d", Name: "D"},
+			},
+			want: "A B C D",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := treeString(BuildCategoryTree(tt.categories)); got != tt.want {
+				t.Errorf("tree = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCategoryPath(t *testing.T) {
+	categories := []Category{
+		{ID: "kerja", Name: "Kerja"},
+		{ID: "proyek", Name: "Proyek", ParentID: "kerja"},
+		{ID: "alpha", Name: "Alpha", ParentID: "proyek"},
+		{ID: "loop", Name: "Loop", ParentID: "loop"},
+	}
+	tests := []struct {
+		id   string
+		want string
+	}{
+		{"kerja", "Kerja"},
+		{"alpha", "Kerja / Proyek / Alpha"},
+		{"loop", "Loop"},
+		{"missing", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := CategoryPath(categories, tt.id); got != tt.want {
+			t.Errorf("CategoryPath(%q) = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+package models
+
+// ChecklistItem is one checkable line of the checklist of a note. Position
+// orders the items of a note, lowest first.
+type ChecklistItem struct {
+	ID       string `json:"id"`
+	NoteID   string `json:"note_id"`
+	Text     string `json:"text"`
+	Checked  bool   `json:"checked"`
+	Position int    `json:"position"`
+}
@@ -1,10 +1,160 @@
 package models
 
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
 type Note struct {
-	ID         string `json:"id"`
-	Subject    string `json:"subject"`
-	Content    string `json:"content"`
-	Priority   string `json:"priority"`
-	Tags       string `json:"tags"`
-	CategoryID string `json:"category_id"`
+	ID         string    `json:"id"`
+	Subject    string    `json:"subject"`
+	Content    string    `json:"content"`
+	Priority   string    `json:"priority"`
+	Tags       string    `json:"tags"`
+	CategoryID string    `json:"category_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	// TrashedAt is when the note was moved to the trash, or nil
+	TrashedAt *time.Time `json:"trashed_at,omitempty"`
+	// Pinned notes are listed first, archived notes are left out of lists
+	// unless asked for, and favorite notes can be listed on their own.
+	// They are changed with SetState rather than Update.
+	Pinned   bool `json:"pinned"`
+	Archived bool `json:"archived"`
+	Favorite bool `json:"favorite"`
+	// DueAt is when the note is due and RemindAt when to be reminded of it,
+	// or nil for none. RemindedAt is when the reminder was delivered; it is
+	// cleared whenever RemindAt changes, so a new reminder fires again.
+	DueAt      *time.Time `json:"due_at,omitempty"`
+	RemindAt   *time.Time `json:"remind_at,omitempty"`
+	RemindedAt *time.Time `json:"reminded_at,omitempty"`
+	// Recurrence is the recurrence rule of the note, as stored by
+	// NormalizeRecurrence, or empty. Each time the note recurs at RecurAt,
+	// RecurrenceMode decides whether it is reset or cloned.
+	Recurrence     string     `json:"recurrence"`
+	RecurrenceMode string     `json:"recurrence_mode"`
+	RecurAt        *time.Time `json:"recur_at,omitempty"`
+	// ChecklistTotal and ChecklistDone count the checklist items of the note
+	// and those checked. Checklist holds the items themselves where a
+	// single note is read; it is not set in lists.
+	ChecklistTotal int             `json:"checklist_total"`
+	ChecklistDone  int             `json:"checklist_done"`
+	Checklist      []ChecklistItem `json:"checklist,omitempty"`
+
+	// SubjectIndex and WordIndexes are the blind indexes of the subject and
+	// of the words of the subject and content. The encrypted repository sets
+	// them when a note is written; they are not read back.
+	SubjectIndex string   `json:"-"`
+	WordIndexes  []string `json:"-"`
+}
+
+// NoteFilter represents filters for notes; empty fields match every note
+type NoteFilter struct {
+	CategoryID string
+	// IncludeSubcategories extends CategoryID to the notes of all its
+	// subcategories, at any depth
+	IncludeSubcategories bool
+	// Trashed matches the notes in the trash instead of the others
+	Trashed bool
+	// IncludeArchived also matches archived notes, which are left out
+	// otherwise; the trash always includes them
+	IncludeArchived bool
+	// Favorites matches only favorite notes
+	Favorites bool
+	// DueBefore matches notes due before this time
+	DueBefore *time.Time
+	// RemindBefore matches notes with a reminder at or before this time that
+	// has not been delivered yet
+	RemindBefore *time.Time
+	// RecurBefore matches recurring notes due to recur at or before this
+	// time
+	RecurBefore *time.Time
+	// Tags matches notes carrying all of these tags, ignoring case
+	Tags []string
+	// TagIDs matches notes carrying all of these tags. Tag names are
+	// encrypted, so the tagged note repository resolves Tags to TagIDs for
+	// the database query.
+	TagIDs []string
+	// Priorities matches notes with any of these priority levels
+	Priorities []string
+	// Subject matches notes with this subject, ignoring case and
+	// surrounding space
+	Subject string
+	// Words matches notes whose subject or content contains all of these
+	// whole words, ignoring case
+	Words []string
+
+	// SubjectIndex and WordIndexes are the blind indexes of Subject and
+	// Words, set by the encrypted repository for the database query
+	SubjectIndex string
+	WordIndexes  []string
+}
+
+// NoteState is a flag of a note that is set apart from its content
+type NoteState string
+
+const (
+	NotePinned   NoteState = "pinned"
+	NoteArchived NoteState = "archived"
+	NoteFavorite NoteState = "favorite"
+)
+
+// Of reports whether note has the state
+func (s NoteState) Of(note *Note) bool {
+	switch s {
+	case NotePinned:
+		return note.Pinned
+	case NoteArchived:
+		return note.Archived
+	case NoteFavorite:
+		return note.Favorite
+	}
+	return false
+}
+
+// Set turns the state of note on or off
+func (s NoteState) Set(note *Note, on bool) {
+	switch s {
+	case NotePinned:
+		note.Pinned = on
+	case NoteArchived:
+		note.Archived = on
+	case NoteFavorite:
+		note.Favorite = on
+	}
+}
+
+// SortPinnedFirst moves the pinned notes before the others, keeping the
+// order within each group
+func SortPinnedFirst(notes []*Note) {
+	sort.SliceStable(notes, func(i, j int) bool {
+		return notes[i].Pinned && !notes[j].Pinned
+	})
+}
+
+// ErrInvalidNoteTime is returned for a due or reminder time in none of the
+// formats accepted by ParseNoteTime
+var ErrInvalidNoteTime = errors.New("invalid time")
+
+// noteTimeLayouts are the layouts ParseNoteTime accepts besides RFC 3339.
+// They carry no zone and are read in local time.
+var noteTimeLayouts = []string{"2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"}
+
+// ParseNoteTime parses a due or reminder time given in RFC 3339, such as
+// 2026-10-19T09:00:00+07:00, or in local time as 2026-10-19 09:00 or
+// 2026-10-19, which is the start of that day
+func ParseNoteTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range noteTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w %q, expected RFC 3339, YYYY-MM-DD HH:MM or YYYY-MM-DD", ErrInvalidNoteTime, value)
 }
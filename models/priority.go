@@ -0,0 +1,127 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Priority is a level a note can be given. Levels with a higher rank are
+// more urgent.
+type Priority struct {
+	Name string `json:"name"`
+	Rank int    `json:"rank"`
+}
+
+// Priorities is the ordered set of priority levels notes may have, with the
+// level given to notes that do not specify one
+type Priorities struct {
+	levels      []Priority
+	defaultName string
+}
+
+// Built-in priority levels, from lowest to highest, and the default level
+var (
+	DefaultPriorityNames = []string{"low", "medium", "high"}
+	DefaultPriority      = "medium"
+)
+
+// ErrInvalidPriority is returned for a priority that is not one of the
+// configured levels
+var ErrInvalidPriority = errors.New("invalid priority")
+
+// NewPriorities returns the levels named in names, ordered from lowest to
+// highest rank, with def as the default. Names are compared and stored in
+// lower case and must be unique.
+func NewPriorities(names []string, def string) (*Priorities, error) {
+	if len(names) == 0 {
+		return nil, errors.New("at least one priority level is required")
+	}
+	p := &Priorities{}
+	for i, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			return nil, errors.New("priority levels cannot be empty")
+		}
+		if p.Rank(name) > 0 {
+			return nil, fmt.Errorf("priority level %q is listed twice", name)
+		}
+		p.levels = append(p.levels, Priority{Name: name, Rank: i + 1})
+	}
+	def = strings.ToLower(strings.TrimSpace(def))
+	if p.Rank(def) == 0 {
+		return nil, fmt.Errorf("default priority %q is not one of %s", def, strings.Join(p.Names(), ", "))
+	}
+	p.defaultName = def
+	return p, nil
+}
+
+// Levels returns the levels from lowest to highest rank
+func (p *Priorities) Levels() []Priority {
+	return append([]Priority(nil), p.levels...)
+}
+
+// Names returns the names of the levels from lowest to highest rank
+func (p *Priorities) Names() []string {
+	names := make([]string, len(p.levels))
+	for i, level := range p.levels {
+		names[i] = level.Name
+	}
+	return names
+}
+
+// Default returns the level given to notes that do not specify one
+func (p *Priorities) Default() string {
+	return p.defaultName
+}
+
+// Rank returns the rank of the level named name, ignoring case, or 0 when
+// it is not a level, so that unknown values sort below every level
+func (p *Priorities) Rank(name string) int {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, level := range p.levels {
+		if level.Name == name {
+			return level.Rank
+		}
+	}
+	return 0
+}
+
+// Normalize returns the stored form of the priority name: the level name
+// in lower case, or the default level when name is empty. A name that is
+// not a level gives ErrInvalidPriority.
+func (p *Priorities) Normalize(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return p.defaultName, nil
+	}
+	if p.Rank(name) == 0 {
+		return "", fmt.Errorf("%w %q, expected one of %s", ErrInvalidPriority, name, strings.Join(p.Names(), ", "))
+	}
+	return name, nil
+}
+
+var currentPriorities, _ = NewPriorities(DefaultPriorityNames, DefaultPriority)
+
+// SetPriorities makes p the levels returned by CurrentPriorities
+func SetPriorities(p *Priorities) {
+	currentPriorities = p
+}
+
+// CurrentPriorities returns the configured priority levels, the built-in
+// ones until SetPriorities is called
+func CurrentPriorities() *Priorities {
+	return currentPriorities
+}
+
+// SortNotes sorts notes by the rank of their priority, highest first or,
+// with ascending, lowest first. Notes of equal rank keep their order.
+func (p *Priorities) SortNotes(notes []*Note, ascending bool) {
+	sort.SliceStable(notes, func(i, j int) bool {
+		if ascending {
+			return p.Rank(notes[i].Priority) < p.Rank(notes[j].Priority)
+		}
+		return p.Rank(notes[i].Priority) > p.Rank(notes[j].Priority)
+	})
+}
@@ -0,0 +1,290 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recurrence modes, what happens to a recurring note each time it recurs
+const (
+	// RecurrenceReset unchecks the checklist of the note
+	RecurrenceReset = "reset"
+	// RecurrenceClone keeps the note as it is and makes a copy with its
+	// checklist unchecked, which recurs in its place
+	RecurrenceClone = "clone"
+)
+
+var (
+	// ErrInvalidRecurrence is returned for a recurrence rule that cannot be
+	// parsed or uses parts that are not supported
+	ErrInvalidRecurrence = errors.New("invalid recurrence")
+	// ErrInvalidRecurrenceMode is returned for a mode other than reset or
+	// clone
+	ErrInvalidRecurrenceMode = errors.New("invalid recurrence mode")
+)
+
+// Recurrence is a recurrence rule, the subset of the RRULE of RFC 5545 made
+// of FREQ (DAILY, WEEKLY or MONTHLY), INTERVAL, BYDAY for weekly rules,
+// BYMONTHDAY for monthly rules and UNTIL. Weeks start on Monday.
+type Recurrence struct {
+	Freq     string
+	Interval int
+	ByDay    []time.Weekday
+	// ByMonthDay holds days of the month from 1 to 31, or -1 for the last
+	// day. A day a month does not have falls on its last day.
+	ByMonthDay []int
+	Until      *time.Time
+	// untilDate records that UNTIL was given as a date, the end of which
+	// is Until
+	untilDate bool
+}
+
+// weekdayCodes are the RRULE names of the days, indexed by time.Weekday
+var weekdayCodes = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+const (
+	untilDateLayout = "20060102"
+	untilTimeLayout = "20060102T150405Z"
+)
+
+// ParseRecurrence parses a recurrence rule: daily, weekly or monthly, or an
+// RRULE such as FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH, optionally prefixed
+// with "RRULE:"
+func ParseRecurrence(rule string) (*Recurrence, error) {
+	rule = strings.TrimSpace(rule)
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("%w %q: %s", ErrInvalidRecurrence, rule, fmt.Sprintf(format, args...))
+	}
+
+	switch strings.ToLower(rule) {
+	case "daily", "weekly", "monthly":
+		return &Recurrence{Freq: strings.ToUpper(rule), Interval: 1}, nil
+	}
+
+	if !strings.Contains(rule, "=") {
+		return nil, invalid("expected daily, weekly, monthly or an RRULE such as FREQ=WEEKLY;BYDAY=MO")
+	}
+
+	r := &Recurrence{Interval: 1}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(strings.TrimPrefix(strings.ToUpper(rule), "RRULE:"), ";") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || value == "" {
+			return nil, invalid("%q is not NAME=VALUE", part)
+		}
+		if seen[key] {
+			return nil, invalid("%s is given twice", key)
+		}
+		seen[key] = true
+
+		switch key {
+		case "FREQ":
+			switch value {
+			case "DAILY", "WEEKLY", "MONTHLY":
+				r.Freq = value
+			default:
+				return nil, invalid("unsupported FREQ %s, expected DAILY, WEEKLY or MONTHLY", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > 999 {
+				return nil, invalid("INTERVAL must be a number from 1 to 999")
+			}
+			r.Interval = n
+		case "BYDAY":
+			for _, code := range strings.Split(value, ",") {
+				day := slices.Index(weekdayCodes, code)
+				if day < 0 {
+					return nil, invalid("unsupported BYDAY %s, expected MO, TU, WE, TH, FR, SA or SU", code)
+				}
+				r.ByDay = append(r.ByDay, time.Weekday(day))
+			}
+		case "BYMONTHDAY":
+			for _, s := range strings.Split(value, ",") {
+				day, err := strconv.Atoi(s)
+				if err != nil || day == 0 || day < -1 || day > 31 {
+					return nil, invalid("unsupported BYMONTHDAY %s, expected 1 to 31 or -1", s)
+				}
+				r.ByMonthDay = append(r.ByMonthDay, day)
+			}
+		case "UNTIL":
+			if t, err := time.ParseInLocation(untilDateLayout, value, time.Local); err == nil {
+				end := t.AddDate(0, 0, 1).Add(-time.Second)
+				r.Until, r.untilDate = &end, true
+			} else if t, err := time.Parse(untilTimeLayout, value); err == nil {
+				r.Until = &t
+			} else {
+				return nil, invalid("UNTIL must be YYYYMMDD or YYYYMMDDTHHMMSSZ")
+			}
+		default:
+			return nil, invalid("unsupported rule part %s", key)
+		}
+	}
+
+	if r.Freq == "" {
+		return nil, invalid("FREQ is required")
+	}
+	if len(r.ByDay) > 0 && r.Freq != "WEEKLY" {
+		return nil, invalid("BYDAY is only supported with FREQ=WEEKLY")
+	}
+	if len(r.ByMonthDay) > 0 && r.Freq != "MONTHLY" {
+		return nil, invalid("BYMONTHDAY is only supported with FREQ=MONTHLY")
+	}
+	slices.SortFunc(r.ByDay, func(a, b time.Weekday) int { return mondayFirst(a) - mondayFirst(b) })
+	r.ByDay = slices.Compact(r.ByDay)
+	slices.Sort(r.ByMonthDay)
+	r.ByMonthDay = slices.Compact(r.ByMonthDay)
+	return r, nil
+}
+
+// String returns the rule as an RRULE without the "RRULE:" prefix
+func (r *Recurrence) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		codes := make([]string, len(r.ByDay))
+		for i, day := range r.ByDay {
+			codes[i] = weekdayCodes[day]
+		}
+		parts = append(parts, "BYDAY="+strings.Join(codes, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, day := range r.ByMonthDay {
+			days[i] = strconv.Itoa(day)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Until != nil {
+		if r.untilDate {
+			parts = append(parts, "UNTIL="+r.Until.In(time.Local).Format(untilDateLayout))
+		} else {
+			parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilTimeLayout))
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+// Next returns the first occurrence of the rule after the occurrence at
+// after, at the same time of day in local time, and false when the rule
+// ends before it
+func (r *Recurrence) Next(after time.Time) (time.Time, bool) {
+	after = after.In(time.Local).Truncate(time.Second)
+	var next time.Time
+	switch r.Freq {
+	case "DAILY":
+		next = after.AddDate(0, 0, r.Interval)
+	case "WEEKLY":
+		next = r.nextWeekly(after)
+	case "MONTHLY":
+		next = r.nextMonthly(after)
+	default:
+		return time.Time{}, false
+	}
+	if r.Until != nil && next.After(*r.Until) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+// nextWeekly returns the next day of ByDay, in a week that is a multiple
+// of Interval weeks after the week of after
+func (r *Recurrence) nextWeekly(after time.Time) time.Time {
+	if len(r.ByDay) == 0 {
+		return after.AddDate(0, 0, 7*r.Interval)
+	}
+	// Every day of ByDay comes up within Interval weeks and one more
+	for days := 1; ; days++ {
+		next := after.AddDate(0, 0, days)
+		weeks := (weekStart(next) - weekStart(after)) / 7
+		if weeks%r.Interval == 0 && slices.Contains(r.ByDay, next.Weekday()) {
+			return next
+		}
+	}
+}
+
+// nextMonthly returns the next day of ByMonthDay, or the day of the month
+// of after when ByMonthDay is empty, in a month that is a multiple of
+// Interval months after the month of after
+func (r *Recurrence) nextMonthly(after time.Time) time.Time {
+	days := r.ByMonthDay
+	if len(days) == 0 {
+		days = []int{after.Day()}
+	}
+	for months := 0; ; months += r.Interval {
+		first := time.Date(after.Year(), after.Month()+time.Month(months), 1, after.Hour(), after.Minute(), after.Second(), 0, after.Location())
+		last := first.AddDate(0, 1, -1).Day()
+		candidates := make([]int, 0, len(days))
+		for _, day := range days {
+			if day == -1 || day > last {
+				day = last
+			}
+			candidates = append(candidates, day)
+		}
+		slices.Sort(candidates)
+		for _, day := range candidates {
+			if next := first.AddDate(0, 0, day-1); next.After(after) {
+				return next
+			}
+		}
+	}
+}
+
+// weekStart returns the number of the Monday starting the week of t,
+// counted in days since 1970-01-01
+func weekStart(t time.Time) int {
+	day := int(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() / 86400)
+	return day - mondayFirst(t.Weekday())
+}
+
+// mondayFirst numbers the days of the week from Monday (0) to Sunday (6)
+func mondayFirst(day time.Weekday) int {
+	return (int(day) + 6) % 7
+}
+
+// NormalizeRecurrence puts the recurrence of note in its stored form: the
+// rule as returned by Recurrence.String, with the day of RecurAt added to
+// monthly rules without BYMONTHDAY, the mode defaulting to reset and
+// RecurAt, the first time the note recurs, defaulting to its due time or
+// else now. A note without a rule has no mode or RecurAt. The error wraps
+// ErrInvalidRecurrence or ErrInvalidRecurrenceMode.
+func NormalizeRecurrence(note *Note, now time.Time) error {
+	if strings.TrimSpace(note.Recurrence) == "" {
+		note.Recurrence, note.RecurrenceMode, note.RecurAt = "", "", nil
+		return nil
+	}
+	rule, err := ParseRecurrence(note.Recurrence)
+	if err != nil {
+		return err
+	}
+
+	switch mode := strings.ToLower(strings.TrimSpace(note.RecurrenceMode)); mode {
+	case "":
+		note.RecurrenceMode = RecurrenceReset
+	case RecurrenceReset, RecurrenceClone:
+		note.RecurrenceMode = mode
+	default:
+		return fmt.Errorf("%w %q, expected reset or clone", ErrInvalidRecurrenceMode, note.RecurrenceMode)
+	}
+
+	if note.RecurAt == nil {
+		at := now
+		if note.DueAt != nil {
+			at = *note.DueAt
+		}
+		note.RecurAt = &at
+	}
+	// Pinning the day keeps a note recurring on the 31st from moving to
+	// the 28th after February
+	if rule.Freq == "MONTHLY" && len(rule.ByMonthDay) == 0 {
+		rule.ByMonthDay = []int{note.RecurAt.In(time.Local).Day()}
+	}
+	note.Recurrence = rule.String()
+	return nil
+}
@@ -0,0 +1,286 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+// inBerlin makes Europe/Berlin the local time zone for the rest of the
+// test, so that times of day and daylight saving time do not depend on
+// the machine. Clocks there went forward on 2026-03-29 and go back on
+// 2026-10-25.
+func inBerlin(t *testing.T) {
+	t.Helper()
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Local
+	time.Local = loc
+	t.Cleanup(func() { time.Local = old })
+}
+
+// local returns the local time at the minute given
+func local(year int, month time.Month, day, hour, min int) time.Time {
+	return time.Date(year, month, day, hour, min, 0, 0, time.Local)
+}
+
+func TestParseRecurrence(t *testing.T) {
+	inBerlin(t)
+	tests := []struct {
+		rule string
+		want string
+	}{
+		{"daily", "FREQ=DAILY"},
+		{" Weekly ", "FREQ=WEEKLY"},
+		{"MONTHLY", "FREQ=MONTHLY"},
+		{"FREQ=DAILY;INTERVAL=1", "FREQ=DAILY"},
+		{"FREQ=DAILY;INTERVAL=3", "FREQ=DAILY;INTERVAL=3"},
+		{"RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=TH,MO", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH"},
+		{"freq=weekly;byday=su,mo,su", "FREQ=WEEKLY;BYDAY=MO,SU"},
+		{"FREQ=MONTHLY;BYMONTHDAY=31,-1,15,15", "FREQ=MONTHLY;BYMONTHDAY=-1,15,31"},
+		{"FREQ=DAILY;UNTIL=20261231", "FREQ=DAILY;UNTIL=20261231"},
+		{"FREQ=DAILY;UNTIL=20261231T080000Z", "FREQ=DAILY;UNTIL=20261231T080000Z"},
+	}
+	for _, tt := range tests {
+		r, err := ParseRecurrence(tt.rule)
+		if err != nil {
+			t.Errorf("ParseRecurrence(%q): %v", tt.rule, err)
+			continue
+		}
+		if got := r.String(); got != tt.want {
+			t.Errorf("ParseRecurrence(%q).String() = %q, want %q", tt.rule, got, tt.want)
+		}
+		// The stored form parses back to itself
+		again, err := ParseRecurrence(tt.want)
+		if err != nil {
+			t.Errorf("ParseRecurrence(%q): %v", tt.want, err)
+		} else if again.String() != tt.want {
+			t.Errorf("ParseRecurrence(%q).String() = %q", tt.want, again.String())
+		}
+	}
+}
+
+func TestParseRecurrenceErrors(t *testing.T) {
+	for _, rule := range []string{
+		"",
+		"yearly",
+		"INTERVAL=2",
+		"FREQ=YEARLY",
+		"FREQ=DAILY;FREQ=WEEKLY",
+		"FREQ=DAILY;INTERVAL",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;INTERVAL=1000",
+		"FREQ=DAILY;BYDAY=MO",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=WEEKLY;BYMONTHDAY=1",
+		"FREQ=MONTHLY;BYMONTHDAY=0",
+		"FREQ=MONTHLY;BYMONTHDAY=-2",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=DAILY;UNTIL=2026-12-31",
+		"FREQ=DAILY;COUNT=3",
+	} {
+		if r, err := ParseRecurrence(rule); !errors.Is(err, ErrInvalidRecurrence) {
+			t.Errorf("ParseRecurrence(%q) = %v, %v, want ErrInvalidRecurrence", rule, r, err)
+		}
+	}
+}
+
+func TestRecurrenceUntil(t *testing.T) {
+	inBerlin(t)
+
+	// A date runs to the end of that day in local time
+	r, err := ParseRecurrence("FREQ=DAILY;UNTIL=20261231")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Date(2026, 12, 31, 23, 59, 59, 0, time.Local); !r.Until.Equal(want) {
+		t.Errorf("UNTIL=20261231 ends at %v, want %v", r.Until, want)
+	}
+	if next, ok := r.Next(local(2026, 12, 30, 23, 0)); !ok || !next.Equal(local(2026, 12, 31, 23, 0)) {
+		t.Errorf("Next on the last day = %v, %v, want 23:00 that day", next, ok)
+	}
+	if next, ok := r.Next(local(2026, 12, 31, 0, 0)); ok {
+		t.Errorf("Next after the last day = %v, want the rule to end", next)
+	}
+
+	// A time is in UTC, an hour behind Berlin in winter, and includes
+	// an occurrence right at it
+	r, err = ParseRecurrence("FREQ=DAILY;UNTIL=20261231T080000Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next, ok := r.Next(local(2026, 12, 30, 9, 0)); !ok || !next.Equal(local(2026, 12, 31, 9, 0)) {
+		t.Errorf("Next at UNTIL = %v, %v, want 09:00 on the last day", next, ok)
+	}
+	if next, ok := r.Next(local(2026, 12, 30, 9, 1)); ok {
+		t.Errorf("Next after UNTIL = %v, want the rule to end", next)
+	}
+}
+
+func TestRecurrenceNext(t *testing.T) {
+	inBerlin(t)
+	tests := []struct {
+		name  string
+		rule  string
+		after time.Time
+		want  time.Time
+	}{
+		{"daily", "daily", local(2026, 3, 10, 9, 0), local(2026, 3, 11, 9, 0)},
+		{"daily interval", "FREQ=DAILY;INTERVAL=3", local(2026, 3, 10, 9, 0), local(2026, 3, 13, 9, 0)},
+		{"daily across month end", "daily", local(2026, 2, 28, 9, 0), local(2026, 3, 1, 9, 0)},
+		{"daily from UTC keeps the local time of day", "daily", time.Date(2026, 3, 10, 8, 0, 0, 0, time.UTC), local(2026, 3, 11, 9, 0)},
+		{"seconds are kept and fractions dropped", "daily", local(2026, 3, 10, 9, 0).Add(30*time.Second + time.Millisecond), local(2026, 3, 11, 9, 0).Add(30 * time.Second)},
+
+		{"weekly", "weekly", local(2026, 3, 10, 9, 0), local(2026, 3, 17, 9, 0)},
+		{"weekly interval", "FREQ=WEEKLY;INTERVAL=2", local(2026, 3, 10, 9, 0), local(2026, 3, 24, 9, 0)},
+		{"weekly by day later in the week", "FREQ=WEEKLY;BYDAY=MO,TH", local(2026, 3, 10, 9, 0), local(2026, 3, 12, 9, 0)},
+		{"weekly by day in the next week", "FREQ=WEEKLY;BYDAY=MO,TH", local(2026, 3, 12, 9, 0), local(2026, 3, 16, 9, 0)},
+		{"interval within the same week", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", local(2026, 3, 9, 9, 0), local(2026, 3, 12, 9, 0)},
+		{"interval skips the weeks between", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH", local(2026, 3, 12, 9, 0), local(2026, 3, 23, 9, 0)},
+		{"interval counts weeks from Monday", "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,SU", local(2026, 3, 14, 9, 0), local(2026, 3, 15, 9, 0)},
+		{"interval from a day not in the rule", "FREQ=WEEKLY;INTERVAL=3;BYDAY=WE", local(2026, 3, 5, 9, 0), local(2026, 3, 25, 9, 0)},
+		{"weekly across the end of the year", "FREQ=WEEKLY;INTERVAL=2;BYDAY=FR", local(2026, 12, 25, 9, 0), local(2027, 1, 8, 9, 0)},
+
+		{"monthly on the same day", "FREQ=MONTHLY;BYMONTHDAY=15", local(2026, 1, 15, 9, 0), local(2026, 2, 15, 9, 0)},
+		{"monthly later in the month", "FREQ=MONTHLY;BYMONTHDAY=1,15", local(2026, 3, 1, 9, 0), local(2026, 3, 15, 9, 0)},
+		{"monthly in the next month", "FREQ=MONTHLY;BYMONTHDAY=1,15", local(2026, 3, 15, 9, 0), local(2026, 4, 1, 9, 0)},
+		{"monthly interval", "FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=10", local(2026, 1, 20, 9, 0), local(2026, 3, 10, 9, 0)},
+		{"monthly interval within the month", "FREQ=MONTHLY;INTERVAL=2;BYMONTHDAY=10", local(2026, 1, 5, 9, 0), local(2026, 1, 10, 9, 0)},
+		{"monthly without a day keeps the day", "monthly", local(2026, 1, 15, 9, 0), local(2026, 2, 15, 9, 0)},
+		{"monthly without a day clamps it", "monthly", local(2026, 1, 31, 9, 0), local(2026, 2, 28, 9, 0)},
+		{"31 falls on the end of February", "FREQ=MONTHLY;BYMONTHDAY=31", local(2026, 1, 31, 9, 0), local(2026, 2, 28, 9, 0)},
+		{"31 comes back after February", "FREQ=MONTHLY;BYMONTHDAY=31", local(2026, 2, 28, 9, 0), local(2026, 3, 31, 9, 0)},
+		{"31 falls on the 30th", "FREQ=MONTHLY;BYMONTHDAY=31", local(2026, 3, 31, 9, 0), local(2026, 4, 30, 9, 0)},
+		{"31 in a leap year", "FREQ=MONTHLY;BYMONTHDAY=31", local(2028, 1, 31, 9, 0), local(2028, 2, 29, 9, 0)},
+		{"-1 is the end of February", "FREQ=MONTHLY;BYMONTHDAY=-1", local(2026, 1, 31, 9, 0), local(2026, 2, 28, 9, 0)},
+		{"-1 is the end of March", "FREQ=MONTHLY;BYMONTHDAY=-1", local(2026, 2, 28, 9, 0), local(2026, 3, 31, 9, 0)},
+		{"-1 in a leap year", "FREQ=MONTHLY;BYMONTHDAY=-1", local(2028, 2, 1, 9, 0), local(2028, 2, 29, 9, 0)},
+		{"clamped days that meet occur once", "FREQ=MONTHLY;BYMONTHDAY=30,31", local(2026, 2, 28, 9, 0), local(2026, 3, 30, 9, 0)},
+		{"clamped day after an earlier day", "FREQ=MONTHLY;BYMONTHDAY=15,31", local(2026, 2, 15, 9, 0), local(2026, 2, 28, 9, 0)},
+		{"monthly across the end of the year", "FREQ=MONTHLY;BYMONTHDAY=-1", local(2026, 12, 31, 9, 0), local(2027, 1, 31, 9, 0)},
+
+		{"daily into summer time", "daily", local(2026, 3, 28, 9, 0), local(2026, 3, 29, 9, 0)},
+		{"daily out of summer time", "daily", local(2026, 10, 24, 9, 0), local(2026, 10, 25, 9, 0)},
+		{"weekly into summer time", "FREQ=WEEKLY;INTERVAL=2;BYDAY=SU", local(2026, 3, 15, 9, 0), local(2026, 3, 29, 9, 0)},
+		{"monthly out of summer time", "FREQ=MONTHLY;BYMONTHDAY=-1", local(2026, 9, 30, 9, 0), local(2026, 10, 31, 9, 0)},
+		{"a time skipped by the clocks moves an hour on", "daily", local(2026, 3, 28, 2, 30), local(2026, 3, 29, 3, 30)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ParseRecurrence(tt.rule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := r.Next(tt.after)
+			if !ok {
+				t.Fatalf("Next(%v) ended the rule, want %v", tt.after, tt.want)
+			}
+			if !got.Equal(tt.want) || got.Location() != time.Local {
+				t.Errorf("Next(%v) = %v, want %v", tt.after, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeRecurrence(t *testing.T) {
+	inBerlin(t)
+	now := local(2026, 3, 10, 12, 0)
+	due := local(2026, 3, 12, 9, 0)
+	recurAt := local(2026, 1, 31, 9, 0)
+	tests := []struct {
+		name        string
+		note        Note
+		wantRule    string
+		wantMode    string
+		wantRecurAt *time.Time
+		wantErr     error
+	}{
+		{
+			name: "no rule clears the mode and time",
+			note: Note{Recurrence: " ", RecurrenceMode: RecurrenceClone, RecurAt: &recurAt},
+		},
+		{
+			name:        "mode defaults to reset and time to the due time",
+			note:        Note{Recurrence: "weekly", DueAt: &due},
+			wantRule:    "FREQ=WEEKLY",
+			wantMode:    RecurrenceReset,
+			wantRecurAt: &due,
+		},
+		{
+			name:        "time defaults to now without a due time",
+			note:        Note{Recurrence: "daily", RecurrenceMode: " Clone "},
+			wantRule:    "FREQ=DAILY",
+			wantMode:    RecurrenceClone,
+			wantRecurAt: &now,
+		},
+		{
+			name:        "a given time is kept",
+			note:        Note{Recurrence: "FREQ=DAILY;INTERVAL=2", RecurrenceMode: "reset", DueAt: &due, RecurAt: &recurAt},
+			wantRule:    "FREQ=DAILY;INTERVAL=2",
+			wantMode:    RecurrenceReset,
+			wantRecurAt: &recurAt,
+		},
+		{
+			name:        "monthly rules keep the day of the month",
+			note:        Note{Recurrence: "monthly", RecurAt: &recurAt},
+			wantRule:    "FREQ=MONTHLY;BYMONTHDAY=31",
+			wantMode:    RecurrenceReset,
+			wantRecurAt: &recurAt,
+		},
+		{
+			name:        "the day of the month is local",
+			note:        Note{Recurrence: "monthly", DueAt: ptr(time.Date(2026, 3, 31, 23, 30, 0, 0, time.UTC))},
+			wantRule:    "FREQ=MONTHLY;BYMONTHDAY=1",
+			wantMode:    RecurrenceReset,
+			wantRecurAt: ptr(time.Date(2026, 3, 31, 23, 30, 0, 0, time.UTC)),
+		},
+		{
+			name:        "monthly rules with days are kept",
+			note:        Note{Recurrence: "FREQ=MONTHLY;BYMONTHDAY=-1", RecurAt: &recurAt},
+			wantRule:    "FREQ=MONTHLY;BYMONTHDAY=-1",
+			wantMode:    RecurrenceReset,
+			wantRecurAt: &recurAt,
+		},
+		{
+			name:    "unknown mode",
+			note:    Note{Recurrence: "daily", RecurrenceMode: "copy"},
+			wantErr: ErrInvalidRecurrenceMode,
+		},
+		{
+			name:    "invalid rule",
+			note:    Note{Recurrence: "yearly", RecurrenceMode: RecurrenceClone},
+			wantErr: ErrInvalidRecurrence,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			note := tt.note
+			err := NormalizeRecurrence(&note, now)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if note.Recurrence != tt.wantRule || note.RecurrenceMode != tt.wantMode {
+				t.Errorf("rule and mode = %q, %q, want %q, %q", note.Recurrence, note.RecurrenceMode, tt.wantRule, tt.wantMode)
+			}
+			switch {
+			case tt.wantRecurAt == nil && note.RecurAt != nil:
+				t.Errorf("RecurAt = %v, want nil", note.RecurAt)
+			case tt.wantRecurAt != nil && (note.RecurAt == nil || !note.RecurAt.Equal(*tt.wantRecurAt)):
+				t.Errorf("RecurAt = %v, want %v", note.RecurAt, tt.wantRecurAt)
+			}
+		})
+	}
+}
+
+func ptr(t time.Time) *time.Time {
+	return &t
+}
@@ -0,0 +1,31 @@
+package models
+
+import "strings"
+
+// Tag is a label that can be given to any number of notes. Count is the
+// number of notes carrying it and is only filled in when listing tags.
+type Tag struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+	// NameIndex is the blind index of the name, set by the encrypted
+	// repository when a tag is written
+	NameIndex string `json:"-"`
+}
+
+// SplitTags splits the comma-separated tags of a note into names, trimming
+// spaces and dropping empty names
+func SplitTags(tags string) []string {
+	var out []string
+	for _, tag := range strings.Split(tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			out = append(out, tag)
+		}
+	}
+	return out
+}
+
+// JoinTags is the reverse of SplitTags
+func JoinTags(names []string) string {
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,74 @@
+package reminders
+
+import (
+	"context"
+	"sync"
+)
+
+// subscriberBuffer is how many reminders a subscriber may fall behind
+// before further ones are dropped for it
+const subscriberBuffer = 16
+
+// Broadcaster passes reminders on to the open event streams of the
+// frontend. Delivery is best effort: a browser that is not connected when
+// a reminder fires does not get it.
+type Broadcaster struct {
+	mu          sync.Mutex
+	subscribers map[chan Reminder]struct{}
+	closed      bool
+}
+
+// NewBroadcaster creates a broadcaster without subscribers
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{subscribers: make(map[chan Reminder]struct{})}
+}
+
+func (b *Broadcaster) Name() string { return "events" }
+
+// Subscribe returns a channel receiving the reminders broadcast from now on
+// and a function to stop receiving them. The channel is closed when the
+// subscription ends or the broadcaster is closed.
+func (b *Broadcaster) Subscribe() (<-chan Reminder, func()) {
+	ch := make(chan Reminder, subscriberBuffer)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+	b.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Notify sends r to every subscriber without waiting for slow ones
+func (b *Broadcaster) Notify(ctx context.Context, r Reminder) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- r:
+		default:
+		}
+	}
+	return nil
+}
+
+// Close ends every subscription, so that open event streams let the
+// server shut down
+func (b *Broadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for ch := range b.subscribers {
+		delete(b.subscribers, ch)
+		close(ch)
+	}
+}
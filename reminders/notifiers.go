@@ -0,0 +1,101 @@
+package reminders
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Time allowed for a single delivery, so one slow notifier cannot hold up
+// the reminders behind it for long
+const (
+	webhookTimeout = 10 * time.Second
+	commandTimeout = 30 * time.Second
+)
+
+// WebhookNotifier POSTs each reminder as JSON to a URL
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookNotifier creates a notifier posting to url
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{url: url, client: &http.Client{Timeout: webhookTimeout}}
+}
+
+func (n *WebhookNotifier) Name() string { return "webhook" }
+
+// Notify fails unless the webhook answers with a 2xx status
+func (n *WebhookNotifier) Notify(ctx context.Context, r Reminder) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode reminder: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// CommandNotifier runs a local command for each reminder, such as
+// notify-send. The command line is split on spaces, without a shell, and
+// the subject of the note is added as the last argument. The reminder is
+// also given as JSON on standard input and in NOTE_* environment variables.
+type CommandNotifier struct {
+	args []string
+}
+
+// NewCommandNotifier creates a notifier running command
+func NewCommandNotifier(command string) *CommandNotifier {
+	return &CommandNotifier{args: strings.Fields(command)}
+}
+
+func (n *CommandNotifier) Name() string { return "command" }
+
+func (n *CommandNotifier) Notify(ctx context.Context, r Reminder) error {
+	if len(n.args) == 0 {
+		return fmt.Errorf("no command configured")
+	}
+	body, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode reminder: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, n.args[0], append(n.args[1:], r.Subject)...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"NOTE_ID="+r.NoteID,
+		"NOTE_SUBJECT="+r.Subject,
+		"NOTE_PRIORITY="+r.Priority,
+		"NOTE_REMIND_AT="+r.RemindAt.Format(time.RFC3339),
+	)
+	if r.DueAt != nil {
+		cmd.Env = append(cmd.Env, "NOTE_DUE_AT="+r.DueAt.Format(time.RFC3339))
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("command %s failed: %w: %s", n.args[0], err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+// Package reminders delivers the reminders of notes once they are due
+package reminders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/repositories"
+)
+
+// Reminder is what notifiers are told about a note whose reminder is due.
+// The content of the note is left out so it does not leave the server.
+type Reminder struct {
+	NoteID   string     `json:"note_id"`
+	Subject  string     `json:"subject"`
+	Priority string     `json:"priority"`
+	DueAt    *time.Time `json:"due_at,omitempty"`
+	RemindAt time.Time  `json:"remind_at"`
+}
+
+// NewReminder returns the reminder of a note that has a reminder set
+func NewReminder(note *models.Note) Reminder {
+	r := Reminder{
+		NoteID:   note.ID,
+		Subject:  note.Subject,
+		Priority: note.Priority,
+		DueAt:    note.DueAt,
+	}
+	if note.RemindAt != nil {
+		r.RemindAt = *note.RemindAt
+	}
+	return r
+}
+
+// Notifier delivers reminders somewhere
+type Notifier interface {
+	// Name identifies the notifier in logs
+	Name() string
+	Notify(ctx context.Context, r Reminder) error
+}
+
+// Scheduler looks for reminders that are due and hands them to its
+// notifiers
+type Scheduler struct {
+	notes     repositories.NoteRepositoryInterface
+	logs      *repositories.ActivityLogWriter
+	notifiers []Notifier
+}
+
+// NewScheduler creates a scheduler for the reminders of notes. Delivered
+// reminders are recorded in logs when it is not nil.
+func NewScheduler(notes repositories.NoteRepositoryInterface, logs *repositories.ActivityLogWriter, notifiers ...Notifier) *Scheduler {
+	return &Scheduler{notes: notes, logs: logs, notifiers: notifiers}
+}
+
+// Check delivers every reminder that is due and was not delivered yet, and
+// returns how many it delivered. Each reminder is offered to every notifier
+// once: it is marked delivered even when a notifier fails, so a webhook
+// that is down does not receive the same reminder on every check. A
+// reminder whose delivery was interrupted by ctx is not marked, so it is
+// offered again on the next start. Notes in the trash or archived are not
+// reminded of.
+func (s *Scheduler) Check(ctx context.Context) (int, error) {
+	now := time.Now()
+	notes, err := s.notes.GetFiltered(models.NoteFilter{RemindBefore: &now})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get due reminders: %w", err)
+	}
+
+	delivered := 0
+	for _, note := range notes {
+		if ctx.Err() != nil {
+			break
+		}
+		reminder := NewReminder(note)
+		var errs []error
+		for _, n := range s.notifiers {
+			if err := n.Notify(ctx, reminder); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", n.Name(), err))
+			}
+		}
+		// A notifier cut off by shutdown may not have delivered it, so
+		// the reminder is left due for the next start
+		if ctx.Err() != nil {
+			break
+		}
+		if err := errors.Join(errs...); err != nil {
+			log.Printf("Failed to deliver reminder for note %s: %v", note.ID, err)
+		}
+
+		if err := s.notes.MarkReminded(note.ID, now); err != nil {
+			return delivered, err
+		}
+		delivered++
+		if s.logs != nil {
+			s.logs.Enqueue(&models.ActivityLog{
+				Action:      "remind",
+				EntityType:  "note",
+				Description: "Sent reminder for note: " + note.Subject,
+				UserID:      1,
+				IPAddress:   "scheduler",
+			})
+		}
+	}
+	return delivered, nil
+}
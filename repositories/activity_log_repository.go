@@ -77,6 +77,61 @@ func (r *ActivityLogRepository) Create(log *models.ActivityLog) error {
 	return nil
 }
 
+// CreateBatch adds several activity log entries in a single transaction,
+// preserving their order
+func (r *ActivityLogRepository) CreateBatch(logs []*models.ActivityLog) error {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`
+	INSERT INTO activity_logs (
+		timestamp, action, entity_type, entity_id, description, user_id, ip_address
+	) VALUES (?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	ids := make([]int, len(logs))
+	for i, log := range logs {
+		if log.Timestamp.IsZero() {
+			log.Timestamp = time.Now()
+		}
+
+		result, err := stmt.Exec(
+			log.Timestamp,
+			log.Action,
+			log.EntityType,
+			log.EntityID,
+			log.Description,
+			log.UserID,
+			log.IPAddress,
+		)
+		if err != nil {
+			return err
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		ids[i] = int(id)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for i, log := range logs {
+		log.ID = ids[i]
+	}
+	return nil
+}
+
 // GetAll retrieves all activity logs with optional filtering
 func (r *ActivityLogRepository) GetAll(filter models.ActivityLogFilter) ([]models.ActivityLog, error) {
 	query := `
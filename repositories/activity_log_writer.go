@@ -0,0 +1,202 @@
+package repositories
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"personal-notes-with-go/models"
+)
+
+// Queue policies of the ActivityLogWriter
+const (
+	// ActivityLogPolicyBlock makes Enqueue wait for room in the queue
+	ActivityLogPolicyBlock = "block"
+	// ActivityLogPolicyDrop makes Enqueue discard the entry and count it
+	ActivityLogPolicyDrop = "drop"
+)
+
+// ActivityLogWriterOptions configures an ActivityLogWriter
+type ActivityLogWriterOptions struct {
+	QueueSize     int
+	BatchSize     int
+	FlushInterval time.Duration
+	Policy        string
+}
+
+// ActivityLogWriterStats is a snapshot of the writer's counters
+type ActivityLogWriterStats struct {
+	QueueDepth    int    `json:"queueDepth"`
+	QueueCapacity int    `json:"queueCapacity"`
+	Policy        string `json:"policy"`
+	Written       uint64 `json:"written"`
+	Dropped       uint64 `json:"dropped"`
+	Failed        uint64 `json:"failed"`
+	Batches       uint64 `json:"batches"`
+}
+
+// ActivityLogWriter queues activity log entries and writes them from a
+// single goroutine in batched transactions. Using one writer keeps the
+// entries in the order they were logged and avoids contending for SQLite's
+// write lock with one INSERT per request.
+type ActivityLogWriter struct {
+	repo          *ActivityLogRepository
+	queue         chan *models.ActivityLog
+	batchSize     int
+	flushInterval time.Duration
+	policy        string
+
+	// stopping wakes Enqueue calls waiting for room once Run is stopping.
+	// closed is set under mu before the final drain; Enqueue sends while
+	// holding mu for reading, so no entry is queued after the drain.
+	stopping chan struct{}
+	mu       sync.RWMutex
+	closed   bool
+
+	written atomic.Uint64
+	dropped atomic.Uint64
+	failed  atomic.Uint64
+	batches atomic.Uint64
+}
+
+// NewActivityLogWriter creates a writer. Call Run to start writing.
+func NewActivityLogWriter(repo *ActivityLogRepository, opts ActivityLogWriterOptions) *ActivityLogWriter {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1024
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 64
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	if opts.Policy != ActivityLogPolicyDrop {
+		opts.Policy = ActivityLogPolicyBlock
+	}
+
+	return &ActivityLogWriter{
+		repo:          repo,
+		queue:         make(chan *models.ActivityLog, opts.QueueSize),
+		stopping:      make(chan struct{}),
+		batchSize:     opts.BatchSize,
+		flushInterval: opts.FlushInterval,
+		policy:        opts.Policy,
+	}
+}
+
+// Enqueue adds an entry to the queue and reports whether it was accepted.
+// When the queue is full the entry is either waited for or dropped,
+// depending on the policy. Entries are always dropped once Run has started
+// its final drain.
+func (w *ActivityLogWriter) Enqueue(entry *models.ActivityLog) bool {
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		w.dropped.Add(1)
+		return false
+	}
+
+	if w.policy == ActivityLogPolicyDrop {
+		select {
+		case w.queue <- entry:
+			return true
+		default:
+			w.dropped.Add(1)
+			return false
+		}
+	}
+
+	select {
+	case w.queue <- entry:
+		return true
+	case <-w.stopping:
+		w.dropped.Add(1)
+		return false
+	}
+}
+
+// Run writes queued entries until ctx is cancelled. A batch is written when
+// it reaches the batch size or when the flush interval passes. On
+// cancellation the entries still in the queue are written before returning.
+func (w *ActivityLogWriter) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*models.ActivityLog, 0, w.batchSize)
+	for {
+		// Once cancelled, stop at once rather than taking more entries
+		// while the queue stays busy
+		if ctx.Err() != nil {
+			w.drain(batch)
+			return
+		}
+		select {
+		case entry := <-w.queue:
+			batch = append(batch, entry)
+			if len(batch) >= w.batchSize {
+				batch = w.flush(batch)
+			}
+		case <-ticker.C:
+			batch = w.flush(batch)
+		case <-ctx.Done():
+			w.drain(batch)
+			return
+		}
+	}
+}
+
+// drain stops accepting entries, then writes batch and whatever is left in
+// the queue so no accepted entry is lost on shutdown
+func (w *ActivityLogWriter) drain(batch []*models.ActivityLog) {
+	close(w.stopping)
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+	for {
+		select {
+		case entry := <-w.queue:
+			batch = append(batch, entry)
+			if len(batch) >= w.batchSize {
+				batch = w.flush(batch)
+			}
+		default:
+			w.flush(batch)
+			return
+		}
+	}
+}
+
+// flush writes a batch and returns it emptied for reuse
+func (w *ActivityLogWriter) flush(batch []*models.ActivityLog) []*models.ActivityLog {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	if err := w.repo.CreateBatch(batch); err != nil {
+		w.failed.Add(uint64(len(batch)))
+		log.Printf("Failed to write %d activity logs: %v", len(batch), err)
+	} else {
+		w.written.Add(uint64(len(batch)))
+		w.batches.Add(1)
+	}
+	return batch[:0]
+}
+
+// Stats returns the current queue depth and counters
+func (w *ActivityLogWriter) Stats() ActivityLogWriterStats {
+	return ActivityLogWriterStats{
+		QueueDepth:    len(w.queue),
+		QueueCapacity: cap(w.queue),
+		Policy:        w.policy,
+		Written:       w.written.Load(),
+		Dropped:       w.dropped.Load(),
+		Failed:        w.failed.Load(),
+		Batches:       w.batches.Load(),
+	}
+}
@@ -0,0 +1,192 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"personal-notes-with-go/models"
+)
+
+func newTestWriter(t *testing.T, opts ActivityLogWriterOptions) (*ActivityLogWriter, *sql.DB) {
+	t.Helper()
+	db := newTestDB(t)
+	return NewActivityLogWriter(NewActivityLogRepository(db), opts), db
+}
+
+func activityLog(n int) *models.ActivityLog {
+	return &models.ActivityLog{Action: "create", EntityType: "note", EntityID: n, Description: "log " + strconv.Itoa(n), UserID: 1, IPAddress: "test"}
+}
+
+// storedLogs returns the descriptions of the stored activity logs in the
+// order they were written
+func storedLogs(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+	rows, err := db.Query("SELECT description FROM activity_logs ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var descriptions []string
+	for rows.Next() {
+		var description string
+		if err := rows.Scan(&description); err != nil {
+			t.Fatal(err)
+		}
+		descriptions = append(descriptions, description)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return descriptions
+}
+
+// runWriter runs w until the returned function is called, which waits for
+// the final drain
+func runWriter(w *ActivityLogWriter) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+func TestActivityLogWriterDropPolicy(t *testing.T) {
+	w, db := newTestWriter(t, ActivityLogWriterOptions{QueueSize: 2, Policy: ActivityLogPolicyDrop})
+
+	// Without Run nothing leaves the queue, so the third entry finds it full
+	for i, want := range []bool{true, true, false, false} {
+		if got := w.Enqueue(activityLog(i)); got != want {
+			t.Errorf("Enqueue #%d = %v, want %v", i, got, want)
+		}
+	}
+	stats := w.Stats()
+	if stats.Dropped != 2 || stats.QueueDepth != 2 || stats.QueueCapacity != 2 || stats.Policy != ActivityLogPolicyDrop {
+		t.Errorf("Stats() = %+v, want 2 dropped and a full queue of 2", stats)
+	}
+
+	runWriter(w)()
+	if got := storedLogs(t, db); len(got) != 2 || got[0] != "log 0" || got[1] != "log 1" {
+		t.Errorf("stored %q, want the two accepted entries", got)
+	}
+	if stats := w.Stats(); stats.Written != 2 || stats.Dropped != 2 || stats.QueueDepth != 0 {
+		t.Errorf("Stats() = %+v after the drain", stats)
+	}
+}
+
+func TestActivityLogWriterBlockedEnqueueReturnsOnCancel(t *testing.T) {
+	w, db := newTestWriter(t, ActivityLogWriterOptions{QueueSize: 1, Policy: ActivityLogPolicyBlock})
+	if !w.Enqueue(activityLog(0)) {
+		t.Fatal("Enqueue into an empty queue failed")
+	}
+
+	blocked := make(chan bool)
+	go func() { blocked <- w.Enqueue(activityLog(1)) }()
+	select {
+	case got := <-blocked:
+		t.Fatalf("Enqueue into a full queue returned %v without waiting", got)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Run is cancelled before it takes anything from the full queue
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w.Run(ctx)
+	select {
+	case got := <-blocked:
+		if got {
+			t.Error("blocked Enqueue was accepted after Run was cancelled")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("blocked Enqueue still waiting after Run was cancelled")
+	}
+
+	if got := storedLogs(t, db); len(got) != 1 || got[0] != "log 0" {
+		t.Errorf("stored %q, want only the entry accepted before cancelling", got)
+	}
+	if stats := w.Stats(); stats.Written != 1 || stats.Dropped != 1 {
+		t.Errorf("Stats() = %+v, want 1 written and 1 dropped", stats)
+	}
+}
+
+func TestActivityLogWriterDrainsOnShutdown(t *testing.T) {
+	// Batches are only written when full or on shutdown
+	w, db := newTestWriter(t, ActivityLogWriterOptions{QueueSize: 16, BatchSize: 7, FlushInterval: time.Hour})
+	stop := runWriter(w)
+
+	const producers, perProducer = 4, 25
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	accepted := 0
+	for p := range producers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perProducer {
+				if w.Enqueue(activityLog(p*perProducer + i)) {
+					mu.Lock()
+					accepted++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	stop()
+
+	if accepted != producers*perProducer {
+		t.Errorf("accepted %d entries before shutdown, want all %d", accepted, producers*perProducer)
+	}
+	if got := storedLogs(t, db); len(got) != accepted {
+		t.Errorf("stored %d entries, want the %d accepted", len(got), accepted)
+	}
+	stats := w.Stats()
+	if stats.Written != uint64(accepted) || stats.Failed != 0 || stats.QueueDepth != 0 {
+		t.Errorf("Stats() = %+v, want all %d written", stats, accepted)
+	}
+	if want := uint64((accepted + 6) / 7); stats.Batches < want {
+		t.Errorf("wrote %d batches, want at least %d of at most 7 entries", stats.Batches, want)
+	}
+
+	// After the drain every entry is rejected and counted
+	if w.Enqueue(activityLog(-1)) {
+		t.Error("Enqueue after the final drain was accepted")
+	}
+	if w.Stats().Dropped != 1 {
+		t.Errorf("Dropped = %d after a late entry, want 1", w.Stats().Dropped)
+	}
+	if got := storedLogs(t, db); len(got) != accepted {
+		t.Errorf("stored %d entries after a late entry, want %d", len(got), accepted)
+	}
+}
+
+func TestActivityLogWriterKeepsOrder(t *testing.T) {
+	w, db := newTestWriter(t, ActivityLogWriterOptions{QueueSize: 4, BatchSize: 3, FlushInterval: time.Millisecond})
+	stop := runWriter(w)
+	var want []string
+	for i := range 20 {
+		if !w.Enqueue(activityLog(i)) {
+			t.Fatalf("Enqueue #%d was not accepted", i)
+		}
+		want = append(want, "log "+strconv.Itoa(i))
+	}
+	stop()
+
+	got := storedLogs(t, db)
+	if len(got) != len(want) {
+		t.Fatalf("stored %d entries, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("stored %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/utils"
+)
+
+// UpdateBlindIndexes computes the blind indexes of tags and notes with bi,
+// decrypting them with c. Only rows without an index are updated, unless
+// rebuild is set or the indexes in the database were computed with another
+// key, in which case every row is. It runs in one transaction and returns
+// the number of rows updated; once every row is indexed it only costs a few
+// queries, so it is safe to call on every start. A row that cannot be
+// decrypted is logged and left without an index.
+func UpdateBlindIndexes(db *sql.DB, c utils.Cipher, bi *utils.BlindIndex, rebuild bool) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var keyCheck string
+	err = tx.QueryRow("SELECT key_check FROM blind_index").Scan(&keyCheck)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("failed to read blind index key check: %w", err)
+	}
+	if keyCheck != bi.KeyCheck() {
+		rebuild = true
+	}
+
+	tags, err := indexTags(tx, c, bi, rebuild)
+	if err != nil {
+		return 0, err
+	}
+	notes, err := indexNotes(tx, c, bi, rebuild)
+	if err != nil {
+		return 0, err
+	}
+
+	if keyCheck != bi.KeyCheck() {
+		if _, err := tx.Exec("DELETE FROM blind_index"); err != nil {
+			return 0, fmt.Errorf("failed to store blind index key check: %w", err)
+		}
+		if _, err := tx.Exec("INSERT INTO blind_index (key_check) VALUES (?)", bi.KeyCheck()); err != nil {
+			return 0, fmt.Errorf("failed to store blind index key check: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return tags + notes, nil
+}
+
+// CountUnindexed returns the number of tags and notes without a blind index
+// and whether the indexes in the database were computed with bi's key
+func CountUnindexed(db *sql.DB, bi *utils.BlindIndex) (int, bool, error) {
+	var keyCheck string
+	err := db.QueryRow("SELECT key_check FROM blind_index").Scan(&keyCheck)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, false, fmt.Errorf("failed to read blind index key check: %w", err)
+	}
+	var count int
+	err = db.QueryRow(`
+		SELECT (SELECT COUNT(*) FROM tags WHERE name_index IS NULL)
+			+ (SELECT COUNT(*) FROM notes WHERE subject_index IS NULL)
+	`).Scan(&count)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to count unindexed rows: %w", err)
+	}
+	return count, keyCheck == bi.KeyCheck(), nil
+}
+
+// indexTags sets the name index of tags
+func indexTags(tx *sql.Tx, c utils.Cipher, bi *utils.BlindIndex, rebuild bool) (int, error) {
+	query := "SELECT id, name FROM tags"
+	if !rebuild {
+		query += " WHERE name_index IS NULL"
+	}
+	rows, err := tx.Query(query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query tags: %w", err)
+	}
+	var tags []models.Tag
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.ID, &tag.Name); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating tag rows: %w", err)
+	}
+
+	updated := 0
+	for _, tag := range tags {
+		name, err := c.Decrypt(tag.Name)
+		if err != nil {
+			log.Printf("Skipping blind index of tag %s: %v", tag.ID, err)
+			continue
+		}
+		if _, err := tx.Exec("UPDATE tags SET name_index = ? WHERE id = ?", bi.Hash(utils.BlindIndexTag, name), tag.ID); err != nil {
+			return 0, fmt.Errorf("failed to index tag %s: %w", tag.ID, err)
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+// indexNotes sets the subject and word indexes of notes
+func indexNotes(tx *sql.Tx, c utils.Cipher, bi *utils.BlindIndex, rebuild bool) (int, error) {
+	query := "SELECT id, subject, COALESCE(content, '') FROM notes"
+	if !rebuild {
+		query += " WHERE subject_index IS NULL"
+	}
+	rows, err := tx.Query(query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query notes: %w", err)
+	}
+	type pending struct{ id, subject, content string }
+	var notes []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.subject, &p.content); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan note: %w", err)
+		}
+		notes = append(notes, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating note rows: %w", err)
+	}
+
+	updated := 0
+	for _, p := range notes {
+		note := &models.Note{ID: p.id}
+		if note.Subject, err = c.Decrypt(p.subject); err == nil {
+			note.Content, err = c.Decrypt(p.content)
+		}
+		if err != nil {
+			log.Printf("Skipping blind index of note %s: %v", p.id, err)
+			continue
+		}
+		subjectIndex, words := noteIndexes(bi, note)
+		if _, err := tx.Exec("UPDATE notes SET subject_index = ? WHERE id = ?", subjectIndex, p.id); err != nil {
+			return 0, fmt.Errorf("failed to index note %s: %w", p.id, err)
+		}
+		if err := setWords(tx, p.id, words); err != nil {
+			return 0, err
+		}
+		updated++
+	}
+	return updated, nil
+}
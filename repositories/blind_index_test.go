@@ -0,0 +1,185 @@
+package repositories
+
+import (
+	"bytes"
+	"database/sql"
+	"testing"
+
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/utils"
+)
+
+func blindIndex(t *testing.T, b byte) *utils.BlindIndex {
+	t.Helper()
+	bi, err := utils.NewBlindIndex(bytes.Repeat([]byte{b}, utils.KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bi
+}
+
+// newIndexedDB returns a database holding one tagged note, written with a
+// cipher and a blind index that use different keys
+func newIndexedDB(t *testing.T) (*sql.DB, utils.Cipher, *utils.BlindIndex) {
+	t.Helper()
+	db := newTestDB(t)
+	c, err := utils.NewCipher(utils.CipherXChaCha20Poly1305, bytes.Repeat([]byte{1}, utils.KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bi := blindIndex(t, 2)
+	note := &models.Note{Subject: "Belanja Mingguan", Content: "Susu dan ROTI", Priority: "medium", Tags: "Rumah, dapur"}
+	if err := NewTransactionalNoteRepository(db, c, bi).Create(note); err != nil {
+		t.Fatal(err)
+	}
+	return db, c, bi
+}
+
+// found returns the number of notes the filter matches when searched with
+// bi
+func found(t *testing.T, db *sql.DB, c utils.Cipher, bi *utils.BlindIndex, filter models.NoteFilter) int {
+	t.Helper()
+	notes, err := NewTransactionalNoteRepository(db, c, bi).GetFiltered(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(notes)
+}
+
+func TestBlindIndexSearchIgnoresCase(t *testing.T) {
+	db, c, bi := newIndexedDB(t)
+	tests := []struct {
+		name   string
+		filter models.NoteFilter
+		want   int
+	}{
+		{"subject", models.NoteFilter{Subject: "Belanja Mingguan"}, 1},
+		{"subject in another case", models.NoteFilter{Subject: "  belanja MINGGUAN "}, 1},
+		{"part of the subject", models.NoteFilter{Subject: "belanja"}, 0},
+		{"word of the subject", models.NoteFilter{Words: []string{"MINGGUAN"}}, 1},
+		{"word of the content", models.NoteFilter{Words: []string{"roti"}}, 1},
+		{"all words", models.NoteFilter{Words: []string{"Susu roti", "belanja"}}, 1},
+		{"a missing word", models.NoteFilter{Words: []string{"susu keju"}}, 0},
+		{"tag", models.NoteFilter{Tags: []string{"rumah"}}, 1},
+		{"tag in another case", models.NoteFilter{Tags: []string{"DAPUR", " Rumah "}}, 1},
+		{"missing tag", models.NoteFilter{Tags: []string{"kantor"}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := found(t, db, c, bi, tt.filter); got != tt.want {
+				t.Errorf("found %d notes, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlindIndexKeyIsSeparate(t *testing.T) {
+	db, c, _ := newIndexedDB(t)
+
+	// An index keyed with the encryption key finds nothing: the indexes do
+	// not reveal anything to whoever holds only that key
+	if got := found(t, db, c, blindIndex(t, 1), models.NoteFilter{Subject: "Belanja Mingguan"}); got != 0 {
+		t.Errorf("the encryption key found %d notes", got)
+	}
+
+	var subjectIndex string
+	if err := db.QueryRow("SELECT subject_index FROM notes").Scan(&subjectIndex); err != nil {
+		t.Fatal(err)
+	}
+	if subjectIndex == blindIndex(t, 1).Hash(utils.BlindIndexSubject, "Belanja Mingguan") {
+		t.Error("the subject was indexed with the encryption key")
+	}
+}
+
+func TestUpdateBlindIndexes(t *testing.T) {
+	db, c, bi := newIndexedDB(t)
+	subject := models.NoteFilter{Subject: "belanja mingguan"}
+	word := models.NoteFilter{Words: []string{"roti"}}
+	tag := models.NoteFilter{Tags: []string{"rumah"}}
+
+	// No key check is stored yet, so the first run indexes both tags and
+	// the note
+	updated, err := UpdateBlindIndexes(db, c, bi, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != 3 {
+		t.Errorf("first run updated %d rows, want 3", updated)
+	}
+	if updated, err := UpdateBlindIndexes(db, c, bi, false); err != nil || updated != 0 {
+		t.Errorf("second run = %d, %v, want nothing to do", updated, err)
+	}
+	if count, sameKey, err := CountUnindexed(db, bi); err != nil || count != 0 || !sameKey {
+		t.Errorf("CountUnindexed = %d, %v, %v, want 0, true", count, sameKey, err)
+	}
+
+	// Rows without an index are filled in
+	if _, err := db.Exec("UPDATE notes SET subject_index = NULL"); err != nil {
+		t.Fatal(err)
+	}
+	if count, _, err := CountUnindexed(db, bi); err != nil || count != 1 {
+		t.Errorf("CountUnindexed = %d, %v, want 1", count, err)
+	}
+	if updated, err := UpdateBlindIndexes(db, c, bi, false); err != nil || updated != 1 {
+		t.Errorf("UpdateBlindIndexes = %d, %v, want 1", updated, err)
+	}
+	if updated, err := UpdateBlindIndexes(db, c, bi, true); err != nil || updated != 3 {
+		t.Errorf("UpdateBlindIndexes with rebuild = %d, %v, want 3", updated, err)
+	}
+
+	// A new key no longer matches the key check, so every row is rebuilt
+	// even though none is missing an index
+	newBI := blindIndex(t, 3)
+	if count, sameKey, err := CountUnindexed(db, newBI); err != nil || count != 0 || sameKey {
+		t.Errorf("CountUnindexed with the new key = %d, %v, %v, want 0, false", count, sameKey, err)
+	}
+	for _, filter := range []models.NoteFilter{subject, word, tag} {
+		if got := found(t, db, c, newBI, filter); got != 0 {
+			t.Errorf("new key found %d notes with %+v before the rebuild", got, filter)
+		}
+	}
+	if updated, err := UpdateBlindIndexes(db, c, newBI, false); err != nil || updated != 3 {
+		t.Errorf("UpdateBlindIndexes with the new key = %d, %v, want 3", updated, err)
+	}
+	for _, filter := range []models.NoteFilter{subject, word, tag} {
+		if got := found(t, db, c, newBI, filter); got != 1 {
+			t.Errorf("new key found %d notes with %+v, want 1", got, filter)
+		}
+		if got := found(t, db, c, bi, filter); got != 0 {
+			t.Errorf("old key still found %d notes with %+v", got, filter)
+		}
+	}
+	if count, sameKey, err := CountUnindexed(db, newBI); err != nil || count != 0 || !sameKey {
+		t.Errorf("CountUnindexed after the rebuild = %d, %v, %v, want 0, true", count, sameKey, err)
+	}
+	var keyChecks int
+	if err := db.QueryRow("SELECT COUNT(*) FROM blind_index").Scan(&keyChecks); err != nil || keyChecks != 1 {
+		t.Errorf("blind_index holds %d key checks, %v, want 1", keyChecks, err)
+	}
+}
+
+func TestUpdateBlindIndexesSkipsUndecryptableRows(t *testing.T) {
+	db, c, bi := newIndexedDB(t)
+	other, err := utils.NewCipher(utils.CipherXChaCha20Poly1305, bytes.Repeat([]byte{9}, utils.KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, err := other.Encrypt("Belanja Mingguan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("UPDATE notes SET subject = ?, subject_index = NULL", subject); err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := UpdateBlindIndexes(db, c, bi, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated != 2 {
+		t.Errorf("updated %d rows, want only the 2 tags", updated)
+	}
+	if count, _, err := CountUnindexed(db, bi); err != nil || count != 1 {
+		t.Errorf("CountUnindexed = %d, %v, want the note left without an index", count, err)
+	}
+}
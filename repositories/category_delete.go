@@ -0,0 +1,156 @@
+package repositories
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"personal-notes-with-go/utils"
+	"time"
+)
+
+// What DeleteCategory does with the notes of the category
+const (
+	// CategoryDeleteRefuse only deletes a category without notes or
+	// subcategories
+	CategoryDeleteRefuse = "refuse"
+	// CategoryDeleteMove moves the notes to another category; the
+	// subcategories move up to the parent of the deleted category
+	CategoryDeleteMove = "move"
+	// CategoryDeleteTrash deletes the category with its subcategories and
+	// moves all their notes to the trash; notes already there keep the time
+	// they were trashed at
+	CategoryDeleteTrash = "trash"
+)
+
+// CategoryDeleteOptions select how DeleteCategory treats the contents of
+// the category
+type CategoryDeleteOptions struct {
+	Mode string
+	// TargetID is the category the notes move to with CategoryDeleteMove
+	TargetID string
+}
+
+// Validate checks the mode and that move has a target
+func (o CategoryDeleteOptions) Validate() error {
+	switch o.Mode {
+	case CategoryDeleteRefuse, CategoryDeleteTrash:
+		return nil
+	case CategoryDeleteMove:
+		if o.TargetID == "" {
+			return errors.New("mode move requires a target category")
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid delete mode %q, expected %s, %s or %s", o.Mode, CategoryDeleteRefuse, CategoryDeleteMove, CategoryDeleteTrash)
+}
+
+// CategoryDeleteResult counts what DeleteCategory changed
+type CategoryDeleteResult struct {
+	CategoriesDeleted int `json:"categories_deleted"`
+	NotesMoved        int `json:"notes_moved"`
+	NotesTrashed      int `json:"notes_trashed"`
+}
+
+// DeleteCategory deletes the category id in a single transaction, treating
+// its notes and subcategories as opts.Mode says. Refusing a category that
+// is not empty gives ErrCategoryNotEmpty. c decrypts category names to keep
+// them unique when subcategories move up.
+func DeleteCategory(db *sql.DB, c utils.Cipher, id string, opts CategoryDeleteOptions) (*CategoryDeleteResult, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	categories := NewEncryptedCategoryRepository(NewCategoryRepository(tx), c)
+	if _, err := categories.GetByID(id); err != nil {
+		return nil, err
+	}
+
+	result := &CategoryDeleteResult{}
+	switch opts.Mode {
+	case CategoryDeleteRefuse:
+		// Notes in the trash are not counted, as in the note count of the
+		// category; they stay in the trash without a category
+		var notes, subcategories int
+		err := tx.QueryRow(`SELECT
+			(SELECT COUNT(*) FROM notes WHERE category_id = ? AND trashed_at IS NULL),
+			(SELECT COUNT(*) FROM categories WHERE parent_id = ?)`, id, id).Scan(&notes, &subcategories)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count category contents: %w", err)
+		}
+		if notes > 0 || subcategories > 0 {
+			return nil, fmt.Errorf("%w: it has %d note(s) and %d subcategory(ies)", utils.ErrCategoryNotEmpty, notes, subcategories)
+		}
+		if _, err := tx.Exec("UPDATE notes SET category_id = NULL WHERE category_id = ?", id); err != nil {
+			return nil, fmt.Errorf("failed to detach notes in the trash: %w", err)
+		}
+		if err := categories.Delete(id); err != nil {
+			return nil, err
+		}
+		result.CategoriesDeleted = 1
+
+	case CategoryDeleteMove:
+		if opts.TargetID == id {
+			return nil, utils.ErrCategoryMoveTarget
+		}
+		if _, err := categories.GetByID(opts.TargetID); err != nil {
+			if errors.Is(err, utils.ErrCategoryNotFound) {
+				return nil, utils.ErrCategoryTargetNotFound
+			}
+			return nil, err
+		}
+		moved, err := tx.Exec("UPDATE notes SET category_id = ? WHERE category_id = ?", opts.TargetID, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to move notes: %w", err)
+		}
+		n, err := moved.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get affected rows: %w", err)
+		}
+		if err := categories.Delete(id); err != nil {
+			return nil, err
+		}
+		result.CategoriesDeleted, result.NotesMoved = 1, int(n)
+
+	case CategoryDeleteTrash:
+		// The category and every category below it
+		const subtree = `WITH RECURSIVE subtree(id) AS (
+				SELECT ?
+				UNION
+				SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+			)
+			SELECT id FROM subtree`
+		trashed, err := tx.Exec("UPDATE notes SET trashed_at = ?, category_id = NULL WHERE trashed_at IS NULL AND category_id IN ("+subtree+")", time.Now().UTC(), id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to move notes to the trash: %w", err)
+		}
+		n, err := trashed.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get affected rows: %w", err)
+		}
+		// Notes already in the trash keep the time they were trashed at and
+		// are not counted again
+		if _, err := tx.Exec("UPDATE notes SET category_id = NULL WHERE category_id IN ("+subtree+")", id); err != nil {
+			return nil, fmt.Errorf("failed to detach notes in the trash: %w", err)
+		}
+		deleted, err := tx.Exec("DELETE FROM categories WHERE id IN ("+subtree+")", id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete categories: %w", err)
+		}
+		d, err := deleted.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get affected rows: %w", err)
+		}
+		result.CategoriesDeleted, result.NotesTrashed = int(d), int(n)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit category deletion: %w", err)
+	}
+	return result, nil
+}
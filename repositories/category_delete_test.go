@@ -0,0 +1,273 @@
+package repositories
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/utils"
+)
+
+// categoryDeleteDB returns a database with the categories
+//
+//	Kerja         notes "Rapat" and "Lama", the latter in the trash
+//	  Proyek      note "Rencana"
+//	    Alpha     note "Peluncuran"
+//	Rumah         note "Belanja"
+//	Kosong
+//
+// and the IDs of the categories and notes by name
+func categoryDeleteDB(t *testing.T) (*sql.DB, utils.Cipher, map[string]string) {
+	t.Helper()
+	db := newTestDB(t)
+	key := bytes.Repeat([]byte{1}, utils.KeySize)
+	c, err := utils.NewCipher(utils.CipherXChaCha20Poly1305, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bi, err := utils.NewBlindIndex(bytes.Repeat([]byte{2}, utils.KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	categories := NewEncryptedCategoryRepository(NewCategoryRepository(db), c)
+	notes := NewTransactionalNoteRepository(db, c, bi)
+
+	ids := make(map[string]string)
+	for _, cat := range []struct{ name, parent string }{
+		{"Kerja", ""},
+		{"Proyek", "Kerja"},
+		{"Alpha", "Proyek"},
+		{"Rumah", ""},
+		{"Kosong", ""},
+	} {
+		category := &models.Category{Name: cat.name, ParentID: ids[cat.parent]}
+		if err := categories.Create(category); err != nil {
+			t.Fatal(err)
+		}
+		ids[cat.name] = category.ID
+	}
+
+	created := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	for _, n := range []struct {
+		subject, category string
+		trashedAt         *time.Time
+	}{
+		{"Rapat", "Kerja", nil},
+		{"Lama", "Kerja", &trashedLongAgo},
+		{"Rencana", "Proyek", nil},
+		{"Peluncuran", "Alpha", nil},
+		{"Belanja", "Rumah", nil},
+	} {
+		note := &models.Note{
+			ID:         "note-" + strings.ToLower(n.subject),
+			Subject:    n.subject,
+			Priority:   "medium",
+			CategoryID: ids[n.category],
+			CreatedAt:  created,
+			UpdatedAt:  created,
+			TrashedAt:  n.trashedAt,
+		}
+		if err := notes.Insert(note); err != nil {
+			t.Fatal(err)
+		}
+		ids[n.subject] = note.ID
+	}
+	return db, c, ids
+}
+
+var trashedLongAgo = time.Date(2026, 2, 1, 12, 0, 0, 0, time.UTC)
+
+// noteState returns the category of a note and when it was trashed
+func noteState(t *testing.T, db *sql.DB, id string) (string, *time.Time) {
+	t.Helper()
+	var categoryID sql.NullString
+	var trashedAt sql.NullTime
+	if err := db.QueryRow("SELECT category_id, trashed_at FROM notes WHERE id = ?", id).Scan(&categoryID, &trashedAt); err != nil {
+		t.Fatal(err)
+	}
+	if !trashedAt.Valid {
+		return categoryID.String, nil
+	}
+	return categoryID.String, &trashedAt.Time
+}
+
+func categoryExists(t *testing.T, db *sql.DB, id string) bool {
+	t.Helper()
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM categories WHERE id = ?", id).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n > 0
+}
+
+func TestDeleteCategoryRefuse(t *testing.T) {
+	db, c, ids := categoryDeleteDB(t)
+	refuse := CategoryDeleteOptions{Mode: CategoryDeleteRefuse}
+
+	for _, name := range []string{"Kerja", "Proyek", "Alpha", "Rumah"} {
+		if _, err := DeleteCategory(db, c, ids[name], refuse); !errors.Is(err, utils.ErrCategoryNotEmpty) {
+			t.Errorf("deleting %s = %v, want ErrCategoryNotEmpty", name, err)
+		}
+		if !categoryExists(t, db, ids[name]) {
+			t.Errorf("%s was deleted", name)
+		}
+	}
+
+	result, err := DeleteCategory(db, c, ids["Kosong"], refuse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *result != (CategoryDeleteResult{CategoriesDeleted: 1}) {
+		t.Errorf("result = %+v", result)
+	}
+	if categoryExists(t, db, ids["Kosong"]) {
+		t.Error("empty category was not deleted")
+	}
+
+	// A category whose only note is in the trash counts as empty; the
+	// note stays in the trash without a category
+	if _, err := db.Exec("UPDATE notes SET trashed_at = ? WHERE id = ?", trashedLongAgo, ids["Peluncuran"]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DeleteCategory(db, c, ids["Alpha"], refuse); err != nil {
+		t.Fatal(err)
+	}
+	if category, trashedAt := noteState(t, db, ids["Peluncuran"]); category != "" || trashedAt == nil || !trashedAt.Equal(trashedLongAgo) {
+		t.Errorf("note in the trash is in %q, trashed at %v", category, trashedAt)
+	}
+}
+
+func TestDeleteCategoryMove(t *testing.T) {
+	db, c, ids := categoryDeleteDB(t)
+
+	result, err := DeleteCategory(db, c, ids["Proyek"], CategoryDeleteOptions{Mode: CategoryDeleteMove, TargetID: ids["Rumah"]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *result != (CategoryDeleteResult{CategoriesDeleted: 1, NotesMoved: 1}) {
+		t.Errorf("result = %+v", result)
+	}
+	if category, trashedAt := noteState(t, db, ids["Rencana"]); category != ids["Rumah"] || trashedAt != nil {
+		t.Errorf("note is in %q, trashed at %v, want it moved to Rumah", category, trashedAt)
+	}
+	// The subcategory moves up to the parent with its notes
+	var parent string
+	if err := db.QueryRow("SELECT COALESCE(parent_id, '') FROM categories WHERE id = ?", ids["Alpha"]).Scan(&parent); err != nil {
+		t.Fatal(err)
+	}
+	if parent != ids["Kerja"] {
+		t.Errorf("subcategory moved to %q, want Kerja", parent)
+	}
+	if category, _ := noteState(t, db, ids["Peluncuran"]); category != ids["Alpha"] {
+		t.Errorf("note of the subcategory is in %q", category)
+	}
+}
+
+func TestDeleteCategoryMoveErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		category string
+		target   string
+		want     error
+	}{
+		{"into itself", "Kerja", "Kerja", utils.ErrCategoryMoveTarget},
+		{"to a missing category", "Kerja", "missing", utils.ErrCategoryTargetNotFound},
+		{"missing category", "missing", "Rumah", utils.ErrCategoryNotFound},
+		// Proyek would move up next to the new top-level Proyek
+		{"subcategory name conflict", "Kerja", "Rumah", utils.ErrCategoryNameConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, c, ids := categoryDeleteDB(t)
+			if _, err := db.Exec("INSERT INTO categories (id, name, position) SELECT 'other', name, 9 FROM categories WHERE id = ?", ids["Proyek"]); err != nil {
+				t.Fatal(err)
+			}
+			id, ok := ids[tt.category]
+			if !ok {
+				id = tt.category
+			}
+			target, ok := ids[tt.target]
+			if !ok {
+				target = tt.target
+			}
+
+			_, err := DeleteCategory(db, c, id, CategoryDeleteOptions{Mode: CategoryDeleteMove, TargetID: target})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("DeleteCategory() = %v, want %v", err, tt.want)
+			}
+			// Nothing changes, not even the notes moved before the error
+			if category, _ := noteState(t, db, ids["Rapat"]); category != ids["Kerja"] {
+				t.Errorf("note moved to %q", category)
+			}
+			if !categoryExists(t, db, ids["Kerja"]) {
+				t.Error("category was deleted")
+			}
+		})
+	}
+}
+
+func TestDeleteCategoryTrash(t *testing.T) {
+	db, c, ids := categoryDeleteDB(t)
+	before := time.Now().UTC().Add(-time.Second)
+
+	result, err := DeleteCategory(db, c, ids["Kerja"], CategoryDeleteOptions{Mode: CategoryDeleteTrash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Rapat, Rencana and Peluncuran; Lama was in the trash already
+	if *result != (CategoryDeleteResult{CategoriesDeleted: 3, NotesTrashed: 3}) {
+		t.Errorf("result = %+v", result)
+	}
+	for _, name := range []string{"Kerja", "Proyek", "Alpha"} {
+		if categoryExists(t, db, ids[name]) {
+			t.Errorf("%s was not deleted", name)
+		}
+	}
+	for _, name := range []string{"Rapat", "Rencana", "Peluncuran"} {
+		if category, trashedAt := noteState(t, db, ids[name]); category != "" || trashedAt == nil || trashedAt.Before(before) {
+			t.Errorf("%s is in %q, trashed at %v, want it in the trash now", name, category, trashedAt)
+		}
+	}
+	if category, trashedAt := noteState(t, db, ids["Lama"]); category != "" || trashedAt == nil || !trashedAt.Equal(trashedLongAgo) {
+		t.Errorf("note already in the trash is in %q, trashed at %v, want %v", category, trashedAt, trashedLongAgo)
+	}
+
+	// Other categories are left alone
+	if !categoryExists(t, db, ids["Rumah"]) {
+		t.Error("Rumah was deleted")
+	}
+	if category, trashedAt := noteState(t, db, ids["Belanja"]); category != ids["Rumah"] || trashedAt != nil {
+		t.Errorf("Belanja is in %q, trashed at %v", category, trashedAt)
+	}
+}
+
+func TestDeleteCategoryOptions(t *testing.T) {
+	db, c, ids := categoryDeleteDB(t)
+	for _, opts := range []CategoryDeleteOptions{{}, {Mode: "cascade"}, {Mode: CategoryDeleteMove}} {
+		if _, err := DeleteCategory(db, c, ids["Kosong"], opts); err == nil {
+			t.Errorf("DeleteCategory accepted %+v", opts)
+		}
+	}
+	if !categoryExists(t, db, ids["Kosong"]) {
+		t.Error("category was deleted with invalid options")
+	}
+}
+
+// The database refuses to delete a category its notes or subcategories
+// still point at, which is why DeleteCategory detaches them first
+func TestCategoryForeignKeys(t *testing.T) {
+	db, _, ids := categoryDeleteDB(t)
+	for _, name := range []string{"Rumah", "Proyek"} {
+		_, err := db.Exec("DELETE FROM categories WHERE id = ?", ids[name])
+		if err == nil || !strings.Contains(err.Error(), "FOREIGN KEY") {
+			t.Errorf("deleting %s = %v, want a foreign key error", name, err)
+		}
+	}
+	if _, err := db.Exec("UPDATE notes SET category_id = 'missing' WHERE id = ?", ids["Belanja"]); err == nil {
+		t.Error("a note was moved to a missing category")
+	}
+}
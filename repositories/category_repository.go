@@ -2,6 +2,7 @@ package repositories
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"personal-notes-with-go/models"
 	"personal-notes-with-go/utils"
@@ -12,30 +13,68 @@ import (
 
 type CategoryRepositoryInterface interface {
 	Create(category *models.Category) error
+	// Insert stores a category under the ID it already has
+	Insert(category *models.Category) error
 	GetAll() ([]models.Category, error)
 	GetByID(id string) (*models.Category, error)
+	// Update changes the name, description, color and icon of a category;
+	// its parent is changed with Move and its position with Reorder
 	Update(category *models.Category) error
+	// Move makes parentID the parent of the category, or makes it a
+	// top-level category when parentID is empty. The category is placed
+	// after the subcategories already there.
+	Move(id, parentID string) error
+	// Reorder gives the subcategories of parentID, or the top-level
+	// categories when parentID is empty, the positions of their IDs in ids
+	Reorder(parentID string, ids []string) error
+	// Delete removes a category; its subcategories move up to its parent
 	Delete(id string) error
 }
 
+// categoryRepository stores categories as given; names are encrypted by the
+// decorator returned from NewEncryptedCategoryRepository, which also keeps
+// them unique among the subcategories of a parent
 type categoryRepository struct {
-	db *sql.DB
+	db DBTX
 }
 
-func NewCategoryRepository(db *sql.DB) CategoryRepositoryInterface {
+func NewCategoryRepository(db DBTX) CategoryRepositoryInterface {
 	return &categoryRepository{db: db}
 }
 
+// categoryColumns are the columns read into a category by scanCategory
+const categoryColumns = `id, name, COALESCE(parent_id, ''), description, color, icon, position,
+	(SELECT COUNT(*) FROM notes n WHERE n.category_id = categories.id AND n.trashed_at IS NULL)`
+
+func scanCategory(row interface{ Scan(...any) error }) (models.Category, error) {
+	var cat models.Category
+	err := row.Scan(&cat.ID, &cat.Name, &cat.ParentID, &cat.Description, &cat.Color, &cat.Icon, &cat.Position, &cat.NoteCount)
+	return cat, err
+}
+
+// Create stores a new category after the subcategories of its parent
 func (r *categoryRepository) Create(category *models.Category) error {
+	position, err := r.nextPosition(category.ParentID)
+	if err != nil {
+		return err
+	}
 	category.ID = uuid.New().String()
+	category.Position = position
+	return r.Insert(category)
+}
 
-	// Encrypt name
-	encryptedName, err := utils.Encrypt(category.Name)
-	if err != nil {
-		return fmt.Errorf("failed to encrypt category name: %w", err)
+func (r *categoryRepository) Insert(category *models.Category) error {
+	if category.ID == "" {
+		return fmt.Errorf("failed to create category: missing ID")
+	}
+	if category.ParentID != "" {
+		if err := r.checkParent(category.ID, category.ParentID); err != nil {
+			return err
+		}
 	}
 
-	_, err = r.db.Exec("INSERT INTO categories (id, name) VALUES (?, ?)", category.ID, encryptedName)
+	_, err := r.db.Exec("INSERT INTO categories (id, name, parent_id, description, color, icon, position) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		category.ID, category.Name, nullIfEmpty(category.ParentID), category.Description, category.Color, category.Icon, category.Position)
 	if err != nil {
 		if sqliteErr, ok := err.(sqlite3.Error); ok {
 			if sqliteErr.Code == sqlite3.ErrConstraint {
@@ -48,7 +87,7 @@ func (r *categoryRepository) Create(category *models.Category) error {
 }
 
 func (r *categoryRepository) GetAll() ([]models.Category, error) {
-	rows, err := r.db.Query("SELECT id, name FROM categories")
+	rows, err := r.db.Query("SELECT " + categoryColumns + " FROM categories ORDER BY position")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get categories: %w", err)
 	}
@@ -56,27 +95,17 @@ func (r *categoryRepository) GetAll() ([]models.Category, error) {
 
 	var categories []models.Category
 	for rows.Next() {
-		var cat models.Category
-		var encryptedName string
-		if err := rows.Scan(&cat.ID, &encryptedName); err != nil {
-			return nil, fmt.Errorf("failed to scan category: %w", err)
-		}
-
-		// Decrypt name
-		cat.Name, err = utils.Decrypt(encryptedName)
+		cat, err := scanCategory(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to decrypt category name: %w", err)
+			return nil, fmt.Errorf("failed to scan category: %w", err)
 		}
-
 		categories = append(categories, cat)
 	}
-	return categories, nil
+	return categories, rows.Err()
 }
 
 func (r *categoryRepository) GetByID(id string) (*models.Category, error) {
-	var category models.Category
-	var encryptedName string
-	err := r.db.QueryRow("SELECT id, name FROM categories WHERE id = ?", id).Scan(&category.ID, &encryptedName)
+	category, err := scanCategory(r.db.QueryRow("SELECT "+categoryColumns+" FROM categories WHERE id = ?", id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, utils.ErrCategoryNotFound
@@ -84,23 +113,12 @@ func (r *categoryRepository) GetByID(id string) (*models.Category, error) {
 		return nil, fmt.Errorf("failed to get category: %w", err)
 	}
 
-	// Decrypt name
-	category.Name, err = utils.Decrypt(encryptedName)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt category name: %w", err)
-	}
-
 	return &category, nil
 }
 
 func (r *categoryRepository) Update(category *models.Category) error {
-	// Encrypt name
-	encryptedName, err := utils.Encrypt(category.Name)
-	if err != nil {
-		return fmt.Errorf("failed to encrypt category name: %w", err)
-	}
-
-	result, err := r.db.Exec("UPDATE categories SET name = ? WHERE id = ?", encryptedName, category.ID)
+	result, err := r.db.Exec("UPDATE categories SET name = ?, description = ?, color = ?, icon = ? WHERE id = ?",
+		category.Name, category.Description, category.Color, category.Icon, category.ID)
 	if err != nil {
 		if sqliteErr, ok := err.(sqlite3.Error); ok {
 			if sqliteErr.Code == sqlite3.ErrConstraint {
@@ -121,7 +139,139 @@ func (r *categoryRepository) Update(category *models.Category) error {
 	return nil
 }
 
+func (r *categoryRepository) Move(id, parentID string) error {
+	category, err := r.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if category.ParentID == parentID {
+		return nil
+	}
+	if parentID != "" {
+		if err := r.checkParent(id, parentID); err != nil {
+			return err
+		}
+	}
+	position, err := r.nextPosition(parentID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.db.Exec("UPDATE categories SET parent_id = ?, position = ? WHERE id = ?", nullIfEmpty(parentID), position, id); err != nil {
+		return fmt.Errorf("failed to move category: %w", err)
+	}
+	return nil
+}
+
+// Reorder refuses with ErrCategoryOrderMismatch unless ids are exactly the
+// subcategories of parentID, each listed once
+func (r *categoryRepository) Reorder(parentID string, ids []string) error {
+	if parentID != "" {
+		if _, err := r.GetByID(parentID); err != nil {
+			if errors.Is(err, utils.ErrCategoryNotFound) {
+				return utils.ErrCategoryParentNotFound
+			}
+			return err
+		}
+	}
+
+	rows, err := r.db.Query("SELECT id FROM categories WHERE COALESCE(parent_id, '') = ?", parentID)
+	if err != nil {
+		return fmt.Errorf("failed to get subcategories: %w", err)
+	}
+	siblings := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan category: %w", err)
+		}
+		siblings[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to get subcategories: %w", err)
+	}
+
+	if len(ids) != len(siblings) {
+		return fmt.Errorf("%w: got %d ID(s) for %d subcategory(ies)", utils.ErrCategoryOrderMismatch, len(ids), len(siblings))
+	}
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if !siblings[id] || seen[id] {
+			return fmt.Errorf("%w: unexpected or repeated ID %s", utils.ErrCategoryOrderMismatch, id)
+		}
+		seen[id] = true
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	// A single statement, so the positions change together without a
+	// transaction of their own
+	query := "UPDATE categories SET position = CASE id"
+	args := make([]interface{}, 0, 2*len(ids)+1)
+	for i, id := range ids {
+		query += " WHEN ? THEN ?"
+		args = append(args, id, i)
+	}
+	query += " END WHERE COALESCE(parent_id, '') = ?"
+	args = append(args, parentID)
+	if _, err := r.db.Exec(query, args...); err != nil {
+		return fmt.Errorf("failed to reorder categories: %w", err)
+	}
+	return nil
+}
+
+// nextPosition returns the position after the last subcategory of parentID
+func (r *categoryRepository) nextPosition(parentID string) (int, error) {
+	var position int
+	err := r.db.QueryRow("SELECT COALESCE(MAX(position) + 1, 0) FROM categories WHERE COALESCE(parent_id, '') = ?", parentID).Scan(&position)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get category position: %w", err)
+	}
+	return position, nil
+}
+
+// checkParent checks that parentID exists and that making it the parent of
+// the category id would not make the category its own ancestor
+func (r *categoryRepository) checkParent(id, parentID string) error {
+	if _, err := r.GetByID(parentID); err != nil {
+		if errors.Is(err, utils.ErrCategoryNotFound) {
+			return utils.ErrCategoryParentNotFound
+		}
+		return err
+	}
+
+	// UNION rather than UNION ALL stops the walk should the stored parents
+	// already contain a cycle
+	var count int
+	err := r.db.QueryRow(`
+		WITH RECURSIVE ancestors(id) AS (
+			SELECT ?
+			UNION
+			SELECT c.parent_id FROM categories c JOIN ancestors a ON c.id = a.id WHERE c.parent_id IS NOT NULL
+		)
+		SELECT COUNT(*) FROM ancestors WHERE id = ?`, parentID, id).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to check category parent: %w", err)
+	}
+	if count > 0 {
+		return utils.ErrCategoryCycle
+	}
+	return nil
+}
+
 func (r *categoryRepository) Delete(id string) error {
+	category, err := r.GetByID(id)
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.db.Exec("UPDATE categories SET parent_id = ? WHERE parent_id = ?", nullIfEmpty(category.ParentID), id); err != nil {
+		return fmt.Errorf("failed to move subcategories: %w", err)
+	}
+
 	result, err := r.db.Exec("DELETE FROM categories WHERE id = ?", id)
 	if err != nil {
 		return fmt.Errorf("failed to delete category: %w", err)
@@ -0,0 +1,187 @@
+package repositories
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/utils"
+)
+
+// newTestCategories returns the encrypted category repository on a new
+// database, holding
+//
+//	Kerja
+//	  Proyek
+//	    Alpha
+//	Rumah
+//	  Dapur
+//
+// and the IDs of those categories by name
+func newTestCategories(t *testing.T) (CategoryRepositoryInterface, map[string]string) {
+	t.Helper()
+	c, err := utils.NewCipher(utils.CipherXChaCha20Poly1305, bytes.Repeat([]byte{1}, utils.KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	categories := NewEncryptedCategoryRepository(NewCategoryRepository(newTestDB(t)), c)
+
+	ids := make(map[string]string)
+	for _, cat := range []struct{ name, parent string }{
+		{"Kerja", ""},
+		{"Proyek", "Kerja"},
+		{"Alpha", "Proyek"},
+		{"Rumah", ""},
+		{"Dapur", "Rumah"},
+	} {
+		category := &models.Category{Name: cat.name, ParentID: ids[cat.parent]}
+		if err := categories.Create(category); err != nil {
+			t.Fatal(err)
+		}
+		ids[cat.name] = category.ID
+	}
+	return categories, ids
+}
+
+// parentOf returns the name of the parent of the category with ID id
+func parentOf(t *testing.T, categories CategoryRepositoryInterface, id string) string {
+	t.Helper()
+	cat, err := categories.GetByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cat.ParentID == "" {
+		return ""
+	}
+	parent, err := categories.GetByID(cat.ParentID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parent.Name
+}
+
+func TestMoveCategory(t *testing.T) {
+	tests := []struct {
+		name       string
+		move       string
+		to         string
+		err        error
+		wantParent string
+	}{
+		{"under another parent", "Proyek", "Rumah", nil, "Rumah"},
+		{"to the top level", "Alpha", "", nil, ""},
+		{"under its own parent", "Alpha", "Proyek", nil, "Proyek"},
+		{"under an unrelated leaf", "Rumah", "Alpha", nil, "Alpha"},
+		{"under itself", "Kerja", "Kerja", utils.ErrCategoryCycle, ""},
+		{"under its subcategory", "Kerja", "Proyek", utils.ErrCategoryCycle, ""},
+		{"under a deeper descendant", "Kerja", "Alpha", utils.ErrCategoryCycle, ""},
+		{"leaf under itself", "Alpha", "Alpha", utils.ErrCategoryCycle, "Proyek"},
+		{"under a missing parent", "Dapur", "missing", utils.ErrCategoryParentNotFound, "Rumah"},
+		{"missing category", "missing", "Rumah", utils.ErrCategoryNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			categories, ids := newTestCategories(t)
+			id, ok := ids[tt.move]
+			if !ok {
+				id = tt.move
+			}
+			to, ok := ids[tt.to]
+			if !ok {
+				to = tt.to
+			}
+
+			err := categories.Move(id, to)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Move() = %v, want %v", err, tt.err)
+			}
+			if tt.err == utils.ErrCategoryNotFound {
+				return
+			}
+			if got := parentOf(t, categories, id); got != tt.wantParent {
+				t.Errorf("parent = %q, want %q", got, tt.wantParent)
+			}
+		})
+	}
+}
+
+func TestMoveCategoryPlacesItLast(t *testing.T) {
+	categories, ids := newTestCategories(t)
+	if err := categories.Move(ids["Dapur"], ids["Kerja"]); err != nil {
+		t.Fatal(err)
+	}
+	proyek, err := categories.GetByID(ids["Proyek"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	dapur, err := categories.GetByID(ids["Dapur"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dapur.Position <= proyek.Position {
+		t.Errorf("moved category is at %d, before the existing subcategory at %d", dapur.Position, proyek.Position)
+	}
+}
+
+func TestCategoryNamesAreUniquePerParent(t *testing.T) {
+	categories, ids := newTestCategories(t)
+
+	// The same name is fine under another parent
+	other := &models.Category{Name: "proyek", ParentID: ids["Rumah"]}
+	if err := categories.Create(other); err != nil {
+		t.Fatalf("Create under another parent: %v", err)
+	}
+	for _, name := range []string{"Alpha", "Proyek"} {
+		if err := categories.Create(&models.Category{Name: name}); err != nil {
+			t.Fatalf("Create at the top level: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		fn   func() error
+	}{
+		{"create next to the same name", func() error {
+			return categories.Create(&models.Category{Name: " PROYEK ", ParentID: ids["Kerja"]})
+		}},
+		{"create at the top level", func() error {
+			return categories.Create(&models.Category{Name: "kerja"})
+		}},
+		{"rename to a sibling's name", func() error {
+			return categories.Update(&models.Category{ID: ids["Rumah"], Name: "Kerja"})
+		}},
+		{"move next to the same name", func() error {
+			return categories.Move(other.ID, ids["Kerja"])
+		}},
+		{"move to the top level next to the same name", func() error {
+			return categories.Move(ids["Alpha"], "")
+		}},
+		{"delete moving a subcategory up next to the same name", func() error {
+			return categories.Delete(ids["Kerja"])
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.fn(); !errors.Is(err, utils.ErrCategoryNameConflict) {
+				t.Errorf("got %v, want ErrCategoryNameConflict", err)
+			}
+		})
+	}
+
+	if got := parentOf(t, categories, other.ID); got != "Rumah" {
+		t.Errorf("refused move left the category under %q", got)
+	}
+	if got := parentOf(t, categories, ids["Alpha"]); got != "Proyek" {
+		t.Errorf("refused move left the category under %q", got)
+	}
+	if _, err := categories.GetByID(ids["Kerja"]); err != nil {
+		t.Errorf("refused delete removed the category: %v", err)
+	}
+
+	// Renaming a category to its own name, in another case, is not a
+	// conflict
+	if err := categories.Update(&models.Category{ID: ids["Rumah"], Name: "RUMAH"}); err != nil {
+		t.Errorf("Update to the same name: %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/utils"
+
+	"github.com/google/uuid"
+)
+
+type ChecklistRepositoryInterface interface {
+	// Create stores a new item after the items already on the checklist of
+	// its note
+	Create(item *models.ChecklistItem) error
+	// Insert stores an item under the ID and position it already has
+	Insert(item *models.ChecklistItem) error
+	// GetByNoteID returns the checklist of a note in order
+	GetByNoteID(noteID string) ([]models.ChecklistItem, error)
+	GetByID(id string) (*models.ChecklistItem, error)
+	// Update changes the text of an item and whether it is checked; its
+	// position is changed with Reorder
+	Update(item *models.ChecklistItem) error
+	SetChecked(id string, checked bool) error
+	// Reorder gives the items of the checklist of a note the positions of
+	// their IDs in ids
+	Reorder(noteID string, ids []string) error
+	Delete(id string) error
+	// Uncheck unchecks every item of the checklist of a note
+	Uncheck(noteID string) error
+}
+
+// checklistRepository stores checklist items as given; their text is
+// encrypted by the decorator returned from NewEncryptedChecklistRepository
+type checklistRepository struct {
+	db DBTX
+}
+
+func NewChecklistRepository(db DBTX) ChecklistRepositoryInterface {
+	return &checklistRepository{db: db}
+}
+
+// checklistColumns are the columns read into an item by scanChecklistItem
+const checklistColumns = "id, note_id, text, checked, position"
+
+func scanChecklistItem(row interface{ Scan(...any) error }) (models.ChecklistItem, error) {
+	var item models.ChecklistItem
+	err := row.Scan(&item.ID, &item.NoteID, &item.Text, &item.Checked, &item.Position)
+	return item, err
+}
+
+func (r *checklistRepository) Create(item *models.ChecklistItem) error {
+	var position int
+	err := r.db.QueryRow("SELECT COALESCE(MAX(position) + 1, 0) FROM checklist_items WHERE note_id = ?", item.NoteID).Scan(&position)
+	if err != nil {
+		return fmt.Errorf("failed to get checklist position: %w", err)
+	}
+	item.ID = uuid.New().String()
+	item.Position = position
+	return r.Insert(item)
+}
+
+func (r *checklistRepository) Insert(item *models.ChecklistItem) error {
+	if item.ID == "" {
+		return fmt.Errorf("failed to create checklist item: missing ID")
+	}
+
+	_, err := r.db.Exec("INSERT INTO checklist_items (id, note_id, text, checked, position) VALUES (?, ?, ?, ?, ?)",
+		item.ID, item.NoteID, item.Text, item.Checked, item.Position)
+	if err != nil {
+		if isForeignKeyError(err) {
+			return utils.ErrNoteNotFound
+		}
+		return fmt.Errorf("failed to create checklist item: %w", err)
+	}
+	return nil
+}
+
+func (r *checklistRepository) GetByNoteID(noteID string) ([]models.ChecklistItem, error) {
+	rows, err := r.db.Query("SELECT "+checklistColumns+" FROM checklist_items WHERE note_id = ? ORDER BY position", noteID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get checklist: %w", err)
+	}
+	defer rows.Close()
+
+	items := []models.ChecklistItem{}
+	for rows.Next() {
+		item, err := scanChecklistItem(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan checklist item: %w", err)
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func (r *checklistRepository) GetByID(id string) (*models.ChecklistItem, error) {
+	item, err := scanChecklistItem(r.db.QueryRow("SELECT "+checklistColumns+" FROM checklist_items WHERE id = ?", id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, utils.ErrChecklistItemNotFound
+		}
+		return nil, fmt.Errorf("failed to get checklist item: %w", err)
+	}
+	return &item, nil
+}
+
+func (r *checklistRepository) Update(item *models.ChecklistItem) error {
+	result, err := r.db.Exec("UPDATE checklist_items SET text = ?, checked = ? WHERE id = ?", item.Text, item.Checked, item.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update checklist item: %w", err)
+	}
+	return checklistItemAffected(result)
+}
+
+func (r *checklistRepository) SetChecked(id string, checked bool) error {
+	result, err := r.db.Exec("UPDATE checklist_items SET checked = ? WHERE id = ?", checked, id)
+	if err != nil {
+		return fmt.Errorf("failed to update checklist item: %w", err)
+	}
+	return checklistItemAffected(result)
+}
+
+func (r *checklistRepository) Reorder(noteID string, ids []string) error {
+	items, err := r.GetByNoteID(noteID)
+	if err != nil {
+		return err
+	}
+	if len(ids) != len(items) {
+		return fmt.Errorf("%w: got %d ID(s) for %d item(s)", utils.ErrChecklistOrderMismatch, len(ids), len(items))
+	}
+	onList := make(map[string]bool, len(items))
+	for _, item := range items {
+		onList[item.ID] = true
+	}
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if !onList[id] || seen[id] {
+			return fmt.Errorf("%w: unexpected or repeated ID %s", utils.ErrChecklistOrderMismatch, id)
+		}
+		seen[id] = true
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	// A single statement, so the positions change together without a
+	// transaction of their own
+	query := "UPDATE checklist_items SET position = CASE id"
+	args := make([]interface{}, 0, 2*len(ids)+1)
+	for i, id := range ids {
+		query += " WHEN ? THEN ?"
+		args = append(args, id, i)
+	}
+	query += " END WHERE note_id = ?"
+	args = append(args, noteID)
+	if _, err := r.db.Exec(query, args...); err != nil {
+		return fmt.Errorf("failed to reorder checklist: %w", err)
+	}
+	return nil
+}
+
+func (r *checklistRepository) Delete(id string) error {
+	result, err := r.db.Exec("DELETE FROM checklist_items WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete checklist item: %w", err)
+	}
+	return checklistItemAffected(result)
+}
+
+func (r *checklistRepository) Uncheck(noteID string) error {
+	if _, err := r.db.Exec("UPDATE checklist_items SET checked = 0 WHERE note_id = ?", noteID); err != nil {
+		return fmt.Errorf("failed to uncheck checklist: %w", err)
+	}
+	return nil
+}
+
+// checklistItemAffected returns ErrChecklistItemNotFound when result
+// changed no item
+func checklistItemAffected(result sql.Result) error {
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rowsAffected == 0 {
+		return utils.ErrChecklistItemNotFound
+	}
+	return nil
+}
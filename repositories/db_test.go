@@ -0,0 +1,21 @@
+package repositories
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"personal-notes-with-go/database"
+)
+
+// newTestDB returns a new, migrated database that is closed at the end of
+// the test
+func newTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := database.InitDB(filepath.Join(t.TempDir(), "db.sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
@@ -0,0 +1,11 @@
+package repositories
+
+import "database/sql"
+
+// DBTX is implemented by both *sql.DB and *sql.Tx, so a repository can be
+// created for a transaction when several changes must succeed together
+type DBTX interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
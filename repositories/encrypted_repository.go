@@ -0,0 +1,650 @@
+package repositories
+
+import (
+	"fmt"
+	"log"
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/utils"
+	"strings"
+	"time"
+)
+
+// encryptedNoteRepository encrypts the sensitive fields of a note before
+// they reach the wrapped repository and decrypts them on the way back, so
+// callers only ever see plaintext and the database only ever sees ciphertext.
+// It also computes the blind indexes that let the database search notes.
+type encryptedNoteRepository struct {
+	inner  NoteRepositoryInterface
+	cipher utils.Cipher
+	index  *utils.BlindIndex
+}
+
+// NewEncryptedNoteRepository wraps inner with field encryption using c and
+// blind indexes computed with index
+func NewEncryptedNoteRepository(inner NoteRepositoryInterface, c utils.Cipher, index *utils.BlindIndex) NoteRepositoryInterface {
+	return &encryptedNoteRepository{inner: inner, cipher: c, index: index}
+}
+
+func (r *encryptedNoteRepository) Create(note *models.Note) error {
+	stored, err := r.encryptNote(note)
+	if err != nil {
+		return err
+	}
+	if err := r.inner.Create(stored); err != nil {
+		return err
+	}
+	note.ID = stored.ID
+	note.CreatedAt, note.UpdatedAt = stored.CreatedAt, stored.UpdatedAt
+	return nil
+}
+
+func (r *encryptedNoteRepository) Insert(note *models.Note) error {
+	stored, err := r.encryptNote(note)
+	if err != nil {
+		return err
+	}
+	if err := r.inner.Insert(stored); err != nil {
+		return err
+	}
+	note.CreatedAt, note.UpdatedAt = stored.CreatedAt, stored.UpdatedAt
+	return nil
+}
+
+func (r *encryptedNoteRepository) GetAll() ([]*models.Note, error) {
+	notes, err := r.inner.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	return r.decryptNotes(notes), nil
+}
+
+func (r *encryptedNoteRepository) GetByID(id string) (*models.Note, error) {
+	note, err := r.inner.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.decryptNote(note); err != nil {
+		return nil, err
+	}
+	return note, nil
+}
+
+func (r *encryptedNoteRepository) Update(note *models.Note) error {
+	stored, err := r.encryptNote(note)
+	if err != nil {
+		return err
+	}
+	if err := r.inner.Update(stored); err != nil {
+		return err
+	}
+	note.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+func (r *encryptedNoteRepository) Delete(id string) error {
+	return r.inner.Delete(id)
+}
+
+func (r *encryptedNoteRepository) Restore(id string) error {
+	return r.inner.Restore(id)
+}
+
+func (r *encryptedNoteRepository) SetState(id string, state models.NoteState, on bool) error {
+	return r.inner.SetState(id, state, on)
+}
+
+func (r *encryptedNoteRepository) SetReminder(id string, remindAt *time.Time) error {
+	return r.inner.SetReminder(id, remindAt)
+}
+
+func (r *encryptedNoteRepository) MarkReminded(id string, at time.Time) error {
+	return r.inner.MarkReminded(id, at)
+}
+
+func (r *encryptedNoteRepository) GetByCategoryID(categoryID string) ([]*models.Note, error) {
+	notes, err := r.inner.GetByCategoryID(categoryID)
+	if err != nil {
+		return nil, err
+	}
+	return r.decryptNotes(notes), nil
+}
+
+func (r *encryptedNoteRepository) GetFiltered(filter models.NoteFilter) ([]*models.Note, error) {
+	if r.index == nil && (filter.Subject != "" || len(filter.Words) > 0) {
+		return nil, fmt.Errorf("failed to search notes: blind index is not initialized")
+	}
+	if filter.Subject != "" {
+		filter.SubjectIndex = r.index.Hash(utils.BlindIndexSubject, filter.Subject)
+	}
+	for _, words := range filter.Words {
+		filter.WordIndexes = append(filter.WordIndexes, r.index.Words(words)...)
+	}
+	notes, err := r.inner.GetFiltered(filter)
+	if err != nil {
+		return nil, err
+	}
+	return r.decryptNotes(notes), nil
+}
+
+// noteField points at one of the encrypted fields of a note
+type noteField struct {
+	name  string
+	value *string
+}
+
+// noteFields returns the encrypted fields of a note
+func noteFields(note *models.Note) []noteField {
+	return []noteField{
+		{"subject", &note.Subject},
+		{"content", &note.Content},
+		{"tags", &note.Tags},
+	}
+}
+
+// encryptNote returns a copy of note with its sensitive fields encrypted
+// and its blind indexes set, leaving the caller's note in plaintext
+func (r *encryptedNoteRepository) encryptNote(note *models.Note) (*models.Note, error) {
+	stored := *note
+	stored.SubjectIndex, stored.WordIndexes = noteIndexes(r.index, note)
+	for _, field := range noteFields(&stored) {
+		encrypted, err := r.cipher.Encrypt(*field.value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encrypt note %s: %w", field.name, err)
+		}
+		*field.value = encrypted
+	}
+	return &stored, nil
+}
+
+// noteIndexes returns the blind indexes of the subject and of the words of
+// a plaintext note
+func noteIndexes(index *utils.BlindIndex, note *models.Note) (string, []string) {
+	return index.Hash(utils.BlindIndexSubject, note.Subject), index.Words(note.Subject + "\n" + note.Content)
+}
+
+// decryptNote decrypts the sensitive fields of a note in place
+func (r *encryptedNoteRepository) decryptNote(note *models.Note) error {
+	for _, field := range noteFields(note) {
+		decrypted, err := r.cipher.Decrypt(*field.value)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt %s of note %s: %w", field.name, note.ID, err)
+		}
+		*field.value = decrypted
+	}
+	return nil
+}
+
+// decryptNotes decrypts a list of notes. A note that cannot be decrypted is
+// logged and left out so that one damaged row does not hide all the others.
+func (r *encryptedNoteRepository) decryptNotes(notes []*models.Note) []*models.Note {
+	var decrypted []*models.Note
+	for _, note := range notes {
+		if err := r.decryptNote(note); err != nil {
+			log.Printf("Skipping note: %v", err)
+			continue
+		}
+		decrypted = append(decrypted, note)
+	}
+	return decrypted
+}
+
+// encryptedCategoryRepository encrypts category names and descriptions in
+// the same way.
+// Encrypted names cannot be compared in SQL, so it also keeps names unique,
+// ignoring case, among the subcategories of each parent.
+type encryptedCategoryRepository struct {
+	inner  CategoryRepositoryInterface
+	cipher utils.Cipher
+}
+
+// NewEncryptedCategoryRepository wraps inner with name and description
+// encryption using c
+func NewEncryptedCategoryRepository(inner CategoryRepositoryInterface, c utils.Cipher) CategoryRepositoryInterface {
+	return &encryptedCategoryRepository{inner: inner, cipher: c}
+}
+
+func (r *encryptedCategoryRepository) Create(category *models.Category) error {
+	if err := r.checkName(category.ParentID, category.Name, ""); err != nil {
+		return err
+	}
+	stored, err := r.encryptCategory(category)
+	if err != nil {
+		return err
+	}
+	if err := r.inner.Create(stored); err != nil {
+		return err
+	}
+	category.ID = stored.ID
+	category.Position = stored.Position
+	return nil
+}
+
+func (r *encryptedCategoryRepository) Insert(category *models.Category) error {
+	if err := r.checkName(category.ParentID, category.Name, category.ID); err != nil {
+		return err
+	}
+	stored, err := r.encryptCategory(category)
+	if err != nil {
+		return err
+	}
+	return r.inner.Insert(stored)
+}
+
+func (r *encryptedCategoryRepository) GetAll() ([]models.Category, error) {
+	categories, err := r.inner.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for i := range categories {
+		if err := r.decryptCategory(&categories[i]); err != nil {
+			return nil, err
+		}
+	}
+	return categories, nil
+}
+
+func (r *encryptedCategoryRepository) GetByID(id string) (*models.Category, error) {
+	category, err := r.inner.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.decryptCategory(category); err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+func (r *encryptedCategoryRepository) Update(category *models.Category) error {
+	existing, err := r.inner.GetByID(category.ID)
+	if err != nil {
+		return err
+	}
+	if err := r.checkName(existing.ParentID, category.Name, category.ID); err != nil {
+		return err
+	}
+	stored, err := r.encryptCategory(category)
+	if err != nil {
+		return err
+	}
+	if err := r.inner.Update(stored); err != nil {
+		return err
+	}
+	category.ParentID = existing.ParentID
+	return nil
+}
+
+func (r *encryptedCategoryRepository) Move(id, parentID string) error {
+	category, err := r.GetByID(id)
+	if err != nil {
+		return err
+	}
+	if err := r.checkName(parentID, category.Name, id); err != nil {
+		return err
+	}
+	return r.inner.Move(id, parentID)
+}
+
+func (r *encryptedCategoryRepository) Reorder(parentID string, ids []string) error {
+	return r.inner.Reorder(parentID, ids)
+}
+
+// Delete refuses with ErrCategoryNameConflict when a subcategory moving up
+// to the parent has the name of one of the subcategories already there
+func (r *encryptedCategoryRepository) Delete(id string) error {
+	categories, err := r.GetAll()
+	if err != nil {
+		return err
+	}
+	var deleted *models.Category
+	for i := range categories {
+		if categories[i].ID == id {
+			deleted = &categories[i]
+		}
+	}
+	if deleted == nil {
+		return utils.ErrCategoryNotFound
+	}
+
+	siblings := make(map[string]bool)
+	for _, cat := range categories {
+		if cat.ParentID == deleted.ParentID && cat.ID != id {
+			siblings[categoryNameKey(cat.Name)] = true
+		}
+	}
+	for _, cat := range categories {
+		if cat.ParentID == id && siblings[categoryNameKey(cat.Name)] {
+			return fmt.Errorf("%w: subcategory %q cannot move up next to a category of the same name", utils.ErrCategoryNameConflict, cat.Name)
+		}
+	}
+	return r.inner.Delete(id)
+}
+
+// checkName checks that name is not empty and that no subcategory of
+// parentID other than the category excludeID has the same name
+func (r *encryptedCategoryRepository) checkName(parentID, name, excludeID string) error {
+	if strings.TrimSpace(name) == "" {
+		return utils.ErrCategoryNameEmpty
+	}
+	categories, err := r.GetAll()
+	if err != nil {
+		return err
+	}
+	for _, cat := range categories {
+		if cat.ParentID == parentID && cat.ID != excludeID && categoryNameKey(cat.Name) == categoryNameKey(name) {
+			return utils.ErrCategoryNameConflict
+		}
+	}
+	return nil
+}
+
+// categoryNameKey is the form in which category names are compared
+func categoryNameKey(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+// encryptCategory returns a copy of category with its name and
+// description encrypted
+func (r *encryptedCategoryRepository) encryptCategory(category *models.Category) (*models.Category, error) {
+	stored := *category
+	encryptedName, err := r.cipher.Encrypt(category.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt category name: %w", err)
+	}
+	encryptedDescription, err := r.cipher.Encrypt(category.Description)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt category description: %w", err)
+	}
+	stored.Name = encryptedName
+	stored.Description = encryptedDescription
+	return &stored, nil
+}
+
+// decryptCategory decrypts the name and description of a category in place
+func (r *encryptedCategoryRepository) decryptCategory(category *models.Category) error {
+	name, err := r.cipher.Decrypt(category.Name)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt category name: %w", err)
+	}
+	description, err := r.cipher.Decrypt(category.Description)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt category description: %w", err)
+	}
+	category.Name = name
+	category.Description = description
+	return nil
+}
+
+// encryptedTagRepository encrypts tag names in the same way. Encrypted
+// names cannot be compared in SQL, so tags are looked up by name through
+// the blind index of the name, which also keeps names unique.
+type encryptedTagRepository struct {
+	inner  TagRepositoryInterface
+	cipher utils.Cipher
+	index  *utils.BlindIndex
+}
+
+// NewEncryptedTagRepository wraps inner with name encryption using c and
+// name indexes computed with index
+func NewEncryptedTagRepository(inner TagRepositoryInterface, c utils.Cipher, index *utils.BlindIndex) TagRepositoryInterface {
+	return &encryptedTagRepository{inner: inner, cipher: c, index: index}
+}
+
+func (r *encryptedTagRepository) Create(tag *models.Tag) error {
+	if err := r.checkName(tag); err != nil {
+		return err
+	}
+	stored, err := r.encryptTag(tag)
+	if err != nil {
+		return err
+	}
+	if err := r.inner.Create(stored); err != nil {
+		return err
+	}
+	tag.ID = stored.ID
+	return nil
+}
+
+func (r *encryptedTagRepository) GetAll() ([]models.Tag, error) {
+	tags, err := r.inner.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for i := range tags {
+		if err := r.decryptTag(&tags[i]); err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
+
+func (r *encryptedTagRepository) GetByID(id string) (*models.Tag, error) {
+	tag, err := r.inner.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.decryptTag(tag); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+func (r *encryptedTagRepository) GetByName(name string) (*models.Tag, error) {
+	return r.GetByNameIndex(r.index.Hash(utils.BlindIndexTag, name))
+}
+
+func (r *encryptedTagRepository) GetByNameIndex(index string) (*models.Tag, error) {
+	tag, err := r.inner.GetByNameIndex(index)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.decryptTag(tag); err != nil {
+		return nil, err
+	}
+	return tag, nil
+}
+
+func (r *encryptedTagRepository) Update(tag *models.Tag) error {
+	if err := r.checkName(tag); err != nil {
+		return err
+	}
+	stored, err := r.encryptTag(tag)
+	if err != nil {
+		return err
+	}
+	return r.inner.Update(stored)
+}
+
+func (r *encryptedTagRepository) Delete(id string) error {
+	return r.inner.Delete(id)
+}
+
+func (r *encryptedTagRepository) Merge(sourceID, targetID string) error {
+	return r.inner.Merge(sourceID, targetID)
+}
+
+func (r *encryptedTagRepository) DeleteUnused() (int64, error) {
+	return r.inner.DeleteUnused()
+}
+
+func (r *encryptedTagRepository) GetNoteTags(noteID string) ([]models.Tag, error) {
+	tags, err := r.inner.GetNoteTags(noteID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range tags {
+		if err := r.decryptTag(&tags[i]); err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
+
+func (r *encryptedTagRepository) GetAllNoteTags() (map[string][]models.Tag, error) {
+	byNote, err := r.inner.GetAllNoteTags()
+	if err != nil {
+		return nil, err
+	}
+	// Notes share tags, so each name is decrypted once
+	names := make(map[string]string)
+	for _, tags := range byNote {
+		for i := range tags {
+			name, ok := names[tags[i].ID]
+			if !ok {
+				if err := r.decryptTag(&tags[i]); err != nil {
+					return nil, err
+				}
+				names[tags[i].ID] = tags[i].Name
+				continue
+			}
+			tags[i].Name = name
+		}
+	}
+	return byNote, nil
+}
+
+func (r *encryptedTagRepository) SetNoteTags(noteID string, tagIDs []string) error {
+	return r.inner.SetNoteTags(noteID, tagIDs)
+}
+
+// checkName trims the name of tag and makes sure no other tag has it
+func (r *encryptedTagRepository) checkName(tag *models.Tag) error {
+	tag.Name = strings.TrimSpace(tag.Name)
+	if tag.Name == "" {
+		return utils.ErrTagNameEmpty
+	}
+	existing, err := r.GetByName(tag.Name)
+	if err != nil && err != utils.ErrTagNotFound {
+		return err
+	}
+	if existing != nil && existing.ID != tag.ID {
+		return utils.ErrTagNameConflict
+	}
+	return nil
+}
+
+// encryptTag returns a copy of tag with its name encrypted and indexed
+func (r *encryptedTagRepository) encryptTag(tag *models.Tag) (*models.Tag, error) {
+	stored := *tag
+	stored.NameIndex = r.index.Hash(utils.BlindIndexTag, tag.Name)
+	encryptedName, err := r.cipher.Encrypt(tag.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt tag name: %w", err)
+	}
+	stored.Name = encryptedName
+	return &stored, nil
+}
+
+// decryptTag decrypts the name of a tag in place
+func (r *encryptedTagRepository) decryptTag(tag *models.Tag) error {
+	name, err := r.cipher.Decrypt(tag.Name)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt tag name: %w", err)
+	}
+	tag.Name = name
+	return nil
+}
+
+// encryptedChecklistRepository encrypts the text of checklist items, like
+// the content of their note, and refuses items without text
+type encryptedChecklistRepository struct {
+	inner  ChecklistRepositoryInterface
+	cipher utils.Cipher
+}
+
+// NewEncryptedChecklistRepository wraps inner with text encryption using c
+func NewEncryptedChecklistRepository(inner ChecklistRepositoryInterface, c utils.Cipher) ChecklistRepositoryInterface {
+	return &encryptedChecklistRepository{inner: inner, cipher: c}
+}
+
+func (r *encryptedChecklistRepository) Create(item *models.ChecklistItem) error {
+	stored, err := r.encryptItem(item)
+	if err != nil {
+		return err
+	}
+	if err := r.inner.Create(stored); err != nil {
+		return err
+	}
+	item.ID, item.Position = stored.ID, stored.Position
+	return nil
+}
+
+func (r *encryptedChecklistRepository) Insert(item *models.ChecklistItem) error {
+	stored, err := r.encryptItem(item)
+	if err != nil {
+		return err
+	}
+	return r.inner.Insert(stored)
+}
+
+func (r *encryptedChecklistRepository) GetByNoteID(noteID string) ([]models.ChecklistItem, error) {
+	items, err := r.inner.GetByNoteID(noteID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		if err := r.decryptItem(&items[i]); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
+func (r *encryptedChecklistRepository) GetByID(id string) (*models.ChecklistItem, error) {
+	item, err := r.inner.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.decryptItem(item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (r *encryptedChecklistRepository) Update(item *models.ChecklistItem) error {
+	stored, err := r.encryptItem(item)
+	if err != nil {
+		return err
+	}
+	return r.inner.Update(stored)
+}
+
+func (r *encryptedChecklistRepository) SetChecked(id string, checked bool) error {
+	return r.inner.SetChecked(id, checked)
+}
+
+func (r *encryptedChecklistRepository) Reorder(noteID string, ids []string) error {
+	return r.inner.Reorder(noteID, ids)
+}
+
+func (r *encryptedChecklistRepository) Delete(id string) error {
+	return r.inner.Delete(id)
+}
+
+func (r *encryptedChecklistRepository) Uncheck(noteID string) error {
+	return r.inner.Uncheck(noteID)
+}
+
+// encryptItem returns a copy of item with its trimmed text encrypted
+func (r *encryptedChecklistRepository) encryptItem(item *models.ChecklistItem) (*models.ChecklistItem, error) {
+	item.Text = strings.TrimSpace(item.Text)
+	if item.Text == "" {
+		return nil, utils.ErrChecklistItemEmpty
+	}
+	stored := *item
+	encryptedText, err := r.cipher.Encrypt(item.Text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt checklist item: %w", err)
+	}
+	stored.Text = encryptedText
+	return &stored, nil
+}
+
+// decryptItem decrypts the text of an item in place
+func (r *encryptedChecklistRepository) decryptItem(item *models.ChecklistItem) error {
+	text, err := r.cipher.Decrypt(item.Text)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt checklist item: %w", err)
+	}
+	item.Text = text
+	return nil
+}
@@ -5,48 +5,98 @@ import (
 	"fmt"
 	"personal-notes-with-go/models"
 	"personal-notes-with-go/utils"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/mattn/go-sqlite3"
 )
 
 type NoteRepositoryInterface interface {
+	// Create stores a new note under a new ID, created and updated now
 	Create(note *models.Note) error
+	// Insert stores a note under the ID it already has, keeping its
+	// timestamps; imports use it to preserve the notes they copy
+	Insert(note *models.Note) error
+	// GetAll returns the notes that are not in the trash
 	GetAll() ([]*models.Note, error)
+	// GetByID returns a note, whether it is in the trash or not
 	GetByID(id string) (*models.Note, error)
 	Update(note *models.Note) error
 	Delete(id string) error
 	GetByCategoryID(categoryID string) ([]*models.Note, error)
+	// GetFiltered returns the notes matching filter
+	GetFiltered(filter models.NoteFilter) ([]*models.Note, error)
+	// Restore takes a note out of the trash
+	Restore(id string) error
+	// SetState turns a state of a note on or off
+	SetState(id string, state models.NoteState, on bool) error
+	// SetReminder moves the reminder of a note to remindAt, or removes it
+	// when remindAt is nil, so that it is delivered again
+	SetReminder(id string, remindAt *time.Time) error
+	// MarkReminded records that the reminder of a note was delivered at at
+	MarkReminded(id string, at time.Time) error
 }
 
+// noteColumns are the columns read into a note by scanNote
+const noteColumns = `id, subject, content, priority, tags, COALESCE(category_id, ''), created_at, updated_at, trashed_at,
+	pinned, archived, favorite, due_at, remind_at, reminded_at, recurrence, recurrence_mode, recur_at,
+	(SELECT COUNT(*) FROM checklist_items c WHERE c.note_id = notes.id),
+	(SELECT COUNT(*) FROM checklist_items c WHERE c.note_id = notes.id AND c.checked = 1)`
+
+// noteRepository stores notes as given; the sensitive fields are encrypted
+// by the decorator returned from NewEncryptedNoteRepository
 type noteRepository struct {
-	db *sql.DB
+	db DBTX
 }
 
-func NewNoteRepository(db *sql.DB) NoteRepositoryInterface {
+func NewNoteRepository(db DBTX) NoteRepositoryInterface {
 	return &noteRepository{db: db}
 }
 
 func (r *noteRepository) Create(note *models.Note) error {
 	// Generate a new UUID for the note
 	note.ID = uuid.New().String()
+	note.CreatedAt = time.Now().UTC()
+	note.UpdatedAt = note.CreatedAt
+	return r.Insert(note)
+}
 
-	// Note: All encryption is now done in the handler
-	// We just insert the already encrypted data
+func (r *noteRepository) Insert(note *models.Note) error {
+	if note.ID == "" {
+		return fmt.Errorf("failed to create note: missing ID")
+	}
+
+	// Timestamps given by the caller are kept; missing ones are now
+	now := time.Now().UTC()
+	if note.CreatedAt.IsZero() {
+		note.CreatedAt = now
+	}
+	if note.UpdatedAt.IsZero() {
+		note.UpdatedAt = note.CreatedAt
+	}
 
 	// Insert into database
 	query := `
-		INSERT INTO notes (id, subject, content, priority, tags, category_id)
-		VALUES (?, ?, ?, ?, ?, ?)
+		INSERT INTO notes (id, subject, content, priority, tags, category_id, created_at, updated_at, subject_index, trashed_at, pinned, archived, favorite,
+			due_at, remind_at, reminded_at, recurrence, recurrence_mode, recur_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	_, err := r.db.Exec(query, note.ID, note.Subject, note.Content, note.Priority, note.Tags, note.CategoryID)
-	if err != nil {
-		return fmt.Errorf("failed to create note: %w", err)
-	}
-	return nil
+	return r.write(func(db DBTX) error {
+		_, err := db.Exec(query, note.ID, note.Subject, note.Content, note.Priority, note.Tags, nullIfEmpty(note.CategoryID), note.CreatedAt, note.UpdatedAt, nullIfEmpty(note.SubjectIndex), note.TrashedAt,
+			note.Pinned, note.Archived, note.Favorite, dbTime(note.DueAt), dbTime(note.RemindAt), dbTime(note.RemindedAt), note.Recurrence, note.RecurrenceMode, dbTime(note.RecurAt))
+		if err != nil {
+			if isForeignKeyError(err) {
+				return utils.ErrCategoryNotFound
+			}
+			return fmt.Errorf("failed to create note: %w", err)
+		}
+		return setWords(db, note.ID, note.WordIndexes)
+	})
 }
 
 func (r *noteRepository) GetAll() ([]*models.Note, error) {
-	query := `SELECT id, subject, content, priority, tags, category_id FROM notes`
+	query := `SELECT ` + noteColumns + ` FROM notes WHERE trashed_at IS NULL`
 	rows, err := r.db.Query(query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get notes: %w", err)
@@ -55,18 +105,11 @@ func (r *noteRepository) GetAll() ([]*models.Note, error) {
 
 	var notes []*models.Note
 	for rows.Next() {
-		note := &models.Note{}
-		var encryptedSubject, encryptedContent, encryptedTags string
-		err := rows.Scan(&note.ID, &encryptedSubject, &encryptedContent, &note.Priority, &encryptedTags, &note.CategoryID)
+		note, err := scanNote(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan note: %w", err)
 		}
 
-		// Store encrypted values for handler to decrypt
-		note.Subject = encryptedSubject
-		note.Content = encryptedContent
-		note.Tags = encryptedTags
-
 		notes = append(notes, note)
 	}
 
@@ -74,10 +117,8 @@ func (r *noteRepository) GetAll() ([]*models.Note, error) {
 }
 
 func (r *noteRepository) GetByID(id string) (*models.Note, error) {
-	query := `SELECT id, subject, content, priority, tags, category_id FROM notes WHERE id = ?`
-	note := &models.Note{}
-	var encryptedSubject, encryptedContent, encryptedTags string
-	err := r.db.QueryRow(query, id).Scan(&note.ID, &encryptedSubject, &encryptedContent, &note.Priority, &encryptedTags, &note.CategoryID)
+	query := `SELECT ` + noteColumns + ` FROM notes WHERE id = ?`
+	note, err := scanNote(r.db.QueryRow(query, id))
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, utils.ErrNoteNotFound
@@ -85,26 +126,179 @@ func (r *noteRepository) GetByID(id string) (*models.Note, error) {
 		return nil, fmt.Errorf("failed to get note: %w", err)
 	}
 
-	// Store encrypted values for handler to decrypt
-	note.Subject = encryptedSubject
-	note.Content = encryptedContent
-	note.Tags = encryptedTags
-
 	return note, nil
 }
 
 func (r *noteRepository) Update(note *models.Note) error {
-	// Note: All encryption is now done in the handler
-	// We just update with the already encrypted data
+	note.UpdatedAt = time.Now().UTC()
 
+	// A reminder that was moved is delivered again at its new time
 	query := `
 		UPDATE notes
-		SET subject = ?, content = ?, priority = ?, tags = ?, category_id = ?
+		SET subject = ?, content = ?, priority = ?, tags = ?, category_id = ?, updated_at = ?, subject_index = ?,
+			due_at = ?, remind_at = ?, reminded_at = CASE WHEN remind_at IS ? THEN reminded_at ELSE NULL END,
+			recurrence = ?, recurrence_mode = ?, recur_at = ?
 		WHERE id = ?
 	`
-	result, err := r.db.Exec(query, note.Subject, note.Content, note.Priority, note.Tags, note.CategoryID, note.ID)
+	remindAt := dbTime(note.RemindAt)
+	return r.write(func(db DBTX) error {
+		result, err := db.Exec(query, note.Subject, note.Content, note.Priority, note.Tags, nullIfEmpty(note.CategoryID), note.UpdatedAt, nullIfEmpty(note.SubjectIndex),
+			dbTime(note.DueAt), remindAt, remindAt, note.Recurrence, note.RecurrenceMode, dbTime(note.RecurAt), note.ID)
+		if err != nil {
+			if isForeignKeyError(err) {
+				return utils.ErrCategoryNotFound
+			}
+			return fmt.Errorf("failed to update note: %w", err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get affected rows: %w", err)
+		}
+		if rowsAffected == 0 {
+			return utils.ErrNoteNotFound
+		}
+
+		return setWords(db, note.ID, note.WordIndexes)
+	})
+}
+
+func (r *noteRepository) Delete(id string) error {
+	return r.write(func(db DBTX) error {
+		if err := setWords(db, id, nil); err != nil {
+			return err
+		}
+		result, err := db.Exec("DELETE FROM notes WHERE id = ?", id)
+		if err != nil {
+			return fmt.Errorf("failed to delete note: %w", err)
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to get affected rows: %w", err)
+		}
+		if rowsAffected == 0 {
+			return utils.ErrNoteNotFound
+		}
+		return nil
+	})
+}
+
+// GetByCategoryID returns all notes for a specific category
+func (r *noteRepository) GetByCategoryID(categoryID string) ([]*models.Note, error) {
+	query := `SELECT ` + noteColumns + ` FROM notes WHERE category_id = ? AND trashed_at IS NULL`
+
+	rows, err := r.db.Query(query, categoryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notes by category ID: %w", err)
+	}
+	defer rows.Close()
+
+	var notes []*models.Note
+	for rows.Next() {
+		note, err := scanNote(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan note row: %w", err)
+		}
+
+		notes = append(notes, note)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating note rows: %w", err)
+	}
+
+	return notes, nil
+}
+
+// GetFiltered returns the notes matching filter, leaving out archived notes
+// unless filter.IncludeArchived is set. Values are encrypted, so
+// only IDs and blind indexes are applied here: filter.Tags is resolved by
+// NewTaggedNoteRepository, and Subject and Words by
+// NewEncryptedNoteRepository.
+func (r *noteRepository) GetFiltered(filter models.NoteFilter) ([]*models.Note, error) {
+	conditions := []string{"trashed_at IS NULL"}
+	if filter.Trashed {
+		conditions[0] = "trashed_at IS NOT NULL"
+	} else if !filter.IncludeArchived {
+		conditions = append(conditions, "archived = 0")
+	}
+	if filter.Favorites {
+		conditions = append(conditions, "favorite = 1")
+	}
+	var args []any
+	if filter.DueBefore != nil {
+		conditions = append(conditions, "due_at < ?")
+		args = append(args, dbTime(filter.DueBefore))
+	}
+	if filter.RemindBefore != nil {
+		conditions = append(conditions, "remind_at <= ? AND reminded_at IS NULL")
+		args = append(args, dbTime(filter.RemindBefore))
+	}
+	if filter.RecurBefore != nil {
+		conditions = append(conditions, "recur_at <= ?")
+		args = append(args, dbTime(filter.RecurBefore))
+	}
+	switch {
+	case filter.CategoryID != "" && filter.IncludeSubcategories:
+		conditions = append(conditions, `category_id IN (
+			WITH RECURSIVE subtree(id) AS (
+				SELECT ?
+				UNION
+				SELECT c.id FROM categories c JOIN subtree s ON c.parent_id = s.id
+			)
+			SELECT id FROM subtree)`)
+		args = append(args, filter.CategoryID)
+	case filter.CategoryID != "":
+		conditions = append(conditions, "category_id = ?")
+		args = append(args, filter.CategoryID)
+	}
+	for _, tagID := range filter.TagIDs {
+		conditions = append(conditions, "id IN (SELECT note_id FROM note_tags WHERE tag_id = ?)")
+		args = append(args, tagID)
+	}
+	if len(filter.Priorities) > 0 {
+		conditions = append(conditions, "priority IN (?"+strings.Repeat(", ?", len(filter.Priorities)-1)+")")
+		for _, priority := range filter.Priorities {
+			args = append(args, priority)
+		}
+	}
+	if filter.SubjectIndex != "" {
+		conditions = append(conditions, "subject_index = ?")
+		args = append(args, filter.SubjectIndex)
+	}
+	for _, word := range filter.WordIndexes {
+		conditions = append(conditions, "id IN (SELECT note_id FROM note_words WHERE word_index = ?)")
+		args = append(args, word)
+	}
+
+	query := `SELECT ` + noteColumns + ` FROM notes WHERE ` + strings.Join(conditions, " AND ")
+
+	rows, err := r.db.Query(query, args...)
 	if err != nil {
-		return fmt.Errorf("failed to update note: %w", err)
+		return nil, fmt.Errorf("failed to query notes: %w", err)
+	}
+	defer rows.Close()
+
+	var notes []*models.Note
+	for rows.Next() {
+		note, err := scanNote(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan note row: %w", err)
+		}
+		notes = append(notes, note)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating note rows: %w", err)
+	}
+
+	return notes, nil
+}
+
+func (r *noteRepository) Restore(id string) error {
+	result, err := r.db.Exec("UPDATE notes SET trashed_at = NULL WHERE id = ? AND trashed_at IS NOT NULL", id)
+	if err != nil {
+		return fmt.Errorf("failed to restore note: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
@@ -114,14 +308,21 @@ func (r *noteRepository) Update(note *models.Note) error {
 	if rowsAffected == 0 {
 		return utils.ErrNoteNotFound
 	}
-
 	return nil
 }
 
-func (r *noteRepository) Delete(id string) error {
-	result, err := r.db.Exec("DELETE FROM notes WHERE id = ?", id)
+func (r *noteRepository) SetState(id string, state models.NoteState, on bool) error {
+	// The column name cannot be a bound parameter, so only known states
+	// reach the query
+	switch state {
+	case models.NotePinned, models.NoteArchived, models.NoteFavorite:
+	default:
+		return fmt.Errorf("%w %q", utils.ErrNoteStateUnknown, state)
+	}
+
+	result, err := r.db.Exec("UPDATE notes SET "+string(state)+" = ? WHERE id = ?", on, id)
 	if err != nil {
-		return fmt.Errorf("failed to delete note: %w", err)
+		return fmt.Errorf("failed to set note %s: %w", state, err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
@@ -131,40 +332,131 @@ func (r *noteRepository) Delete(id string) error {
 	if rowsAffected == 0 {
 		return utils.ErrNoteNotFound
 	}
+	return nil
+}
+
+func (r *noteRepository) SetReminder(id string, remindAt *time.Time) error {
+	result, err := r.db.Exec("UPDATE notes SET remind_at = ?, reminded_at = NULL WHERE id = ?", dbTime(remindAt), id)
+	if err != nil {
+		return fmt.Errorf("failed to set note reminder: %w", err)
+	}
 
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rowsAffected == 0 {
+		return utils.ErrNoteNotFound
+	}
 	return nil
 }
 
-// GetByCategoryID returns all notes for a specific category
-func (r *noteRepository) GetByCategoryID(categoryID string) ([]*models.Note, error) {
-	query := `SELECT id, subject, content, priority, tags, category_id FROM notes WHERE category_id = ?`
+func (r *noteRepository) MarkReminded(id string, at time.Time) error {
+	result, err := r.db.Exec("UPDATE notes SET reminded_at = ? WHERE id = ?", dbTime(&at), id)
+	if err != nil {
+		return fmt.Errorf("failed to mark note reminded: %w", err)
+	}
 
-	rows, err := r.db.Query(query, categoryID)
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return nil, fmt.Errorf("failed to query notes by category ID: %w", err)
+		return fmt.Errorf("failed to get affected rows: %w", err)
 	}
-	defer rows.Close()
+	if rowsAffected == 0 {
+		return utils.ErrNoteNotFound
+	}
+	return nil
+}
 
-	var notes []*models.Note
-	for rows.Next() {
-		note := &models.Note{}
-		var encryptedSubject, encryptedContent, encryptedTags string
-		err := rows.Scan(&note.ID, &encryptedSubject, &encryptedContent, &note.Priority, &encryptedTags, &note.CategoryID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan note row: %w", err)
-		}
+// scanNote reads the noteColumns of a row into a new note
+func scanNote(row interface{ Scan(dest ...any) error }) (*models.Note, error) {
+	note := &models.Note{}
+	var trashedAt, dueAt, remindAt, remindedAt, recurAt sql.NullTime
+	if err := row.Scan(&note.ID, &note.Subject, &note.Content, &note.Priority, &note.Tags, &note.CategoryID, &note.CreatedAt, &note.UpdatedAt, &trashedAt,
+		&note.Pinned, &note.Archived, &note.Favorite, &dueAt, &remindAt, &remindedAt,
+		&note.Recurrence, &note.RecurrenceMode, &recurAt, &note.ChecklistTotal, &note.ChecklistDone); err != nil {
+		return nil, err
+	}
+	note.TrashedAt = timeOrNil(trashedAt)
+	note.DueAt = timeOrNil(dueAt)
+	note.RemindAt = timeOrNil(remindAt)
+	note.RemindedAt = timeOrNil(remindedAt)
+	note.RecurAt = timeOrNil(recurAt)
+	return note, nil
+}
 
-		// Store encrypted values for handler to decrypt
-		note.Subject = encryptedSubject
-		note.Content = encryptedContent
-		note.Tags = encryptedTags
+func timeOrNil(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
 
-		notes = append(notes, note)
+// dbTime stores a due, reminder or recurrence time in UTC to the second. The driver
+// writes times as text, so the same zone and precision everywhere keep the
+// comparisons in GetFiltered and Update correct.
+func dbTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
 	}
+	return sql.NullTime{Time: t.UTC().Truncate(time.Second), Valid: true}
+}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating note rows: %w", err)
+// isForeignKeyError reports whether err is a violated foreign key, which
+// for notes means the category does not exist
+func isForeignKeyError(err error) bool {
+	sqliteErr, ok := err.(sqlite3.Error)
+	return ok && sqliteErr.ExtendedCode == sqlite3.ErrConstraintForeignKey
+}
+
+// write runs fn on the database of r, in a transaction of its own unless r
+// already works in one, so that a note and its word indexes change
+// together or not at all
+func (r *noteRepository) write(fn func(db DBTX) error) error {
+	db, ok := r.db.(*sql.DB)
+	if !ok {
+		return fn(r.db)
 	}
 
-	return notes, nil
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit note: %w", err)
+	}
+	return nil
+}
+
+// setWords replaces the word indexes of a note. It is called in the same
+// transaction as the write of the note row.
+func setWords(db DBTX, noteID string, words []string) error {
+	if _, err := db.Exec("DELETE FROM note_words WHERE note_id = ?", noteID); err != nil {
+		return fmt.Errorf("failed to update note words: %w", err)
+	}
+	// A note has many words, so they are inserted in batches rather than
+	// one statement each; 400 rows stay below SQLite's limit of 999
+	// parameters
+	const batch = 400
+	for start := 0; start < len(words); start += batch {
+		end := min(start+batch, len(words))
+		args := make([]any, 0, 2*(end-start))
+		for _, word := range words[start:end] {
+			args = append(args, noteID, word)
+		}
+		query := "INSERT OR IGNORE INTO note_words (note_id, word_index) VALUES " + strings.TrimSuffix(strings.Repeat("(?, ?), ", end-start), ", ")
+		if _, err := db.Exec(query, args...); err != nil {
+			return fmt.Errorf("failed to update note words: %w", err)
+		}
+	}
+	return nil
+}
+
+// nullIfEmpty stores an empty value as NULL: an empty blind index marks the
+// row as not indexed yet, and an empty category or parent ID means none
+func nullIfEmpty(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
 }
@@ -0,0 +1,145 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/utils"
+	"time"
+)
+
+// RecurredNote is a recurring note that RecurNotes has moved on
+type RecurredNote struct {
+	NoteID  string
+	Subject string
+	Mode    string
+	// CloneID is the note made by the clone mode, which now carries the
+	// recurrence
+	CloneID string
+	// Next is when the note recurs next, or nil when its rule has ended
+	Next *time.Time
+}
+
+// RecurNotes moves on every recurring note whose recurrence time has come
+// by now. The due time and reminder of the note move to its next
+// occurrence, by as much as its recurrence time does. In reset mode the
+// checklist of the note is unchecked. In clone mode the note is kept as it
+// is and a copy with an unchecked checklist takes over the recurrence.
+// When the rule has ended, the note only stops recurring. Each note is
+// moved on in a transaction of its own; c and bi encrypt and index the
+// notes as the repositories of the server do. Notes in the trash or
+// archived do not recur. A note that fails to move on is logged and left
+// for the next run, so it does not hold up the others.
+func RecurNotes(db *sql.DB, c utils.Cipher, bi *utils.BlindIndex, now time.Time) ([]RecurredNote, error) {
+	notes, err := newTaggedNotes(db, c, bi).GetFiltered(models.NoteFilter{RecurBefore: &now})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recurring notes: %w", err)
+	}
+
+	var recurred []RecurredNote
+	for _, note := range notes {
+		r, err := recurNote(db, c, bi, note.ID, now)
+		if err != nil {
+			log.Printf("Failed to recur note %s: %v", note.ID, err)
+			continue
+		}
+		if r != nil {
+			recurred = append(recurred, *r)
+		}
+	}
+	return recurred, nil
+}
+
+// recurNote moves on the note id as RecurNotes describes. The note is read
+// again in the transaction, as it may have changed since it was listed;
+// when it no longer recurs by now, is in the trash or is archived, nothing
+// happens and the result is nil.
+func recurNote(db *sql.DB, c utils.Cipher, bi *utils.BlindIndex, id string, now time.Time) (*RecurredNote, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	notes := newTaggedNotes(tx, c, bi)
+	checklists := NewEncryptedChecklistRepository(NewChecklistRepository(tx), c)
+	note, err := notes.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if note.RecurAt == nil || note.Recurrence == "" || note.RecurAt.After(now) || note.TrashedAt != nil || note.Archived {
+		return nil, nil
+	}
+	rule, err := models.ParseRecurrence(note.Recurrence)
+	if err != nil {
+		return nil, err
+	}
+	result := &RecurredNote{NoteID: note.ID, Subject: note.Subject, Mode: note.RecurrenceMode}
+
+	// Occurrences missed while the server was down are skipped
+	next, ok := *note.RecurAt, true
+	for ok && !next.After(now) {
+		next, ok = rule.Next(next)
+	}
+	if !ok {
+		note.RecurAt = nil
+		if err := notes.Update(note); err != nil {
+			return nil, err
+		}
+		return result, tx.Commit()
+	}
+
+	offset := next.Sub(*note.RecurAt)
+	moved := *note
+	moved.DueAt = shiftTime(note.DueAt, offset)
+	moved.RemindAt = shiftTime(note.RemindAt, offset)
+	moved.RecurAt = &next
+	result.Next = &next
+
+	switch note.RecurrenceMode {
+	case models.RecurrenceClone:
+		items, err := checklists.GetByNoteID(note.ID)
+		if err != nil {
+			return nil, err
+		}
+		moved.ID = ""
+		moved.CreatedAt, moved.UpdatedAt = time.Time{}, time.Time{}
+		moved.RemindedAt = nil
+		if err := notes.Create(&moved); err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			copied := models.ChecklistItem{NoteID: moved.ID, Text: item.Text}
+			if err := checklists.Create(&copied); err != nil {
+				return nil, err
+			}
+		}
+		note.Recurrence, note.RecurrenceMode, note.RecurAt = "", "", nil
+		if err := notes.Update(note); err != nil {
+			return nil, err
+		}
+		result.CloneID = moved.ID
+	default:
+		if err := notes.Update(&moved); err != nil {
+			return nil, err
+		}
+		if err := checklists.Uncheck(note.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit recurrence: %w", err)
+	}
+	return result, nil
+}
+
+// shiftTime returns t moved by offset, or nil when t is nil
+func shiftTime(t *time.Time, offset time.Duration) *time.Time {
+	if t == nil {
+		return nil
+	}
+	shifted := t.Add(offset)
+	return &shifted
+}
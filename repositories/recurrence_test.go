@@ -0,0 +1,353 @@
+package repositories
+
+import (
+	"bytes"
+	"database/sql"
+	"log"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"personal-notes-with-go/database"
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/utils"
+)
+
+// newRecurrenceDB returns a new database with the cipher and blind index
+// the notes are written with. Local time is UTC for the rest of the test.
+func newRecurrenceDB(t *testing.T) (*sql.DB, utils.Cipher, *utils.BlindIndex) {
+	t.Helper()
+	old := time.Local
+	time.Local = time.UTC
+	t.Cleanup(func() { time.Local = old })
+
+	db, err := database.InitDB(filepath.Join(t.TempDir(), "db.sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	key := bytes.Repeat([]byte{1}, utils.KeySize)
+	c, err := utils.NewCipher(utils.CipherXChaCha20Poly1305, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bi, err := utils.NewBlindIndex(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, c, bi
+}
+
+func at(month time.Month, day, hour int) *time.Time {
+	t := time.Date(2026, month, day, hour, 0, 0, 0, time.UTC)
+	return &t
+}
+
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+// checklistOf returns the items of a note as text and whether each is
+// checked
+func checklistOf(t *testing.T, checklists ChecklistRepositoryInterface, noteID string) []string {
+	t.Helper()
+	items, err := checklists.GetByNoteID(noteID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, item := range items {
+		if item.Checked {
+			got = append(got, "[x] "+item.Text)
+		} else {
+			got = append(got, "[ ] "+item.Text)
+		}
+	}
+	return got
+}
+
+func TestRecurNotes(t *testing.T) {
+	for _, mode := range []string{models.RecurrenceReset, models.RecurrenceClone} {
+		t.Run(mode, func(t *testing.T) {
+			db, c, bi := newRecurrenceDB(t)
+			notes := newTaggedNotes(db, c, bi)
+			checklists := NewEncryptedChecklistRepository(NewChecklistRepository(db), c)
+
+			// Due every Monday from 2 March, with the checklist half done
+			// and the reminder delivered
+			note := &models.Note{
+				Subject:        "Laporan mingguan",
+				Content:        "Kirim ke tim",
+				Priority:       "medium",
+				Tags:           "kerja",
+				Recurrence:     "FREQ=WEEKLY;BYDAY=MO",
+				RecurrenceMode: mode,
+				RecurAt:        at(3, 2, 9),
+				DueAt:          at(3, 2, 9),
+				RemindAt:       at(3, 2, 8),
+			}
+			if err := notes.Create(note); err != nil {
+				t.Fatal(err)
+			}
+			for i, text := range []string{"Tulis", "Kirim"} {
+				item := &models.ChecklistItem{NoteID: note.ID, Text: text}
+				if err := checklists.Create(item); err != nil {
+					t.Fatal(err)
+				}
+				if i == 0 {
+					if err := checklists.SetChecked(item.ID, true); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			if err := notes.MarkReminded(note.ID, *at(3, 2, 8)); err != nil {
+				t.Fatal(err)
+			}
+
+			// The server was down on 9 and 16 March, which are skipped
+			now := *at(3, 18, 12)
+			recurred, err := RecurNotes(db, c, bi, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(recurred) != 1 {
+				t.Fatalf("RecurNotes moved on %d notes, want 1", len(recurred))
+			}
+			r := recurred[0]
+			if r.NoteID != note.ID || r.Subject != note.Subject || r.Mode != mode || !sameTime(r.Next, at(3, 23, 9)) {
+				t.Errorf("RecurNotes = %+v, want the note to recur next on 23 March at 09:00", r)
+			}
+
+			original, err := notes.GetByID(note.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			recurring := original
+			switch mode {
+			case models.RecurrenceReset:
+				if r.CloneID != "" {
+					t.Errorf("reset mode made a clone %s", r.CloneID)
+				}
+			case models.RecurrenceClone:
+				if r.CloneID == "" || r.CloneID == note.ID {
+					t.Fatalf("clone mode made clone %q", r.CloneID)
+				}
+				// The original stays as it was and stops recurring
+				if original.Recurrence != "" || original.RecurrenceMode != "" || original.RecurAt != nil {
+					t.Errorf("original still recurs: %q, %q, %v", original.Recurrence, original.RecurrenceMode, original.RecurAt)
+				}
+				if !sameTime(original.DueAt, at(3, 2, 9)) || !sameTime(original.RemindAt, at(3, 2, 8)) || original.RemindedAt == nil {
+					t.Errorf("original was moved: due %v, remind %v, reminded %v", original.DueAt, original.RemindAt, original.RemindedAt)
+				}
+				if got := checklistOf(t, checklists, note.ID); !slices.Equal(got, []string{"[x] Tulis", "[ ] Kirim"}) {
+					t.Errorf("checklist of the original = %q", got)
+				}
+
+				recurring, err = notes.GetByID(r.CloneID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if recurring.Subject != note.Subject || recurring.Content != note.Content || recurring.Tags != note.Tags {
+					t.Errorf("clone = %q, %q, %q, want a copy of the note", recurring.Subject, recurring.Content, recurring.Tags)
+				}
+				if recurring.CreatedAt.Before(original.CreatedAt) {
+					t.Errorf("clone was created at %v, before the original at %v", recurring.CreatedAt, original.CreatedAt)
+				}
+			}
+
+			// The recurring note moves to the next occurrence with the
+			// reminder due again and the checklist unchecked
+			if recurring.Recurrence != note.Recurrence || recurring.RecurrenceMode != mode {
+				t.Errorf("recurring note has rule %q and mode %q", recurring.Recurrence, recurring.RecurrenceMode)
+			}
+			if !sameTime(recurring.RecurAt, at(3, 23, 9)) || !sameTime(recurring.DueAt, at(3, 23, 9)) || !sameTime(recurring.RemindAt, at(3, 23, 8)) {
+				t.Errorf("recurring note recurs at %v, is due at %v and reminds at %v", recurring.RecurAt, recurring.DueAt, recurring.RemindAt)
+			}
+			if recurring.RemindedAt != nil {
+				t.Errorf("recurring note was already reminded at %v", recurring.RemindedAt)
+			}
+			if got := checklistOf(t, checklists, recurring.ID); !slices.Equal(got, []string{"[ ] Tulis", "[ ] Kirim"}) {
+				t.Errorf("checklist of the recurring note = %q", got)
+			}
+
+			// Nothing else is due until the next occurrence
+			if recurred, err := RecurNotes(db, c, bi, now); err != nil || len(recurred) != 0 {
+				t.Errorf("RecurNotes again = %+v, %v, want nothing", recurred, err)
+			}
+			all, err := notes.GetAll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := 1
+			if mode == models.RecurrenceClone {
+				want = 2
+			}
+			if len(all) != want {
+				t.Errorf("got %d notes, want %d", len(all), want)
+			}
+		})
+	}
+}
+
+func TestRecurNotesEndsAndSkips(t *testing.T) {
+	db, c, bi := newRecurrenceDB(t)
+	notes := newTaggedNotes(db, c, bi)
+
+	create := func(subject, rule string, recurAt *time.Time) *models.Note {
+		note := &models.Note{Subject: subject, Priority: "medium", Recurrence: rule, RecurrenceMode: models.RecurrenceReset, RecurAt: recurAt, DueAt: recurAt}
+		if err := notes.Create(note); err != nil {
+			t.Fatal(err)
+		}
+		return note
+	}
+	ended := create("Selesai", "FREQ=DAILY;UNTIL=20260305", at(3, 1, 9))
+	create("Nanti", "daily", at(3, 11, 9))
+	archived := create("Diarsipkan", "daily", at(3, 1, 9))
+	if err := notes.SetState(archived.ID, models.NoteArchived, true); err != nil {
+		t.Fatal(err)
+	}
+
+	recurred, err := RecurNotes(db, c, bi, *at(3, 10, 12))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recurred) != 1 || recurred[0].NoteID != ended.ID || recurred[0].Next != nil {
+		t.Fatalf("RecurNotes = %+v, want only the ended rule, without a next time", recurred)
+	}
+
+	// The rule ran out while the server was down: the note stops recurring
+	// and keeps its due time
+	got, err := notes.GetByID(ended.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.RecurAt != nil || !sameTime(got.DueAt, at(3, 1, 9)) {
+		t.Errorf("ended note recurs at %v and is due at %v", got.RecurAt, got.DueAt)
+	}
+	if recurred, err := RecurNotes(db, c, bi, *at(3, 10, 12)); err != nil || len(recurred) != 0 {
+		t.Errorf("RecurNotes again = %+v, %v, want nothing", recurred, err)
+	}
+}
+
+// recurNote reads the note again, so a note that changed after RecurNotes
+// listed it is left alone
+func TestRecurNoteSkipsChangedNotes(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(notes NoteRepositoryInterface, db *sql.DB, note *models.Note) error
+	}{
+		{"recurrence removed", func(notes NoteRepositoryInterface, db *sql.DB, note *models.Note) error {
+			note.Recurrence, note.RecurrenceMode, note.RecurAt = "", "", nil
+			return notes.Update(note)
+		}},
+		{"recurrence time cleared", func(notes NoteRepositoryInterface, db *sql.DB, note *models.Note) error {
+			note.RecurAt = nil
+			return notes.Update(note)
+		}},
+		{"rule cleared", func(notes NoteRepositoryInterface, db *sql.DB, note *models.Note) error {
+			note.Recurrence = ""
+			return notes.Update(note)
+		}},
+		{"moved on already", func(notes NoteRepositoryInterface, db *sql.DB, note *models.Note) error {
+			note.RecurAt = at(3, 11, 9)
+			return notes.Update(note)
+		}},
+		{"archived", func(notes NoteRepositoryInterface, db *sql.DB, note *models.Note) error {
+			return notes.SetState(note.ID, models.NoteArchived, true)
+		}},
+		{"trashed", func(notes NoteRepositoryInterface, db *sql.DB, note *models.Note) error {
+			_, err := db.Exec("UPDATE notes SET trashed_at = ? WHERE id = ?", *at(3, 9, 9), note.ID)
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, c, bi := newRecurrenceDB(t)
+			notes := newTaggedNotes(db, c, bi)
+			note := &models.Note{Subject: "Harian", Priority: "medium", Recurrence: "daily", RecurrenceMode: models.RecurrenceClone, RecurAt: at(3, 1, 9), DueAt: at(3, 1, 9)}
+			if err := notes.Create(note); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.change(notes, db, note); err != nil {
+				t.Fatal(err)
+			}
+			before, err := notes.GetByID(note.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := recurNote(db, c, bi, note.ID, *at(3, 10, 12))
+			if err != nil || r != nil {
+				t.Fatalf("recurNote() = %+v, %v, want nothing", r, err)
+			}
+			after, err := notes.GetByID(note.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameTime(after.RecurAt, before.RecurAt) || !sameTime(after.DueAt, before.DueAt) || after.Recurrence != before.Recurrence {
+				t.Errorf("note changed to recur at %v by %q, due at %v", after.RecurAt, after.Recurrence, after.DueAt)
+			}
+			all, err := notes.GetFiltered(models.NoteFilter{IncludeArchived: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(all) > 1 {
+				t.Errorf("%d notes, want no clone", len(all))
+			}
+		})
+	}
+}
+
+func TestRecurNotesLogsFailuresAndGoesOn(t *testing.T) {
+	db, c, bi := newRecurrenceDB(t)
+	notes := newTaggedNotes(db, c, bi)
+
+	// Whatever order the notes are listed in, a good one comes after the
+	// broken one
+	ids := make(map[string]string)
+	for _, subject := range []string{"Pertama", "Rusak", "Terakhir"} {
+		note := &models.Note{Subject: subject, Priority: "medium", Recurrence: "daily", RecurrenceMode: models.RecurrenceReset, RecurAt: at(3, 1, 9)}
+		if err := notes.Create(note); err != nil {
+			t.Fatal(err)
+		}
+		ids[subject] = note.ID
+	}
+	if _, err := db.Exec("UPDATE notes SET recurrence = 'sometimes' WHERE id = ?", ids["Rusak"]); err != nil {
+		t.Fatal(err)
+	}
+
+	var logged bytes.Buffer
+	old := log.Writer()
+	log.SetOutput(&logged)
+	t.Cleanup(func() { log.SetOutput(old) })
+
+	recurred, err := RecurNotes(db, c, bi, *at(3, 10, 12))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range recurred {
+		got = append(got, r.Subject)
+	}
+	slices.Sort(got)
+	if want := []string{"Pertama", "Terakhir"}; !slices.Equal(got, want) {
+		t.Errorf("recurred %q, want %q", got, want)
+	}
+	if !strings.Contains(logged.String(), ids["Rusak"]) {
+		t.Errorf("log = %q, want the broken note", logged.String())
+	}
+
+	// The broken note is left as it was, for the next run
+	broken, err := notes.GetByID(ids["Rusak"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameTime(broken.RecurAt, at(3, 1, 9)) {
+		t.Errorf("broken note recurs at %v", broken.RecurAt)
+	}
+}
@@ -0,0 +1,245 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/utils"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+type TagRepositoryInterface interface {
+	Create(tag *models.Tag) error
+	// GetAll returns every tag with the number of notes carrying it
+	GetAll() ([]models.Tag, error)
+	GetByID(id string) (*models.Tag, error)
+	// GetByName returns the tag with the given name, ignoring case
+	GetByName(name string) (*models.Tag, error)
+	// GetByNameIndex returns the tag whose name has the given blind index
+	GetByNameIndex(index string) (*models.Tag, error)
+	Update(tag *models.Tag) error
+	Delete(id string) error
+	// Merge moves the notes of the tag sourceID to the tag targetID and
+	// deletes the source tag
+	Merge(sourceID, targetID string) error
+	// DeleteUnused deletes the tags no note carries anymore
+	DeleteUnused() (int64, error)
+
+	// GetNoteTags returns the tags of a note in the order they were given
+	GetNoteTags(noteID string) ([]models.Tag, error)
+	// GetAllNoteTags returns the tags of every note that has any, by note ID
+	GetAllNoteTags() (map[string][]models.Tag, error)
+	// SetNoteTags replaces the tags of a note
+	SetNoteTags(noteID string, tagIDs []string) error
+}
+
+// tagRepository stores tags as given; names are encrypted by the decorator
+// returned from NewEncryptedTagRepository
+type tagRepository struct {
+	db DBTX
+}
+
+func NewTagRepository(db DBTX) TagRepositoryInterface {
+	return &tagRepository{db: db}
+}
+
+func (r *tagRepository) Create(tag *models.Tag) error {
+	tag.ID = uuid.New().String()
+	if _, err := r.db.Exec("INSERT INTO tags (id, name, name_index) VALUES (?, ?, ?)", tag.ID, tag.Name, nullIfEmpty(tag.NameIndex)); err != nil {
+		return fmt.Errorf("failed to create tag: %w", err)
+	}
+	return nil
+}
+
+func (r *tagRepository) GetAll() ([]models.Tag, error) {
+	rows, err := r.db.Query(`
+		SELECT t.id, t.name, COUNT(nt.note_id)
+		FROM tags t LEFT JOIN note_tags nt ON nt.tag_id = t.id
+		GROUP BY t.id, t.name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []models.Tag
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan tag: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating tag rows: %w", err)
+	}
+	return tags, nil
+}
+
+func (r *tagRepository) GetByID(id string) (*models.Tag, error) {
+	return r.getTag("t.id = ?", id)
+}
+
+func (r *tagRepository) GetByNameIndex(index string) (*models.Tag, error) {
+	return r.getTag("t.name_index = ?", index)
+}
+
+// getTag returns the first tag matching where, with its count
+func (r *tagRepository) getTag(where string, args ...any) (*models.Tag, error) {
+	var tag models.Tag
+	err := r.db.QueryRow(`
+		SELECT t.id, t.name, (SELECT COUNT(*) FROM note_tags WHERE tag_id = t.id)
+		FROM tags t WHERE `+where+` LIMIT 1
+	`, args...).Scan(&tag.ID, &tag.Name, &tag.Count)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, utils.ErrTagNotFound
+		}
+		return nil, fmt.Errorf("failed to get tag: %w", err)
+	}
+	return &tag, nil
+}
+
+// GetByName compares names in Go, since SQLite's NOCASE only folds ASCII.
+// Names of tags written by the encrypted repository are ciphertext; it
+// looks them up with GetByNameIndex instead.
+func (r *tagRepository) GetByName(name string) (*models.Tag, error) {
+	tags, err := r.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	return findTag(tags, name)
+}
+
+func (r *tagRepository) Update(tag *models.Tag) error {
+	result, err := r.db.Exec("UPDATE tags SET name = ?, name_index = ? WHERE id = ?", tag.Name, nullIfEmpty(tag.NameIndex), tag.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update tag: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rowsAffected == 0 {
+		return utils.ErrTagNotFound
+	}
+	return nil
+}
+
+func (r *tagRepository) Delete(id string) error {
+	if _, err := r.db.Exec("DELETE FROM note_tags WHERE tag_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete tag: %w", err)
+	}
+	result, err := r.db.Exec("DELETE FROM tags WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete tag: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %w", err)
+	}
+	if rowsAffected == 0 {
+		return utils.ErrTagNotFound
+	}
+	return nil
+}
+
+// Merge copies the links before deleting the source, so if it fails
+// halfway no note loses a tag and running it again finishes the merge
+func (r *tagRepository) Merge(sourceID, targetID string) error {
+	for _, id := range []string{sourceID, targetID} {
+		if _, err := r.GetByID(id); err != nil {
+			return err
+		}
+	}
+	if sourceID == targetID {
+		return nil
+	}
+
+	// A note carrying both tags keeps the target at its own position
+	_, err := r.db.Exec(`
+		INSERT OR IGNORE INTO note_tags (note_id, tag_id, position)
+		SELECT note_id, ?, position FROM note_tags WHERE tag_id = ?
+	`, targetID, sourceID)
+	if err != nil {
+		return fmt.Errorf("failed to merge tags: %w", err)
+	}
+	return r.Delete(sourceID)
+}
+
+func (r *tagRepository) DeleteUnused() (int64, error) {
+	result, err := r.db.Exec("DELETE FROM tags WHERE id NOT IN (SELECT tag_id FROM note_tags)")
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete unused tags: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+func (r *tagRepository) GetNoteTags(noteID string) ([]models.Tag, error) {
+	byNote, err := r.queryNoteTags("WHERE nt.note_id = ?", noteID)
+	if err != nil {
+		return nil, err
+	}
+	return byNote[noteID], nil
+}
+
+func (r *tagRepository) GetAllNoteTags() (map[string][]models.Tag, error) {
+	return r.queryNoteTags("")
+}
+
+// queryNoteTags returns the tags of the notes matched by where, by note ID.
+// Count is not filled in.
+func (r *tagRepository) queryNoteTags(where string, args ...any) (map[string][]models.Tag, error) {
+	rows, err := r.db.Query(`
+		SELECT nt.note_id, t.id, t.name
+		FROM note_tags nt JOIN tags t ON t.id = nt.tag_id
+		`+where+`
+		ORDER BY nt.note_id, nt.position
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get note tags: %w", err)
+	}
+	defer rows.Close()
+
+	byNote := make(map[string][]models.Tag)
+	for rows.Next() {
+		var noteID string
+		var tag models.Tag
+		if err := rows.Scan(&noteID, &tag.ID, &tag.Name); err != nil {
+			return nil, fmt.Errorf("failed to scan note tag: %w", err)
+		}
+		byNote[noteID] = append(byNote[noteID], tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating note tag rows: %w", err)
+	}
+	return byNote, nil
+}
+
+func (r *tagRepository) SetNoteTags(noteID string, tagIDs []string) error {
+	if _, err := r.db.Exec("DELETE FROM note_tags WHERE note_id = ?", noteID); err != nil {
+		return fmt.Errorf("failed to set note tags: %w", err)
+	}
+	for i, tagID := range tagIDs {
+		_, err := r.db.Exec("INSERT OR IGNORE INTO note_tags (note_id, tag_id, position) VALUES (?, ?, ?)", noteID, tagID, i)
+		if err != nil {
+			return fmt.Errorf("failed to set note tags: %w", err)
+		}
+	}
+	return nil
+}
+
+// findTag returns the tag in tags named name, ignoring case
+func findTag(tags []models.Tag, name string) (*models.Tag, error) {
+	name = strings.TrimSpace(name)
+	for i := range tags {
+		if strings.EqualFold(tags[i].Name, name) {
+			return &tags[i], nil
+		}
+	}
+	return nil, utils.ErrTagNotFound
+}
@@ -0,0 +1,270 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/utils"
+	"strings"
+	"time"
+)
+
+// taggedNoteRepository keeps the tags of notes in the tags table instead of
+// the notes themselves. Callers still see Note.Tags as a comma-separated
+// string: it is split into tags when a note is written and rebuilt from
+// them when it is read.
+type taggedNoteRepository struct {
+	inner NoteRepositoryInterface
+	tags  TagRepositoryInterface
+}
+
+// NewTaggedNoteRepository wraps inner, storing tags with tags. Both are
+// expected to encrypt, and must use the same database or transaction.
+func NewTaggedNoteRepository(inner NoteRepositoryInterface, tags TagRepositoryInterface) NoteRepositoryInterface {
+	return &taggedNoteRepository{inner: inner, tags: tags}
+}
+
+func (r *taggedNoteRepository) Create(note *models.Note) error {
+	stored := *note
+	stored.Tags = ""
+	if err := r.inner.Create(&stored); err != nil {
+		return err
+	}
+	note.ID = stored.ID
+	note.CreatedAt, note.UpdatedAt = stored.CreatedAt, stored.UpdatedAt
+	return r.setTags(note)
+}
+
+func (r *taggedNoteRepository) Insert(note *models.Note) error {
+	stored := *note
+	stored.Tags = ""
+	if err := r.inner.Insert(&stored); err != nil {
+		return err
+	}
+	note.CreatedAt, note.UpdatedAt = stored.CreatedAt, stored.UpdatedAt
+	return r.setTags(note)
+}
+
+func (r *taggedNoteRepository) GetAll() ([]*models.Note, error) {
+	notes, err := r.inner.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	return notes, r.fillTags(notes)
+}
+
+func (r *taggedNoteRepository) GetByID(id string) (*models.Note, error) {
+	note, err := r.inner.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := r.tags.GetNoteTags(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) > 0 {
+		note.Tags = joinTagNames(tags)
+	}
+	return note, nil
+}
+
+func (r *taggedNoteRepository) Update(note *models.Note) error {
+	stored := *note
+	stored.Tags = ""
+	if err := r.inner.Update(&stored); err != nil {
+		return err
+	}
+	note.UpdatedAt = stored.UpdatedAt
+	if err := r.setTags(note); err != nil {
+		return err
+	}
+	_, err := r.tags.DeleteUnused()
+	return err
+}
+
+func (r *taggedNoteRepository) Delete(id string) error {
+	if err := r.inner.Delete(id); err != nil {
+		return err
+	}
+	if err := r.tags.SetNoteTags(id, nil); err != nil {
+		return err
+	}
+	_, err := r.tags.DeleteUnused()
+	return err
+}
+
+func (r *taggedNoteRepository) Restore(id string) error {
+	return r.inner.Restore(id)
+}
+
+func (r *taggedNoteRepository) SetState(id string, state models.NoteState, on bool) error {
+	return r.inner.SetState(id, state, on)
+}
+
+func (r *taggedNoteRepository) SetReminder(id string, remindAt *time.Time) error {
+	return r.inner.SetReminder(id, remindAt)
+}
+
+func (r *taggedNoteRepository) MarkReminded(id string, at time.Time) error {
+	return r.inner.MarkReminded(id, at)
+}
+
+func (r *taggedNoteRepository) GetByCategoryID(categoryID string) ([]*models.Note, error) {
+	notes, err := r.inner.GetByCategoryID(categoryID)
+	if err != nil {
+		return nil, err
+	}
+	return notes, r.fillTags(notes)
+}
+
+// GetFiltered resolves filter.Tags to tag IDs; a tag that does not exist
+// matches no notes
+func (r *taggedNoteRepository) GetFiltered(filter models.NoteFilter) ([]*models.Note, error) {
+	if len(filter.Tags) > 0 {
+		ids := append([]string(nil), filter.TagIDs...)
+		for _, name := range filter.Tags {
+			tag, err := r.tags.GetByName(name)
+			if err == utils.ErrTagNotFound {
+				return []*models.Note{}, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, tag.ID)
+		}
+		filter.Tags, filter.TagIDs = nil, ids
+	}
+
+	notes, err := r.inner.GetFiltered(filter)
+	if err != nil {
+		return nil, err
+	}
+	return notes, r.fillTags(notes)
+}
+
+// setTags links note to the tags named in note.Tags, creating the ones that
+// do not exist yet. Names are matched ignoring case, and note.Tags is
+// rewritten with the names of the existing tags.
+func (r *taggedNoteRepository) setTags(note *models.Note) error {
+	names := models.SplitTags(note.Tags)
+	if len(names) == 0 {
+		note.Tags = ""
+		return r.tags.SetNoteTags(note.ID, nil)
+	}
+
+	var ids, canonical []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		tag, err := r.tags.GetByName(name)
+		if err == utils.ErrTagNotFound {
+			tag = &models.Tag{Name: name}
+			err = r.tags.Create(tag)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to set tag %q: %w", name, err)
+		}
+		if seen[tag.ID] {
+			continue
+		}
+		seen[tag.ID] = true
+		ids = append(ids, tag.ID)
+		canonical = append(canonical, tag.Name)
+	}
+
+	if err := r.tags.SetNoteTags(note.ID, ids); err != nil {
+		return err
+	}
+	note.Tags = models.JoinTags(canonical)
+	return nil
+}
+
+// fillTags sets the tags of notes from the tags table. A note without
+// linked tags keeps the value read from notes.tags, which is empty once
+// MigrateLegacyTags has run.
+func (r *taggedNoteRepository) fillTags(notes []*models.Note) error {
+	if len(notes) == 0 {
+		return nil
+	}
+	byNote, err := r.tags.GetAllNoteTags()
+	if err != nil {
+		return err
+	}
+	for _, note := range notes {
+		if tags := byNote[note.ID]; len(tags) > 0 {
+			note.Tags = joinTagNames(tags)
+		}
+	}
+	return nil
+}
+
+// joinTagNames returns the names of tags as a comma-separated string
+func joinTagNames(tags []models.Tag) string {
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = tag.Name
+	}
+	return models.JoinTags(names)
+}
+
+// MigrateLegacyTags moves the tags of notes written before the tags table
+// existed from notes.tags to the tags table, encrypting tag names with c and
+// indexing them with bi. Existing tags are looked up by their index, so
+// UpdateBlindIndexes must have run first.
+// It runs in one transaction and returns the number of notes migrated;
+// once every note is migrated it only costs a query, so it is safe to call
+// on every start. A note whose tags cannot be decrypted is logged and left
+// as it is.
+func MigrateLegacyTags(db *sql.DB, c utils.Cipher, bi *utils.BlindIndex) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	type legacy struct{ id, tags string }
+	rows, err := tx.Query("SELECT id, tags FROM notes WHERE tags IS NOT NULL AND tags != ''")
+	if err != nil {
+		return 0, fmt.Errorf("failed to query note tags: %w", err)
+	}
+	var pending []legacy
+	for rows.Next() {
+		var l legacy
+		if err := rows.Scan(&l.id, &l.tags); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan note tags: %w", err)
+		}
+		pending = append(pending, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error iterating note rows: %w", err)
+	}
+	if len(pending) == 0 {
+		return 0, nil
+	}
+
+	r := &taggedNoteRepository{tags: NewEncryptedTagRepository(NewTagRepository(tx), c, bi)}
+	migrated := 0
+	for _, l := range pending {
+		plain, err := c.Decrypt(l.tags)
+		if err != nil {
+			log.Printf("Skipping tags of note %s: %v", l.id, err)
+			continue
+		}
+		if strings.TrimSpace(plain) != "" {
+			if err := r.setTags(&models.Note{ID: l.id, Tags: plain}); err != nil {
+				return 0, fmt.Errorf("failed to migrate tags of note %s: %w", l.id, err)
+			}
+		}
+		if _, err := tx.Exec("UPDATE notes SET tags = '' WHERE id = ?", l.id); err != nil {
+			return 0, fmt.Errorf("failed to clear tags of note %s: %w", l.id, err)
+		}
+		migrated++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return migrated, nil
+}
@@ -0,0 +1,120 @@
+package repositories
+
+import (
+	"database/sql"
+	"fmt"
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/utils"
+	"time"
+)
+
+// transactionalNoteRepository writes every note in a transaction of its
+// own, so that the note row, its word indexes and its tags are written
+// together or not at all. Reads and writes of a single statement go to
+// the database directly.
+type transactionalNoteRepository struct {
+	db    *sql.DB
+	c     utils.Cipher
+	bi    *utils.BlindIndex
+	notes NoteRepositoryInterface
+}
+
+// NewTransactionalNoteRepository returns the note repository the server and
+// the CLI use on db: notes are encrypted with c, indexed with bi and keep
+// their tags in the tags table, and each write runs in its own
+// transaction. Code that already works in a transaction builds the same
+// repositories on it instead.
+func NewTransactionalNoteRepository(db *sql.DB, c utils.Cipher, bi *utils.BlindIndex) NoteRepositoryInterface {
+	return &transactionalNoteRepository{db: db, c: c, bi: bi, notes: newTaggedNotes(db, c, bi)}
+}
+
+// newTaggedNotes returns the encrypted, tagged note repository on db
+func newTaggedNotes(db DBTX, c utils.Cipher, bi *utils.BlindIndex) NoteRepositoryInterface {
+	return NewTaggedNoteRepository(
+		NewEncryptedNoteRepository(NewNoteRepository(db), c, bi),
+		NewEncryptedTagRepository(NewTagRepository(db), c, bi),
+	)
+}
+
+// inTx runs fn with the note repository on a new transaction, committing
+// it when fn succeeds
+func (r *transactionalNoteRepository) inTx(fn func(notes NoteRepositoryInterface) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(newTaggedNotes(tx, r.c, r.bi)); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit note: %w", err)
+	}
+	return nil
+}
+
+// The note is only updated once the transaction has committed, so a
+// caller never sees an ID or timestamps that were rolled back
+func (r *transactionalNoteRepository) Create(note *models.Note) error {
+	stored := *note
+	if err := r.inTx(func(notes NoteRepositoryInterface) error { return notes.Create(&stored) }); err != nil {
+		return err
+	}
+	*note = stored
+	return nil
+}
+
+func (r *transactionalNoteRepository) Insert(note *models.Note) error {
+	stored := *note
+	if err := r.inTx(func(notes NoteRepositoryInterface) error { return notes.Insert(&stored) }); err != nil {
+		return err
+	}
+	*note = stored
+	return nil
+}
+
+func (r *transactionalNoteRepository) GetAll() ([]*models.Note, error) {
+	return r.notes.GetAll()
+}
+
+func (r *transactionalNoteRepository) GetByID(id string) (*models.Note, error) {
+	return r.notes.GetByID(id)
+}
+
+func (r *transactionalNoteRepository) Update(note *models.Note) error {
+	stored := *note
+	if err := r.inTx(func(notes NoteRepositoryInterface) error { return notes.Update(&stored) }); err != nil {
+		return err
+	}
+	*note = stored
+	return nil
+}
+
+func (r *transactionalNoteRepository) Delete(id string) error {
+	return r.inTx(func(notes NoteRepositoryInterface) error { return notes.Delete(id) })
+}
+
+func (r *transactionalNoteRepository) GetByCategoryID(categoryID string) ([]*models.Note, error) {
+	return r.notes.GetByCategoryID(categoryID)
+}
+
+func (r *transactionalNoteRepository) GetFiltered(filter models.NoteFilter) ([]*models.Note, error) {
+	return r.notes.GetFiltered(filter)
+}
+
+func (r *transactionalNoteRepository) Restore(id string) error {
+	return r.notes.Restore(id)
+}
+
+func (r *transactionalNoteRepository) SetState(id string, state models.NoteState, on bool) error {
+	return r.notes.SetState(id, state, on)
+}
+
+func (r *transactionalNoteRepository) SetReminder(id string, remindAt *time.Time) error {
+	return r.notes.SetReminder(id, remindAt)
+}
+
+func (r *transactionalNoteRepository) MarkReminded(id string, at time.Time) error {
+	return r.notes.MarkReminded(id, at)
+}
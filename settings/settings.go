@@ -1,24 +1,52 @@
 package settings
 
 import (
+	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
-	"math/rand"
+	"fmt"
 	"os"
-	"time"
 )
 
 type Settings struct {
 	EncryptionKey string `json:"encryption_key"`
-	NotesLimit    int    `json:"notes_limit,omitempty"`
+	// KeySource records how the encryption key was created. It is empty for
+	// keys created before it was recorded.
+	KeySource  string `json:"key_source,omitempty"`
+	NotesLimit int    `json:"notes_limit,omitempty"`
+	// BlindIndexKey is the base64 key of the blind indexes used to search
+	// encrypted fields. It is independent of the encryption key and of the
+	// key provider, and is created on first use.
+	BlindIndexKey string `json:"blind_index_key,omitempty"`
 }
 
+// Values of Settings.KeySource
+const (
+	// KeySourceRandom marks a key generated from crypto/rand
+	KeySourceRandom = "crypto/rand"
+	// KeySourceUser marks a key supplied by the user
+	KeySourceUser = "user"
+)
+
 const (
-	settingsFile      = "settings.json"
 	keyLength         = 32 // Length of the encryption key in bytes
 	defaultNotesLimit = 10 // Default limit for notes if not specified
 )
 
+// settingsFile is the path of the settings file, relative to the working
+// directory unless changed with SetFilePath
+var settingsFile = "settings.json"
+
+// SetFilePath changes the path of the settings file used by LoadSettings
+func SetFilePath(path string) {
+	settingsFile = path
+}
+
+// FilePath returns the path of the settings file
+func FilePath() string {
+	return settingsFile
+}
+
 // LoadSettings loads settings from the settings.json file
 // If the file doesn't exist or the encryption key is not set,
 // it will generate a new key and save it
@@ -30,7 +58,7 @@ func LoadSettings() (*Settings, error) {
 	if err != nil {
 		if os.IsNotExist(err) {
 			// File doesn't exist, generate new settings
-			return generateAndSaveSettings()
+			return generateAndSaveSettings(&settings)
 		}
 		return nil, err
 	}
@@ -43,7 +71,7 @@ func LoadSettings() (*Settings, error) {
 
 	// If encryption key is not set, generate new settings
 	if settings.EncryptionKey == "" {
-		return generateAndSaveSettings()
+		return generateAndSaveSettings(&settings)
 	}
 
 	// If notes limit is not set, use default
@@ -54,38 +82,65 @@ func LoadSettings() (*Settings, error) {
 	return &settings, nil
 }
 
-// generateAndSaveSettings creates new settings with a generated encryption key
-// and saves them to the settings file
-func generateAndSaveSettings() (*Settings, error) {
+// generateAndSaveSettings gives settings a generated encryption key and
+// saves them to the settings file. The blind index key is kept, since the
+// file may have been created by LoadBlindIndexKey.
+func generateAndSaveSettings(settings *Settings) (*Settings, error) {
 	// Generate new encryption key
-	key := generateEncryptionKey()
+	key, err := GenerateEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
 
-	// Create settings with the new key
-	settings := &Settings{
-		EncryptionKey: base64.StdEncoding.EncodeToString(key),
-		NotesLimit:    defaultNotesLimit,
+	settings.EncryptionKey = key
+	settings.KeySource = KeySourceRandom
+	if settings.NotesLimit <= 0 {
+		settings.NotesLimit = defaultNotesLimit
 	}
 
 	// Save to file
-	data, err := json.MarshalIndent(settings, "", "    ")
-	if err != nil {
+	if err := settings.Save(); err != nil {
 		return nil, err
 	}
 
-	err = os.WriteFile(settingsFile, data, 0600)
+	return settings, nil
+}
+
+// Save writes the settings to the settings file
+func (s *Settings) Save() error {
+	return s.SaveTo(settingsFile)
+}
+
+// SaveTo writes the settings to the given path with owner-only permissions
+func (s *Settings) SaveTo(path string) error {
+	data, err := json.MarshalIndent(s, "", "    ")
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return settings, nil
+	return os.WriteFile(path, data, 0600)
 }
 
-// generateEncryptionKey creates a new random encryption key
-func generateEncryptionKey() []byte {
-	rand.Seed(time.Now().UnixNano())
+// GenerateEncryptionKey returns a new base64-encoded encryption key read
+// from the operating system's cryptographically secure random source
+func GenerateEncryptionKey() (string, error) {
 	key := make([]byte, keyLength)
-	rand.Read(key)
-	return key
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("failed to generate encryption key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// KeyRotationRecommended reports whether the origin of the key is unknown.
+// Keys created by the old generator, which seeded math/rand with the
+// current time and so produced predictable keys, carry no KeySource; so do
+// keys users put in the settings file themselves before KeySource was
+// recorded. The two cannot be told apart: math/rand cuts its seed to 31
+// bits, so replaying the seeds around the time the file was written means
+// trying nearly all of them. It only flags unknown origin, and setting
+// KeySource to KeySourceUser keeps such a key without the recommendation.
+func (s *Settings) KeyRotationRecommended() bool {
+	return s.KeySource == ""
 }
 
 // GetEncryptionKey returns the base64-decoded encryption key
@@ -93,6 +148,58 @@ func (s *Settings) GetEncryptionKey() ([]byte, error) {
 	return base64.StdEncoding.DecodeString(s.EncryptionKey)
 }
 
+// ReadSettings returns the settings in the settings file as they are,
+// without generating anything; a missing file gives empty settings
+func ReadSettings() (*Settings, error) {
+	var settings Settings
+	data, err := os.ReadFile(settingsFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &settings, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+
+// LoadBlindIndexKey returns the blind index key from the settings file,
+// generating and saving one when the file or the key does not exist yet.
+// Unlike LoadSettings it does not create an encryption key, so it can be
+// used with any key provider.
+func LoadBlindIndexKey() ([]byte, error) {
+	settings, err := ReadSettings()
+	if err != nil {
+		return nil, err
+	}
+
+	if settings.BlindIndexKey == "" {
+		key, err := GenerateEncryptionKey()
+		if err != nil {
+			return nil, err
+		}
+		settings.BlindIndexKey = key
+		if err := settings.Save(); err != nil {
+			return nil, err
+		}
+	}
+	return settings.GetBlindIndexKey()
+}
+
+// GetBlindIndexKey returns the base64-decoded blind index key
+func (s *Settings) GetBlindIndexKey() ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(s.BlindIndexKey)
+	if err != nil {
+		return nil, fmt.Errorf("blind index key is not valid base64: %w", err)
+	}
+	if len(key) != keyLength {
+		return nil, fmt.Errorf("blind index key is %d bytes, expected %d", len(key), keyLength)
+	}
+	return key, nil
+}
+
 // GetNotesLimit returns the notes limit, ensuring it's never less than 1
 func (s *Settings) GetNotesLimit() int {
 	if s.NotesLimit <= 0 {
@@ -0,0 +1,90 @@
+package settings
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+// useFile points the package at a settings file in a temporary directory
+// for the rest of the test
+func useFile(t *testing.T) string {
+	t.Helper()
+	old := settingsFile
+	path := filepath.Join(t.TempDir(), "settings.json")
+	SetFilePath(path)
+	t.Cleanup(func() { SetFilePath(old) })
+	return path
+}
+
+func TestBlindIndexKeyIsSeparate(t *testing.T) {
+	for _, order := range []string{"blind index key first", "encryption key first"} {
+		t.Run(order, func(t *testing.T) {
+			useFile(t)
+			var indexKey []byte
+			var s *Settings
+			var err error
+			if order == "blind index key first" {
+				if indexKey, err = LoadBlindIndexKey(); err != nil {
+					t.Fatal(err)
+				}
+				s, err = LoadSettings()
+			} else {
+				if s, err = LoadSettings(); err != nil {
+					t.Fatal(err)
+				}
+				indexKey, err = LoadBlindIndexKey()
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			encryptionKey, err := s.GetEncryptionKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(indexKey) != keyLength || len(encryptionKey) != keyLength {
+				t.Fatalf("keys are %d and %d bytes, want %d", len(indexKey), len(encryptionKey), keyLength)
+			}
+			if bytes.Equal(indexKey, encryptionKey) {
+				t.Error("the blind index key is the encryption key")
+			}
+
+			// Both keys are kept in the file and loaded again as they are
+			again, err := LoadBlindIndexKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			saved, err := ReadSettings()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(again, indexKey) || saved.EncryptionKey != s.EncryptionKey {
+				t.Error("the keys changed when loaded again")
+			}
+		})
+	}
+}
+
+func TestLoadBlindIndexKeyLeavesEncryptionKeyAlone(t *testing.T) {
+	useFile(t)
+	if _, err := LoadBlindIndexKey(); err != nil {
+		t.Fatal(err)
+	}
+	s, err := ReadSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.EncryptionKey != "" {
+		t.Error("LoadBlindIndexKey created an encryption key, which other key providers do not use")
+	}
+}
+
+func TestGetBlindIndexKeyRejectsBadKeys(t *testing.T) {
+	for _, key := range []string{"not base64!", "c2hvcnQ="} {
+		s := &Settings{BlindIndexKey: key}
+		if _, err := s.GetBlindIndexKey(); err == nil {
+			t.Errorf("GetBlindIndexKey accepted %q", key)
+		}
+	}
+}
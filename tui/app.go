@@ -0,0 +1,572 @@
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"personal-notes-with-go/models"
+	"personal-notes-with-go/repositories"
+	"sort"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// EditFunc lets the user edit a note's subject and content, typically in an
+// external editor, and returns the new values
+type EditFunc func(subject, content string) (string, string, error)
+
+// pane is the part of the screen that receives navigation keys
+type pane int
+
+const (
+	paneCategories pane = iota
+	paneNotes
+)
+
+// mode changes how key presses are interpreted
+type mode int
+
+const (
+	modeNormal mode = iota
+	modeSearch
+	modeTags
+	modeConfirmDelete
+	modeMove
+	modeHelp
+)
+
+// sidebarKind distinguishes the pseudo categories from real ones
+type sidebarKind int
+
+const (
+	sidebarAll sidebarKind = iota
+	sidebarCategory
+	sidebarUncategorized
+)
+
+type sidebarItem struct {
+	kind     sidebarKind
+	label    string
+	category string
+}
+
+// App is a full-screen terminal UI for browsing and editing notes. It works
+// directly on the repositories, so it does not need a running server.
+type App struct {
+	categoryRepo repositories.CategoryRepositoryInterface
+	noteRepo     repositories.NoteRepositoryInterface
+	edit         EditFunc
+
+	in       *os.File
+	out      io.Writer
+	keys     *keyReader
+	rawState *term.State
+
+	categories []models.Category
+	notes      []*models.Note
+	visible    []*models.Note
+	sidebar    []sidebarItem
+
+	focus         pane
+	mode          mode
+	catIndex      int
+	noteIndex     int
+	catOffset     int
+	noteOffset    int
+	previewScroll int
+	search        string
+	input         string
+	status        string
+	width         int
+	height        int
+}
+
+// New creates the UI on the given repositories, which decrypt and encrypt
+// notes and categories themselves, so the UI only handles plaintext.
+func New(categoryRepo repositories.CategoryRepositoryInterface, noteRepo repositories.NoteRepositoryInterface, edit EditFunc) *App {
+	return &App{
+		categoryRepo: categoryRepo,
+		noteRepo:     noteRepo,
+		edit:         edit,
+		in:           os.Stdin,
+		out:          os.Stdout,
+		keys:         &keyReader{r: os.Stdin},
+		focus:        paneNotes,
+	}
+}
+
+// Run takes over the terminal until the user quits
+func (a *App) Run() error {
+	fd := int(a.in.Fd())
+	if !term.IsTerminal(fd) {
+		return errors.New("standard input is not a terminal")
+	}
+
+	if err := a.reload(); err != nil {
+		return err
+	}
+
+	if err := a.enterScreen(); err != nil {
+		return err
+	}
+	defer a.leaveScreen()
+
+	// Log lines, such as notes the repository could not decrypt, would be
+	// drawn over the screen
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	for {
+		a.render()
+
+		k, err := a.keys.readKey()
+		if err != nil {
+			return err
+		}
+		if quit := a.handleKey(k); quit {
+			return nil
+		}
+	}
+}
+
+// enterScreen switches to raw mode and the alternate screen
+func (a *App) enterScreen() error {
+	state, err := term.MakeRaw(int(a.in.Fd()))
+	if err != nil {
+		return fmt.Errorf("failed to enable raw mode: %w", err)
+	}
+	a.rawState = state
+	fmt.Fprint(a.out, "\x1b[?1049h\x1b[?25l")
+	return nil
+}
+
+// leaveScreen restores the terminal to the state it was in before Run
+func (a *App) leaveScreen() {
+	fmt.Fprint(a.out, "\x1b[?25h\x1b[?1049l")
+	if a.rawState != nil {
+		term.Restore(int(a.in.Fd()), a.rawState)
+		a.rawState = nil
+	}
+}
+
+// reload reads categories and the notes that are not archived from the
+// database, with the pinned notes first
+func (a *App) reload() error {
+	categories, err := a.categoryRepo.GetAll()
+	if err != nil {
+		return fmt.Errorf("failed to load categories: %w", err)
+	}
+	notes, err := a.noteRepo.GetFiltered(models.NoteFilter{})
+	if err != nil {
+		return fmt.Errorf("failed to load notes: %w", err)
+	}
+	sort.SliceStable(notes, func(i, j int) bool {
+		return strings.ToLower(notes[i].Subject) < strings.ToLower(notes[j].Subject)
+	})
+	models.SortPinnedFirst(notes)
+
+	a.categories = categories
+	a.notes = notes
+	a.sidebar = []sidebarItem{{kind: sidebarAll, label: "All notes"}}
+	a.addCategories(models.BuildCategoryTree(categories), 0)
+	a.sidebar = append(a.sidebar, sidebarItem{kind: sidebarUncategorized, label: "Uncategorized"})
+	a.catIndex = clamp(a.catIndex, 0, len(a.sidebar)-1)
+	a.applyFilter()
+	return nil
+}
+
+// addCategories adds nodes and their subcategories to the sidebar, indenting
+// subcategories under their parent
+func (a *App) addCategories(nodes []*models.CategoryNode, depth int) {
+	for _, node := range nodes {
+		label := strings.Repeat("  ", depth) + node.Name
+		a.sidebar = append(a.sidebar, sidebarItem{kind: sidebarCategory, label: label, category: node.ID})
+		a.addCategories(node.Children, depth+1)
+	}
+}
+
+// applyFilter recomputes the visible notes from the selected category and
+// the search text
+func (a *App) applyFilter() {
+	known := make(map[string]bool, len(a.categories))
+	for _, cat := range a.categories {
+		known[cat.ID] = true
+	}
+
+	item := a.sidebar[a.catIndex]
+	search := strings.ToLower(a.search)
+
+	a.visible = a.visible[:0]
+	for _, note := range a.notes {
+		switch item.kind {
+		case sidebarCategory:
+			if note.CategoryID != item.category {
+				continue
+			}
+		case sidebarUncategorized:
+			if known[note.CategoryID] {
+				continue
+			}
+		}
+		if search != "" &&
+			!strings.Contains(strings.ToLower(note.Subject), search) &&
+			!strings.Contains(strings.ToLower(note.Content), search) &&
+			!strings.Contains(strings.ToLower(note.Tags), search) {
+			continue
+		}
+		a.visible = append(a.visible, note)
+	}
+
+	a.noteIndex = clamp(a.noteIndex, 0, len(a.visible)-1)
+	a.previewScroll = 0
+}
+
+// selectedNote returns the highlighted note, if any
+func (a *App) selectedNote() *models.Note {
+	if a.noteIndex < 0 || a.noteIndex >= len(a.visible) {
+		return nil
+	}
+	return a.visible[a.noteIndex]
+}
+
+// categoryName returns the path of names of a category ID
+func (a *App) categoryName(id string) string {
+	return models.CategoryPath(a.categories, id)
+}
+
+// handleKey updates the state for a key press and reports whether to quit
+func (a *App) handleKey(k key) bool {
+	if k.kind == keyCtrlC {
+		return true
+	}
+
+	switch a.mode {
+	case modeSearch, modeTags:
+		a.handleInputKey(k)
+		return false
+	case modeConfirmDelete:
+		if k.kind == keyRune && (k.r == 'y' || k.r == 'Y') {
+			a.deleteSelected()
+		} else {
+			a.status = "Delete cancelled"
+		}
+		a.mode = modeNormal
+		return false
+	case modeHelp:
+		a.mode = modeNormal
+		return false
+	case modeMove:
+		switch {
+		case k.kind == keyEnter:
+			a.moveSelected()
+			a.mode = modeNormal
+			return false
+		case k.kind == keyEscape:
+			a.mode = modeNormal
+			a.status = "Move cancelled"
+			return false
+		}
+	}
+
+	switch {
+	case k.kind == keyRune && k.r == 'q':
+		return true
+	case k.kind == keyTab || k.kind == keyBackTab || k.kind == keyLeft || k.kind == keyRight ||
+		(k.kind == keyRune && (k.r == 'h' || k.r == 'l')):
+		a.switchFocus(k)
+	case k.kind == keyUp || (k.kind == keyRune && k.r == 'k'):
+		a.moveSelection(-1)
+	case k.kind == keyDown || (k.kind == keyRune && k.r == 'j'):
+		a.moveSelection(1)
+	case k.kind == keyHome || (k.kind == keyRune && k.r == 'g'):
+		a.moveSelection(-len(a.notes) - len(a.sidebar))
+	case k.kind == keyEnd || (k.kind == keyRune && k.r == 'G'):
+		a.moveSelection(len(a.notes) + len(a.sidebar))
+	case k.kind == keyPageDown || (k.kind == keyRune && k.r == 'J'):
+		a.previewScroll++
+	case k.kind == keyPageUp || (k.kind == keyRune && k.r == 'K'):
+		if a.previewScroll > 0 {
+			a.previewScroll--
+		}
+	case a.mode == modeMove:
+		// Only navigation is allowed while picking a category
+	case k.kind == keyRune && k.r == '/':
+		a.mode = modeSearch
+		a.input = a.search
+	case k.kind == keyEscape:
+		if a.search != "" {
+			a.search = ""
+			a.applyFilter()
+			a.status = "Search cleared"
+		}
+	case k.kind == keyRune && k.r == 'n':
+		a.createNote()
+	case k.kind == keyEnter && a.focus == paneCategories:
+		a.focus = paneNotes
+	case k.kind == keyEnter || (k.kind == keyRune && k.r == 'e'):
+		a.editSelected()
+	case k.kind == keyRune && k.r == 'd':
+		if note := a.selectedNote(); note != nil {
+			a.mode = modeConfirmDelete
+			a.status = fmt.Sprintf("Delete %q? (y/N)", note.Subject)
+		}
+	case k.kind == keyRune && k.r == 'm':
+		if a.selectedNote() != nil {
+			a.mode = modeMove
+			a.focus = paneCategories
+			a.status = "Move to: pick a category and press Enter (Esc to cancel)"
+		}
+	case k.kind == keyRune && k.r == 't':
+		if note := a.selectedNote(); note != nil {
+			a.mode = modeTags
+			a.input = note.Tags
+		}
+	case k.kind == keyRune && k.r == 'p':
+		a.cyclePriority()
+	case k.kind == keyRune && k.r == 'r':
+		if err := a.reload(); err != nil {
+			a.status = err.Error()
+		} else {
+			a.status = "Reloaded"
+		}
+	case k.kind == keyRune && k.r == '?':
+		a.mode = modeHelp
+	}
+	return false
+}
+
+// handleInputKey edits the text of the search or tags input line
+func (a *App) handleInputKey(k key) {
+	switch k.kind {
+	case keyEnter:
+		if a.mode == modeTags {
+			a.mode = modeNormal
+			a.setTags(a.input)
+			return
+		}
+		a.search = strings.TrimSpace(a.input)
+		a.mode = modeNormal
+		a.focus = paneNotes
+		a.noteIndex = 0
+		a.applyFilter()
+		a.status = fmt.Sprintf("%d note(s) match", len(a.visible))
+	case keyEscape:
+		a.mode = modeNormal
+	case keyBackspace:
+		if r := []rune(a.input); len(r) > 0 {
+			a.input = string(r[:len(r)-1])
+		}
+	case keyRune:
+		a.input += string(k.r)
+	}
+}
+
+// switchFocus moves the focus between the sidebar and the note list
+func (a *App) switchFocus(k key) {
+	if a.mode == modeMove {
+		return
+	}
+	switch {
+	case k.kind == keyLeft || (k.kind == keyRune && k.r == 'h'):
+		a.focus = paneCategories
+	case k.kind == keyRight || (k.kind == keyRune && k.r == 'l'):
+		a.focus = paneNotes
+	case a.focus == paneCategories:
+		a.focus = paneNotes
+	default:
+		a.focus = paneCategories
+	}
+}
+
+// moveSelection moves the highlight in the focused pane by delta rows
+func (a *App) moveSelection(delta int) {
+	if a.focus == paneCategories {
+		a.catIndex = clamp(a.catIndex+delta, 0, len(a.sidebar)-1)
+		if a.mode != modeMove {
+			a.noteIndex = 0
+			a.applyFilter()
+		}
+		return
+	}
+	a.noteIndex = clamp(a.noteIndex+delta, 0, len(a.visible)-1)
+	a.previewScroll = 0
+}
+
+// createNote writes a new note in the editor, in the selected category
+func (a *App) createNote() {
+	subject, content, err := a.runEditor("", "")
+	if err != nil {
+		a.status = err.Error()
+		return
+	}
+
+	note := &models.Note{Subject: subject, Content: content, Priority: models.CurrentPriorities().Default()}
+	if item := a.sidebar[a.catIndex]; item.kind == sidebarCategory {
+		note.CategoryID = item.category
+	}
+
+	if err := a.save(note, true); err != nil {
+		a.status = err.Error()
+		return
+	}
+	a.status = "Created " + subject
+	a.selectNote(note.ID)
+}
+
+// editSelected edits the highlighted note in the editor
+func (a *App) editSelected() {
+	note := a.selectedNote()
+	if note == nil {
+		return
+	}
+
+	subject, content, err := a.runEditor(note.Subject, note.Content)
+	if err != nil {
+		a.status = err.Error()
+		return
+	}
+
+	updated := *note
+	updated.Subject = subject
+	updated.Content = content
+	if err := a.save(&updated, false); err != nil {
+		a.status = err.Error()
+		return
+	}
+	a.status = "Saved " + subject
+	a.selectNote(note.ID)
+}
+
+// deleteSelected deletes the highlighted note
+func (a *App) deleteSelected() {
+	note := a.selectedNote()
+	if note == nil {
+		return
+	}
+	if err := a.noteRepo.Delete(note.ID); err != nil {
+		a.status = "Failed to delete note: " + err.Error()
+		return
+	}
+	a.status = "Deleted " + note.Subject
+	if err := a.reload(); err != nil {
+		a.status = err.Error()
+	}
+}
+
+// moveSelected moves the highlighted note to the category picked in the
+// sidebar; "All notes" and "Uncategorized" remove the category
+func (a *App) moveSelected() {
+	note := a.selectedNote()
+	if note == nil {
+		return
+	}
+
+	updated := *note
+	updated.CategoryID = ""
+	target := "no category"
+	if item := a.sidebar[a.catIndex]; item.kind == sidebarCategory {
+		updated.CategoryID = item.category
+		target = a.categoryName(item.category)
+	}
+
+	if err := a.save(&updated, false); err != nil {
+		a.status = err.Error()
+		return
+	}
+	a.status = fmt.Sprintf("Moved %q to %s", note.Subject, target)
+	a.noteIndex = 0
+	a.applyFilter()
+	a.selectNote(note.ID)
+}
+
+// setTags replaces the tags of the highlighted note
+func (a *App) setTags(tags string) {
+	note := a.selectedNote()
+	if note == nil {
+		return
+	}
+
+	updated := *note
+	updated.Tags = strings.TrimSpace(tags)
+	if err := a.save(&updated, false); err != nil {
+		a.status = err.Error()
+		return
+	}
+	a.status = "Tags updated"
+	a.selectNote(note.ID)
+}
+
+// cyclePriority advances the priority of the highlighted note
+func (a *App) cyclePriority() {
+	note := a.selectedNote()
+	if note == nil {
+		return
+	}
+
+	// The priority key cycles through the levels from lowest to highest
+	priorities := models.CurrentPriorities().Names()
+	next := priorities[0]
+	for i, p := range priorities {
+		if strings.EqualFold(p, note.Priority) {
+			next = priorities[(i+1)%len(priorities)]
+		}
+	}
+
+	updated := *note
+	updated.Priority = next
+	if err := a.save(&updated, false); err != nil {
+		a.status = err.Error()
+		return
+	}
+	a.status = "Priority set to " + next
+	a.selectNote(note.ID)
+}
+
+// runEditor suspends the UI while the user edits in the external editor
+func (a *App) runEditor(subject, content string) (string, string, error) {
+	a.leaveScreen()
+	defer func() {
+		if err := a.enterScreen(); err != nil {
+			a.status = err.Error()
+		}
+	}()
+	return a.edit(subject, content)
+}
+
+// save stores a note, then reloads the lists
+func (a *App) save(note *models.Note, create bool) error {
+	var err error
+	if create {
+		err = a.noteRepo.Create(note)
+	} else {
+		err = a.noteRepo.Update(note)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to save note: %w", err)
+	}
+
+	return a.reload()
+}
+
+// selectNote highlights the visible note with the given ID
+func (a *App) selectNote(id string) {
+	for i, note := range a.visible {
+		if note.ID == id {
+			a.noteIndex = i
+			return
+		}
+	}
+}
+
+func clamp(v, lo, hi int) int {
+	if v > hi {
+		v = hi
+	}
+	if v < lo {
+		v = lo
+	}
+	return v
+}
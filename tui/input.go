@@ -0,0 +1,105 @@
+package tui
+
+import (
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// keyKind identifies special keys; printable characters use keyRune
+type keyKind int
+
+const (
+	keyRune keyKind = iota
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyPageUp
+	keyPageDown
+	keyHome
+	keyEnd
+	keyTab
+	keyBackTab
+	keyEnter
+	keyEscape
+	keyBackspace
+	keyCtrlC
+	keyUnknown
+)
+
+// key is a single key press read from the terminal
+type key struct {
+	kind keyKind
+	r    rune
+}
+
+// escapeSequences maps the CSI and SS3 sequences sent by common terminals
+var escapeSequences = map[string]keyKind{
+	"[A": keyUp, "[B": keyDown, "[C": keyRight, "[D": keyLeft,
+	"OA": keyUp, "OB": keyDown, "OC": keyRight, "OD": keyLeft,
+	"[5~": keyPageUp, "[6~": keyPageDown,
+	"[H": keyHome, "[F": keyEnd, "[1~": keyHome, "[4~": keyEnd,
+	"OH": keyHome, "OF": keyEnd,
+	"[Z": keyBackTab,
+}
+
+// keyReader turns the bytes read from a terminal in raw mode into key
+// presses. A single read can hold several keys when text is pasted, so the
+// remainder is kept for the next call.
+type keyReader struct {
+	r       io.Reader
+	pending []byte
+}
+
+// readKey returns the next key press. A terminal delivers an escape sequence
+// in a single read, so a read that contains only ESC is the Escape key itself.
+func (kr *keyReader) readKey() (key, error) {
+	if len(kr.pending) == 0 {
+		buf := make([]byte, 256)
+		n, err := kr.r.Read(buf)
+		if err != nil {
+			return key{}, err
+		}
+		kr.pending = buf[:n]
+	}
+	if len(kr.pending) == 0 {
+		return key{kind: keyUnknown}, nil
+	}
+
+	k, size := parseKey(kr.pending)
+	kr.pending = kr.pending[size:]
+	return k, nil
+}
+
+// parseKey decodes the first key in buf and returns it with its length
+func parseKey(buf []byte) (key, int) {
+	switch b := buf[0]; {
+	case b == 0x1b:
+		if len(buf) == 1 {
+			return key{kind: keyEscape}, 1
+		}
+		for seq, kind := range escapeSequences {
+			if strings.HasPrefix(string(buf[1:]), seq) {
+				return key{kind: kind}, 1 + len(seq)
+			}
+		}
+		return key{kind: keyUnknown}, len(buf)
+	case b == 3:
+		return key{kind: keyCtrlC}, 1
+	case b == '\t':
+		return key{kind: keyTab}, 1
+	case b == '\r' || b == '\n':
+		return key{kind: keyEnter}, 1
+	case b == 0x7f || b == 0x08:
+		return key{kind: keyBackspace}, 1
+	case b < 0x20:
+		return key{kind: keyUnknown}, 1
+	}
+
+	ch, size := utf8.DecodeRune(buf)
+	if ch == utf8.RuneError {
+		return key{kind: keyUnknown}, max(size, 1)
+	}
+	return key{kind: keyRune, r: ch}, size
+}
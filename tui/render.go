@@ -0,0 +1,270 @@
+package tui
+
+import (
+	"fmt"
+	"personal-notes-with-go/models"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// ANSI styles used by the renderer
+const (
+	styleReset   = "\x1b[0m"
+	styleBold    = "\x1b[1m"
+	styleDim     = "\x1b[2m"
+	styleReverse = "\x1b[7m"
+)
+
+const (
+	sidebarWidth  = 22
+	minListWidth  = 28
+	minPreviewLen = 20
+)
+
+// helpLines is shown by the ? key
+var helpLines = []string{
+	"Keys",
+	"",
+	"  j/k, Up/Down      move selection",
+	"  g/G, Home/End     first / last item",
+	"  Tab, h/l          switch between categories and notes",
+	"  J/K, PgDn/PgUp    scroll the preview",
+	"  /                 search subject, content and tags",
+	"  Esc               clear the search",
+	"  n                 new note in the selected category",
+	"  e, Enter          edit the note in $EDITOR",
+	"  t                 edit tags",
+	"  p                 cycle priority",
+	"  m                 move the note to another category",
+	"  d                 delete the note",
+	"  r                 reload from the database",
+	"  q, Ctrl-C         quit",
+	"",
+	"Press any key to close this help.",
+}
+
+// render draws the whole screen
+func (a *App) render() {
+	a.width, a.height = 80, 24
+	if w, h, err := term.GetSize(int(a.in.Fd())); err == nil {
+		a.width, a.height = w, h
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+
+	// Title bar
+	title := fmt.Sprintf(" Personal Notes  %d/%d notes", len(a.visible), len(a.notes))
+	if a.search != "" {
+		title += fmt.Sprintf("  search: %q", a.search)
+	}
+	b.WriteString(styleReverse + pad(title, a.width) + styleReset + "\r\n")
+
+	bodyHeight := a.height - 2
+	if a.mode == modeHelp {
+		for i := 0; i < bodyHeight; i++ {
+			line := ""
+			if i < len(helpLines) {
+				line = "  " + helpLines[i]
+			}
+			b.WriteString(pad(line, a.width) + "\r\n")
+		}
+	} else {
+		a.renderBody(&b, bodyHeight)
+	}
+
+	// Status line
+	b.WriteString(a.statusLine())
+	fmt.Fprint(a.out, b.String())
+}
+
+// renderBody draws the sidebar, the note list and the preview side by side
+func (a *App) renderBody(b *strings.Builder, height int) {
+	listWidth := a.width / 3
+	if listWidth < minListWidth {
+		listWidth = minListWidth
+	}
+	previewWidth := a.width - sidebarWidth - listWidth - 2
+	showPreview := previewWidth >= minPreviewLen
+	if !showPreview {
+		listWidth = a.width - sidebarWidth - 1
+	}
+
+	a.catOffset = scrollOffset(a.catIndex, a.catOffset, height)
+	a.noteOffset = scrollOffset(a.noteIndex, a.noteOffset, height)
+	preview := a.previewLines(previewWidth - 1)
+
+	for row := 0; row < height; row++ {
+		// Sidebar
+		i := a.catOffset + row
+		if i < len(a.sidebar) {
+			b.WriteString(a.cell(" "+a.sidebar[i].label, sidebarWidth, i == a.catIndex, a.focus == paneCategories))
+		} else {
+			b.WriteString(pad("", sidebarWidth))
+		}
+		b.WriteString(styleDim + "│" + styleReset)
+
+		// Note list
+		i = a.noteOffset + row
+		switch {
+		case i < len(a.visible):
+			note := a.visible[i]
+			line := fmt.Sprintf(" %s %s", priorityMarker(note.Priority), note.Subject)
+			b.WriteString(a.cell(line, listWidth, i == a.noteIndex, a.focus == paneNotes))
+		case row == 0 && len(a.visible) == 0:
+			b.WriteString(styleDim + pad(" no notes", listWidth) + styleReset)
+		default:
+			b.WriteString(pad("", listWidth))
+		}
+
+		// Preview
+		if showPreview {
+			b.WriteString(styleDim + "│" + styleReset + " ")
+			if row < len(preview) {
+				b.WriteString(preview[row])
+			}
+		}
+		b.WriteString("\x1b[K\r\n")
+	}
+}
+
+// cell renders a list entry, highlighting it when it is selected
+func (a *App) cell(text string, width int, selected, focused bool) string {
+	text = pad(text, width)
+	switch {
+	case selected && focused:
+		return styleReverse + text + styleReset
+	case selected:
+		return styleBold + text + styleReset
+	default:
+		return text
+	}
+}
+
+// previewLines returns the lines of the preview pane for the selected note
+func (a *App) previewLines(width int) []string {
+	note := a.selectedNote()
+	if note == nil || width <= 0 {
+		return nil
+	}
+
+	lines := []string{styleBold + truncate(note.Subject, width) + styleReset}
+	meta := fmt.Sprintf("Priority: %s", note.Priority)
+	if category := a.categoryName(note.CategoryID); category != "" {
+		meta += "  Category: " + category
+	}
+	lines = append(lines, styleDim+truncate(meta, width)+styleReset)
+	if note.Tags != "" {
+		lines = append(lines, styleDim+truncate("Tags: "+note.Tags, width)+styleReset)
+	}
+	lines = append(lines, "")
+
+	content := wrap(note.Content, width)
+	if a.previewScroll >= len(content) {
+		a.previewScroll = max(len(content)-1, 0)
+	}
+	return append(lines, content[a.previewScroll:]...)
+}
+
+// statusLine returns the bottom line: an input prompt, a message or help
+func (a *App) statusLine() string {
+	switch a.mode {
+	case modeSearch:
+		return pad("/"+a.input+"█", a.width)
+	case modeTags:
+		return pad("Tags: "+a.input+"█", a.width)
+	}
+	if a.status != "" {
+		status := a.status
+		if a.mode == modeNormal {
+			a.status = ""
+		}
+		return styleBold + pad(" "+status, a.width) + styleReset
+	}
+	return styleDim + pad(" q quit  / search  n new  e edit  d delete  m move  t tags  p priority  ? help", a.width) + styleReset
+}
+
+// priorityMarker returns a short symbol for a priority: ! for the highest
+// level, . for the lowest and - for the others
+func priorityMarker(priority string) string {
+	priorities := models.CurrentPriorities()
+	levels := priorities.Levels()
+	switch rank := priorities.Rank(priority); {
+	case len(levels) > 1 && rank == levels[len(levels)-1].Rank:
+		return "!"
+	case len(levels) > 1 && rank == levels[0].Rank:
+		return "."
+	default:
+		return "-"
+	}
+}
+
+// scrollOffset keeps the selected row within a window of height rows
+func scrollOffset(selected, offset, height int) int {
+	if height <= 0 {
+		return 0
+	}
+	if selected < offset {
+		return selected
+	}
+	if selected >= offset+height {
+		return selected - height + 1
+	}
+	return offset
+}
+
+// pad truncates or pads s with spaces to exactly width runes
+func pad(s string, width int) string {
+	s = truncate(s, width)
+	if n := utf8.RuneCountInString(s); n < width {
+		s += strings.Repeat(" ", width-n)
+	}
+	return s
+}
+
+// truncate shortens s to at most width runes, marking the cut with an ellipsis
+func truncate(s string, width int) string {
+	s = strings.ReplaceAll(s, "\t", " ")
+	if width <= 0 {
+		return ""
+	}
+	r := []rune(s)
+	if len(r) <= width {
+		return s
+	}
+	if width == 1 {
+		return "…"
+	}
+	return string(r[:width-1]) + "…"
+}
+
+// wrap breaks text into lines of at most width runes, preferring to break
+// at spaces
+func wrap(text string, width int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		r := []rune(strings.ReplaceAll(paragraph, "\t", "    "))
+		if len(r) == 0 {
+			lines = append(lines, "")
+			continue
+		}
+		for len(r) > width {
+			cut := width
+			for i := width; i > width/2; i-- {
+				if r[i] == ' ' {
+					cut = i
+					break
+				}
+			}
+			lines = append(lines, string(r[:cut]))
+			r = r[cut:]
+			if len(r) > 0 && r[0] == ' ' {
+				r = r[1:]
+			}
+		}
+		lines = append(lines, string(r))
+	}
+	return lines
+}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Kinds of values with a blind index. The kind is part of the hashed data,
+// so equal values of different kinds do not get the same index.
+const (
+	BlindIndexTag     = "tag"
+	BlindIndexSubject = "subject"
+	BlindIndexWord    = "word"
+)
+
+// blindIndexSize is the number of bytes of the HMAC kept in an index
+const blindIndexSize = 16
+
+// BlindIndex computes blind indexes: keyed hashes of normalized values that
+// are stored next to the ciphertext. Equal values have equal indexes, so
+// they can be looked up with SQL, while someone holding only the database
+// cannot test guesses without the key. The key must not be the encryption
+// key.
+type BlindIndex struct {
+	key []byte
+}
+
+// NewBlindIndex returns a BlindIndex using the 32-byte key
+func NewBlindIndex(key []byte) (*BlindIndex, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("blind index requires a %d-byte key, got %d bytes", KeySize, len(key))
+	}
+	return &BlindIndex{key: key}, nil
+}
+
+// Hash returns the index of value as a value of kind. Values are compared
+// ignoring case and surrounding space. A nil BlindIndex returns empty
+// indexes, which match nothing.
+func (b *BlindIndex) Hash(kind, value string) string {
+	if b == nil {
+		return ""
+	}
+	mac := hmac.New(sha256.New, b.key)
+	mac.Write([]byte(kind))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strings.ToLower(strings.TrimSpace(value))))
+	return base64.RawStdEncoding.EncodeToString(mac.Sum(nil)[:blindIndexSize])
+}
+
+// Words returns the indexes of the distinct words of text, as split by
+// SplitWords
+func (b *BlindIndex) Words(text string) []string {
+	words := SplitWords(text)
+	indexes := make([]string, len(words))
+	for i, word := range words {
+		indexes[i] = b.Hash(BlindIndexWord, word)
+	}
+	return indexes
+}
+
+// KeyCheck returns a value that identifies the key without revealing it,
+// to detect indexes computed with another key
+func (b *BlindIndex) KeyCheck() string {
+	return b.Hash("key-check", "")
+}
+
+// SplitWords splits text into distinct lower-case words, made of letters
+// and digits
+func SplitWords(text string) []string {
+	var words []string
+	seen := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if !seen[word] {
+			seen[word] = true
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+var defaultBlindIndex *BlindIndex
+
+// InitBlindIndex sets the BlindIndex returned by DefaultBlindIndex
+func InitBlindIndex(key []byte) error {
+	b, err := NewBlindIndex(key)
+	if err != nil {
+		return err
+	}
+	defaultBlindIndex = b
+	return nil
+}
+
+// DefaultBlindIndex returns the BlindIndex set up by InitBlindIndex, or nil
+// before that
+func DefaultBlindIndex() *BlindIndex {
+	return defaultBlindIndex
+}
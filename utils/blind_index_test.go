@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestBlindIndexNormalizesValues(t *testing.T) {
+	bi, err := NewBlindIndex(testKey(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bi.Hash(BlindIndexTag, "rumah")
+	for _, value := range []string{"Rumah", "RUMAH", "  rumah\t", "\nRuMaH "} {
+		if got := bi.Hash(BlindIndexTag, value); got != want {
+			t.Errorf("Hash(%q) = %q, want the index of %q", value, got, "rumah")
+		}
+	}
+	for _, value := range []string{"rumahku", "ru mah", "rumah."} {
+		if bi.Hash(BlindIndexTag, value) == want {
+			t.Errorf("Hash(%q) matches %q", value, "rumah")
+		}
+	}
+	if bi.Hash(BlindIndexSubject, "rumah") == want || bi.Hash(BlindIndexWord, "rumah") == want {
+		t.Error("equal values of different kinds have the same index")
+	}
+}
+
+func TestBlindIndexDependsOnKey(t *testing.T) {
+	a, err := NewBlindIndex(testKey(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewBlindIndex(testKey(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Hash(BlindIndexTag, "rumah") == b.Hash(BlindIndexTag, "rumah") {
+		t.Error("two keys give the same index")
+	}
+	if a.KeyCheck() == b.KeyCheck() {
+		t.Error("two keys give the same key check")
+	}
+	again, _ := NewBlindIndex(testKey(2))
+	if a.KeyCheck() != again.KeyCheck() || a.Hash(BlindIndexTag, "rumah") != again.Hash(BlindIndexTag, "rumah") {
+		t.Error("the same key gives different indexes")
+	}
+}
+
+func TestNewBlindIndexKeySize(t *testing.T) {
+	for _, size := range []int{0, 16, KeySize - 1, KeySize + 1} {
+		if _, err := NewBlindIndex(make([]byte, size)); err == nil {
+			t.Errorf("NewBlindIndex accepted a %d-byte key", size)
+		}
+	}
+}
+
+func TestNilBlindIndex(t *testing.T) {
+	var bi *BlindIndex
+	if got := bi.Hash(BlindIndexTag, "rumah"); got != "" {
+		t.Errorf("nil Hash = %q, want an empty index", got)
+	}
+}
+
+func TestBlindIndexWords(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"", nil},
+		{"Belanja susu, ROTI dan susu!", []string{"belanja", "susu", "roti", "dan"}},
+		{"e-mail ke andi@example.com", []string{"e", "mail", "ke", "andi", "example", "com"}},
+		{"Catatan 2025: Übung", []string{"catatan", "2025", "übung"}},
+	}
+	for _, tt := range tests {
+		if got := SplitWords(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("SplitWords(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+
+	bi, err := NewBlindIndex(testKey(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := bi.Words("Susu ROTI susu")
+	want := []string{bi.Hash(BlindIndexWord, "susu"), bi.Hash(BlindIndexWord, "roti")}
+	if !slices.Equal(got, want) {
+		t.Errorf("Words = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,234 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Cipher encrypts and decrypts single field values. Ciphertexts are returned
+// as base64 strings, prefixed with the algorithm tag for algorithms other
+// than AES-256-GCM, so they can be stored in TEXT columns.
+type Cipher interface {
+	// Name returns the algorithm name as used in the configuration
+	Name() string
+	Encrypt(plaintext string) (string, error)
+	Decrypt(ciphertext string) (string, error)
+}
+
+// Cipher names accepted by NewCipher
+const (
+	CipherAESGCM            = "aes-256-gcm"
+	CipherXChaCha20Poly1305 = "xchacha20-poly1305"
+)
+
+// KeySize is the key length in bytes required by every cipher
+const KeySize = 32
+
+// xchachaPrefix tags XChaCha20-Poly1305 ciphertexts. AES-256-GCM values are
+// stored untagged, as they were before the algorithm was recorded.
+const xchachaPrefix = "xc1:"
+
+// NewCipher returns a cipher using key that encrypts new values with the
+// named algorithm and decrypts values written with any supported algorithm,
+// so data can be migrated from one algorithm to another gradually
+func NewCipher(name string, key []byte) (Cipher, error) {
+	aesCipher, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	xchachaCipher, err := newXChaCha20Poly1305(key)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &multiCipher{aes: aesCipher, xchacha: xchachaCipher}
+	switch name {
+	case CipherAESGCM, "":
+		c.primary = c.aes
+	case CipherXChaCha20Poly1305:
+		c.primary = c.xchacha
+	default:
+		return nil, fmt.Errorf("unknown cipher %q", name)
+	}
+	return c, nil
+}
+
+// AlgorithmOf returns the name of the algorithm a value was encrypted with,
+// or an empty string when the value is empty or not encrypted
+func AlgorithmOf(value string) string {
+	switch {
+	case value == "":
+		return ""
+	case strings.HasPrefix(value, xchachaPrefix):
+		return CipherXChaCha20Poly1305
+	case IsBase64(value):
+		return CipherAESGCM
+	default:
+		return ""
+	}
+}
+
+// IsCiphertext reports whether value looks like the output of a Cipher.
+// Empty values are considered valid since empty fields are not encrypted.
+func IsCiphertext(value string) bool {
+	return value == "" || AlgorithmOf(value) != ""
+}
+
+// NewAESGCMCipher returns an AES-256-GCM cipher with a random 12-byte nonce
+// per value
+func NewAESGCMCipher(key []byte) (Cipher, error) {
+	c, err := newAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func newAESGCM(key []byte) (*aeadCipher, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("%s requires a %d-byte key, got %d bytes", CipherAESGCM, KeySize, len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &aeadCipher{name: CipherAESGCM, aead: gcm}, nil
+}
+
+// NewXChaCha20Poly1305Cipher returns an XChaCha20-Poly1305 cipher. Its
+// 24-byte nonce is large enough to be picked at random without any risk of
+// reuse, however many values are encrypted with one key.
+func NewXChaCha20Poly1305Cipher(key []byte) (Cipher, error) {
+	c, err := newXChaCha20Poly1305(key)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func newXChaCha20Poly1305(key []byte) (*aeadCipher, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("%s requires a %d-byte key, got %d bytes", CipherXChaCha20Poly1305, KeySize, len(key))
+	}
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	return &aeadCipher{name: CipherXChaCha20Poly1305, prefix: xchachaPrefix, aead: aead}, nil
+}
+
+// aeadCipher implements Cipher on top of an AEAD, storing values as
+// prefix + base64(nonce || ciphertext)
+type aeadCipher struct {
+	name   string
+	prefix string
+	aead   cipher.AEAD
+}
+
+func (c *aeadCipher) Name() string {
+	return c.name
+}
+
+func (c *aeadCipher) Encrypt(plaintext string) (string, error) {
+	// Handle empty text case
+	if plaintext == "" {
+		return "", nil
+	}
+
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	ciphertext := c.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return c.prefix + base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+func (c *aeadCipher) Decrypt(encryptedText string) (string, error) {
+	// Handle empty text case
+	if encryptedText == "" {
+		return "", nil
+	}
+
+	encoded, ok := strings.CutPrefix(encryptedText, c.prefix)
+	if !ok {
+		return "", fmt.Errorf("value was not encrypted with %s", c.name)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+
+	nonceSize := c.aead.NonceSize()
+	if len(ciphertext) < nonceSize+c.aead.Overhead() {
+		return "", errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
+
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// multiCipher encrypts with its primary algorithm and decrypts with the
+// algorithm recorded in each value
+type multiCipher struct {
+	primary *aeadCipher
+	aes     *aeadCipher
+	xchacha *aeadCipher
+}
+
+func (c *multiCipher) Name() string {
+	return c.primary.name
+}
+
+func (c *multiCipher) Encrypt(plaintext string) (string, error) {
+	return c.primary.Encrypt(plaintext)
+}
+
+func (c *multiCipher) Decrypt(encryptedText string) (string, error) {
+	switch AlgorithmOf(encryptedText) {
+	case CipherXChaCha20Poly1305:
+		return c.xchacha.Decrypt(encryptedText)
+	case CipherAESGCM:
+		return c.aes.Decrypt(encryptedText)
+	default:
+		// Empty values, and values stored before encryption was
+		// introduced, are plain text
+		return encryptedText, nil
+	}
+}
+
+// unavailableCipher is the default cipher until encryption has been
+// initialized successfully; every operation fails
+type unavailableCipher struct{}
+
+var errEncryptionNotInitialized = errors.New("encryption system not properly initialized")
+
+func (unavailableCipher) Name() string {
+	return "none"
+}
+
+func (unavailableCipher) Encrypt(string) (string, error) {
+	return "", errEncryptionNotInitialized
+}
+
+func (unavailableCipher) Decrypt(string) (string, error) {
+	return "", errEncryptionNotInitialized
+}
@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, KeySize)
+}
+
+func TestCipherRoundTrip(t *testing.T) {
+	for _, name := range []string{CipherAESGCM, CipherXChaCha20Poly1305} {
+		t.Run(name, func(t *testing.T) {
+			c, err := NewCipher(name, testKey(1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.Name() != name {
+				t.Errorf("Name() = %q, want %q", c.Name(), name)
+			}
+
+			for _, plaintext := range []string{"", "a", "Belanja: susu, roti", strings.Repeat("ü", 1000)} {
+				ciphertext, err := c.Encrypt(plaintext)
+				if err != nil {
+					t.Fatalf("Encrypt(%q): %v", plaintext, err)
+				}
+				if plaintext != "" && AlgorithmOf(ciphertext) != name {
+					t.Errorf("AlgorithmOf(Encrypt(%q)) = %q, want %q", plaintext, AlgorithmOf(ciphertext), name)
+				}
+				got, err := c.Decrypt(ciphertext)
+				if err != nil {
+					t.Fatalf("Decrypt(Encrypt(%q)): %v", plaintext, err)
+				}
+				if got != plaintext {
+					t.Errorf("Decrypt(Encrypt(%q)) = %q", plaintext, got)
+				}
+			}
+
+			first, _ := c.Encrypt("same")
+			second, _ := c.Encrypt("same")
+			if first == second {
+				t.Error("encrypting the same value twice gave the same ciphertext")
+			}
+		})
+	}
+}
+
+func TestCipherDecryptsEitherAlgorithm(t *testing.T) {
+	aesCipher, err := NewCipher(CipherAESGCM, testKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	xchachaCipher, err := NewCipher(CipherXChaCha20Poly1305, testKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rows written before and after a change of cipher sit side by side
+	// until migrate-cipher has run
+	rows := map[string]string{}
+	for plaintext, c := range map[string]Cipher{"written with aes": aesCipher, "written with xchacha": xchachaCipher} {
+		ciphertext, err := c.Encrypt(plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows[ciphertext] = plaintext
+	}
+
+	for _, c := range []Cipher{aesCipher, xchachaCipher} {
+		for ciphertext, want := range rows {
+			got, err := c.Decrypt(ciphertext)
+			if err != nil {
+				t.Errorf("%s: Decrypt(%q): %v", c.Name(), ciphertext, err)
+			} else if got != want {
+				t.Errorf("%s: Decrypt(%q) = %q, want %q", c.Name(), ciphertext, got, want)
+			}
+		}
+	}
+}
+
+func TestAlgorithmOf(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", ""},
+		{"plain text from before encryption", ""},
+		{"aGVsbG8=", CipherAESGCM},
+		{"xc1:aGVsbG8=", CipherXChaCha20Poly1305},
+		{"xc1:", CipherXChaCha20Poly1305},
+	}
+	for _, tt := range tests {
+		if got := AlgorithmOf(tt.value); got != tt.want {
+			t.Errorf("AlgorithmOf(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCipherPlaintextFallback(t *testing.T) {
+	c, err := NewCipher(CipherXChaCha20Poly1305, testKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Values stored before encryption was introduced are returned as is
+	for _, value := range []string{"", "plain text", "not base64!"} {
+		got, err := c.Decrypt(value)
+		if err != nil {
+			t.Errorf("Decrypt(%q): %v", value, err)
+		} else if got != value {
+			t.Errorf("Decrypt(%q) = %q, want it unchanged", value, got)
+		}
+	}
+}
+
+func TestCipherRejectsWrongKey(t *testing.T) {
+	for _, name := range []string{CipherAESGCM, CipherXChaCha20Poly1305} {
+		t.Run(name, func(t *testing.T) {
+			c, err := NewCipher(name, testKey(1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			other, err := NewCipher(name, testKey(2))
+			if err != nil {
+				t.Fatal(err)
+			}
+			ciphertext, err := c.Encrypt("secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got, err := other.Decrypt(ciphertext); err == nil {
+				t.Errorf("Decrypt with another key = %q, want an error", got)
+			}
+
+			// Flipping a character of the base64 body breaks the tag
+			tampered := []byte(ciphertext)
+			i := len(tampered) - 5
+			if tampered[i] == 'A' {
+				tampered[i] = 'B'
+			} else {
+				tampered[i] = 'A'
+			}
+			if got, err := c.Decrypt(string(tampered)); err == nil {
+				t.Errorf("Decrypt of tampered value = %q, want an error", got)
+			}
+		})
+	}
+}
+
+func TestNewCipherErrors(t *testing.T) {
+	if _, err := NewCipher("rot13", testKey(1)); err == nil {
+		t.Error("NewCipher with an unknown algorithm succeeded")
+	}
+	if _, err := NewCipher(CipherAESGCM, testKey(1)[:16]); err == nil {
+		t.Error("NewCipher with a 16-byte key succeeded")
+	}
+}
@@ -1,63 +1,71 @@
 package utils
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"io"
-	"personal-notes-with-go/settings"
 	"strings"
 )
 
 var (
+	defaultCipher   Cipher = unavailableCipher{}
 	encryptionKey   []byte
 	encryptionValid bool // Flag to track if encryption is valid
+
+	keyRotationRecommended bool
 )
 
-// InitEncryption initializes the encryption system with the key from settings
+// InitEncryption initializes the encryption system with AES-256-GCM and the
+// key from settings
 func InitEncryption() error {
+	return InitEncryptionWith(SettingsKeyProvider{}, CipherAESGCM)
+}
+
+// InitEncryptionWith loads the key from provider and makes the named cipher
+// the default used by Encrypt and Decrypt
+func InitEncryptionWith(provider KeyProvider, cipherName string) error {
 	// Reset encryption status
 	encryptionValid = false
+	defaultCipher = unavailableCipher{}
+	encryptionKey = nil
 
-	// Load settings
-	s, err := settings.LoadSettings()
+	key, err := provider.Key()
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to get key from %s provider: %w", provider.Name(), err)
 	}
 
-	// Get the encryption key
-	key, err := s.GetEncryptionKey()
+	c, err := NewCipher(cipherName, key)
 	if err != nil {
 		return err
 	}
 
-	encryptionKey = key
-
-	// Validate encryption key by performing a test encryption and decryption
-	if err := validateEncryptionKey(); err != nil {
+	// Validate the cipher by performing a test encryption and decryption
+	if err := validateCipher(c); err != nil {
 		return err
 	}
 
 	// If we reach here, encryption is valid
+	defaultCipher = c
+	encryptionKey = key
 	encryptionValid = true
+
+	checker, ok := provider.(rotationChecker)
+	keyRotationRecommended = ok && checker.RotationRecommended()
 	return nil
 }
 
-// validateEncryptionKey tests if the encryption key is valid by encrypting and decrypting a test string
-func validateEncryptionKey() error {
+// validateCipher tests if a cipher works by encrypting and decrypting a test string
+func validateCipher(c Cipher) error {
 	testString := "encryption_test"
 
 	// Try to encrypt
-	encrypted, err := encryptWithKey(testString, encryptionKey)
+	encrypted, err := c.Encrypt(testString)
 	if err != nil {
 		return errors.New("encryption key validation failed: " + err.Error())
 	}
 
 	// Try to decrypt
-	decrypted, err := decryptWithKey(encrypted, encryptionKey)
+	decrypted, err := c.Decrypt(encrypted)
 	if err != nil {
 		return errors.New("encryption key validation failed: " + err.Error())
 	}
@@ -75,69 +83,37 @@ func IsEncryptionValid() bool {
 	return encryptionValid
 }
 
-// Encrypt encrypts the given text using AES-256 and returns a base64 encoded string
-func Encrypt(text string) (string, error) {
-	if !encryptionValid {
-		return "", errors.New("encryption system not properly initialized")
-	}
-
-	// Handle empty text case
-	if text == "" {
-		return "", nil
-	}
-
-	return encryptWithKey(text, encryptionKey)
+// IsKeyRotationRecommended returns whether the active key should be replaced,
+// for example because its origin is unknown and it may have been created by
+// the old, predictable generator
+func IsKeyRotationRecommended() bool {
+	return keyRotationRecommended
 }
 
-// encryptWithKey encrypts text with the provided key
-func encryptWithKey(text string, key []byte) (string, error) {
-	if len(key) == 0 {
-		return "", errors.New("encryption key not provided")
-	}
-
-	// Create cipher block
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return "", err
-	}
-
-	// Create GCM
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", err
-	}
-
-	// Generate nonce
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", err
-	}
-
-	// Encrypt
-	ciphertext := gcm.Seal(nonce, nonce, []byte(text), nil)
-
-	// Encode to base64
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+// DefaultCipher returns the cipher set up by InitEncryption. Until
+// initialization succeeds it returns a cipher whose operations all fail.
+func DefaultCipher() Cipher {
+	return defaultCipher
 }
 
-// Decrypt decrypts the given base64 encoded ciphertext
-func Decrypt(encryptedText string) (string, error) {
+// CipherForAlgorithm returns a cipher using the active key that encrypts
+// with the named algorithm. It is used to migrate data between algorithms.
+func CipherForAlgorithm(name string) (Cipher, error) {
 	if !encryptionValid {
-		return "", errors.New("encryption system not properly initialized")
-	}
-
-	// Handle empty text case
-	if encryptedText == "" {
-		return "", nil
+		return nil, errEncryptionNotInitialized
 	}
+	return NewCipher(name, encryptionKey)
+}
 
-	// Check if the text is actually encrypted (should be base64)
-	if !IsBase64(encryptedText) {
-		// If it's not encrypted, return as is
-		return encryptedText, nil
-	}
+// Encrypt encrypts the given text with the default cipher and returns a base64 encoded string
+func Encrypt(text string) (string, error) {
+	return defaultCipher.Encrypt(text)
+}
 
-	return decryptWithKey(encryptedText, encryptionKey)
+// Decrypt decrypts the given ciphertext with the default cipher, using the
+// algorithm recorded in the value
+func Decrypt(encryptedText string) (string, error) {
+	return defaultCipher.Decrypt(encryptedText)
 }
 
 // IsBase64 checks if a string is base64 encoded
@@ -158,14 +134,8 @@ func SafeDecrypt(encryptedText string) string {
 		return encryptedText
 	}
 
-	// Check if the text is actually encrypted (should be base64)
-	if !IsBase64(encryptedText) {
-		// If it's not encrypted, return as is
-		return encryptedText
-	}
-
 	// Try to decrypt
-	decrypted, err := decryptWithKey(encryptedText, encryptionKey)
+	decrypted, err := defaultCipher.Decrypt(encryptedText)
 	if err != nil {
 		// If decryption fails, return original
 		fmt.Printf("Warning: Failed to decrypt text, returning original: %v\n", err)
@@ -175,41 +145,17 @@ func SafeDecrypt(encryptedText string) string {
 	return decrypted
 }
 
-// decryptWithKey decrypts text with the provided key
-func decryptWithKey(encryptedText string, key []byte) (string, error) {
-	if len(key) == 0 {
-		return "", errors.New("encryption key not provided")
-	}
-
-	// Decode base64
-	ciphertext, err := base64.StdEncoding.DecodeString(encryptedText)
-	if err != nil {
-		return "", err
-	}
-
-	// Create cipher block
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return "", err
-	}
-
-	// Create GCM
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", err
-	}
-
-	// Extract nonce
-	if len(ciphertext) < gcm.NonceSize() {
-		return "", errors.New("ciphertext too short")
+// Reencrypt decrypts text with the default cipher and encrypts the result
+// with target. It is used when rotating the encryption key.
+func Reencrypt(encryptedText string, target Cipher) (string, error) {
+	if encryptedText == "" {
+		return "", nil
 	}
-	nonce, ciphertext := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
 
-	// Decrypt
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := Decrypt(encryptedText)
 	if err != nil {
 		return "", err
 	}
 
-	return string(plaintext), nil
+	return target.Encrypt(plaintext)
 }
@@ -0,0 +1,200 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"personal-notes-with-go/settings"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// KeyProvider supplies the key used to encrypt notes and categories
+type KeyProvider interface {
+	// Name returns the provider name as used in the configuration
+	Name() string
+	Key() ([]byte, error)
+}
+
+// Key provider names
+const (
+	KeyProviderSettings   = "settings"
+	KeyProviderEnv        = "env"
+	KeyProviderPassphrase = "passphrase"
+	KeyProviderFile       = "file"
+)
+
+// rotationChecker is implemented by key providers that can tell whether
+// their key should be replaced
+type rotationChecker interface {
+	RotationRecommended() bool
+}
+
+// SettingsKeyProvider reads the base64 key from settings.json, generating
+// one when the file or the key does not exist yet
+type SettingsKeyProvider struct{}
+
+func (SettingsKeyProvider) Name() string {
+	return KeyProviderSettings
+}
+
+func (SettingsKeyProvider) Key() ([]byte, error) {
+	s, err := settings.LoadSettings()
+	if err != nil {
+		return nil, err
+	}
+	return s.GetEncryptionKey()
+}
+
+// RotationRecommended reports whether the origin of the key in settings.json
+// is unknown, so it may have been created by the old, predictable key
+// generator
+func (SettingsKeyProvider) RotationRecommended() bool {
+	s, err := settings.LoadSettings()
+	return err == nil && s.KeyRotationRecommended()
+}
+
+// EnvKeyProvider reads a base64 key from an environment variable
+type EnvKeyProvider struct {
+	Variable string
+}
+
+func (p EnvKeyProvider) Name() string {
+	return KeyProviderEnv
+}
+
+func (p EnvKeyProvider) Key() ([]byte, error) {
+	value := os.Getenv(p.Variable)
+	if value == "" {
+		return nil, fmt.Errorf("environment variable %s is not set", p.Variable)
+	}
+	key, err := decodeKey(value)
+	if err != nil {
+		return nil, fmt.Errorf("environment variable %s: %w", p.Variable, err)
+	}
+	return key, nil
+}
+
+// KeyFileProvider reads the key from a file holding either the base64 key
+// or the 32 raw key bytes, for example a file mounted from a secret store
+type KeyFileProvider struct {
+	Path string
+}
+
+func (p KeyFileProvider) Name() string {
+	return KeyProviderFile
+}
+
+func (p KeyFileProvider) Key() ([]byte, error) {
+	data, err := os.ReadFile(p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	if len(data) == KeySize {
+		return data, nil
+	}
+	key, err := decodeKey(string(bytes.TrimSpace(data)))
+	if err != nil {
+		return nil, fmt.Errorf("key file %s: %w", p.Path, err)
+	}
+	return key, nil
+}
+
+// Argon2id parameters used by PassphraseKeyProvider
+const (
+	kdfTime    = 3
+	kdfMemory  = 64 * 1024 // KiB
+	kdfThreads = 4
+	kdfSaltLen = 16
+)
+
+// PassphraseKeyProvider derives the key from a passphrase with Argon2id. The
+// random salt is kept in SaltPath together with a check value that detects a
+// wrong passphrase; the file is created on first use. Losing it makes the
+// data unrecoverable even with the right passphrase.
+type PassphraseKeyProvider struct {
+	Passphrase func() (string, error)
+	SaltPath   string
+}
+
+func (p PassphraseKeyProvider) Name() string {
+	return KeyProviderPassphrase
+}
+
+func (p PassphraseKeyProvider) Key() ([]byte, error) {
+	passphrase, err := p.Passphrase()
+	if err != nil {
+		return nil, err
+	}
+	if passphrase == "" {
+		return nil, errors.New("passphrase cannot be empty")
+	}
+
+	data, err := os.ReadFile(p.SaltPath)
+	if os.IsNotExist(err) {
+		return p.create(passphrase)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read salt file: %w", err)
+	}
+
+	lines := strings.Fields(string(data))
+	if len(lines) != 2 {
+		return nil, fmt.Errorf("salt file %s is corrupted", p.SaltPath)
+	}
+	salt, err := base64.StdEncoding.DecodeString(lines[0])
+	if err != nil || len(salt) < kdfSaltLen {
+		return nil, fmt.Errorf("salt file %s is corrupted", p.SaltPath)
+	}
+
+	key := deriveKey(passphrase, salt)
+	if !hmac.Equal([]byte(lines[1]), []byte(keyCheck(key))) {
+		return nil, errors.New("wrong passphrase")
+	}
+	return key, nil
+}
+
+// create derives a key with a new random salt and writes the salt file
+func (p PassphraseKeyProvider) create(passphrase string) ([]byte, error) {
+	salt := make([]byte, kdfSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	key := deriveKey(passphrase, salt)
+	data := base64.StdEncoding.EncodeToString(salt) + "\n" + keyCheck(key) + "\n"
+	if err := os.WriteFile(p.SaltPath, []byte(data), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write salt file: %w", err)
+	}
+	return key, nil
+}
+
+// deriveKey derives the encryption key from a passphrase
+func deriveKey(passphrase string, salt []byte) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, kdfTime, kdfMemory, kdfThreads, KeySize)
+}
+
+// keyCheck returns a value that identifies key without revealing it
+func keyCheck(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("personal-notes key check"))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// decodeKey decodes a base64 key and checks its length
+func decodeKey(value string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("key is not valid base64: %w", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key is %d bytes, expected %d", len(key), KeySize)
+	}
+	return key, nil
+}
@@ -10,14 +10,46 @@ import (
 
 // Error definitions
 var (
-	ErrCategoryNameEmpty    = errors.New("category name cannot be empty")
-	ErrCategoryNameConflict = errors.New("category name already exists")
-	ErrCategoryNotFound     = errors.New("category not found")
-	ErrNoteSubjectEmpty     = errors.New("note subject cannot be empty")
-	ErrNoteNotFound         = errors.New("note not found")
-	ErrEmptyInput           = errors.New("input text cannot be empty")
+	ErrCategoryNameEmpty      = errors.New("category name cannot be empty")
+	ErrCategoryNameConflict   = errors.New("category name already exists")
+	ErrCategoryNotFound       = errors.New("category not found")
+	ErrCategoryParentNotFound = errors.New("parent category not found")
+	ErrCategoryCycle          = errors.New("a category cannot be moved into itself or its own subcategory")
+	ErrCategoryNotEmpty       = errors.New("category is not empty")
+	ErrCategoryMoveTarget     = errors.New("notes cannot be moved to the category being deleted")
+	ErrCategoryTargetNotFound = errors.New("target category not found")
+	ErrCategoryOrderMismatch  = errors.New("the order must list every subcategory of the parent exactly once")
+	ErrNoteSubjectEmpty       = errors.New("note subject cannot be empty")
+	ErrNoteNotFound           = errors.New("note not found")
+	ErrNoteStateUnknown       = errors.New("unknown note state")
+	ErrChecklistItemEmpty     = errors.New("checklist item text cannot be empty")
+	ErrChecklistItemNotFound  = errors.New("checklist item not found")
+	ErrChecklistOrderMismatch = errors.New("the order must list every item of the checklist exactly once")
+	ErrTagNameEmpty           = errors.New("tag name cannot be empty")
+	ErrTagNameConflict        = errors.New("tag name already exists")
+	ErrTagNotFound            = errors.New("tag not found")
+	ErrEmptyInput             = errors.New("input text cannot be empty")
 )
 
+// FieldError describes a request field with an invalid value. It is sent
+// as the body of a 400 response, with the message under the same error key
+// as other errors.
+type FieldError struct {
+	Message string   `json:"error"`
+	Field   string   `json:"field"`
+	Value   string   `json:"value"`
+	Allowed []string `json:"allowed,omitempty"`
+}
+
+func (e *FieldError) Error() string {
+	return e.Message
+}
+
+// HandleFieldError responds with 400 and the details of err.
+func HandleFieldError(c *gin.Context, err *FieldError) {
+	c.JSON(http.StatusBadRequest, err)
+}
+
 // HandleBadRequestError handles bad request errors.
 func HandleBadRequestError(c *gin.Context, err error) {
 	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})